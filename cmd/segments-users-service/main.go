@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/AlexZahvatkin/segments-users-service/internal/app"
 	"github.com/joho/godotenv"
@@ -23,5 +24,10 @@ func init() {
 // @schemes http
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		app.RunImport(os.Args[2:])
+		return
+	}
+
 	app.Run()
 }
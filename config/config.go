@@ -3,6 +3,7 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
 	"time"
 )
 
@@ -10,13 +11,22 @@ type Config struct {
 	Env        string `yaml:"env" env:"ENV" env-default:"local"`
 	HTTPServer `yaml:"http_server"`
 	Database   `yaml:"database"`
+	Expiry     `yaml:"expiry"`
+	Jobs       `yaml:"jobs"`
+	Users      `yaml:"users"`
+	Batch      `yaml:"batch"`
+	Deletion   `yaml:"deletion"`
+	Reports    `yaml:"reports"`
+	Stats      `yaml:"stats"`
+	History    `yaml:"history"`
 }
 
 type HTTPServer struct {
-	Port        string        `yaml:"port" env-default:"8080"`
-	Host        string        `yaml:"address" env-default:"localhost"`
-	Timeout     time.Duration `yaml:"timeout" env-default:"4s"`
-	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	Port            string        `yaml:"port" env-default:"8080"`
+	Host            string        `yaml:"address" env-default:"localhost"`
+	Timeout         time.Duration `yaml:"timeout" env-default:"4s"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env-default:"10s"`
 }
 
 type Database struct {
@@ -28,6 +38,68 @@ type Database struct {
 	SSLMode  string `yaml:"ssl_mode" env-default:"disable"`
 }
 
+type Expiry struct {
+	Interval  time.Duration `yaml:"interval" env-default:"1m"`
+	BatchSize int32         `yaml:"batch_size" env-default:"1000"`
+}
+
+type Users struct {
+	// CreateOnAssign makes segment assignment create users referenced by an unknown ext:<id>.
+	CreateOnAssign bool `yaml:"create_on_assign" env-default:"false"`
+	// ImportMaxSize caps an uploaded import file in bytes.
+	ImportMaxSize int64 `yaml:"import_max_size" env-default:"1073741824"`
+	// ImportUploadTimeout is how long the upload of an import file may take.
+	ImportUploadTimeout time.Duration `yaml:"import_upload_timeout" env-default:"10m"`
+}
+
+type Batch struct {
+	// SyncLimit is the largest batch applied within the request, larger ones are handed to a background job.
+	SyncLimit int `yaml:"sync_limit" env-default:"1000"`
+	MaxSize   int `yaml:"max_size" env-default:"100000"`
+	// MaxBodySize caps the request body in bytes, it is checked while the body is read.
+	MaxBodySize int64 `yaml:"max_body_size" env-default:"33554432"`
+}
+
+type Deletion struct {
+	// Retention is how long deleted segments and users can be restored before they are purged for good.
+	Retention     time.Duration `yaml:"retention" env-default:"720h"`
+	PurgeInterval time.Duration `yaml:"purge_interval" env-default:"1h"`
+}
+
+type Reports struct {
+	// Dir is where report files are kept.
+	Dir string `yaml:"dir" env-default:"data/reports"`
+	// SigningKey signs download links. Without it a random key is used, so links stop working on restart.
+	SigningKey      string        `yaml:"signing_key"`
+	LinkTTL         time.Duration `yaml:"link_ttl" env-default:"1h"`
+	Retention       time.Duration `yaml:"retention" env-default:"168h"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval" env-default:"1h"`
+}
+
+type Stats struct {
+	Interval  time.Duration `yaml:"interval" env-default:"1m"`
+	BatchSize int32         `yaml:"batch_size" env-default:"10000"`
+}
+
+type History struct {
+	// RetentionMonths is how many full months of history are kept in the database besides the current one.
+	// Older months are archived to the report storage.
+	RetentionMonths int           `yaml:"retention_months" env-default:"13"`
+	ArchiveInterval time.Duration `yaml:"archive_interval" env-default:"24h"`
+	// PartitionsAhead is for how many months ahead history partitions are created.
+	PartitionsAhead int `yaml:"partitions_ahead" env-default:"3"`
+}
+
+type Jobs struct {
+	Workers          int           `yaml:"workers" env-default:"2"`
+	PollInterval     time.Duration `yaml:"poll_interval" env-default:"1s"`
+	StaleAfter       time.Duration `yaml:"stale_after" env-default:"5m"`
+	MaxAttempts      int32         `yaml:"max_attempts" env-default:"3"`
+	RolloutBatchSize int32         `yaml:"rollout_batch_size" env-default:"5000"`
+	DeleteBatchSize  int32         `yaml:"delete_batch_size" env-default:"5000"`
+	AssignBatchSize  int32         `yaml:"assign_batch_size" env-default:"5000"`
+}
+
 func MustLoad() *Config {
 	var cfg Config
 	cfg.Env = os.Getenv("ENV_TYPE")
@@ -45,6 +117,7 @@ func MustLoad() *Config {
 		log.Fatal("Wrong idle timeout format")
 	}
 	cfg.HTTPServer.IdleTimeout = idleTimeoutDur
+	cfg.HTTPServer.ShutdownTimeout = getEnvDuration("SERVER_SHUTDOWN_TIMEOUT", 10*time.Second)
 
 	cfg.Database.Host = os.Getenv("POSTGRES_HOST")
 	cfg.Database.Port = os.Getenv("POSTGRES_PORT")
@@ -53,5 +126,83 @@ func MustLoad() *Config {
 	cfg.Database.Name = os.Getenv("POSTGRES_DB")
 	cfg.Database.SSLMode = os.Getenv("POSTGRES_SSLMODE")
 
+	cfg.Expiry.Interval = getEnvDuration("EXPIRY_SWEEP_INTERVAL", time.Minute)
+	cfg.Expiry.BatchSize = int32(getEnvInt("EXPIRY_SWEEP_BATCH_SIZE", 1000))
+
+	cfg.Jobs.Workers = getEnvInt("JOBS_WORKERS", 2)
+	cfg.Jobs.PollInterval = getEnvDuration("JOBS_POLL_INTERVAL", time.Second)
+	cfg.Jobs.StaleAfter = getEnvDuration("JOBS_STALE_AFTER", 5*time.Minute)
+	cfg.Jobs.MaxAttempts = int32(getEnvInt("JOBS_MAX_ATTEMPTS", 3))
+	cfg.Jobs.RolloutBatchSize = int32(getEnvInt("JOBS_ROLLOUT_BATCH_SIZE", 5000))
+	cfg.Jobs.DeleteBatchSize = int32(getEnvInt("JOBS_DELETE_BATCH_SIZE", 5000))
+	cfg.Jobs.AssignBatchSize = int32(getEnvInt("JOBS_ASSIGN_BATCH_SIZE", 5000))
+
+	cfg.Users.CreateOnAssign = getEnvBool("USERS_CREATE_ON_ASSIGN", false)
+	cfg.Users.ImportMaxSize = int64(getEnvInt("USERS_IMPORT_MAX_SIZE", 1<<30))
+	cfg.Users.ImportUploadTimeout = getEnvDuration("USERS_IMPORT_UPLOAD_TIMEOUT", 10*time.Minute)
+
+	cfg.Batch.SyncLimit = getEnvInt("BATCH_SYNC_LIMIT", 1000)
+	cfg.Batch.MaxSize = getEnvInt("BATCH_MAX_SIZE", 100000)
+	cfg.Batch.MaxBodySize = int64(getEnvInt("BATCH_MAX_BODY_SIZE", 32<<20))
+
+	cfg.Deletion.Retention = getEnvDuration("DELETION_RETENTION", 30*24*time.Hour)
+	cfg.Deletion.PurgeInterval = getEnvDuration("DELETION_PURGE_INTERVAL", time.Hour)
+
+	cfg.Reports.Dir = getEnvString("REPORTS_DIR", "data/reports")
+	cfg.Reports.SigningKey = os.Getenv("REPORTS_SIGNING_KEY")
+	cfg.Reports.LinkTTL = getEnvDuration("REPORTS_LINK_TTL", time.Hour)
+	cfg.Reports.Retention = getEnvDuration("REPORTS_RETENTION", 7*24*time.Hour)
+	cfg.Reports.CleanupInterval = getEnvDuration("REPORTS_CLEANUP_INTERVAL", time.Hour)
+
+	cfg.Stats.Interval = getEnvDuration("STATS_INTERVAL", time.Minute)
+	cfg.Stats.BatchSize = int32(getEnvInt("STATS_BATCH_SIZE", 10000))
+
+	cfg.History.RetentionMonths = getEnvInt("HISTORY_RETENTION_MONTHS", 13)
+	cfg.History.ArchiveInterval = getEnvDuration("HISTORY_ARCHIVE_INTERVAL", 24*time.Hour)
+	cfg.History.PartitionsAhead = getEnvInt("HISTORY_PARTITIONS_AHEAD", 3)
+
 	return &cfg
 }
+
+func getEnvString(key string, defaultValue string) string {
+	if s := os.Getenv(key); s != "" {
+		return s
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	s := os.Getenv(key)
+	if s == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		log.Fatalf("Wrong %s format", key)
+	}
+	return d
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	s := os.Getenv(key)
+	if s == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		log.Fatalf("Wrong %s format", key)
+	}
+	return b
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	s := os.Getenv(key)
+	if s == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		log.Fatalf("Wrong %s format", key)
+	}
+	return n
+}
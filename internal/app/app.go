@@ -1,16 +1,30 @@
 package app
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
 	"github.com/AlexZahvatkin/segments-users-service/config"
 	v1 "github.com/AlexZahvatkin/segments-users-service/internal/http-server/handlers/v1"
+	"github.com/AlexZahvatkin/segments-users-service/internal/jobs"
 	"github.com/AlexZahvatkin/segments-users-service/internal/lib/logger"
+	"github.com/AlexZahvatkin/segments-users-service/internal/lib/urlsign"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage/blob"
 	"github.com/AlexZahvatkin/segments-users-service/internal/storage/database"
+	"github.com/AlexZahvatkin/segments-users-service/internal/workers/archive"
+	"github.com/AlexZahvatkin/segments-users-service/internal/workers/cleanup"
+	"github.com/AlexZahvatkin/segments-users-service/internal/workers/expiry"
+	"github.com/AlexZahvatkin/segments-users-service/internal/workers/purge"
+	"github.com/AlexZahvatkin/segments-users-service/internal/workers/stats"
 	_ "github.com/lib/pq"
 )
 
@@ -20,6 +34,23 @@ const (
 	envProd  = "prod"
 )
 
+type App struct {
+	log        *slog.Logger
+	db         *sql.DB
+	srv        *http.Server
+	listener   net.Listener
+	sweeper    *expiry.Sweeper
+	purger     *purge.Purger
+	cleaner    *cleanup.Cleaner
+	aggregator *stats.Aggregator
+	archiver   *archive.Archiver
+	jobs       *jobs.Pool
+
+	stopWorkers context.CancelFunc
+	workers     sync.WaitGroup
+	serveErr    chan error
+}
+
 func Run() {
 	cfg := config.MustLoad()
 
@@ -28,36 +59,198 @@ func Run() {
 	log.Info("starting segments-users-service", slog.String("env", cfg.Env))
 	log.Debug("debug messages are enabled")
 
-	log.Info("Initializing postgres...")
-	queries := initDb(getDbURL(cfg), log)
-	log.Debug(getDbURL(cfg))
+	app, err := New(cfg, log)
+	if err != nil {
+		log.Error("failed to initialize app", sl.Err(err))
+		os.Exit(1)
+	}
 
-	log.Info("Initializing routers...")
-	router := v1.InitRouters(queries, log, cfg)
-
-	srv := &http.Server{
-		Addr:         cfg.HTTPServer.Host + ":" + cfg.HTTPServer.Port,
-		Handler:      router,
-		ReadTimeout:  cfg.HTTPServer.Timeout,
-		WriteTimeout: cfg.HTTPServer.Timeout,
-		IdleTimeout:  cfg.HTTPServer.IdleTimeout,
+	if err := app.Start(); err != nil {
+		log.Error("failed to start server", sl.Err(err))
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case <-ctx.Done():
+		log.Info("shutdown signal received")
+	case err := <-app.serveErr:
+		log.Error("server stopped unexpectedly", sl.Err(err))
 	}
 
-	if err := srv.ListenAndServe(); err != nil {
-		log.Error("failed to start server", err)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTPServer.ShutdownTimeout)
+	defer cancel()
+
+	if err := app.Shutdown(shutdownCtx); err != nil {
+		log.Error("failed to shutdown gracefully", sl.Err(err))
+		os.Exit(1)
 	}
 
-	log.Error("server stopped")
+	log.Info("server stopped")
 }
 
-func initDb(dbURL string, log *slog.Logger) *database.Queries {
-	conn, err := sql.Open("postgres", dbURL)
+// New wires up the database, background workers and HTTP server without starting them.
+func New(cfg *config.Config, log *slog.Logger) (*App, error) {
+	log.Info("Initializing report storage...")
+	blobs, err := blob.NewFS(cfg.Reports.Dir)
 	if err != nil {
-		log.Error("can not connect to a database", sl.Err(err))
-		os.Exit(1)
+		return nil, fmt.Errorf("can not open report storage: %w", err)
+	}
+
+	var signer *urlsign.Signer
+	if cfg.Reports.SigningKey != "" {
+		signer = urlsign.New([]byte(cfg.Reports.SigningKey))
+	} else {
+		log.Warn("reports signing key is not set, download links will stop working on restart")
+		if signer, err = urlsign.NewRandom(); err != nil {
+			return nil, fmt.Errorf("can not generate signing key: %w", err)
+		}
 	}
-	queries := database.New(conn)
-	return queries
+
+	log.Info("Initializing postgres...")
+	db, err := initDb(getDbURL(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("can not connect to a database: %w", err)
+	}
+	store := database.NewStore(db)
+
+	jobPool := jobs.NewPool(log, store, jobs.Config{
+		Workers:      cfg.Jobs.Workers,
+		PollInterval: cfg.Jobs.PollInterval,
+		StaleAfter:   cfg.Jobs.StaleAfter,
+		MaxAttempts:  cfg.Jobs.MaxAttempts,
+	})
+	jobPool.Register(jobs.KindSegmentRollout, jobs.NewSegmentRolloutHandler(store, cfg.Jobs.RolloutBatchSize))
+	jobPool.Register(jobs.KindSegmentDeletion, jobs.NewSegmentDeletionHandler(store, cfg.Jobs.DeleteBatchSize))
+	jobPool.Register(jobs.KindSegmentMembersBatch, jobs.NewSegmentMembersBatchHandler(store, cfg.Jobs.AssignBatchSize))
+	jobPool.Register(jobs.KindHistoryReport, jobs.NewHistoryReportHandler(store, blobs, cfg.Reports.Retention))
+
+	log.Info("Initializing routers...")
+	router := v1.InitRouters(store, blobs, signer, log, cfg)
+
+	return &App{
+		log: log,
+		db:  db,
+		srv: &http.Server{
+			Addr:         cfg.HTTPServer.Host + ":" + cfg.HTTPServer.Port,
+			Handler:      router,
+			ReadTimeout:  cfg.HTTPServer.Timeout,
+			WriteTimeout: cfg.HTTPServer.Timeout,
+			IdleTimeout:  cfg.HTTPServer.IdleTimeout,
+		},
+		sweeper:    expiry.New(log, store, cfg.Expiry.Interval, cfg.Expiry.BatchSize),
+		purger:     purge.New(log, store, cfg.Deletion.PurgeInterval, cfg.Deletion.Retention),
+		cleaner:    cleanup.New(log, store, blobs, cfg.Reports.CleanupInterval),
+		aggregator: stats.New(log, store, cfg.Stats.Interval, cfg.Stats.BatchSize),
+		archiver:   archive.New(log, store, blobs, cfg.History.ArchiveInterval, cfg.History.RetentionMonths, cfg.History.PartitionsAhead),
+		jobs:       jobPool,
+		serveErr:   make(chan error, 1),
+	}, nil
+}
+
+// Start binds the listener, starts background workers and serves requests in the background.
+func (a *App) Start() error {
+	listener, err := net.Listen("tcp", a.srv.Addr)
+	if err != nil {
+		return err
+	}
+	a.listener = listener
+
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	a.stopWorkers = stopWorkers
+
+	a.log.Info("Starting expiry sweeper...")
+	a.workers.Add(1)
+	go func() {
+		defer a.workers.Done()
+		a.sweeper.Run(workersCtx)
+	}()
+
+	a.log.Info("Starting purger...")
+	a.workers.Add(1)
+	go func() {
+		defer a.workers.Done()
+		a.purger.Run(workersCtx)
+	}()
+
+	a.log.Info("Starting report cleaner...")
+	a.workers.Add(1)
+	go func() {
+		defer a.workers.Done()
+		a.cleaner.Run(workersCtx)
+	}()
+
+	a.log.Info("Starting stats aggregator...")
+	a.workers.Add(1)
+	go func() {
+		defer a.workers.Done()
+		a.aggregator.Run(workersCtx)
+	}()
+
+	a.log.Info("Starting history archiver...")
+	a.workers.Add(1)
+	go func() {
+		defer a.workers.Done()
+		a.archiver.Run(workersCtx)
+	}()
+
+	a.log.Info("Starting job workers...")
+	a.workers.Add(1)
+	go func() {
+		defer a.workers.Done()
+		a.jobs.Run(workersCtx)
+	}()
+
+	a.log.Info("Starting server...", slog.String("address", listener.Addr().String()))
+	go func() {
+		if err := a.srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			a.serveErr <- err
+		}
+	}()
+
+	return nil
+}
+
+// Addr returns the address the server is listening on.
+func (a *App) Addr() string {
+	return a.listener.Addr().String()
+}
+
+// Shutdown drains in-flight requests, stops background workers and closes the database pool.
+// It gives up waiting once ctx is done.
+func (a *App) Shutdown(ctx context.Context) error {
+	var errs []error
+
+	a.log.Info("Stopping server...")
+	if err := a.srv.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("server shutdown: %w", err))
+	}
+
+	a.log.Info("Stopping background workers...")
+	a.stopWorkers()
+	done := make(chan struct{})
+	go func() {
+		a.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("workers shutdown: %w", ctx.Err()))
+	}
+
+	a.log.Info("Closing database...")
+	if err := a.db.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("database close: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+func initDb(dbURL string) (*sql.DB, error) {
+	return sql.Open("postgres", dbURL)
 }
 
 func getDbURL(cfg *config.Config) string {
@@ -0,0 +1,87 @@
+package app_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/AlexZahvatkin/segments-users-service/config"
+	"github.com/AlexZahvatkin/segments-users-service/internal/app"
+	slogdiscard "github.com/AlexZahvatkin/segments-users-service/internal/lib/logger/handlers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppStartAndShutdown(t *testing.T) {
+	cfg := &config.Config{
+		Env: "local",
+		HTTPServer: config.HTTPServer{
+			Host:            "127.0.0.1",
+			Port:            "0",
+			Timeout:         4 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			ShutdownTimeout: 5 * time.Second,
+		},
+		Database: config.Database{
+			Host:    "127.0.0.1",
+			Port:    "5432",
+			User:    "postgres",
+			Name:    "segments_test",
+			SSLMode: "disable",
+		},
+		Expiry: config.Expiry{
+			Interval:  time.Hour,
+			BatchSize: 100,
+		},
+		Jobs: config.Jobs{
+			Workers:          1,
+			PollInterval:     time.Hour,
+			StaleAfter:       time.Hour,
+			MaxAttempts:      3,
+			RolloutBatchSize: 100,
+			DeleteBatchSize:  100,
+			AssignBatchSize:  100,
+		},
+		Batch: config.Batch{
+			SyncLimit:   100,
+			MaxSize:     1000,
+			MaxBodySize: 1 << 20,
+		},
+		Deletion: config.Deletion{
+			Retention:     time.Hour,
+			PurgeInterval: time.Hour,
+		},
+		Reports: config.Reports{
+			Dir:             t.TempDir(),
+			SigningKey:      "secret",
+			LinkTTL:         time.Hour,
+			Retention:       time.Hour,
+			CleanupInterval: time.Hour,
+		},
+		Stats: config.Stats{
+			Interval:  time.Hour,
+			BatchSize: 100,
+		},
+		History: config.History{
+			RetentionMonths: 13,
+			ArchiveInterval: time.Hour,
+			PartitionsAhead: 3,
+		},
+	}
+
+	a, err := app.New(cfg, slogdiscard.NewDiscardLogger())
+	require.NoError(t, err)
+	require.NoError(t, a.Start())
+
+	resp, err := http.Get("http://" + a.Addr() + "/swagger/doc.json")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HTTPServer.ShutdownTimeout)
+	defer cancel()
+	require.NoError(t, a.Shutdown(ctx))
+
+	_, err = http.Get("http://" + a.Addr() + "/swagger/doc.json")
+	require.Error(t, err)
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/AlexZahvatkin/segments-users-service/config"
+	"github.com/AlexZahvatkin/segments-users-service/internal/lib/logger"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage/database"
+	"github.com/AlexZahvatkin/segments-users-service/internal/use-cases/users"
+)
+
+// RunImport implements the import subcommand: it loads users from a CSV or NDJSON file
+// straight into the database, the same way as POST /v1/users:import.
+//
+//	segments-users-service import -file users.csv [-format csv|ndjson] [-dry-run]
+func RunImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	file := flags.String("file", "-", "CSV or NDJSON file with users, - to read from stdin")
+	format := flags.String("format", "", "csv or ndjson, by default taken from the file extension")
+	dryRun := flags.Bool("dry-run", false, "validate the file without writing anything")
+	_ = flags.Parse(args)
+
+	if *format == "" {
+		switch filepath.Ext(*file) {
+		case ".ndjson", ".jsonl":
+			*format = usecases_users.ImportFormatNDJSON
+		default:
+			*format = usecases_users.ImportFormatCSV
+		}
+	}
+
+	cfg := config.MustLoad()
+	log := setupLogger(cfg.Env)
+
+	var in io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			log.Error("failed to open file", sl.Err(err))
+			os.Exit(1)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	db, err := initDb(getDbURL(cfg))
+	if err != nil {
+		log.Error("can not connect to a database", sl.Err(err))
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	res, err := usecases_users.ImportUsers(ctx, database.NewStore(db), in, *format, *dryRun)
+	if err != nil {
+		log.Error("failed to import users", sl.Err(err))
+		os.Exit(1)
+	}
+
+	for _, rowErr := range res.Errors {
+		fmt.Fprintf(os.Stderr, "line %d: %s\n", rowErr.Line, rowErr.Error)
+	}
+	if len(res.Errors) > 0 {
+		fmt.Fprintf(os.Stderr, "nothing imported: %d errors\n", len(res.Errors))
+		os.Exit(1)
+	}
+
+	if *dryRun {
+		fmt.Printf("dry run: %d users with %d segments are valid\n", res.Users, res.Segments)
+		return
+	}
+	fmt.Printf("imported %d users with %d segments\n", res.Users, res.Segments)
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	httpserver "github.com/AlexZahvatkin/segments-users-service/internal/http-server"
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+)
+
+type UserResolver interface {
+	GetUserById(context.Context, int64) (models.User, error)
+	GetUserByExternalId(ctx context.Context, externalID string) (models.User, error)
+}
+
+// ResolveUser loads the user referenced by the userId URL parameter, which is either
+// an internal id or ext:<external id>. If the user can not be loaded it responds
+// with 400, 404 or 500 and returns false.
+func ResolveUser(w http.ResponseWriter, r *http.Request, log *slog.Logger, resolver UserResolver) (models.User, bool) {
+	ref, err := httpserver.GetUserRefFromParams(w, r, log)
+	if err != nil {
+		return models.User{}, false
+	}
+
+	return LoadUser(w, r, log, resolver, ref)
+}
+
+// LoadUser loads the user by an already parsed reference, responding the same way as ResolveUser.
+func LoadUser(w http.ResponseWriter, r *http.Request, log *slog.Logger, resolver UserResolver, ref httpserver.UserRef) (models.User, bool) {
+	var (
+		user models.User
+		err  error
+	)
+	if ref.IsExternal() {
+		user, err = resolver.GetUserByExternalId(r.Context(), ref.ExternalID)
+	} else {
+		user, err = resolver.GetUserById(r.Context(), ref.ID)
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			httpserver.RespondWithError(w, http.StatusNotFound, fmt.Sprintf("User %s does not exist", ref), log)
+			return models.User{}, false
+		}
+		log.Error(err.Error())
+
+		httpserver.RespondWithError(w, http.StatusInternalServerError, "Failed to get user", log)
+		return models.User{}, false
+	}
+
+	return user, true
+}
@@ -0,0 +1,158 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	httpserver "github.com/AlexZahvatkin/segments-users-service/internal/http-server"
+	"github.com/AlexZahvatkin/segments-users-service/internal/http-server/handlers"
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/go-chi/chi"
+)
+
+type JobGetter interface {
+	GetJobById(ctx context.Context, id int64) (models.Job, error)
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=JobCanceller
+type JobCanceller interface {
+	CancelJob(ctx context.Context, id int64) (models.Job, error)
+	GetJobById(ctx context.Context, id int64) (models.Job, error)
+}
+
+type JobResponse struct {
+	ID         int64      `json:"id"`
+	Kind       string     `json:"kind"`
+	Status     string     `json:"status"`
+	Total      int64      `json:"total"`
+	Processed  int64      `json:"processed"`
+	Affected   int64      `json:"affected"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// @Summary Job status
+// @Description Returns status and progress of a background job.
+// @Description For segment rollout jobs total and processed count scanned users, affected counts enrolled users.
+// @Tags Jobs
+// @Accept  json
+// @Produce  json
+// @ID get-job
+// @Param jobId path int true "Job id"
+// @Success 200 {object} JobResponse
+// @Failure 400 {object} error
+// @Failure 404 {object} error
+// @Failure 500 {object} error
+// @Router /v1/jobs/{jobId} [get]
+func GetJobHandler(log *slog.Logger, getter JobGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.v1.GetJobHandler"
+
+		handlers.SetLogger(log, r.Context(), op)
+
+		jobId, err := strconv.ParseInt(chi.URLParam(r, "jobId"), 10, 64)
+		if err != nil {
+			httpserver.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Job id must be a number: %v", err), log)
+			return
+		}
+
+		job, err := getter.GetJobById(r.Context(), jobId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				httpserver.RespondWithError(w, http.StatusNotFound, "Job does not exist", log)
+				return
+			}
+			log.Error(err.Error())
+
+			httpserver.RespondWithError(w, http.StatusInternalServerError, "Failed to get job", log)
+			return
+		}
+
+		httpserver.RespondWithJSON(w, http.StatusOK, log, transformToJobResponse(job))
+	}
+}
+
+// @Summary Cancel a job
+// @Description Cancels a queued or running background job.
+// @Description A running job stops after its current batch, changes already made by it are kept.
+// @Tags Jobs
+// @Accept  json
+// @Produce  json
+// @ID cancel-job
+// @Param jobId path int true "Job id"
+// @Success 200 {object} JobResponse
+// @Failure 400 {object} error
+// @Failure 404 {object} error
+// @Failure 409 {object} error
+// @Failure 500 {object} error
+// @Router /v1/jobs/{jobId} [delete]
+func CancelJobHandler(log *slog.Logger, canceller JobCanceller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.v1.CancelJobHandler"
+
+		handlers.SetLogger(log, r.Context(), op)
+
+		jobId, err := strconv.ParseInt(chi.URLParam(r, "jobId"), 10, 64)
+		if err != nil {
+			httpserver.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Job id must be a number: %v", err), log)
+			return
+		}
+
+		job, err := canceller.CancelJob(r.Context(), jobId)
+		if err == nil {
+			httpserver.RespondWithJSON(w, http.StatusOK, log, transformToJobResponse(job))
+			return
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Error(err.Error())
+
+			httpserver.RespondWithError(w, http.StatusInternalServerError, "Failed to cancel job", log)
+			return
+		}
+
+		// Nothing was updated: the job either does not exist or has already finished.
+		job, err = canceller.GetJobById(r.Context(), jobId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				httpserver.RespondWithError(w, http.StatusNotFound, "Job does not exist", log)
+				return
+			}
+			log.Error(err.Error())
+
+			httpserver.RespondWithError(w, http.StatusInternalServerError, "Failed to cancel job", log)
+			return
+		}
+
+		httpserver.RespondWithError(w, http.StatusConflict, fmt.Sprintf("Job has already %s", job.Status), log)
+	}
+}
+
+func transformToJobResponse(job models.Job) JobResponse {
+	resp := JobResponse{
+		ID:        job.ID,
+		Kind:      job.Kind,
+		Status:    job.Status,
+		Total:     job.Total,
+		Processed: job.Processed,
+		Affected:  job.Affected,
+		Error:     job.Error.String,
+		CreatedAt: job.CreatedAt,
+		UpdatedAt: job.UpdatedAt,
+	}
+	if job.StartedAt.Valid {
+		resp.StartedAt = &job.StartedAt.Time
+	}
+	if job.FinishedAt.Valid {
+		resp.FinishedAt = &job.FinishedAt.Time
+	}
+	return resp
+}
@@ -0,0 +1,76 @@
+package jobs_test
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/http-server/handlers/v1/jobs"
+	"github.com/AlexZahvatkin/segments-users-service/internal/http-server/handlers/v1/jobs/mocks"
+	slogdiscard "github.com/AlexZahvatkin/segments-users-service/internal/lib/logger/handlers"
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCancelJobHandler(t *testing.T) {
+	cases := []struct {
+		name       string
+		jobId      string
+		cancelErr  error
+		job        models.Job
+		getErr     error
+		statusCode int
+	}{
+		{
+			name:       "Running job cancelled",
+			jobId:      "1",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Job does not exist",
+			jobId:      "1",
+			cancelErr:  sql.ErrNoRows,
+			getErr:     sql.ErrNoRows,
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "Job already finished",
+			jobId:      "1",
+			cancelErr:  sql.ErrNoRows,
+			job:        models.Job{ID: 1, Status: "succeeded"},
+			statusCode: http.StatusConflict,
+		},
+		{
+			name:       "Invalid job id",
+			jobId:      "abc",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cancellerMock := mocks.NewJobCanceller(t)
+			cancellerMock.On("CancelJob", mock.Anything, int64(1)).
+				Return(models.Job{ID: 1, Status: "cancelled"}, tc.cancelErr).Maybe()
+			cancellerMock.On("GetJobById", mock.Anything, int64(1)).Return(tc.job, tc.getErr).Maybe()
+
+			handler := jobs.CancelJobHandler(slogdiscard.NewDiscardLogger(), cancellerMock)
+			req, err := http.NewRequest(http.MethodDelete, "/jobs/"+tc.jobId, nil)
+			require.NoError(t, err)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("jobId", tc.jobId)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tc.statusCode, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+// Code generated by mockery v2.33.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	models "github.com/AlexZahvatkin/segments-users-service/internal/models"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// JobCanceller is an autogenerated mock type for the JobCanceller type
+type JobCanceller struct {
+	mock.Mock
+}
+
+// CancelJob provides a mock function with given fields: ctx, id
+func (_m *JobCanceller) CancelJob(ctx context.Context, id int64) (models.Job, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 models.Job
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) (models.Job, error)); ok {
+		return rf(ctx, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) models.Job); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Get(0).(models.Job)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetJobById provides a mock function with given fields: ctx, id
+func (_m *JobCanceller) GetJobById(ctx context.Context, id int64) (models.Job, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 models.Job
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) (models.Job, error)); ok {
+		return rf(ctx, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) models.Job); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Get(0).(models.Job)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewJobCanceller creates a new instance of JobCanceller. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewJobCanceller(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *JobCanceller {
+	mock := &JobCanceller{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
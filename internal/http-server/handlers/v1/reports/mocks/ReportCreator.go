@@ -0,0 +1,53 @@
+// Code generated by mockery v2.33.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	models "github.com/AlexZahvatkin/segments-users-service/internal/models"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// ReportCreator is an autogenerated mock type for the ReportCreator type
+type ReportCreator struct {
+	mock.Mock
+}
+
+// CreateJob provides a mock function with given fields: ctx, arg
+func (_m *ReportCreator) CreateJob(ctx context.Context, arg models.CreateJobParams) (models.Job, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 models.Job
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.CreateJobParams) (models.Job, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.CreateJobParams) models.Job); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(models.Job)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.CreateJobParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewReportCreator creates a new instance of ReportCreator. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewReportCreator(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *ReportCreator {
+	mock := &ReportCreator{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,77 @@
+// Code generated by mockery v2.33.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	models "github.com/AlexZahvatkin/segments-users-service/internal/models"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// ReportGetter is an autogenerated mock type for the ReportGetter type
+type ReportGetter struct {
+	mock.Mock
+}
+
+// GetJobById provides a mock function with given fields: ctx, id
+func (_m *ReportGetter) GetJobById(ctx context.Context, id int64) (models.Job, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 models.Job
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) (models.Job, error)); ok {
+		return rf(ctx, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) models.Job); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Get(0).(models.Job)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetReportByJobId provides a mock function with given fields: ctx, jobID
+func (_m *ReportGetter) GetReportByJobId(ctx context.Context, jobID int64) (models.Report, error) {
+	ret := _m.Called(ctx, jobID)
+
+	var r0 models.Report
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) (models.Report, error)); ok {
+		return rf(ctx, jobID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) models.Report); ok {
+		r0 = rf(ctx, jobID)
+	} else {
+		r0 = ret.Get(0).(models.Report)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, jobID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewReportGetter creates a new instance of ReportGetter. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewReportGetter(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *ReportGetter {
+	mock := &ReportGetter{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,43 @@
+// Code generated by mockery v2.33.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	models "github.com/AlexZahvatkin/segments-users-service/internal/models"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// SegmentsHistoryReporter is an autogenerated mock type for the SegmentsHistoryReporter type
+type SegmentsHistoryReporter struct {
+	mock.Mock
+}
+
+// ReportSegmentsHistory provides a mock function with given fields: ctx, arg, fn
+func (_m *SegmentsHistoryReporter) ReportSegmentsHistory(ctx context.Context, arg models.HistoryReportParams, fn func(models.UsersInSegmentsHistory) error) error {
+	ret := _m.Called(ctx, arg, fn)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.HistoryReportParams, func(models.UsersInSegmentsHistory) error) error); ok {
+		r0 = rf(ctx, arg, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// NewSegmentsHistoryReporter creates a new instance of SegmentsHistoryReporter. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewSegmentsHistoryReporter(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *SegmentsHistoryReporter {
+	mock := &SegmentsHistoryReporter{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,431 @@
+package reports
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	httpserver "github.com/AlexZahvatkin/segments-users-service/internal/http-server"
+	"github.com/AlexZahvatkin/segments-users-service/internal/http-server/handlers"
+	"github.com/AlexZahvatkin/segments-users-service/internal/jobs"
+	"github.com/AlexZahvatkin/segments-users-service/internal/lib/logger"
+	"github.com/AlexZahvatkin/segments-users-service/internal/lib/urlsign"
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+	usecases_segments "github.com/AlexZahvatkin/segments-users-service/internal/use-cases/segments"
+	"github.com/AlexZahvatkin/segments-users-service/internal/use-cases/user_segments"
+	"github.com/go-chi/chi"
+)
+
+const (
+	timeFormat = "2006-01-02T15:04:05Z07:00" //RFC3339
+
+	// StatusExpired is reported for a report whose file has already been removed.
+	StatusExpired = "expired"
+)
+
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=SegmentsHistoryReporter
+type SegmentsHistoryReporter interface {
+	storage.HistoryReporter
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=ReportCreator
+type ReportCreator interface {
+	CreateJob(ctx context.Context, arg models.CreateJobParams) (models.Job, error)
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=ReportGetter
+type ReportGetter interface {
+	GetJobById(ctx context.Context, id int64) (models.Job, error)
+	GetReportByJobId(ctx context.Context, jobID int64) (models.Report, error)
+}
+
+type ReportResponse struct {
+	ID          int64      `json:"id"`
+	Status      string     `json:"status"`
+	From        time.Time  `json:"from"`
+	To          time.Time  `json:"to"`
+	Segment     string     `json:"segment,omitempty"`
+	Gzip        bool       `json:"gzip"`
+	Records     int64      `json:"records"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	Filename    string     `json:"filename,omitempty"`
+	Size        int64      `json:"size,omitempty"`
+	ExpireAt    *time.Time `json:"expire_at,omitempty"`
+	DownloadURL string     `json:"download_url,omitempty"`
+	// DownloadURLExpireAt is when the download link stops working, request the report again for a new one.
+	DownloadURLExpireAt *time.Time `json:"download_url_expire_at,omitempty"`
+}
+
+// @Summary Segments history report
+// @Description Returns the history of all users for a month (month=2023-09) or for an arbitrary period (from and to, RFC3339),
+// @Description optionally only for one segment. The period includes from and excludes to, a month is taken in UTC.
+// @Description The report is a CSV with a header row, with gzip=true it is gzip-compressed.
+// @Description Records are ordered by action date and streamed from the database as they are read, so reports of any size can be downloaded.
+// @Tags Reports
+// @Accept  json
+// @Produce  text/csv,application/gzip
+// @ID get-history-report
+// @Param month query string false "Year and month, e.g. 2023-09"
+// @Param from query string false "From datetime, instead of month"
+// @Param to query string false "To datetime, instead of month"
+// @Param segment query string false "Only records of this segment"
+// @Param gzip query bool false "Compress the report with gzip"
+// @Success 200 {file} file
+// @Failure 400 {object} error
+// @Failure 500 {object} error
+// @Router /v1/reports/history [get]
+func GetHistoryReportHandler(log *slog.Logger, reporter SegmentsHistoryReporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.v1.GetHistoryReportHandler"
+
+		handlers.SetLogger(log, r.Context(), op)
+
+		month := r.URL.Query().Get("month")
+		var from, to time.Time
+		if month == "" {
+			var err error
+			from, err = httpserver.GetTimeFromParams(w, r, log, "from", timeFormat)
+			if err != nil {
+				return
+			}
+			to, err = httpserver.GetTimeFromParams(w, r, log, "to", timeFormat)
+			if err != nil {
+				return
+			}
+		}
+
+		params := models.HistoryReportParams{
+			SegmentName: usecases_segments.FormatSegmnetName(r.URL.Query().Get("segment")),
+		}
+		var err error
+		params.FromDate, params.ToDate, err = usecases_user_segments.ReportPeriod(month, from, to)
+		if err != nil {
+			httpserver.RespondWithError(w, http.StatusBadRequest, err.Error(), log)
+			return
+		}
+		compress := r.URL.Query().Get("gzip") == "true"
+
+		out := &reportWriter{
+			w:           w,
+			filename:    usecases_user_segments.HistoryReportFilename(params, compress),
+			contentType: usecases_user_segments.HistoryReportContentType(compress),
+		}
+
+		n, err := usecases_user_segments.WriteHistoryReport(r.Context(), reporter, params, out, compress)
+		if err != nil {
+			if !out.started {
+				log.Error(err.Error())
+
+				httpserver.RespondWithError(w, http.StatusInternalServerError, "Failed to build history report", log)
+				return
+			}
+			log.Error("Failed to write history report, response is incomplete", sl.Err(err))
+			return
+		}
+
+		log.Info("history report written", slog.String("filename", out.filename), slog.Int64("records", n))
+	}
+}
+
+// @Summary Requests a segments history report
+// @Description Schedules a background job writing the same report as /v1/reports/history into the report storage,
+// @Description so it can be downloaded later without holding a connection open.
+// @Description Either month or from and to must be set. The response is 202 with the report id, its status is available at /v1/reports/{id}.
+// @Tags Reports
+// @Accept  json
+// @Produce  json
+// @ID create-history-report
+// @Param report body models.HistoryReportRequest true "Report period and segment"
+// @Success 202 {object} ReportResponse
+// @Failure 400 {object} error
+// @Failure 500 {object} error
+// @Router /v1/reports [post]
+func CreateReportHandler(log *slog.Logger, creator ReportCreator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.v1.CreateReportHandler"
+
+		handlers.SetLogger(log, r.Context(), op)
+
+		req, err := httpserver.DecodeRequsetBody(w, r, models.HistoryReportRequest{}, log)
+		if err != nil {
+			return
+		}
+
+		log.Info("request body decoded", slog.Any("request", req))
+
+		var from, to time.Time
+		if req.Month == "" {
+			from, err = parseRequestTime("from", req.From)
+			if err != nil {
+				httpserver.RespondWithError(w, http.StatusBadRequest, err.Error(), log)
+				return
+			}
+			to, err = parseRequestTime("to", req.To)
+			if err != nil {
+				httpserver.RespondWithError(w, http.StatusBadRequest, err.Error(), log)
+				return
+			}
+		}
+		from, to, err = usecases_user_segments.ReportPeriod(req.Month, from, to)
+		if err != nil {
+			httpserver.RespondWithError(w, http.StatusBadRequest, err.Error(), log)
+			return
+		}
+
+		payload, err := json.Marshal(jobs.HistoryReportPayload{
+			From:        from,
+			To:          to,
+			SegmentName: usecases_segments.FormatSegmnetName(req.Segment),
+			Gzip:        req.Gzip,
+		})
+		if err != nil {
+			log.Error(err.Error())
+
+			httpserver.RespondWithError(w, http.StatusInternalServerError, "Failed to schedule report", log)
+			return
+		}
+
+		job, err := creator.CreateJob(r.Context(), jobs.NewJobParams(r.Context(), jobs.KindHistoryReport, payload))
+		if err != nil {
+			log.Error(err.Error())
+
+			httpserver.RespondWithError(w, http.StatusInternalServerError, "Failed to schedule report", log)
+			return
+		}
+
+		log.Info("report scheduled", slog.Int64("job_id", job.ID))
+
+		resp, err := transformToReportResponse(job)
+		if err != nil {
+			log.Error(err.Error())
+
+			httpserver.RespondWithError(w, http.StatusInternalServerError, "Failed to schedule report", log)
+			return
+		}
+		httpserver.RespondWithJSON(w, http.StatusAccepted, log, resp)
+	}
+}
+
+// @Summary Report status
+// @Description Returns the status of a report requested through POST /v1/reports: queued, running, succeeded, failed, cancelled
+// @Description or expired once its file has been removed. While running, records counts the records written so far.
+// @Description A succeeded report has download_url, a signed link to the file valid until download_url_expire_at.
+// @Tags Reports
+// @Accept  json
+// @Produce  json
+// @ID get-report
+// @Param id path int true "Report id"
+// @Success 200 {object} ReportResponse
+// @Failure 400 {object} error
+// @Failure 404 {object} error
+// @Failure 500 {object} error
+// @Router /v1/reports/{id} [get]
+func GetReportHandler(log *slog.Logger, getter ReportGetter, signer *urlsign.Signer, linkTTL time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.v1.GetReportHandler"
+
+		handlers.SetLogger(log, r.Context(), op)
+
+		id, ok := getReportID(w, r, log)
+		if !ok {
+			return
+		}
+
+		job, err := getter.GetJobById(r.Context(), id)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Error(err.Error())
+
+			httpserver.RespondWithError(w, http.StatusInternalServerError, "Failed to get report", log)
+			return
+		}
+		if err != nil || job.Kind != jobs.KindHistoryReport {
+			httpserver.RespondWithError(w, http.StatusNotFound, "Report does not exist", log)
+			return
+		}
+
+		resp, err := transformToReportResponse(job)
+		if err != nil {
+			log.Error(err.Error())
+
+			httpserver.RespondWithError(w, http.StatusInternalServerError, "Failed to get report", log)
+			return
+		}
+
+		if job.Status == jobs.StatusSucceeded {
+			report, err := getter.GetReportByJobId(r.Context(), id)
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				resp.Status = StatusExpired
+			case err != nil:
+				log.Error(err.Error())
+
+				httpserver.RespondWithError(w, http.StatusInternalServerError, "Failed to get report", log)
+				return
+			default:
+				addDownloadLink(&resp, report, signer, time.Now().Add(linkTTL))
+			}
+		}
+
+		httpserver.RespondWithJSON(w, http.StatusOK, log, resp)
+	}
+}
+
+// @Summary Downloads a report
+// @Description Downloads the file of a report by the signed link from download_url of /v1/reports/{id}.
+// @Description Links are time-limited: an expired or altered link is rejected with 403.
+// @Tags Reports
+// @Produce  text/csv,application/gzip
+// @ID download-report
+// @Param id path int true "Report id"
+// @Param expires query int true "Link expiry, part of download_url"
+// @Param signature query string true "Link signature, part of download_url"
+// @Success 200 {file} file
+// @Failure 400 {object} error
+// @Failure 403 {object} error
+// @Failure 404 {object} error
+// @Failure 500 {object} error
+// @Router /v1/reports/{id}/download [get]
+func DownloadReportHandler(log *slog.Logger, getter ReportGetter, blobs storage.BlobStore, signer *urlsign.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.v1.DownloadReportHandler"
+
+		handlers.SetLogger(log, r.Context(), op)
+
+		id, ok := getReportID(w, r, log)
+		if !ok {
+			return
+		}
+
+		if err := signer.Verify(downloadPath(id), r.URL.Query(), time.Now()); err != nil {
+			httpserver.RespondWithError(w, http.StatusForbidden, fmt.Sprintf("Invalid download link: %v", err), log)
+			return
+		}
+
+		report, err := getter.GetReportByJobId(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				httpserver.RespondWithError(w, http.StatusNotFound, "Report does not exist or has expired", log)
+				return
+			}
+			log.Error(err.Error())
+
+			httpserver.RespondWithError(w, http.StatusInternalServerError, "Failed to get report", log)
+			return
+		}
+
+		file, err := blobs.Get(r.Context(), report.BlobKey)
+		if err != nil {
+			if errors.Is(err, storage.ErrBlobNotFound) {
+				httpserver.RespondWithError(w, http.StatusNotFound, "Report does not exist or has expired", log)
+				return
+			}
+			log.Error(err.Error())
+
+			httpserver.RespondWithError(w, http.StatusInternalServerError, "Failed to read report", log)
+			return
+		}
+		defer file.Close()
+
+		// The server write timeout is meant for regular requests and would cut a long download.
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		w.Header().Set("Content-Type", report.ContentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment;filename=%s", report.Filename))
+		w.Header().Set("Content-Length", strconv.FormatInt(report.Size, 10))
+		w.WriteHeader(http.StatusOK)
+
+		if _, err := io.Copy(w, file); err != nil {
+			log.Error("Failed to write report, response is incomplete", sl.Err(err))
+		}
+	}
+}
+
+func getReportID(w http.ResponseWriter, r *http.Request, log *slog.Logger) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		httpserver.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Report id must be a number: %v", err), log)
+		return 0, false
+	}
+	return id, true
+}
+
+func parseRequestTime(name string, s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(timeFormat, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC3339 timestamp", name)
+	}
+	return t, nil
+}
+
+func downloadPath(id int64) string {
+	return fmt.Sprintf("/v1/reports/%d/download", id)
+}
+
+// addDownloadLink signs a link valid until expires, but not after the report itself expires.
+func addDownloadLink(resp *ReportResponse, report models.Report, signer *urlsign.Signer, expires time.Time) {
+	if report.ExpireAt.Before(expires) {
+		expires = report.ExpireAt
+	}
+	resp.Filename = report.Filename
+	resp.Size = report.Size
+	resp.Records = report.Records
+	resp.ExpireAt = &report.ExpireAt
+	resp.DownloadURL = signer.Sign(downloadPath(report.JobID), expires)
+	resp.DownloadURLExpireAt = &expires
+}
+
+func transformToReportResponse(job models.Job) (ReportResponse, error) {
+	var payload jobs.HistoryReportPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return ReportResponse{}, err
+	}
+
+	resp := ReportResponse{
+		ID:        job.ID,
+		Status:    job.Status,
+		From:      payload.From,
+		To:        payload.To,
+		Segment:   payload.SegmentName,
+		Gzip:      payload.Gzip,
+		Records:   job.Processed,
+		Error:     job.Error.String,
+		CreatedAt: job.CreatedAt,
+	}
+	if job.FinishedAt.Valid {
+		resp.FinishedAt = &job.FinishedAt.Time
+	}
+	return resp, nil
+}
+
+// reportWriter sends the download headers right before the first byte of the report,
+// so an error before anything is written can still be answered with an error status.
+type reportWriter struct {
+	w           http.ResponseWriter
+	filename    string
+	contentType string
+	started     bool
+}
+
+func (rw *reportWriter) Write(p []byte) (int, error) {
+	if !rw.started {
+		rw.started = true
+		// The server write timeout is meant for regular requests and would cut a long download.
+		_ = http.NewResponseController(rw.w).SetWriteDeadline(time.Time{})
+		rw.w.Header().Set("Content-Type", rw.contentType)
+		rw.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment;filename=%s", rw.filename))
+		rw.w.WriteHeader(http.StatusOK)
+	}
+	return rw.w.Write(p)
+}
@@ -0,0 +1,432 @@
+package reports_test
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/http-server/handlers/v1/reports"
+	"github.com/AlexZahvatkin/segments-users-service/internal/http-server/handlers/v1/reports/mocks"
+	"github.com/AlexZahvatkin/segments-users-service/internal/jobs"
+	slogdiscard "github.com/AlexZahvatkin/segments-users-service/internal/lib/logger/handlers"
+	"github.com/AlexZahvatkin/segments-users-service/internal/lib/urlsign"
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+	storagemocks "github.com/AlexZahvatkin/segments-users-service/internal/storage/mocks"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetHistoryReportHandler(t *testing.T) {
+	history := []models.UsersInSegmentsHistory{
+		{
+			ID:          1,
+			UserID:      1,
+			SegmentName: "TEST_SEGMENT",
+			ActionType:  models.ActionInserted,
+			ActionDate:  time.Date(2023, 9, 1, 10, 0, 0, 0, time.UTC),
+			Actor:       sql.NullString{String: "alice", Valid: true},
+		},
+		{
+			ID:          2,
+			UserID:      2,
+			SegmentName: "TEST_SEGMENT",
+			ActionType:  models.ActionExpired,
+			ActionDate:  time.Date(2023, 9, 30, 23, 59, 0, 0, time.UTC),
+			ExpireAt:    sql.NullTime{Time: time.Date(2023, 9, 30, 23, 58, 0, 0, time.UTC), Valid: true},
+		},
+	}
+	csvReport := "user_id,segment_name,action_type,action_date,expire_at,old_expire_at,actor,reason\n" +
+		"1,TEST_SEGMENT,inserted,2023-09-01 10:00:00,,,alice,\n" +
+		"2,TEST_SEGMENT,expired,2023-09-30 23:59:00,2023-09-30 23:58:00,,,\n"
+
+	cases := []struct {
+		name        string
+		query       string
+		params      models.HistoryReportParams
+		reportErr   error
+		statusCode  int
+		contentType string
+		filename    string
+	}{
+		{
+			name:  "Month",
+			query: "month=2023-09",
+			params: models.HistoryReportParams{
+				FromDate: time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC),
+				ToDate:   time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC),
+			},
+			statusCode:  http.StatusOK,
+			contentType: "text/csv",
+			filename:    "history_2023-09.csv",
+		},
+		{
+			name:  "December of a segment gzipped",
+			query: "month=2023-12&segment=test%20segment&gzip=true",
+			params: models.HistoryReportParams{
+				FromDate:    time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC),
+				ToDate:      time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				SegmentName: "TEST_SEGMENT",
+			},
+			statusCode:  http.StatusOK,
+			contentType: "application/gzip",
+			filename:    "history_TEST_SEGMENT_2023-12.csv.gz",
+		},
+		{
+			name:  "Period",
+			query: "from=2023-09-01T03:00:00%2B03:00&to=2023-09-15T00:00:00Z",
+			params: models.HistoryReportParams{
+				FromDate: time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC),
+				ToDate:   time.Date(2023, 9, 15, 0, 0, 0, 0, time.UTC),
+			},
+			statusCode:  http.StatusOK,
+			contentType: "text/csv",
+			filename:    "history_20230901T000000_20230915T000000.csv",
+		},
+		{
+			name:       "Invalid month",
+			query:      "month=2023-13",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "No period",
+			query:      "segment=TEST_SEGMENT",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Empty period",
+			query:      "from=2023-09-15T00:00:00Z&to=2023-09-01T00:00:00Z",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:  "Database error",
+			query: "month=2023-09",
+			params: models.HistoryReportParams{
+				FromDate: time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC),
+				ToDate:   time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC),
+			},
+			reportErr:  errors.New("connection refused"),
+			statusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			reporterMock := mocks.NewSegmentsHistoryReporter(t)
+			reporterMock.On("ReportSegmentsHistory", mock.Anything, mock.MatchedBy(func(arg models.HistoryReportParams) bool {
+				return arg.FromDate.Equal(tc.params.FromDate) && arg.ToDate.Equal(tc.params.ToDate) &&
+					arg.SegmentName == tc.params.SegmentName
+			}), mock.Anything).
+				Return(func(_ context.Context, _ models.HistoryReportParams, fn func(models.UsersInSegmentsHistory) error) error {
+					if tc.reportErr != nil {
+						return tc.reportErr
+					}
+					for _, h := range history {
+						if err := fn(h); err != nil {
+							return err
+						}
+					}
+					return nil
+				}).Maybe()
+
+			handler := reports.GetHistoryReportHandler(slogdiscard.NewDiscardLogger(), reporterMock)
+			req, err := http.NewRequest(http.MethodGet, "/reports/history?"+tc.query, nil)
+			require.NoError(t, err)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tc.statusCode, rr.Code)
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+
+			require.Equal(t, tc.contentType, rr.Header().Get("Content-Type"))
+			require.Equal(t, "attachment;filename="+tc.filename, rr.Header().Get("Content-Disposition"))
+
+			var body io.Reader = rr.Body
+			if strings.HasSuffix(tc.filename, ".gz") {
+				body, err = gzip.NewReader(rr.Body)
+				require.NoError(t, err)
+			}
+			report, err := io.ReadAll(body)
+			require.NoError(t, err)
+			require.Equal(t, csvReport, string(report))
+		})
+	}
+}
+
+func TestCreateReportHandler(t *testing.T) {
+	cases := []struct {
+		name       string
+		body       string
+		payload    jobs.HistoryReportPayload
+		createErr  error
+		statusCode int
+	}{
+		{
+			name: "Month",
+			body: `{"month": "2023-09", "segment": "test_segment", "gzip": true}`,
+			payload: jobs.HistoryReportPayload{
+				From:        time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC),
+				To:          time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC),
+				SegmentName: "TEST_SEGMENT",
+				Gzip:        true,
+			},
+			statusCode: http.StatusAccepted,
+		},
+		{
+			name: "Period",
+			body: `{"from": "2023-09-01T00:00:00Z", "to": "2023-09-15T00:00:00Z"}`,
+			payload: jobs.HistoryReportPayload{
+				From: time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC),
+				To:   time.Date(2023, 9, 15, 0, 0, 0, 0, time.UTC),
+			},
+			statusCode: http.StatusAccepted,
+		},
+		{
+			name:       "No period",
+			body:       `{"segment": "TEST_SEGMENT"}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Invalid from",
+			body:       `{"from": "yesterday", "to": "2023-09-15T00:00:00Z"}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name: "Database error",
+			body: `{"month": "2023-09"}`,
+			payload: jobs.HistoryReportPayload{
+				From: time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC),
+				To:   time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC),
+			},
+			createErr:  errors.New("connection refused"),
+			statusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			payload, err := json.Marshal(tc.payload)
+			require.NoError(t, err)
+
+			creatorMock := mocks.NewReportCreator(t)
+			creatorMock.On("CreateJob", mock.Anything, mock.MatchedBy(func(arg models.CreateJobParams) bool {
+				return arg.Kind == jobs.KindHistoryReport && string(arg.Payload) == string(payload)
+			})).Return(models.Job{ID: 1, Kind: jobs.KindHistoryReport, Status: jobs.StatusQueued, Payload: payload}, tc.createErr).Maybe()
+
+			handler := reports.CreateReportHandler(slogdiscard.NewDiscardLogger(), creatorMock)
+			req, err := http.NewRequest(http.MethodPost, "/reports", strings.NewReader(tc.body))
+			require.NoError(t, err)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tc.statusCode, rr.Code)
+			if tc.statusCode != http.StatusAccepted {
+				return
+			}
+
+			var resp reports.ReportResponse
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			require.Equal(t, int64(1), resp.ID)
+			require.Equal(t, jobs.StatusQueued, resp.Status)
+			require.True(t, tc.payload.From.Equal(resp.From))
+		})
+	}
+}
+
+func TestGetReportHandler(t *testing.T) {
+	payload, err := json.Marshal(jobs.HistoryReportPayload{
+		From: time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC),
+	})
+	require.NoError(t, err)
+	signer := urlsign.New([]byte("secret"))
+
+	cases := []struct {
+		name       string
+		id         string
+		job        models.Job
+		jobErr     error
+		report     models.Report
+		reportErr  error
+		statusCode int
+		status     string
+		link       bool
+	}{
+		{
+			name:       "Running",
+			id:         "1",
+			job:        models.Job{ID: 1, Kind: jobs.KindHistoryReport, Status: jobs.StatusRunning, Payload: payload, Processed: 100},
+			statusCode: http.StatusOK,
+			status:     jobs.StatusRunning,
+		},
+		{
+			name: "Succeeded",
+			id:   "1",
+			job:  models.Job{ID: 1, Kind: jobs.KindHistoryReport, Status: jobs.StatusSucceeded, Payload: payload},
+			report: models.Report{JobID: 1, Filename: "history_2023-09.csv", Size: 10, Records: 1,
+				ExpireAt: time.Now().Add(24 * time.Hour)},
+			statusCode: http.StatusOK,
+			status:     jobs.StatusSucceeded,
+			link:       true,
+		},
+		{
+			name:       "Expired",
+			id:         "1",
+			job:        models.Job{ID: 1, Kind: jobs.KindHistoryReport, Status: jobs.StatusSucceeded, Payload: payload},
+			reportErr:  sql.ErrNoRows,
+			statusCode: http.StatusOK,
+			status:     reports.StatusExpired,
+		},
+		{
+			name:       "Job of another kind",
+			id:         "1",
+			job:        models.Job{ID: 1, Kind: jobs.KindSegmentRollout, Status: jobs.StatusSucceeded},
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "Report does not exist",
+			id:         "1",
+			jobErr:     sql.ErrNoRows,
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "Invalid id",
+			id:         "abc",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			getterMock := mocks.NewReportGetter(t)
+			getterMock.On("GetJobById", mock.Anything, int64(1)).Return(tc.job, tc.jobErr).Maybe()
+			getterMock.On("GetReportByJobId", mock.Anything, int64(1)).Return(tc.report, tc.reportErr).Maybe()
+
+			handler := reports.GetReportHandler(slogdiscard.NewDiscardLogger(), getterMock, signer, time.Hour)
+			req, err := http.NewRequest(http.MethodGet, "/reports/"+tc.id, nil)
+			require.NoError(t, err)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", tc.id)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tc.statusCode, rr.Code)
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+
+			var resp reports.ReportResponse
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			require.Equal(t, tc.status, resp.Status)
+			if !tc.link {
+				require.Empty(t, resp.DownloadURL)
+				return
+			}
+			u, err := url.Parse(resp.DownloadURL)
+			require.NoError(t, err)
+			require.Equal(t, "/v1/reports/1/download", u.Path)
+			require.NoError(t, signer.Verify(u.Path, u.Query(), time.Now()))
+			require.WithinDuration(t, time.Now().Add(time.Hour), *resp.DownloadURLExpireAt, time.Minute)
+		})
+	}
+}
+
+func TestDownloadReportHandler(t *testing.T) {
+	signer := urlsign.New([]byte("secret"))
+	valid := signer.Sign("/v1/reports/1/download", time.Now().Add(time.Hour))
+	report := models.Report{JobID: 1, BlobKey: "reports/1/history_2023-09.csv", Filename: "history_2023-09.csv",
+		ContentType: "text/csv", Size: 8}
+
+	cases := []struct {
+		name       string
+		link       string
+		reportErr  error
+		blobErr    error
+		statusCode int
+	}{
+		{
+			name:       "Valid link",
+			link:       valid,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Expired link",
+			link:       signer.Sign("/v1/reports/1/download", time.Now().Add(-time.Minute)),
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "Link of another report",
+			link:       strings.Replace(signer.Sign("/v1/reports/2/download", time.Now().Add(time.Hour)), "/2/", "/1/", 1),
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "Unsigned link",
+			link:       "/v1/reports/1/download",
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "Report expired",
+			link:       valid,
+			reportErr:  sql.ErrNoRows,
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "File removed",
+			link:       valid,
+			blobErr:    storage.ErrBlobNotFound,
+			statusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			getterMock := mocks.NewReportGetter(t)
+			getterMock.On("GetReportByJobId", mock.Anything, int64(1)).Return(report, tc.reportErr).Maybe()
+			blobsMock := storagemocks.NewBlobStore(t)
+			blobsMock.On("Get", mock.Anything, report.BlobKey).Return(io.NopCloser(strings.NewReader("user_id\n")), tc.blobErr).Maybe()
+
+			handler := reports.DownloadReportHandler(slogdiscard.NewDiscardLogger(), getterMock, blobsMock, signer)
+			req, err := http.NewRequest(http.MethodGet, tc.link, nil)
+			require.NoError(t, err)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "1")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tc.statusCode, rr.Code)
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+
+			require.Equal(t, "text/csv", rr.Header().Get("Content-Type"))
+			require.Equal(t, "attachment;filename=history_2023-09.csv", rr.Header().Get("Content-Disposition"))
+			require.Equal(t, "user_id\n", rr.Body.String())
+		})
+	}
+}
@@ -6,10 +6,14 @@ import (
 
 	"github.com/AlexZahvatkin/segments-users-service/config"
 	_ "github.com/AlexZahvatkin/segments-users-service/docs"
+	"github.com/AlexZahvatkin/segments-users-service/internal/http-server/handlers/v1/jobs"
+	"github.com/AlexZahvatkin/segments-users-service/internal/http-server/handlers/v1/reports"
 	"github.com/AlexZahvatkin/segments-users-service/internal/http-server/handlers/v1/segments"
 	"github.com/AlexZahvatkin/segments-users-service/internal/http-server/handlers/v1/users"
 	"github.com/AlexZahvatkin/segments-users-service/internal/http-server/handlers/v1/users_in_segments"
+	"github.com/AlexZahvatkin/segments-users-service/internal/http-server/middleware/mwaudit"
 	"github.com/AlexZahvatkin/segments-users-service/internal/http-server/middleware/mwlogger"
+	"github.com/AlexZahvatkin/segments-users-service/internal/lib/urlsign"
 	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
@@ -17,12 +21,12 @@ import (
 	httpSwagger "github.com/swaggo/http-swagger/v2"
 )
 
-func InitRouters(storage storage.Storage, log *slog.Logger, cfg *config.Config) *chi.Mux {
+func InitRouters(storage storage.Storage, blobs storage.BlobStore, signer *urlsign.Signer, log *slog.Logger, cfg *config.Config) *chi.Mux {
 	router := chi.NewRouter()
 
 	router.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*, http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"*"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: false,
@@ -34,17 +38,38 @@ func InitRouters(storage storage.Storage, log *slog.Logger, cfg *config.Config)
 	v1Router.Use(middleware.RequestID)
 	v1Router.Use(middleware.Logger)
 	v1Router.Use(mwlogger.New(log))
+	v1Router.Use(mwaudit.New())
 	v1Router.Use(middleware.Recoverer)
 	v1Router.Use(middleware.URLFormat)
 
-	v1Router.Post("/segments/assign/{userId}", users_in_segments.SegmentsAssignHandler(log, storage))
+	v1Router.Post("/segments/assign/{userId}", users_in_segments.SegmentsAssignHandler(log, storage, cfg.Users.CreateOnAssign))
 	v1Router.Get("/segments/history/{userId}", users_in_segments.GetSegmentsHistoryByUser(log, storage))
-	v1Router.Post("/segments/ttl/{userId}", users_in_segments.SegmentsAssignWithTTLInHoursHandler(log, storage))
-	v1Router.Get("/segments/{userId}", users_in_segments.GetSegmentsForUserHandler(log, storage))
+	v1Router.Post("/segments/ttl/{userId}", users_in_segments.SegmentsAssignWithTTLHandler(log, storage, cfg.Users.CreateOnAssign))
+	v1Router.Get("/segments/{userId:(?:[0-9]+|ext:.+)}", users_in_segments.GetSegmentsForUserHandler(log, storage))
 	v1Router.Post("/users", users.AddUserHandler(log, storage))
+	v1Router.Post("/users:import", users.ImportUsersHandler(log, storage, cfg.Users.ImportMaxSize, cfg.Users.ImportUploadTimeout))
 	v1Router.Delete("/users/{userId}", users.DeleteUserHandler(log, storage))
+	v1Router.Get("/users", users.ListUsersHandler(log, storage))
+	v1Router.Get("/users/{userId}", users.GetUserHandler(log, storage))
+	v1Router.Patch("/users/{userId}", users.UpdateUserHandler(log, storage))
+	v1Router.Get("/users/{userId}/segments", users_in_segments.GetUserSegmentsHandler(log, storage))
+	v1Router.Post("/users/{userId}/restore", users.RestoreUserHandler(log, storage, cfg.Deletion.Retention))
 	v1Router.Post("/segments", segments.AddSegmentHandler(log, storage))
 	v1Router.Delete("/segments", segments.DeleteSegmentHandler(log, storage))
+	v1Router.Get("/segments", segments.ListSegmentsHandler(log, storage))
+	v1Router.Get("/segments/{name}", segments.GetSegmentHandler(log, storage))
+	v1Router.Patch("/segments/{name}", segments.UpdateSegmentHandler(log, storage))
+	v1Router.Post("/segments/{name}/restore", segments.RestoreSegmentHandler(log, storage, cfg.Deletion.Retention))
+	v1Router.Get("/segments/{name}/stats", segments.GetSegmentStatsHandler(log, storage))
+	v1Router.Get("/segments/{name}/users", users_in_segments.GetUsersInSegmentHandler(log, storage))
+	v1Router.Post("/segments/{name}/members:batch",
+		users_in_segments.AddSegmentMembersBatchHandler(log, storage, cfg.Batch.SyncLimit, cfg.Batch.MaxSize, cfg.Batch.MaxBodySize))
+	v1Router.Get("/jobs/{jobId}", jobs.GetJobHandler(log, storage))
+	v1Router.Delete("/jobs/{jobId}", jobs.CancelJobHandler(log, storage))
+	v1Router.Get("/reports/history", reports.GetHistoryReportHandler(log, storage))
+	v1Router.Post("/reports", reports.CreateReportHandler(log, storage))
+	v1Router.Get("/reports/{id}", reports.GetReportHandler(log, storage, signer, cfg.Reports.LinkTTL))
+	v1Router.Get("/reports/{id}/download", reports.DownloadReportHandler(log, storage, blobs, signer))
 
 	router.Mount("/v1", v1Router)
 
@@ -0,0 +1,69 @@
+// Code generated by mockery v2.33.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	models "github.com/AlexZahvatkin/segments-users-service/internal/models"
+	mock "github.com/stretchr/testify/mock"
+
+	storage "github.com/AlexZahvatkin/segments-users-service/internal/storage"
+)
+
+// SegmentAdder is an autogenerated mock type for the SegmentAdder type
+type SegmentAdder struct {
+	mock.Mock
+}
+
+// ExecTx provides a mock function with given fields: ctx, fn
+func (_m *SegmentAdder) ExecTx(ctx context.Context, fn func(storage.Querier) error) error {
+	ret := _m.Called(ctx, fn)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, func(storage.Querier) error) error); ok {
+		r0 = rf(ctx, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetSegmentByName provides a mock function with given fields: ctx, name
+func (_m *SegmentAdder) GetSegmentByName(ctx context.Context, name string) (models.Segment, error) {
+	ret := _m.Called(ctx, name)
+
+	var r0 models.Segment
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (models.Segment, error)); ok {
+		return rf(ctx, name)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) models.Segment); ok {
+		r0 = rf(ctx, name)
+	} else {
+		r0 = ret.Get(0).(models.Segment)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewSegmentAdder creates a new instance of SegmentAdder. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewSegmentAdder(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *SegmentAdder {
+	mock := &SegmentAdder{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,91 @@
+// Code generated by mockery v2.33.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	models "github.com/AlexZahvatkin/segments-users-service/internal/models"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// SegmentDeleter is an autogenerated mock type for the SegmentDeleter type
+type SegmentDeleter struct {
+	mock.Mock
+}
+
+// CreateJob provides a mock function with given fields: ctx, arg
+func (_m *SegmentDeleter) CreateJob(ctx context.Context, arg models.CreateJobParams) (models.Job, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 models.Job
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.CreateJobParams) (models.Job, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.CreateJobParams) models.Job); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(models.Job)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.CreateJobParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteSegment provides a mock function with given fields: _a0, _a1
+func (_m *SegmentDeleter) DeleteSegment(_a0 context.Context, _a1 string) error {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetSegmentByName provides a mock function with given fields: ctx, name
+func (_m *SegmentDeleter) GetSegmentByName(ctx context.Context, name string) (models.Segment, error) {
+	ret := _m.Called(ctx, name)
+
+	var r0 models.Segment
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (models.Segment, error)); ok {
+		return rf(ctx, name)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) models.Segment); ok {
+		r0 = rf(ctx, name)
+	} else {
+		r0 = ret.Get(0).(models.Segment)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewSegmentDeleter creates a new instance of SegmentDeleter. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewSegmentDeleter(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *SegmentDeleter {
+	mock := &SegmentDeleter{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,53 @@
+// Code generated by mockery v2.33.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	models "github.com/AlexZahvatkin/segments-users-service/internal/models"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// SegmentGetter is an autogenerated mock type for the SegmentGetter type
+type SegmentGetter struct {
+	mock.Mock
+}
+
+// GetSegmentWithMembersCount provides a mock function with given fields: ctx, name
+func (_m *SegmentGetter) GetSegmentWithMembersCount(ctx context.Context, name string) (models.GetSegmentWithMembersCountRow, error) {
+	ret := _m.Called(ctx, name)
+
+	var r0 models.GetSegmentWithMembersCountRow
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (models.GetSegmentWithMembersCountRow, error)); ok {
+		return rf(ctx, name)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) models.GetSegmentWithMembersCountRow); ok {
+		r0 = rf(ctx, name)
+	} else {
+		r0 = ret.Get(0).(models.GetSegmentWithMembersCountRow)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewSegmentGetter creates a new instance of SegmentGetter. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewSegmentGetter(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *SegmentGetter {
+	mock := &SegmentGetter{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
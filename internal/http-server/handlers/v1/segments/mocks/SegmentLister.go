@@ -0,0 +1,55 @@
+// Code generated by mockery v2.33.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	models "github.com/AlexZahvatkin/segments-users-service/internal/models"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// SegmentLister is an autogenerated mock type for the SegmentLister type
+type SegmentLister struct {
+	mock.Mock
+}
+
+// ListSegments provides a mock function with given fields: ctx, arg
+func (_m *SegmentLister) ListSegments(ctx context.Context, arg models.ListSegmentsParams) ([]models.ListSegmentsRow, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 []models.ListSegmentsRow
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.ListSegmentsParams) ([]models.ListSegmentsRow, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.ListSegmentsParams) []models.ListSegmentsRow); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.ListSegmentsRow)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.ListSegmentsParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewSegmentLister creates a new instance of SegmentLister. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewSegmentLister(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *SegmentLister {
+	mock := &SegmentLister{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
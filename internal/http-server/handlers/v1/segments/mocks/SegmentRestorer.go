@@ -0,0 +1,53 @@
+// Code generated by mockery v2.33.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	models "github.com/AlexZahvatkin/segments-users-service/internal/models"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// SegmentRestorer is an autogenerated mock type for the SegmentRestorer type
+type SegmentRestorer struct {
+	mock.Mock
+}
+
+// RestoreSegment provides a mock function with given fields: ctx, arg
+func (_m *SegmentRestorer) RestoreSegment(ctx context.Context, arg models.RestoreSegmentParams) (models.Segment, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 models.Segment
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.RestoreSegmentParams) (models.Segment, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.RestoreSegmentParams) models.Segment); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(models.Segment)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.RestoreSegmentParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewSegmentRestorer creates a new instance of SegmentRestorer. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewSegmentRestorer(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *SegmentRestorer {
+	mock := &SegmentRestorer{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
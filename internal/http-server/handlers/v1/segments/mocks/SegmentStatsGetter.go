@@ -0,0 +1,79 @@
+// Code generated by mockery v2.33.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	models "github.com/AlexZahvatkin/segments-users-service/internal/models"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// SegmentStatsGetter is an autogenerated mock type for the SegmentStatsGetter type
+type SegmentStatsGetter struct {
+	mock.Mock
+}
+
+// GetSegmentDailyStats provides a mock function with given fields: ctx, arg
+func (_m *SegmentStatsGetter) GetSegmentDailyStats(ctx context.Context, arg models.GetSegmentDailyStatsParams) ([]models.GetSegmentDailyStatsRow, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 []models.GetSegmentDailyStatsRow
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.GetSegmentDailyStatsParams) ([]models.GetSegmentDailyStatsRow, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.GetSegmentDailyStatsParams) []models.GetSegmentDailyStatsRow); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.GetSegmentDailyStatsRow)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.GetSegmentDailyStatsParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSegmentMembershipCounts provides a mock function with given fields: ctx, arg
+func (_m *SegmentStatsGetter) GetSegmentMembershipCounts(ctx context.Context, arg models.GetSegmentMembershipCountsParams) (models.GetSegmentMembershipCountsRow, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 models.GetSegmentMembershipCountsRow
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.GetSegmentMembershipCountsParams) (models.GetSegmentMembershipCountsRow, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.GetSegmentMembershipCountsParams) models.GetSegmentMembershipCountsRow); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(models.GetSegmentMembershipCountsRow)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.GetSegmentMembershipCountsParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewSegmentStatsGetter creates a new instance of SegmentStatsGetter. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewSegmentStatsGetter(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *SegmentStatsGetter {
+	mock := &SegmentStatsGetter{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,44 @@
+// Code generated by mockery v2.33.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	mock "github.com/stretchr/testify/mock"
+
+	storage "github.com/AlexZahvatkin/segments-users-service/internal/storage"
+)
+
+// SegmentUpdater is an autogenerated mock type for the SegmentUpdater type
+type SegmentUpdater struct {
+	mock.Mock
+}
+
+// ExecTx provides a mock function with given fields: ctx, fn
+func (_m *SegmentUpdater) ExecTx(ctx context.Context, fn func(storage.Querier) error) error {
+	ret := _m.Called(ctx, fn)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, func(storage.Querier) error) error); ok {
+		r0 = rf(ctx, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// NewSegmentUpdater creates a new instance of SegmentUpdater. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewSegmentUpdater(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *SegmentUpdater {
+	mock := &SegmentUpdater{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
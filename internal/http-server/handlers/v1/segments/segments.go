@@ -3,6 +3,7 @@ package segments
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -11,51 +12,104 @@ import (
 
 	"github.com/AlexZahvatkin/segments-users-service/internal/http-server"
 	"github.com/AlexZahvatkin/segments-users-service/internal/http-server/handlers"
+	"github.com/AlexZahvatkin/segments-users-service/internal/jobs"
 	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
 	"github.com/AlexZahvatkin/segments-users-service/internal/use-cases/segments"
-	usecases_user_segments "github.com/AlexZahvatkin/segments-users-service/internal/use-cases/user_segments"
+	"github.com/go-chi/chi"
 	"github.com/go-playground/validator/v10"
 )
 
+var errPercentDecreased = errors.New("rollout percent can not be decreased")
+
 const (
 	maxDescriptionLength = 65536
+	defaultPageSize      = 100
+	maxPageSize          = 1000
 )
 
-//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=UserAdder
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=SegmentAdder
 type SegmentAdder interface {
-	AddSegment(context.Context, models.AddSegmentParams) (models.Segment, error)
+	storage.Transactor
 	GetSegmentByName(ctx context.Context, name string) (models.Segment, error)
 }
 
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=SegmentDeleter
 type SegmentDeleter interface {
 	DeleteSegment(context.Context, string) error
 	GetSegmentByName(ctx context.Context, name string) (models.Segment, error)
+	CreateJob(ctx context.Context, arg models.CreateJobParams) (models.Job, error)
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=SegmentRestorer
+type SegmentRestorer interface {
+	RestoreSegment(ctx context.Context, arg models.RestoreSegmentParams) (models.Segment, error)
 }
 
-type SegmentAutoAssigner interface {
-	SegmentAdder
-	AutoAssigner
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=SegmentLister
+type SegmentLister interface {
+	ListSegments(ctx context.Context, arg models.ListSegmentsParams) ([]models.ListSegmentsRow, error)
 }
 
-type AutoAssigner interface {
-	GetAllUsersId(ctx context.Context) ([]int64, error)
-	AddUserIntoSegment(ctx context.Context, arg models.AddUserIntoSegmentParams) (models.UsersInSegment, error)
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=SegmentGetter
+type SegmentGetter interface {
+	GetSegmentWithMembersCount(ctx context.Context, name string) (models.GetSegmentWithMembersCountRow, error)
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=SegmentStatsGetter
+type SegmentStatsGetter interface {
+	GetSegmentMembershipCounts(ctx context.Context, arg models.GetSegmentMembershipCountsParams) (models.GetSegmentMembershipCountsRow, error)
+	GetSegmentDailyStats(ctx context.Context, arg models.GetSegmentDailyStatsParams) ([]models.GetSegmentDailyStatsRow, error)
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=SegmentUpdater
+type SegmentUpdater interface {
+	storage.Transactor
 }
 
 type responseSegment struct {
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
+	RolloutSalt string    `json:"rollout_salt"`
+	Percent     float64   `json:"percent,omitempty"`
 	Created_At  time.Time `json:"created_at"`
 	Updated_At  time.Time `json:"updated_at"`
 }
 
-type responseSegmentAndUsers struct {
+type responseSegmentAndJob struct {
 	Segment responseSegment `json:"segment"`
-	Users   []int64         `json:"added_users_ids"`
+	JobID   int64           `json:"job_id"`
+}
+
+type responseSegmentWithMembers struct {
+	responseSegment
+	MembersCount int64 `json:"members_count"`
+	PendingCount int64 `json:"pending_count"`
+}
+
+type responseSegmentsPage struct {
+	Segments   []responseSegmentWithMembers `json:"segments"`
+	NextCursor string                       `json:"next_cursor,omitempty"`
+}
+
+type responseSegmentStats struct {
+	Name              string                         `json:"name"`
+	ActiveCount       int64                          `json:"active_count"`
+	ExpiringSoonCount int64                          `json:"expiring_soon_count"`
+	ExpiringWithin    string                         `json:"expiring_within"`
+	Days              []usecases_segments.DailyStats `json:"days"`
+}
+
+type responseJob struct {
+	JobID int64 `json:"job_id"`
 }
 
 // @Summary Adds a segment
-// @Description Adds a segment. If percent is provided, automatically assign that percentage of users to the segment.
+// @Description Adds a segment. If percent is provided, a background job assigns that percentage of users to the segment.
+// @Description Progress of the job is available at /v1/jobs/{jobId}.
+// @Description Users are picked deterministically by a hash of the salt (segment name by default) and user id.
+// @Description The percent is saved with the segment, so users created later are enrolled the same way.
+// @Description A name of digits only is rejected, as it could not be told apart from a user id in /v1/segments/{userId}.
 // @Tags Segments
 // @Accept  json
 // @Produce  json
@@ -63,16 +117,18 @@ type responseSegmentAndUsers struct {
 // @Param name body string true "Segment name"
 // @Param description body string false "Description"
 // @Param percent body number false "Percent of users to be assigned to the segment"
+// @Param salt body string false "Salt for picking users, segment name by default"
 // @Success 201 {object} responseSegment
-// @Success 201 {object} responseSegmentAndUsers
+// @Success 201 {object} responseSegmentAndJob
 // @Failure 400 {object} error
 // @Failure 500 {object} error
 // @Router /v1/segments [post]
-func AddSegmentHandler(log *slog.Logger, segmentAdder SegmentAutoAssigner) http.HandlerFunc {
+func AddSegmentHandler(log *slog.Logger, segmentAdder SegmentAdder) http.HandlerFunc {
 	type request struct {
 		Name        string  `json:"name" validate:"required,min=4,max=255"`
 		Description string  `json:"description"`
-		Percent     float64 `json:"percent"`
+		Percent     float64 `json:"percent" validate:"gte=0,lte=100"`
+		Salt        string  `json:"salt" validate:"max=255"`
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -97,58 +153,93 @@ func AddSegmentHandler(log *slog.Logger, segmentAdder SegmentAutoAssigner) http.
 		}
 
 		req.Name = usecases_segments.FormatSegmnetName(req.Name)
+		if usecases_segments.IsNumericSegmentName(req.Name) {
+			httpserver.RespondWithError(w, http.StatusBadRequest, "Segment name can not consist of digits only", log)
+			return
+		}
+		if req.Salt == "" {
+			req.Salt = req.Name
+		}
 
 		if _, err := segmentAdder.GetSegmentByName(r.Context(), req.Name); err == nil {
 			httpserver.RespondWithError(w, http.StatusBadRequest, "Segment with such name already exists", log)
 			return
 		}
 
-		addedSegment, err := segmentAdder.AddSegment(r.Context(), models.AddSegmentParams{
-			Name: req.Name,
-			Description: sql.NullString{
-				String: req.Description,
-				Valid:  true,
-			},
+		var (
+			addedSegment models.Segment
+			job          models.Job
+		)
+
+		err = segmentAdder.ExecTx(r.Context(), func(q storage.Querier) error {
+			var err error
+			addedSegment, err = q.AddSegment(r.Context(), models.AddSegmentParams{
+				Name: req.Name,
+				Description: sql.NullString{
+					String: req.Description,
+					Valid:  true,
+				},
+				RolloutSalt: req.Salt,
+				RolloutPercent: sql.NullFloat64{
+					Float64: req.Percent,
+					Valid:   req.Percent > 0,
+				},
+			})
+			if err != nil {
+				return err
+			}
+
+			if req.Percent == 0 {
+				return nil
+			}
+
+			payload, err := json.Marshal(jobs.SegmentRolloutPayload{SegmentName: addedSegment.Name})
+			if err != nil {
+				return err
+			}
+
+			job, err = q.CreateJob(r.Context(), jobs.NewJobParams(r.Context(), jobs.KindSegmentRollout, payload))
+			return err
 		})
 		if err != nil {
+			if storage.IsUniqueViolation(err) {
+				httpserver.RespondWithError(w, http.StatusBadRequest,
+					"Segment with such name was deleted, restore it or wait until it is purged", log)
+				return
+			}
 			log.Error(err.Error())
 
 			httpserver.RespondWithError(w, http.StatusInternalServerError, "Could not create segment", log)
 			return
 		}
 
-		respSegm := responseSegment{
-			Name:        addedSegment.Name,
-			Description: addedSegment.Description.String,
-			Created_At:  addedSegment.CreatedAt,
-			Updated_At:  addedSegment.UpdatedAt,
-		}
+		respSegm := transformToSegmentResponse(addedSegment)
 
 		if req.Percent == 0 {
 			httpserver.RespondWithJSON(w, http.StatusCreated, log, respSegm)
 			return
 		}
 
-		userIds, err := assignProcentOfUsersToSegment(log, segmentAdder, w, r, req.Percent, req.Name)
-		if err != nil {
-			return
-		}
-
-		httpserver.RespondWithJSON(w, http.StatusCreated, log, responseSegmentAndUsers{
+		httpserver.RespondWithJSON(w, http.StatusCreated, log, responseSegmentAndJob{
 			Segment: respSegm,
-			Users:   userIds,
+			JobID:   job.ID,
 		})
 	}
 }
 
 // @Summary Delete a segment
-// @Description Delete a segment using its name.
+// @Description Delete a segment using its name. Its users are removed from it and recorded in the history as segment_deleted,
+// @Description the segment itself is hidden and can be restored with /v1/segments/{name}/restore until it is purged.
+// @Description With async=true users are removed from the segment by a background job in batches,
+// @Description the segment itself is deleted when the job finishes. Progress is available at /v1/jobs/{jobId}.
 // @Tags Segments
 // @Accept  json
 // @Produce  json
 // @ID delete-segment
 // @Param name query string true "Segment name"
+// @Param async query bool false "Delete in a background job"
 // @Success 200
+// @Success 202 {object} responseJob
 // @Failure 400 {object} error
 // @Failure 500 {object} error
 // @Router /v1/segments [delete]
@@ -158,7 +249,7 @@ func DeleteSegmentHandler(log *slog.Logger, segmentDeleter SegmentDeleter) http.
 
 		handlers.SetLogger(log, r.Context(), op)
 
-		req := r.URL.Query().Get("name")
+		req := usecases_segments.FormatSegmnetName(r.URL.Query().Get("name"))
 		if req == "" {
 			httpserver.RespondWithError(w, http.StatusBadRequest, "Name is required", log)
 			return
@@ -171,6 +262,27 @@ func DeleteSegmentHandler(log *slog.Logger, segmentDeleter SegmentDeleter) http.
 			return
 		}
 
+		if r.URL.Query().Get("async") == "true" {
+			payload, err := json.Marshal(jobs.SegmentDeletionPayload{SegmentName: req})
+			if err != nil {
+				log.Error(err.Error())
+
+				httpserver.RespondWithError(w, http.StatusInternalServerError, "Could not delete segment", log)
+				return
+			}
+
+			job, err := segmentDeleter.CreateJob(r.Context(), jobs.NewJobParams(r.Context(), jobs.KindSegmentDeletion, payload))
+			if err != nil {
+				log.Error(err.Error())
+
+				httpserver.RespondWithError(w, http.StatusInternalServerError, "Could not delete segment", log)
+				return
+			}
+
+			httpserver.RespondWithJSON(w, http.StatusAccepted, log, responseJob{JobID: job.ID})
+			return
+		}
+
 		if err := segmentDeleter.DeleteSegment(r.Context(), req); err != nil {
 			log.Error(err.Error())
 
@@ -182,38 +294,365 @@ func DeleteSegmentHandler(log *slog.Logger, segmentDeleter SegmentDeleter) http.
 	}
 }
 
-func assignProcentOfUsersToSegment(log *slog.Logger, autoAssigner AutoAssigner, w http.ResponseWriter,
-	r *http.Request, percent float64, segmentName string) ([]int64, error) {
-	ids, err := autoAssigner.GetAllUsersId(r.Context())
-	if err != nil {
-		log.Error(err.Error())
+// @Summary List segments
+// @Description Returns segments ordered by name together with the number of users currently in each of them
+// @Description and the number of users whose scheduled membership has not started yet.
+// @Description Pass next_cursor from the response as cursor to get the next page, it is omitted on the last page.
+// @Tags Segments
+// @Accept  json
+// @Produce  json
+// @ID list-segments
+// @Param prefix query string false "Segment name prefix"
+// @Param cursor query string false "Name of the last segment on the previous page"
+// @Param limit query int false "Page size, 100 by default, 1000 at most"
+// @Success 200 {object} responseSegmentsPage
+// @Failure 400 {object} error
+// @Failure 500 {object} error
+// @Router /v1/segments [get]
+func ListSegmentsHandler(log *slog.Logger, lister SegmentLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.v1.ListSegmentsHandler"
+
+		handlers.SetLogger(log, r.Context(), op)
+
+		limit, err := httpserver.GetLimitFromParams(w, r, log, defaultPageSize, maxPageSize)
+		if err != nil {
+			return
+		}
+
+		res, err := lister.ListSegments(r.Context(), models.ListSegmentsParams{
+			NamePrefix: usecases_segments.FormatSegmnetName(r.URL.Query().Get("prefix")),
+			AfterName:  r.URL.Query().Get("cursor"),
+			PageSize:   limit,
+		})
+		if err != nil {
+			log.Error(err.Error())
+
+			httpserver.RespondWithError(w, http.StatusInternalServerError, "Failed to get segments", log)
+			return
+		}
+
+		resp := responseSegmentsPage{
+			Segments: make([]responseSegmentWithMembers, 0, len(res)),
+		}
+		for _, item := range res {
+			resp.Segments = append(resp.Segments, transformToSegmentWithMembersResponse(item))
+		}
+		if len(res) == int(limit) {
+			resp.NextCursor = res[len(res)-1].Name
+		}
+
+		httpserver.RespondWithJSON(w, http.StatusOK, log, resp)
+	}
+}
+
+// @Summary Get a segment
+// @Description Returns a segment by its name together with the number of users currently in it
+// @Description and the number of users whose scheduled membership has not started yet.
+// @Tags Segments
+// @Accept  json
+// @Produce  json
+// @ID get-segment
+// @Param name path string true "Segment name"
+// @Success 200 {object} responseSegmentWithMembers
+// @Failure 404 {object} error
+// @Failure 500 {object} error
+// @Router /v1/segments/{name} [get]
+func GetSegmentHandler(log *slog.Logger, getter SegmentGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.v1.GetSegmentHandler"
+
+		handlers.SetLogger(log, r.Context(), op)
+
+		name := usecases_segments.FormatSegmnetName(chi.URLParam(r, "name"))
+
+		res, err := getter.GetSegmentWithMembersCount(r.Context(), name)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				httpserver.RespondWithError(w, http.StatusNotFound, "Segment does not exist", log)
+				return
+			}
+			log.Error(err.Error())
+
+			httpserver.RespondWithError(w, http.StatusInternalServerError, "Failed to get segment", log)
+			return
+		}
+
+		httpserver.RespondWithJSON(w, http.StatusOK, log, transformToSegmentWithMembersResponse(models.ListSegmentsRow(res)))
+	}
+}
+
+// @Summary Update a segment
+// @Description Updates the description and the rollout percent of a segment.
+// @Description The percent can only be raised: users already in the rollout stay in it, and a background job enrolls the new ones.
+// @Description Progress of the job is available at /v1/jobs/{jobId}.
+// @Description The name and the salt of a segment are fixed once it is created, a request with any other field is rejected.
+// @Tags Segments
+// @Accept  json
+// @Produce  json
+// @ID update-segment
+// @Param name path string true "Segment name"
+// @Param description body string false "Description"
+// @Param percent body number false "New percent of users to be assigned to the segment, not less than the current one"
+// @Success 200 {object} responseSegment
+// @Success 200 {object} responseSegmentAndJob
+// @Failure 400 {object} error
+// @Failure 404 {object} error
+// @Failure 500 {object} error
+// @Router /v1/segments/{name} [patch]
+func UpdateSegmentHandler(log *slog.Logger, updater SegmentUpdater) http.HandlerFunc {
+	type request struct {
+		Description *string  `json:"description"`
+		Percent     *float64 `json:"percent"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.v1.UpdateSegmentHandler"
+
+		handlers.SetLogger(log, r.Context(), op)
 
-		httpserver.RespondWithError(w, http.StatusInternalServerError, "Could not get users", log)
-		return nil, err
+		name := usecases_segments.FormatSegmnetName(chi.URLParam(r, "name"))
+
+		var req request
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			httpserver.RespondWithError(w, http.StatusBadRequest,
+				fmt.Sprintf("Error parsing JSON: %v, only description and percent can be updated", err), log)
+			return
+		}
+
+		log.Info("request body decoded", slog.Any("request", req))
+
+		if req.Description == nil && req.Percent == nil {
+			httpserver.RespondWithError(w, http.StatusBadRequest, "Nothing to update", log)
+			return
+		}
+
+		params := models.UpdateSegmentParams{Name: name}
+		if req.Description != nil {
+			if err := checkDescriptionLength(log, *req.Description, w); err != nil {
+				return
+			}
+			params.Description = sql.NullString{String: *req.Description, Valid: true}
+		}
+		if req.Percent != nil {
+			if *req.Percent <= 0 || *req.Percent > 100 {
+				httpserver.RespondWithError(w, http.StatusBadRequest, "Percent must be greater than 0 and at most 100", log)
+				return
+			}
+			params.RolloutPercent = sql.NullFloat64{Float64: *req.Percent, Valid: true}
+		}
+
+		var (
+			updated models.Segment
+			job     models.Job
+		)
+
+		err := updater.ExecTx(r.Context(), func(q storage.Querier) error {
+			current, err := q.GetSegmentByName(r.Context(), name)
+			if err != nil {
+				return err
+			}
+			if params.RolloutPercent.Valid && params.RolloutPercent.Float64 < current.RolloutPercent.Float64 {
+				return errPercentDecreased
+			}
+
+			updated, err = q.UpdateSegment(r.Context(), params)
+			if err != nil {
+				// The segment exists, so it is only missed when its percent has just been raised above the requested one.
+				if errors.Is(err, sql.ErrNoRows) {
+					return errPercentDecreased
+				}
+				return err
+			}
+
+			if !params.RolloutPercent.Valid || params.RolloutPercent.Float64 == current.RolloutPercent.Float64 {
+				return nil
+			}
+
+			payload, err := json.Marshal(jobs.SegmentRolloutPayload{SegmentName: updated.Name})
+			if err != nil {
+				return err
+			}
+
+			job, err = q.CreateJob(r.Context(), jobs.NewJobParams(r.Context(), jobs.KindSegmentRollout, payload))
+			return err
+		})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				httpserver.RespondWithError(w, http.StatusNotFound, "Segment does not exist", log)
+				return
+			}
+			if errors.Is(err, errPercentDecreased) {
+				httpserver.RespondWithError(w, http.StatusBadRequest,
+					"Percent can not be decreased, users already in the segment would have to be removed", log)
+				return
+			}
+			log.Error(err.Error())
+
+			httpserver.RespondWithError(w, http.StatusInternalServerError, "Could not update segment", log)
+			return
+		}
+
+		respSegm := transformToSegmentResponse(updated)
+
+		if job.ID == 0 {
+			httpserver.RespondWithJSON(w, http.StatusOK, log, respSegm)
+			return
+		}
+
+		httpserver.RespondWithJSON(w, http.StatusOK, log, responseSegmentAndJob{
+			Segment: respSegm,
+			JobID:   job.ID,
+		})
 	}
+}
+
+// @Summary Restore a deleted segment
+// @Description Restores a segment deleted within the retention period (DELETION_RETENTION).
+// @Description Users removed by the deletion are put back into it with their expiry, except for the ones that have expired meanwhile or have been deleted.
+// @Tags Segments
+// @Accept  json
+// @Produce  json
+// @ID restore-segment
+// @Param name path string true "Segment name"
+// @Success 200 {object} responseSegment
+// @Failure 404 {object} error
+// @Failure 500 {object} error
+// @Router /v1/segments/{name}/restore [post]
+func RestoreSegmentHandler(log *slog.Logger, restorer SegmentRestorer, retention time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.v1.RestoreSegmentHandler"
+
+		handlers.SetLogger(log, r.Context(), op)
+
+		name := usecases_segments.FormatSegmnetName(chi.URLParam(r, "name"))
 
-	pickedIds, err := usecases_user_segments.PickRandomIds(percent, ids)
-	if err != nil {
-		httpserver.RespondWithError(w, http.StatusBadRequest, err.Error(), log)
-		return nil, err
+		restored, err := restorer.RestoreSegment(r.Context(), models.RestoreSegmentParams{
+			Name:         name,
+			DeletedAfter: time.Now().Add(-retention).UTC(),
+		})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				httpserver.RespondWithError(w, http.StatusNotFound, "Segment was not deleted or can not be restored anymore", log)
+				return
+			}
+			log.Error(err.Error())
+
+			httpserver.RespondWithError(w, http.StatusInternalServerError, "Could not restore segment", log)
+			return
+		}
+
+		log.Info("segment restored", slog.String("name", restored.Name))
+
+		httpserver.RespondWithJSON(w, http.StatusOK, log, transformToSegmentResponse(restored))
 	}
+}
+
+// @Summary Segment stats
+// @Description Returns the number of users currently in a segment, how many of them leave it within expiring_within
+// @Description and the number of memberships added, removed and expired per day (UTC) from from to to inclusive.
+// @Description The last 30 days are returned by default, the period can not be longer than 366 days.
+// @Description Daily numbers are read from a rollup kept up to date by a background aggregator (STATS_INTERVAL).
+// @Tags Segments
+// @Accept  json
+// @Produce  json
+// @ID get-segment-stats
+// @Param name path string true "Segment name"
+// @Param from query string false "First day, 2006-01-02"
+// @Param to query string false "Last day, 2006-01-02, today by default"
+// @Param expiring_within query string false "Window of expiring memberships, 24h by default"
+// @Success 200 {object} responseSegmentStats
+// @Failure 400 {object} error
+// @Failure 404 {object} error
+// @Failure 500 {object} error
+// @Router /v1/segments/{name}/stats [get]
+func GetSegmentStatsHandler(log *slog.Logger, getter SegmentStatsGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.v1.GetSegmentStatsHandler"
+
+		handlers.SetLogger(log, r.Context(), op)
+
+		name := usecases_segments.FormatSegmnetName(chi.URLParam(r, "name"))
+		now := time.Now()
+
+		fromDay, toDay, err := usecases_segments.StatsPeriod(r.URL.Query().Get("from"), r.URL.Query().Get("to"), now)
+		if err != nil {
+			httpserver.RespondWithError(w, http.StatusBadRequest, err.Error(), log)
+			return
+		}
+
+		expiringWithin := usecases_segments.DefaultExpiringWithin
+		if s := r.URL.Query().Get("expiring_within"); s != "" {
+			expiringWithin, err = time.ParseDuration(s)
+			if err != nil || expiringWithin <= 0 {
+				httpserver.RespondWithError(w, http.StatusBadRequest, "expiring_within must be a positive duration, e.g. 24h", log)
+				return
+			}
+		}
+
+		counts, err := getter.GetSegmentMembershipCounts(r.Context(), models.GetSegmentMembershipCountsParams{
+			ExpiringBefore: now.Add(expiringWithin).UTC(),
+			SegmentName:    name,
+		})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				httpserver.RespondWithError(w, http.StatusNotFound, "Segment does not exist", log)
+				return
+			}
+			log.Error(err.Error())
+
+			httpserver.RespondWithError(w, http.StatusInternalServerError, "Failed to get segment stats", log)
+			return
+		}
 
-	var res []int64
-	for _, id := range pickedIds {
-		_, err := autoAssigner.AddUserIntoSegment(r.Context(), models.AddUserIntoSegmentParams{
-			UserID:      id,
-			SegmentName: segmentName,
+		rows, err := getter.GetSegmentDailyStats(r.Context(), models.GetSegmentDailyStatsParams{
+			SegmentName: name,
+			FromDay:     fromDay,
+			ToDay:       toDay,
 		})
 		if err != nil {
 			log.Error(err.Error())
 
-			httpserver.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Could not add user %d", id), log)
-			return nil, err
+			httpserver.RespondWithError(w, http.StatusInternalServerError, "Failed to get segment stats", log)
+			return
 		}
-		res = append(res, id)
+
+		httpserver.RespondWithJSON(w, http.StatusOK, log, responseSegmentStats{
+			Name:              name,
+			ActiveCount:       counts.ActiveCount,
+			ExpiringSoonCount: counts.ExpiringCount,
+			ExpiringWithin:    expiringWithin.String(),
+			Days:              usecases_segments.FillDailyStats(fromDay, toDay, rows),
+		})
 	}
+}
 
-	return res, nil
+func transformToSegmentResponse(segment models.Segment) responseSegment {
+	return responseSegment{
+		Name:        segment.Name,
+		Description: segment.Description.String,
+		RolloutSalt: segment.RolloutSalt,
+		Percent:     segment.RolloutPercent.Float64,
+		Created_At:  segment.CreatedAt,
+		Updated_At:  segment.UpdatedAt,
+	}
+}
+
+func transformToSegmentWithMembersResponse(row models.ListSegmentsRow) responseSegmentWithMembers {
+	return responseSegmentWithMembers{
+		responseSegment: transformToSegmentResponse(models.Segment{
+			Name:           row.Name,
+			Description:    row.Description,
+			CreatedAt:      row.CreatedAt,
+			UpdatedAt:      row.UpdatedAt,
+			RolloutSalt:    row.RolloutSalt,
+			RolloutPercent: row.RolloutPercent,
+		}),
+		MembersCount: row.MembersCount,
+		PendingCount: row.PendingCount,
+	}
 }
 
 func checkDescriptionLength(log *slog.Logger, description string, w http.ResponseWriter) error {
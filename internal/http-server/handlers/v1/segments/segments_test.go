@@ -0,0 +1,523 @@
+package segments_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/http-server/handlers/v1/segments"
+	"github.com/AlexZahvatkin/segments-users-service/internal/http-server/handlers/v1/segments/mocks"
+	"github.com/AlexZahvatkin/segments-users-service/internal/jobs"
+	slogdiscard "github.com/AlexZahvatkin/segments-users-service/internal/lib/logger/handlers"
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+	storagemocks "github.com/AlexZahvatkin/segments-users-service/internal/storage/mocks"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddSegmentHandler(t *testing.T) {
+	cases := []struct {
+		name        string
+		requestBody string
+		statusCode  int
+	}{
+		{
+			name:        "Segment added",
+			requestBody: `{"name": "test segment"}`,
+			statusCode:  http.StatusCreated,
+		},
+		{
+			name:        "Name of digits only",
+			requestBody: `{"name": "12345"}`,
+			statusCode:  http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			querierMock := storagemocks.NewQuerier(t)
+			querierMock.On("AddSegment", mock.Anything, mock.MatchedBy(func(arg models.AddSegmentParams) bool {
+				return arg.Name == "TEST_SEGMENT"
+			})).Return(models.Segment{Name: "TEST_SEGMENT"}, nil).Maybe()
+
+			adderMock := mocks.NewSegmentAdder(t)
+			adderMock.On("GetSegmentByName", mock.Anything, mock.Anything).Return(models.Segment{}, sql.ErrNoRows).Maybe()
+			adderMock.On("ExecTx", mock.Anything, mock.Anything).Return(
+				func(_ context.Context, fn func(storage.Querier) error) error {
+					return fn(querierMock)
+				}).Maybe()
+
+			handler := segments.AddSegmentHandler(slogdiscard.NewDiscardLogger(), adderMock)
+			req, err := http.NewRequest(http.MethodPost, "/segments", bytes.NewReader([]byte(tc.requestBody)))
+			require.NoError(t, err)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tc.statusCode, rr.Code)
+		})
+	}
+}
+
+func TestDeleteSegmentHandler(t *testing.T) {
+	cases := []struct {
+		name       string
+		query      string
+		statusCode int
+	}{
+		{
+			name:       "Deleted synchronously",
+			query:      "?name=TEST_SEGMENT",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Deletion job enqueued",
+			query:      "?name=TEST_SEGMENT&async=true",
+			statusCode: http.StatusAccepted,
+		},
+		{
+			name:       "Name is normalized",
+			query:      "?name=test+segment",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "No name",
+			query:      "",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			deleterMock := mocks.NewSegmentDeleter(t)
+			deleterMock.On("GetSegmentByName", mock.Anything, "TEST_SEGMENT").Return(models.Segment{}, nil).Maybe()
+			deleterMock.On("DeleteSegment", mock.Anything, "TEST_SEGMENT").Return(nil).Maybe()
+			deleterMock.On("CreateJob", mock.Anything, mock.MatchedBy(func(arg models.CreateJobParams) bool {
+				return arg.Kind == jobs.KindSegmentDeletion
+			})).Return(models.Job{ID: 1}, nil).Maybe()
+
+			handler := segments.DeleteSegmentHandler(slogdiscard.NewDiscardLogger(), deleterMock)
+			req, err := http.NewRequest(http.MethodDelete, "/segments"+tc.query, nil)
+			require.NoError(t, err)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tc.statusCode, rr.Code)
+		})
+	}
+}
+
+func TestListSegmentsHandler(t *testing.T) {
+	cases := []struct {
+		name       string
+		query      string
+		params     models.ListSegmentsParams
+		rows       []models.ListSegmentsRow
+		nextCursor string
+		statusCode int
+	}{
+		{
+			name:       "Full page has a cursor",
+			query:      "?prefix=avito&limit=2",
+			params:     models.ListSegmentsParams{NamePrefix: "AVITO", PageSize: 2},
+			rows:       []models.ListSegmentsRow{{Name: "AVITO_A", MembersCount: 3, PendingCount: 2}, {Name: "AVITO_B"}},
+			nextCursor: "AVITO_B",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Last page",
+			query:      "?cursor=AVITO_B",
+			params:     models.ListSegmentsParams{AfterName: "AVITO_B", PageSize: 100},
+			rows:       []models.ListSegmentsRow{{Name: "AVITO_C"}},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Limit too big",
+			query:      "?limit=100000",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			listerMock := mocks.NewSegmentLister(t)
+			listerMock.On("ListSegments", mock.Anything, tc.params).Return(tc.rows, nil).Maybe()
+
+			handler := segments.ListSegmentsHandler(slogdiscard.NewDiscardLogger(), listerMock)
+			req, err := http.NewRequest(http.MethodGet, "/segments"+tc.query, nil)
+			require.NoError(t, err)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tc.statusCode, rr.Code)
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Segments []struct {
+					Name         string `json:"name"`
+					MembersCount int64  `json:"members_count"`
+					PendingCount int64  `json:"pending_count"`
+				} `json:"segments"`
+				NextCursor string `json:"next_cursor"`
+			}
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			require.Len(t, resp.Segments, len(tc.rows))
+			require.Equal(t, tc.rows[0].MembersCount, resp.Segments[0].MembersCount)
+			require.Equal(t, tc.rows[0].PendingCount, resp.Segments[0].PendingCount)
+			require.Equal(t, tc.nextCursor, resp.NextCursor)
+		})
+	}
+}
+
+func TestGetSegmentHandler(t *testing.T) {
+	cases := []struct {
+		name       string
+		err        error
+		statusCode int
+	}{
+		{
+			name:       "Segment exists",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Segment does not exist",
+			err:        sql.ErrNoRows,
+			statusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			getterMock := mocks.NewSegmentGetter(t)
+			getterMock.On("GetSegmentWithMembersCount", mock.Anything, "TEST_SEGMENT").
+				Return(models.GetSegmentWithMembersCountRow{Name: "TEST_SEGMENT"}, tc.err)
+
+			handler := segments.GetSegmentHandler(slogdiscard.NewDiscardLogger(), getterMock)
+			req, err := http.NewRequest(http.MethodGet, "/segments/test_segment", nil)
+			require.NoError(t, err)
+			req = withNameParam(req, "test_segment")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tc.statusCode, rr.Code)
+		})
+	}
+}
+
+func TestUpdateSegmentHandler(t *testing.T) {
+	cases := []struct {
+		name        string
+		requestBody string
+		percent     sql.NullFloat64
+		err         error
+		updateErr   error
+		statusCode  int
+		jobID       int64
+	}{
+		{
+			name:        "Description updated",
+			requestBody: `{"description": "new"}`,
+			statusCode:  http.StatusOK,
+		},
+		{
+			name:        "Nothing to update",
+			requestBody: `{}`,
+			statusCode:  http.StatusBadRequest,
+		},
+		{
+			name:        "Salt can not be updated",
+			requestBody: `{"description": "new", "salt": "other"}`,
+			statusCode:  http.StatusBadRequest,
+		},
+		{
+			name:        "Percent raised",
+			requestBody: `{"percent": 20}`,
+			percent:     sql.NullFloat64{Float64: 10, Valid: true},
+			statusCode:  http.StatusOK,
+			jobID:       7,
+		},
+		{
+			name:        "Percent set on a segment without rollout",
+			requestBody: `{"description": "new", "percent": 20}`,
+			statusCode:  http.StatusOK,
+			jobID:       7,
+		},
+		{
+			name:        "Percent unchanged",
+			requestBody: `{"percent": 20}`,
+			percent:     sql.NullFloat64{Float64: 20, Valid: true},
+			statusCode:  http.StatusOK,
+		},
+		{
+			name:        "Percent decreased",
+			requestBody: `{"percent": 20}`,
+			percent:     sql.NullFloat64{Float64: 30, Valid: true},
+			statusCode:  http.StatusBadRequest,
+		},
+		{
+			name:        "Percent raised concurrently",
+			requestBody: `{"percent": 20}`,
+			percent:     sql.NullFloat64{Float64: 10, Valid: true},
+			updateErr:   sql.ErrNoRows,
+			statusCode:  http.StatusBadRequest,
+		},
+		{
+			name:        "Wrong percent",
+			requestBody: `{"percent": 120}`,
+			statusCode:  http.StatusBadRequest,
+		},
+		{
+			name:        "Segment does not exist",
+			requestBody: `{"description": "new"}`,
+			err:         sql.ErrNoRows,
+			statusCode:  http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			querierMock := storagemocks.NewQuerier(t)
+			querierMock.On("GetSegmentByName", mock.Anything, "TEST_SEGMENT").
+				Return(models.Segment{Name: "TEST_SEGMENT", RolloutPercent: tc.percent}, tc.err).Maybe()
+			querierMock.On("UpdateSegment", mock.Anything, mock.MatchedBy(func(arg models.UpdateSegmentParams) bool {
+				return arg.Name == "TEST_SEGMENT"
+			})).Return(models.Segment{Name: "TEST_SEGMENT"}, tc.updateErr).Maybe()
+			querierMock.On("CreateJob", mock.Anything, mock.MatchedBy(func(arg models.CreateJobParams) bool {
+				return arg.Kind == jobs.KindSegmentRollout && string(arg.Payload) == `{"segment_name":"TEST_SEGMENT"}`
+			})).Return(models.Job{ID: tc.jobID}, nil).Maybe()
+
+			updaterMock := mocks.NewSegmentUpdater(t)
+			updaterMock.On("ExecTx", mock.Anything, mock.Anything).Return(
+				func(_ context.Context, fn func(storage.Querier) error) error {
+					return fn(querierMock)
+				}).Maybe()
+
+			handler := segments.UpdateSegmentHandler(slogdiscard.NewDiscardLogger(), updaterMock)
+			req, err := http.NewRequest(http.MethodPatch, "/segments/test_segment", bytes.NewReader([]byte(tc.requestBody)))
+			require.NoError(t, err)
+			req = withNameParam(req, "test segment")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tc.statusCode, rr.Code)
+
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+			var resp struct {
+				JobID int64 `json:"job_id"`
+			}
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+			require.Equal(t, tc.jobID, resp.JobID)
+		})
+	}
+}
+
+func TestRestoreSegmentHandler(t *testing.T) {
+	cases := []struct {
+		name       string
+		err        error
+		statusCode int
+	}{
+		{
+			name:       "Segment restored",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Segment was not deleted or is purged",
+			err:        sql.ErrNoRows,
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "Restore fails",
+			err:        errors.New("restore failed"),
+			statusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			// Only segments deleted within the last day can be restored.
+			restorerMock := mocks.NewSegmentRestorer(t)
+			restorerMock.On("RestoreSegment", mock.Anything, mock.MatchedBy(func(arg models.RestoreSegmentParams) bool {
+				return arg.Name == "TEST_SEGMENT" && time.Since(arg.DeletedAfter) >= 24*time.Hour &&
+					time.Since(arg.DeletedAfter) < 25*time.Hour
+			})).Return(models.Segment{Name: "TEST_SEGMENT"}, tc.err)
+
+			handler := segments.RestoreSegmentHandler(slogdiscard.NewDiscardLogger(), restorerMock, 24*time.Hour)
+			req, err := http.NewRequest(http.MethodPost, "/segments/test_segment/restore", nil)
+			require.NoError(t, err)
+			req = withNameParam(req, "test_segment")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tc.statusCode, rr.Code)
+		})
+	}
+}
+
+func TestGetSegmentStatsHandler(t *testing.T) {
+	day := func(s string) time.Time {
+		d, err := time.Parse("2006-01-02", s)
+		require.NoError(t, err)
+		return d
+	}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	cases := []struct {
+		name       string
+		segment    string
+		query      string
+		countsErr  error
+		statsErr   error
+		rows       []models.GetSegmentDailyStatsRow
+		fromDay    time.Time
+		toDay      time.Time
+		statusCode int
+		days       []map[string]any
+	}{
+		{
+			name:       "Last 30 days by default",
+			fromDay:    today.AddDate(0, 0, -29),
+			toDay:      today.AddDate(0, 0, 1),
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Segment name is normalized",
+			segment:    "test segment",
+			fromDay:    today.AddDate(0, 0, -29),
+			toDay:      today.AddDate(0, 0, 1),
+			statusCode: http.StatusOK,
+		},
+		{
+			name:  "Days without changes are zero",
+			query: "?from=2023-09-01&to=2023-09-03&expiring_within=1h",
+			rows: []models.GetSegmentDailyStatsRow{
+				{Day: day("2023-09-01"), Added: 3, Removed: 1},
+				{Day: day("2023-09-03"), Expired: 2},
+			},
+			fromDay:    day("2023-09-01"),
+			toDay:      day("2023-09-04"),
+			statusCode: http.StatusOK,
+			days: []map[string]any{
+				{"date": "2023-09-01", "added": float64(3), "removed": float64(1), "expired": float64(0)},
+				{"date": "2023-09-02", "added": float64(0), "removed": float64(0), "expired": float64(0)},
+				{"date": "2023-09-03", "added": float64(0), "removed": float64(0), "expired": float64(2)},
+			},
+		},
+		{
+			name:       "Wrong date format",
+			query:      "?from=01.09.2023",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "From after to",
+			query:      "?from=2023-09-02&to=2023-09-01",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Period too long",
+			query:      "?from=2022-01-01&to=2023-09-01",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Wrong expiring window",
+			query:      "?expiring_within=tomorrow",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Segment does not exist",
+			countsErr:  sql.ErrNoRows,
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "Stats query fails",
+			fromDay:    today.AddDate(0, 0, -29),
+			toDay:      today.AddDate(0, 0, 1),
+			statsErr:   errors.New("db is down"),
+			statusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			getterMock := mocks.NewSegmentStatsGetter(t)
+			getterMock.On("GetSegmentMembershipCounts", mock.Anything, mock.MatchedBy(func(arg models.GetSegmentMembershipCountsParams) bool {
+				return arg.SegmentName == "TEST_SEGMENT" && arg.ExpiringBefore.After(time.Now())
+			})).Return(models.GetSegmentMembershipCountsRow{ActiveCount: 10, ExpiringCount: 4}, tc.countsErr).Maybe()
+			getterMock.On("GetSegmentDailyStats", mock.Anything, models.GetSegmentDailyStatsParams{
+				SegmentName: "TEST_SEGMENT",
+				FromDay:     tc.fromDay,
+				ToDay:       tc.toDay,
+			}).Return(tc.rows, tc.statsErr).Maybe()
+
+			segment := tc.segment
+			if segment == "" {
+				segment = "TEST_SEGMENT"
+			}
+
+			handler := segments.GetSegmentStatsHandler(slogdiscard.NewDiscardLogger(), getterMock)
+			req, err := http.NewRequest(http.MethodGet, "/segments/"+url.PathEscape(segment)+"/stats"+tc.query, nil)
+			require.NoError(t, err)
+			req = withNameParam(req, segment)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tc.statusCode, rr.Code)
+
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				ActiveCount       int64            `json:"active_count"`
+				ExpiringSoonCount int64            `json:"expiring_soon_count"`
+				Days              []map[string]any `json:"days"`
+			}
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+			require.Equal(t, int64(10), resp.ActiveCount)
+			require.Equal(t, int64(4), resp.ExpiringSoonCount)
+			require.Len(t, resp.Days, int(tc.toDay.Sub(tc.fromDay)/(24*time.Hour)))
+			if tc.days != nil {
+				require.Equal(t, tc.days, resp.Days)
+			}
+		})
+	}
+}
+
+func withNameParam(req *http.Request, name string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("name", name)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
@@ -5,7 +5,7 @@ package mocks
 import (
 	context "context"
 
-	models "github.com/AlexZahvatkin/segments-users-service/internal/models"
+	storage "github.com/AlexZahvatkin/segments-users-service/internal/storage"
 	mock "github.com/stretchr/testify/mock"
 )
 
@@ -14,28 +14,18 @@ type UserAdder struct {
 	mock.Mock
 }
 
-// AddUser provides a mock function with given fields: _a0, _a1
-func (_m *UserAdder) AddUser(_a0 context.Context, _a1 string) (models.User, error) {
-	ret := _m.Called(_a0, _a1)
+// ExecTx provides a mock function with given fields: ctx, fn
+func (_m *UserAdder) ExecTx(ctx context.Context, fn func(storage.Querier) error) error {
+	ret := _m.Called(ctx, fn)
 
-	var r0 models.User
-	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) (models.User, error)); ok {
-		return rf(_a0, _a1)
-	}
-	if rf, ok := ret.Get(0).(func(context.Context, string) models.User); ok {
-		r0 = rf(_a0, _a1)
-	} else {
-		r0 = ret.Get(0).(models.User)
-	}
-
-	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(_a0, _a1)
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, func(storage.Querier) error) error); ok {
+		r0 = rf(ctx, fn)
 	} else {
-		r1 = ret.Error(1)
+		r0 = ret.Error(0)
 	}
 
-	return r0, r1
+	return r0
 }
 
 // NewUserAdder creates a new instance of UserAdder. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
@@ -28,6 +28,30 @@ func (_m *UserDeleter) DeleteUser(_a0 context.Context, _a1 int64) error {
 	return r0
 }
 
+// GetUserByExternalId provides a mock function with given fields: ctx, externalID
+func (_m *UserDeleter) GetUserByExternalId(ctx context.Context, externalID string) (models.User, error) {
+	ret := _m.Called(ctx, externalID)
+
+	var r0 models.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (models.User, error)); ok {
+		return rf(ctx, externalID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) models.User); ok {
+		r0 = rf(ctx, externalID)
+	} else {
+		r0 = ret.Get(0).(models.User)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, externalID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetUserById provides a mock function with given fields: _a0, _a1
 func (_m *UserDeleter) GetUserById(_a0 context.Context, _a1 int64) (models.User, error) {
 	ret := _m.Called(_a0, _a1)
@@ -0,0 +1,55 @@
+// Code generated by mockery v2.33.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	models "github.com/AlexZahvatkin/segments-users-service/internal/models"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// UserLister is an autogenerated mock type for the UserLister type
+type UserLister struct {
+	mock.Mock
+}
+
+// ListUsers provides a mock function with given fields: ctx, arg
+func (_m *UserLister) ListUsers(ctx context.Context, arg models.ListUsersParams) ([]models.User, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 []models.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.ListUsersParams) ([]models.User, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.ListUsersParams) []models.User); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.User)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.ListUsersParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewUserLister creates a new instance of UserLister. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewUserLister(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *UserLister {
+	mock := &UserLister{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,53 @@
+// Code generated by mockery v2.33.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	models "github.com/AlexZahvatkin/segments-users-service/internal/models"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// UserRestorer is an autogenerated mock type for the UserRestorer type
+type UserRestorer struct {
+	mock.Mock
+}
+
+// RestoreUser provides a mock function with given fields: ctx, arg
+func (_m *UserRestorer) RestoreUser(ctx context.Context, arg models.RestoreUserParams) (models.User, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 models.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.RestoreUserParams) (models.User, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.RestoreUserParams) models.User); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(models.User)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.RestoreUserParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewUserRestorer creates a new instance of UserRestorer. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewUserRestorer(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *UserRestorer {
+	mock := &UserRestorer{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
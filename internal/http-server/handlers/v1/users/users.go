@@ -2,34 +2,78 @@ package users
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/AlexZahvatkin/segments-users-service/internal/http-server"
 	"github.com/AlexZahvatkin/segments-users-service/internal/http-server/handlers"
 	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+	"github.com/AlexZahvatkin/segments-users-service/internal/use-cases/users"
 	"github.com/go-playground/validator/v10"
 )
 
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
 //go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=UserAdder
 type UserAdder interface {
-	AddUser(context.Context, string) (models.User, error)
+	storage.Transactor
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=UserGetter
+type UserGetter interface {
+	handlers.UserResolver
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=UserLister
+type UserLister interface {
+	ListUsers(ctx context.Context, arg models.ListUsersParams) ([]models.User, error)
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=UserUpdater
+type UserUpdater interface {
+	UpdateUser(ctx context.Context, arg models.UpdateUserParams) (models.User, error)
+	handlers.UserResolver
+}
+
+type responseUserWithSegments struct {
+	models.User
+	Segments []string `json:"segments,omitempty"`
+}
+
+type responseUsersPage struct {
+	Users      []models.User `json:"users"`
+	NextCursor int64         `json:"next_cursor,omitempty"`
 }
 
 // @Summary Add new user
-// @Description Creates new user with a given name
+// @Description Creates new user with a given name.
+// @Description The user is enrolled into every percentage segment whose rollout covers them.
 // @Tags Users
 // @Accept  json
 // @Produce  json
 // @ID create-user
 // @Param name body string true "User name"
-// @Success 201 {object} models.User
+// @Param external_id body string false "Unique user id in an upstream system"
+// @Success 201 {object} responseUserWithSegments
 // @Failure 400 {object} error
+// @Failure 409 {object} error
 // @Failure 500 {object} error
 // @Router /v1/users [post]
 func AddUserHandler(log *slog.Logger, userAdder UserAdder) http.HandlerFunc {
 	type request struct {
-		Name string `json:"name" validate:"required,min=4,max=255"`
+		Name       string  `json:"name" validate:"required,min=4,max=255"`
+		ExternalID *string `json:"external_id" validate:"omitempty,min=1,max=255"`
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -49,58 +93,411 @@ func AddUserHandler(log *slog.Logger, userAdder UserAdder) http.HandlerFunc {
 			return
 		}
 
-		user, err := userAdder.AddUser(r.Context(), req.Name)
+		var resp responseUserWithSegments
+
+		err = userAdder.ExecTx(r.Context(), func(q storage.Querier) error {
+			user, err := q.AddUser(r.Context(), models.AddUserParams{
+				Name:       req.Name,
+				ExternalID: req.ExternalID,
+			})
+			if err != nil {
+				return err
+			}
+			resp.User = user
+
+			added, err := usecases_users.EnrollIntoRolloutSegments(r.Context(), q, user.ID)
+			if err != nil {
+				return err
+			}
+			for _, item := range added {
+				resp.Segments = append(resp.Segments, item.SegmentName)
+			}
+
+			return nil
+		})
 		if err != nil {
+			if storage.IsUniqueViolation(err) {
+				httpserver.RespondWithError(w, http.StatusConflict, "User with such external id already exists", log)
+				return
+			}
 			log.Error(err.Error())
 
 			httpserver.RespondWithError(w, http.StatusInternalServerError, "Could not create user:", log)
 			return
 		}
 
-		httpserver.RespondWithJSON(w, http.StatusCreated, log, user)
+		httpserver.RespondWithJSON(w, http.StatusCreated, log, resp)
 	}
 }
 
 //go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=UserDeleter
 type UserDeleter interface {
 	DeleteUser(context.Context, int64) error
-	GetUserById(context.Context, int64) (models.User, error)
+	handlers.UserResolver
 }
 
 // @Summary Delete user
-// @Description Deletes user with a given id
+// @Description Deletes user with a given id. The user is removed from all segments, which is recorded in the history as user_deleted,
+// @Description and is hidden until it is restored with /v1/users/{id}/restore or purged after the retention period.
 // @Tags Users
 // @Accept  json
 // @Produce  json
 // @ID delete-user
-// @Param id path int true "User ID"
+// @Param id path string true "User ID or ext:<external id>"
 // @Success 200
 // @Failure 400 {object} error
+// @Failure 404 {object} error
 // @Failure 500 {object} error
-// @Router /v1/users [delete]
+// @Router /v1/users/{id} [delete]
 func DeleteUserHandler(log *slog.Logger, userDeleter UserDeleter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.v1.DeleteUserHandler"
 
 		handlers.SetLogger(log, r.Context(), op)
 
-		userId, err := httpserver.GetUserIdFromParams(w, r, log)
+		user, ok := handlers.ResolveUser(w, r, log, userDeleter)
+		if !ok {
+			return
+		}
+
+		if err := userDeleter.DeleteUser(r.Context(), user.ID); err != nil {
+			log.Error(err.Error())
+
+			httpserver.RespondWithError(w, http.StatusInternalServerError, "Could not delete user:", log)
+			return
+		}
+
+		httpserver.RespondWithJSON(w, http.StatusOK, log, struct{}{})
+	}
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=UserRestorer
+type UserRestorer interface {
+	RestoreUser(ctx context.Context, arg models.RestoreUserParams) (models.User, error)
+}
+
+// @Summary Restore a deleted user
+// @Description Restores a user deleted within the retention period (DELETION_RETENTION).
+// @Description The user is put back into the segments they were removed from by the deletion, except for the expired or deleted ones.
+// @Tags Users
+// @Accept  json
+// @Produce  json
+// @ID restore-user
+// @Param id path string true "User ID or ext:<external id>"
+// @Success 200 {object} models.User
+// @Failure 400 {object} error
+// @Failure 404 {object} error
+// @Failure 500 {object} error
+// @Router /v1/users/{id}/restore [post]
+func RestoreUserHandler(log *slog.Logger, restorer UserRestorer, retention time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.v1.RestoreUserHandler"
+
+		handlers.SetLogger(log, r.Context(), op)
+
+		ref, err := httpserver.GetUserRefFromParams(w, r, log)
+		if err != nil {
+			return
+		}
+
+		arg := models.RestoreUserParams{
+			ID:           ref.ID,
+			DeletedAfter: time.Now().Add(-retention).UTC(),
+		}
+		if ref.IsExternal() {
+			arg.ExternalID = &ref.ExternalID
+		}
+
+		user, err := restorer.RestoreUser(r.Context(), arg)
 		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				httpserver.RespondWithError(w, http.StatusNotFound, fmt.Sprintf("User %s was not deleted or can not be restored anymore", ref), log)
+				return
+			}
+			log.Error(err.Error())
+
+			httpserver.RespondWithError(w, http.StatusInternalServerError, "Could not restore user", log)
 			return
 		}
 
-		if _, err := userDeleter.GetUserById(r.Context(), userId); err != nil {
-			httpserver.RespondWithError(w, http.StatusBadRequest, "Invalid user id", log)
+		log.Info("user restored", slog.Int64("id", user.ID))
+
+		httpserver.RespondWithJSON(w, http.StatusOK, log, user)
+	}
+}
+
+// @Summary Get user
+// @Description Returns user with a given id
+// @Tags Users
+// @Accept  json
+// @Produce  json
+// @ID get-user
+// @Param id path string true "User ID or ext:<external id>"
+// @Success 200 {object} models.User
+// @Failure 400 {object} error
+// @Failure 404 {object} error
+// @Failure 500 {object} error
+// @Router /v1/users/{id} [get]
+func GetUserHandler(log *slog.Logger, userGetter UserGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.v1.GetUserHandler"
+
+		handlers.SetLogger(log, r.Context(), op)
+
+		user, ok := handlers.ResolveUser(w, r, log, userGetter)
+		if !ok {
 			return
 		}
 
-		if err = userDeleter.DeleteUser(r.Context(), userId); err != nil {
+		httpserver.RespondWithJSON(w, http.StatusOK, log, user)
+	}
+}
+
+// @Summary List users
+// @Description Returns users ordered by id. Pass next_cursor from the response as cursor to get the next page, it is omitted on the last page.
+// @Tags Users
+// @Accept  json
+// @Produce  json
+// @ID list-users
+// @Param name query string false "Case insensitive substring of the user name"
+// @Param cursor query int false "Id of the last user on the previous page"
+// @Param limit query int false "Page size, 100 by default, 1000 at most"
+// @Success 200 {object} responseUsersPage
+// @Failure 400 {object} error
+// @Failure 500 {object} error
+// @Router /v1/users [get]
+func ListUsersHandler(log *slog.Logger, userLister UserLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.v1.ListUsersHandler"
+
+		handlers.SetLogger(log, r.Context(), op)
+
+		limit, err := httpserver.GetLimitFromParams(w, r, log, defaultPageSize, maxPageSize)
+		if err != nil {
+			return
+		}
+
+		var afterId int64
+		if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+			afterId, err = strconv.ParseInt(cursor, 10, 64)
+			if err != nil {
+				httpserver.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Cursor must be a number: %v", err), log)
+				return
+			}
+		}
+
+		res, err := userLister.ListUsers(r.Context(), models.ListUsersParams{
+			AfterID:   afterId,
+			NameQuery: r.URL.Query().Get("name"),
+			PageSize:  limit,
+		})
+		if err != nil {
 			log.Error(err.Error())
 
-			httpserver.RespondWithError(w, http.StatusInternalServerError, "Could not delete user:", log)
+			httpserver.RespondWithError(w, http.StatusInternalServerError, "Failed to get users", log)
 			return
 		}
 
-		httpserver.RespondWithJSON(w, http.StatusOK, log, struct{}{})
+		resp := responseUsersPage{
+			Users: res,
+		}
+		if resp.Users == nil {
+			resp.Users = []models.User{}
+		}
+		if len(res) == int(limit) {
+			resp.NextCursor = res[len(res)-1].ID
+		}
+
+		httpserver.RespondWithJSON(w, http.StatusOK, log, resp)
+	}
+}
+
+// @Summary Update user
+// @Description Renames a user with a given id or sets their external id. Fields that are not passed are left unchanged.
+// @Description An empty external_id clears it.
+// @Tags Users
+// @Accept  json
+// @Produce  json
+// @ID update-user
+// @Param id path string true "User ID or ext:<external id>"
+// @Param name body string false "User name"
+// @Param external_id body string false "Unique user id in an upstream system, empty to clear it"
+// @Success 200 {object} models.User
+// @Failure 400 {object} error
+// @Failure 404 {object} error
+// @Failure 409 {object} error
+// @Failure 500 {object} error
+// @Router /v1/users/{id} [patch]
+func UpdateUserHandler(log *slog.Logger, userUpdater UserUpdater) http.HandlerFunc {
+	type request struct {
+		Name       *string `json:"name" validate:"omitempty,min=4,max=255"`
+		ExternalID *string `json:"external_id" validate:"omitempty,max=255"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.v1.UpdateUserHandler"
+
+		handlers.SetLogger(log, r.Context(), op)
+
+		req, err := httpserver.DecodeRequsetBody(w, r, request{}, log)
+		if err != nil {
+			return
+		}
+
+		log.Info("request body decoded", slog.Any("request", req))
+
+		if err := validator.New().Struct(req); err != nil {
+			httpserver.RespondWithValidateError(w, log, err)
+			return
+		}
+
+		if req.Name == nil && req.ExternalID == nil {
+			httpserver.RespondWithError(w, http.StatusBadRequest, "Nothing to update", log)
+			return
+		}
+
+		ref, err := httpserver.GetUserRefFromParams(w, r, log)
+		if err != nil {
+			return
+		}
+
+		user, ok := handlers.LoadUser(w, r, log, userUpdater, ref)
+		if !ok {
+			return
+		}
+
+		user, err = userUpdater.UpdateUser(r.Context(), models.UpdateUserParams{
+			Name:       req.Name,
+			ExternalID: req.ExternalID,
+			ID:         user.ID,
+		})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				httpserver.RespondWithError(w, http.StatusNotFound, fmt.Sprintf("User %s does not exist", ref), log)
+				return
+			}
+			if storage.IsUniqueViolation(err) {
+				httpserver.RespondWithError(w, http.StatusConflict, "User with such external id already exists", log)
+				return
+			}
+			log.Error(err.Error())
+
+			httpserver.RespondWithError(w, http.StatusInternalServerError, "Could not update user", log)
+			return
+		}
+
+		httpserver.RespondWithJSON(w, http.StatusOK, log, user)
+	}
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=UsersImporter
+type UsersImporter interface {
+	storage.UserImporter
+}
+
+// @Summary Import users
+// @Description Creates users from a CSV (Content-Type: text/csv) or NDJSON (Content-Type: application/x-ndjson) upload.
+// @Description CSV columns are name, external_id and segments, e.g. "AVITO_VOICE_MESSAGES;AVITO_DISCOUNT_30:24" (TTL in hours), the header is optional.
+// @Description NDJSON lines look like {"name": "...", "external_id": "...", "segments": [{"name": "...", "ttl": 24}]}.
+// @Description The import is all or nothing: if any row is invalid, nothing is written and the errors are returned with line numbers.
+// @Description With dry_run=true the file is only validated.
+// @Description The file is received in full before the import starts, its size is capped by USERS_IMPORT_MAX_SIZE.
+// @Tags Users
+// @Accept  text/csv,application/x-ndjson
+// @Produce  json
+// @ID import-users
+// @Param dry_run query bool false "Validate the file without writing anything"
+// @Success 200 {object} models.ImportUsersResult
+// @Success 201 {object} models.ImportUsersResult
+// @Failure 408 {object} error
+// @Failure 413 {object} error
+// @Failure 415 {object} error
+// @Failure 422 {object} models.ImportUsersResult
+// @Failure 500 {object} error
+// @Router /v1/users:import [post]
+func ImportUsersHandler(log *slog.Logger, importer UsersImporter, maxSize int64, uploadTimeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.v1.ImportUsersHandler"
+
+		handlers.SetLogger(log, r.Context(), op)
+
+		var format string
+		switch httpserver.GetRequestFormat(r) {
+		case httpserver.FormatCSV:
+			format = usecases_users.ImportFormatCSV
+		case httpserver.FormatNDJSON:
+			format = usecases_users.ImportFormatNDJSON
+		default:
+			httpserver.RespondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be text/csv or application/x-ndjson", log)
+			return
+		}
+		dryRun := r.URL.Query().Get("dry_run") == "true"
+
+		// Server timeouts are meant for regular requests and would cut a large upload,
+		// so the upload gets its own deadline and the response waits for the import.
+		rc := http.NewResponseController(w)
+		_ = rc.SetReadDeadline(time.Now().Add(uploadTimeout))
+		_ = rc.SetWriteDeadline(time.Time{})
+
+		// The file is received in full before the import transaction is opened,
+		// so a slow client does not keep it open.
+		file, err := spoolUpload(http.MaxBytesReader(w, r.Body, maxSize))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				httpserver.RespondWithError(w, http.StatusRequestEntityTooLarge,
+					fmt.Sprintf("Import file must be at most %d bytes", maxSize), log)
+				return
+			}
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				httpserver.RespondWithError(w, http.StatusRequestTimeout,
+					fmt.Sprintf("Import file must be uploaded within %s", uploadTimeout), log)
+				return
+			}
+			log.Error(err.Error())
+
+			httpserver.RespondWithError(w, http.StatusInternalServerError, "Could not receive import file", log)
+			return
+		}
+		defer func() {
+			file.Close()
+			os.Remove(file.Name())
+		}()
+
+		res, err := usecases_users.ImportUsers(r.Context(), importer, file, format, dryRun)
+		if err != nil {
+			log.Error(err.Error())
+
+			httpserver.RespondWithError(w, http.StatusInternalServerError, "Could not import users", log)
+			return
+		}
+
+		log.Info("users import finished", slog.Int64("users", res.Users), slog.Int("errors", len(res.Errors)), slog.Bool("dry_run", dryRun))
+
+		switch {
+		case len(res.Errors) > 0:
+			httpserver.RespondWithJSON(w, http.StatusUnprocessableEntity, log, res)
+		case dryRun:
+			httpserver.RespondWithJSON(w, http.StatusOK, log, res)
+		default:
+			httpserver.RespondWithJSON(w, http.StatusCreated, log, res)
+		}
+	}
+}
+
+// spoolUpload copies an upload into a temporary file and rewinds it.
+func spoolUpload(body io.Reader) (*os.File, error) {
+	file, err := os.CreateTemp("", "users-import-*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.Copy(file, body); err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
 	}
+	return file, nil
 }
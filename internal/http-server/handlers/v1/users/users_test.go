@@ -2,14 +2,23 @@ package users_test
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/AlexZahvatkin/segments-users-service/internal/http-server/handlers/v1/users"
 	"github.com/AlexZahvatkin/segments-users-service/internal/http-server/handlers/v1/users/mocks"
 	slogdiscard "github.com/AlexZahvatkin/segments-users-service/internal/lib/logger/handlers"
 	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+	storagemocks "github.com/AlexZahvatkin/segments-users-service/internal/storage/mocks"
+	"github.com/go-chi/chi"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
@@ -43,8 +52,17 @@ func TestAddUserHandler(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
 
+			querierMock := storagemocks.NewQuerier(t)
+			querierMock.On("AddUser", mock.Anything, mock.Anything).Return(models.User{ID: 1}, nil).Maybe()
+			querierMock.On("SetHistoryAction", mock.Anything, models.ActionAutoAssigned).Return(nil).Maybe()
+			querierMock.On("SetHistoryAction", mock.Anything, "").Return(nil).Maybe()
+			querierMock.On("AddUserIntoRolloutSegments", mock.Anything, int64(1)).Return([]models.UsersInSegment{}, nil).Maybe()
+
 			userAdderMock := mocks.NewUserAdder(t)
-			userAdderMock.On("AddUser", mock.Anything, mock.Anything).Return(models.User{}, nil).Maybe()
+			userAdderMock.On("ExecTx", mock.Anything, mock.Anything).Return(
+				func(_ context.Context, fn func(storage.Querier) error) error {
+					return fn(querierMock)
+				}).Maybe()
 
 			handler := users.AddUserHandler(slogdiscard.NewDiscardLogger(), userAdderMock)
 			req, err := http.NewRequest(http.MethodPost, "/users", bytes.NewReader([]byte(tc.requestBody)))
@@ -55,3 +73,356 @@ func TestAddUserHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestDeleteUserHandler(t *testing.T) {
+	cases := []struct {
+		name       string
+		getErr     error
+		statusCode int
+	}{
+		{
+			name:       "User deleted",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "User does not exist",
+			getErr:     sql.ErrNoRows,
+			statusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			userDeleterMock := mocks.NewUserDeleter(t)
+			userDeleterMock.On("GetUserById", mock.Anything, int64(1)).Return(models.User{ID: 1}, tc.getErr)
+			userDeleterMock.On("DeleteUser", mock.Anything, int64(1)).Return(nil).Maybe()
+
+			handler := users.DeleteUserHandler(slogdiscard.NewDiscardLogger(), userDeleterMock)
+			req, err := http.NewRequest(http.MethodDelete, "/users/1", nil)
+			require.NoError(t, err)
+			req = withUserIdParam(req, "1")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tc.statusCode, rr.Code)
+		})
+	}
+}
+
+func TestRestoreUserHandler(t *testing.T) {
+	externalID := "crm-42"
+
+	cases := []struct {
+		name       string
+		userId     string
+		id         int64
+		externalID *string
+		err        error
+		statusCode int
+	}{
+		{
+			name:       "User restored by id",
+			userId:     "1",
+			id:         1,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "User restored by external id",
+			userId:     "ext:crm-42",
+			externalID: &externalID,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "User was not deleted or is purged",
+			userId:     "1",
+			id:         1,
+			err:        sql.ErrNoRows,
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "Invalid user id",
+			userId:     "one",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			restorerMock := mocks.NewUserRestorer(t)
+			restorerMock.On("RestoreUser", mock.Anything, mock.MatchedBy(func(arg models.RestoreUserParams) bool {
+				return arg.ID == tc.id && assert.ObjectsAreEqual(tc.externalID, arg.ExternalID) &&
+					time.Since(arg.DeletedAfter) >= 24*time.Hour && time.Since(arg.DeletedAfter) < 25*time.Hour
+			})).Return(models.User{ID: 1, ExternalID: &externalID}, tc.err).Maybe()
+
+			handler := users.RestoreUserHandler(slogdiscard.NewDiscardLogger(), restorerMock, 24*time.Hour)
+			req, err := http.NewRequest(http.MethodPost, "/users/"+tc.userId+"/restore", nil)
+			require.NoError(t, err)
+			req = withUserIdParam(req, tc.userId)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tc.statusCode, rr.Code)
+		})
+	}
+}
+
+func TestGetUserHandler(t *testing.T) {
+	cases := []struct {
+		name       string
+		userId     string
+		getErr     error
+		statusCode int
+	}{
+		{
+			name:       "User exists",
+			userId:     "1",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "User does not exist",
+			userId:     "1",
+			getErr:     sql.ErrNoRows,
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "User found by external id",
+			userId:     "ext:acc%2F42",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Unknown external id",
+			userId:     "ext:missing",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "Invalid user id",
+			userId:     "abc",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			userGetterMock := mocks.NewUserGetter(t)
+			userGetterMock.On("GetUserById", mock.Anything, int64(1)).Return(models.User{ID: 1}, tc.getErr).Maybe()
+			userGetterMock.On("GetUserByExternalId", mock.Anything, "acc/42").Return(models.User{ID: 1}, nil).Maybe()
+			userGetterMock.On("GetUserByExternalId", mock.Anything, "missing").Return(models.User{}, sql.ErrNoRows).Maybe()
+
+			handler := users.GetUserHandler(slogdiscard.NewDiscardLogger(), userGetterMock)
+			req, err := http.NewRequest(http.MethodGet, "/users/"+tc.userId, nil)
+			require.NoError(t, err)
+			req = withUserIdParam(req, tc.userId)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tc.statusCode, rr.Code)
+		})
+	}
+}
+
+func TestListUsersHandler(t *testing.T) {
+	cases := []struct {
+		name       string
+		query      string
+		params     models.ListUsersParams
+		rows       []models.User
+		body       string
+		statusCode int
+	}{
+		{
+			name:       "Full page has a cursor",
+			query:      "?name=jo&limit=1",
+			params:     models.ListUsersParams{NameQuery: "jo", PageSize: 1},
+			rows:       []models.User{{ID: 3, Name: "John"}},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Empty page",
+			query:      "?cursor=3",
+			params:     models.ListUsersParams{AfterID: 3, PageSize: 100},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Invalid cursor",
+			query:      "?cursor=abc",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			userListerMock := mocks.NewUserLister(t)
+			userListerMock.On("ListUsers", mock.Anything, tc.params).Return(tc.rows, nil).Maybe()
+
+			handler := users.ListUsersHandler(slogdiscard.NewDiscardLogger(), userListerMock)
+			req, err := http.NewRequest(http.MethodGet, "/users"+tc.query, nil)
+			require.NoError(t, err)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tc.statusCode, rr.Code)
+		})
+	}
+}
+
+func TestUpdateUserHandler(t *testing.T) {
+	cases := []struct {
+		name        string
+		requestBody string
+		getErr      error
+		updateErr   error
+		statusCode  int
+		body        string
+	}{
+		{
+			name:        "User renamed",
+			requestBody: `{"name": "example"}`,
+			statusCode:  http.StatusOK,
+		},
+		{
+			name:        "Short name in request body",
+			requestBody: `{"name": "s"}`,
+			statusCode:  http.StatusBadRequest,
+		},
+		{
+			name:        "Nothing to update",
+			requestBody: `{}`,
+			statusCode:  http.StatusBadRequest,
+		},
+		{
+			name:        "User does not exist",
+			requestBody: `{"name": "example"}`,
+			getErr:      sql.ErrNoRows,
+			statusCode:  http.StatusNotFound,
+		},
+		{
+			name:        "User deleted before update",
+			requestBody: `{"name": "example"}`,
+			updateErr:   sql.ErrNoRows,
+			statusCode:  http.StatusNotFound,
+			body:        `{"error":"User 1 does not exist"}`,
+		},
+		{
+			name:        "External id is taken",
+			requestBody: `{"name": "example"}`,
+			updateErr:   &pq.Error{Code: "23505"},
+			statusCode:  http.StatusConflict,
+		},
+		{
+			name:        "External id cleared",
+			requestBody: `{"external_id": ""}`,
+			statusCode:  http.StatusOK,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := "example"
+			userUpdaterMock := mocks.NewUserUpdater(t)
+			userUpdaterMock.On("GetUserById", mock.Anything, int64(1)).Return(models.User{ID: 1}, tc.getErr).Maybe()
+			userUpdaterMock.On("UpdateUser", mock.Anything, models.UpdateUserParams{Name: &name, ID: 1}).
+				Return(models.User{ID: 1, Name: "example"}, tc.updateErr).Maybe()
+			userUpdaterMock.On("UpdateUser", mock.Anything, mock.MatchedBy(func(arg models.UpdateUserParams) bool {
+				return arg.Name == nil && arg.ExternalID != nil && *arg.ExternalID == "" && arg.ID == 1
+			})).Return(models.User{ID: 1, Name: "example"}, tc.updateErr).Maybe()
+
+			handler := users.UpdateUserHandler(slogdiscard.NewDiscardLogger(), userUpdaterMock)
+			req, err := http.NewRequest(http.MethodPatch, "/users/1", bytes.NewReader([]byte(tc.requestBody)))
+			require.NoError(t, err)
+			req = withUserIdParam(req, "1")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tc.statusCode, rr.Code)
+			if tc.body != "" {
+				require.JSONEq(t, tc.body, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestImportUsersHandler(t *testing.T) {
+	cases := []struct {
+		name        string
+		contentType string
+		query       string
+		body        string
+		result      models.ImportUsersResult
+		statusCode  int
+	}{
+		{
+			name:        "Imported",
+			contentType: "text/csv",
+			result:      models.ImportUsersResult{Users: 1},
+			statusCode:  http.StatusCreated,
+		},
+		{
+			name:        "Dry run",
+			contentType: "application/x-ndjson",
+			query:       "?dry_run=true",
+			result:      models.ImportUsersResult{Users: 1, DryRun: true},
+			statusCode:  http.StatusOK,
+		},
+		{
+			name:        "Invalid rows",
+			contentType: "text/csv",
+			result:      models.ImportUsersResult{Errors: []models.ImportError{{Line: 1, Error: "segment TEST does not exist"}}},
+			statusCode:  http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "JSON is not supported",
+			contentType: "application/json",
+			statusCode:  http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "File is too large",
+			contentType: "text/csv",
+			body:        strings.Repeat("Alexander\n", 10),
+			statusCode:  http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			importerMock := mocks.NewUsersImporter(t)
+			importerMock.On("ImportUsers", mock.Anything, mock.Anything, tc.result.DryRun).Return(tc.result, nil).Maybe()
+
+			body := "Alexander\n"
+			if tc.body != "" {
+				body = tc.body
+			}
+			handler := users.ImportUsersHandler(slogdiscard.NewDiscardLogger(), importerMock, 64, time.Minute)
+			req, err := http.NewRequest(http.MethodPost, "/users:import"+tc.query, strings.NewReader(body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", tc.contentType)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tc.statusCode, rr.Code)
+		})
+	}
+}
+
+func withUserIdParam(req *http.Request, userId string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("userId", userId)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
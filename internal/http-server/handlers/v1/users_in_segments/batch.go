@@ -0,0 +1,387 @@
+package users_in_segments
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	httpserver "github.com/AlexZahvatkin/segments-users-service/internal/http-server"
+	"github.com/AlexZahvatkin/segments-users-service/internal/http-server/handlers"
+	"github.com/AlexZahvatkin/segments-users-service/internal/jobs"
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	usecases_segments "github.com/AlexZahvatkin/segments-users-service/internal/use-cases/segments"
+	"github.com/AlexZahvatkin/segments-users-service/internal/use-cases/user_segments"
+	"github.com/go-chi/chi"
+)
+
+const (
+	BatchStatusAdded   = "added"
+	BatchStatusUpdated = "updated"
+	BatchStatusFailed  = "failed"
+)
+
+var errBatchTooLarge = errors.New("batch is too large")
+
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=SegmentMembersBatchAdder
+type SegmentMembersBatchAdder interface {
+	AddUsersIntoSegmentBatch(ctx context.Context, arg models.AddUsersIntoSegmentBatchParams) ([]models.AddUsersIntoSegmentBatchRow, error)
+	CreateJob(ctx context.Context, arg models.CreateJobParams) (models.Job, error)
+	SegmentGetter
+}
+
+type SegmentMembersBatchResult struct {
+	UserId    int64      `json:"user_id"`
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	Expire_at *time.Time `json:"expire_at,omitempty"`
+	Starts_at *time.Time `json:"starts_at,omitempty"`
+}
+
+type SegmentMembersBatchResponse struct {
+	Total   int                         `json:"total"`
+	Added   int                         `json:"added"`
+	Updated int                         `json:"updated"`
+	Failed  int                         `json:"failed"`
+	Results []SegmentMembersBatchResult `json:"results"`
+}
+
+type JobResponse struct {
+	JobID int64 `json:"job_id"`
+}
+
+// @Summary Adds many users into a segment
+// @Description Adds users into the segment with a single set-based query. Users already in the segment get the new expiry.
+// @Description Every user may have either ttl (a number of hours or a duration such as "90m", "3d", "2w", "P1DT12H")
+// @Description or an RFC3339 expire_at in the future, users without them never expire.
+// @Description An RFC3339 starts_at in the future schedules the membership: it becomes active at starts_at and ttl is counted from it.
+// @Description The body is a JSON object, or a CSV (Content-Type: text/csv, columns user_id, optional ttl or expire_at
+// @Description and optional starts_at, header is optional)
+// @Description or NDJSON (Content-Type: application/x-ndjson) upload.
+// @Description Batches larger than BATCH_SYNC_LIMIT, or any batch with async=true, are applied by a background job:
+// @Description the response is 202 with job_id, progress is available at /v1/jobs/{jobId}.
+// @Tags Useres in segments
+// @Accept  json,text/csv,application/x-ndjson
+// @Produce  json
+// @ID add-segment-members-batch
+// @Param name path string true "Segment name"
+// @Param async query bool false "Apply the batch in a background job"
+// @Param users body models.SegmentMembersBatchRequest true "Users to add"
+// @Success 200 {object} SegmentMembersBatchResponse
+// @Success 202 {object} JobResponse
+// @Failure 400 {object} error
+// @Failure 404 {object} error
+// @Failure 413 {object} error
+// @Failure 500 {object} error
+// @Router /v1/segments/{name}/members:batch [post]
+func AddSegmentMembersBatchHandler(log *slog.Logger, adder SegmentMembersBatchAdder, syncLimit int, maxSize int, maxBodySize int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.v1.AddSegmentMembersBatchHandler"
+
+		handlers.SetLogger(log, r.Context(), op)
+
+		segmentName := usecases_segments.FormatSegmnetName(chi.URLParam(r, "name"))
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+
+		members, err := readBatchMembers(r, maxSize, time.Now())
+		if err != nil {
+			if errors.Is(err, errBatchTooLarge) {
+				httpserver.RespondWithError(w, http.StatusRequestEntityTooLarge,
+					fmt.Sprintf("Batch must contain at most %d users", maxSize), log)
+				return
+			}
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				httpserver.RespondWithError(w, http.StatusRequestEntityTooLarge,
+					fmt.Sprintf("Request body must be at most %d bytes", maxBodySize), log)
+				return
+			}
+			httpserver.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid batch: %v", err), log)
+			return
+		}
+		if len(members) == 0 {
+			httpserver.RespondWithError(w, http.StatusBadRequest, "You must provide at least one user", log)
+			return
+		}
+		members = usecases_user_segments.DedupMembers(members)
+
+		log.Info("batch decoded", slog.String("segment_name", segmentName), slog.Int("users", len(members)))
+
+		if _, err := adder.GetSegmentByName(r.Context(), segmentName); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				httpserver.RespondWithError(w, http.StatusNotFound, "Segment does not exist", log)
+				return
+			}
+			log.Error(err.Error())
+
+			httpserver.RespondWithError(w, http.StatusInternalServerError, "Failed to get segment", log)
+			return
+		}
+
+		if len(members) > syncLimit || r.URL.Query().Get("async") == "true" {
+			payload, err := json.Marshal(jobs.SegmentMembersBatchPayload{SegmentName: segmentName, Users: members})
+			if err != nil {
+				log.Error(err.Error())
+
+				httpserver.RespondWithError(w, http.StatusInternalServerError, "Failed to schedule batch", log)
+				return
+			}
+
+			job, err := adder.CreateJob(r.Context(), jobs.NewJobParams(r.Context(), jobs.KindSegmentMembersBatch, payload))
+			if err != nil {
+				log.Error(err.Error())
+
+				httpserver.RespondWithError(w, http.StatusInternalServerError, "Failed to schedule batch", log)
+				return
+			}
+
+			log.Info("batch scheduled", slog.Int64("job_id", job.ID))
+
+			httpserver.RespondWithJSON(w, http.StatusAccepted, log, JobResponse{JobID: job.ID})
+			return
+		}
+
+		res, err := adder.AddUsersIntoSegmentBatch(r.Context(), usecases_user_segments.BatchParams(segmentName, members))
+		if err != nil {
+			log.Error(err.Error())
+
+			httpserver.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to add users into segment %s", segmentName), log)
+			return
+		}
+
+		httpserver.RespondWithJSON(w, http.StatusOK, log, transformToSegmentMembersBatchResponse(members, res))
+	}
+}
+
+// batchMemberRequest is a user of a batch as it is sent by the client.
+type batchMemberRequest struct {
+	UserID int64 `json:"user_id"`
+	usecases_user_segments.Schedule
+}
+
+// resolve validates the user and fixes its schedule relative to now.
+func (m batchMemberRequest) resolve(now time.Time) (usecases_user_segments.BatchMember, error) {
+	if m.UserID <= 0 {
+		return usecases_user_segments.BatchMember{}, errors.New("user_id must be positive")
+	}
+	window, err := m.Schedule.Resolve(now)
+	if err != nil {
+		return usecases_user_segments.BatchMember{}, err
+	}
+
+	member := usecases_user_segments.BatchMember{UserID: m.UserID}
+	if window.ExpireAt.Valid {
+		member.ExpireAt = &window.ExpireAt.Time
+	}
+	if window.StartsAt.Valid {
+		member.StartsAt = &window.StartsAt.Time
+	}
+	return member, nil
+}
+
+// readBatchMembers reads the batch in the format given by Content-Type.
+// It stops reading as soon as the batch has more than maxSize users.
+func readBatchMembers(r *http.Request, maxSize int, now time.Time) ([]usecases_user_segments.BatchMember, error) {
+	switch httpserver.GetRequestFormat(r) {
+	case httpserver.FormatCSV:
+		return readBatchMembersCSV(r.Body, maxSize, now)
+	case httpserver.FormatNDJSON:
+		return readBatchMembersNDJSON(r.Body, maxSize, now)
+	}
+
+	members, err := readBatchMembersJSON(r.Body, maxSize, now)
+	if err != nil && !errors.Is(err, errBatchTooLarge) {
+		return nil, fmt.Errorf("error parsing JSON: %w", err)
+	}
+	return members, err
+}
+
+// readBatchMembersJSON reads {"users": [...]} one user at a time, so that
+// an oversized batch is rejected without being decoded whole.
+func readBatchMembersJSON(body io.Reader, maxSize int, now time.Time) ([]usecases_user_segments.BatchMember, error) {
+	dec := json.NewDecoder(body)
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, err
+	}
+
+	var members []usecases_user_segments.BatchMember
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if key != "users" {
+			var skipped json.RawMessage
+			if err := dec.Decode(&skipped); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if err := expectDelim(dec, '['); err != nil {
+			return nil, fmt.Errorf("users: %w", err)
+		}
+		for i := 0; dec.More(); i++ {
+			if i == maxSize {
+				return nil, errBatchTooLarge
+			}
+			var item batchMemberRequest
+			if err := dec.Decode(&item); err != nil {
+				return nil, fmt.Errorf("users[%d]: %w", i, err)
+			}
+			member, err := item.resolve(now)
+			if err != nil {
+				return nil, fmt.Errorf("users[%d]: %w", i, err)
+			}
+			members = append(members, member)
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return nil, err
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %v, got %v", delim, token)
+	}
+	return nil
+}
+
+func readBatchMembersCSV(body io.Reader, maxSize int, now time.Time) ([]usecases_user_segments.BatchMember, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var members []usecases_user_segments.BatchMember
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return members, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		if first && record[0] == "user_id" {
+			continue
+		}
+		if len(record) > 3 {
+			return nil, fmt.Errorf("line %d: expected user_id, optional ttl or expire_at and optional starts_at, got %d fields", line, len(record))
+		}
+
+		var item batchMemberRequest
+		item.UserID, err = strconv.ParseInt(record[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: user_id must be a number", line)
+		}
+		if len(record) > 1 {
+			item.Expiry, err = usecases_user_segments.ParseExpiry(record[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		if len(record) > 2 && record[2] != "" {
+			startsAt, err := time.Parse(time.RFC3339, record[2])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: starts_at must be an RFC3339 timestamp", line)
+			}
+			item.StartsAt = &startsAt
+		}
+		member, err := item.resolve(now)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if len(members) == maxSize {
+			return nil, errBatchTooLarge
+		}
+		members = append(members, member)
+	}
+}
+
+func readBatchMembersNDJSON(body io.Reader, maxSize int, now time.Time) ([]usecases_user_segments.BatchMember, error) {
+	scanner := bufio.NewScanner(body)
+
+	var members []usecases_user_segments.BatchMember
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var item batchMemberRequest
+		if err := json.Unmarshal([]byte(text), &item); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		member, err := item.resolve(now)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if len(members) == maxSize {
+			return nil, errBatchTooLarge
+		}
+		members = append(members, member)
+	}
+	return members, scanner.Err()
+}
+
+// transformToSegmentMembersBatchResponse reports the result for every user in the order of the request.
+func transformToSegmentMembersBatchResponse(members []usecases_user_segments.BatchMember,
+	rows []models.AddUsersIntoSegmentBatchRow) SegmentMembersBatchResponse {
+	byUser := make(map[int64]models.AddUsersIntoSegmentBatchRow, len(rows))
+	for _, row := range rows {
+		byUser[row.UserID] = row
+	}
+
+	resp := SegmentMembersBatchResponse{
+		Total:   len(members),
+		Results: make([]SegmentMembersBatchResult, 0, len(members)),
+	}
+	for _, member := range members {
+		result := SegmentMembersBatchResult{UserId: member.UserID}
+
+		row := byUser[member.UserID]
+		switch {
+		case !row.UserExists:
+			result.Status = BatchStatusFailed
+			result.Error = "User does not exist"
+			resp.Failed++
+		case row.Inserted:
+			result.Status = BatchStatusAdded
+			resp.Added++
+		default:
+			result.Status = BatchStatusUpdated
+			resp.Updated++
+		}
+		if row.ExpireAt.Valid {
+			result.Expire_at = &row.ExpireAt.Time
+		}
+		if row.StartsAt.Valid {
+			result.Starts_at = &row.StartsAt.Time
+		}
+
+		resp.Results = append(resp.Results, result)
+	}
+	return resp
+}
@@ -0,0 +1,103 @@
+// Code generated by mockery v2.33.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	models "github.com/AlexZahvatkin/segments-users-service/internal/models"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// SegmentHistoryGetter is an autogenerated mock type for the SegmentHistoryGetter type
+type SegmentHistoryGetter struct {
+	mock.Mock
+}
+
+// GetSegmentsHistoryByUserId provides a mock function with given fields: ctx, arg
+func (_m *SegmentHistoryGetter) GetSegmentsHistoryByUserId(ctx context.Context, arg models.GetSegmentsHistoryByUserIdParams) ([]models.UsersInSegmentsHistory, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 []models.UsersInSegmentsHistory
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.GetSegmentsHistoryByUserIdParams) ([]models.UsersInSegmentsHistory, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.GetSegmentsHistoryByUserIdParams) []models.UsersInSegmentsHistory); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.UsersInSegmentsHistory)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.GetSegmentsHistoryByUserIdParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserByExternalId provides a mock function with given fields: ctx, externalID
+func (_m *SegmentHistoryGetter) GetUserByExternalId(ctx context.Context, externalID string) (models.User, error) {
+	ret := _m.Called(ctx, externalID)
+
+	var r0 models.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (models.User, error)); ok {
+		return rf(ctx, externalID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) models.User); ok {
+		r0 = rf(ctx, externalID)
+	} else {
+		r0 = ret.Get(0).(models.User)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, externalID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserById provides a mock function with given fields: _a0, _a1
+func (_m *SegmentHistoryGetter) GetUserById(_a0 context.Context, _a1 int64) (models.User, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 models.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) (models.User, error)); ok {
+		return rf(_a0, _a1)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) models.User); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		r0 = ret.Get(0).(models.User)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewSegmentHistoryGetter creates a new instance of SegmentHistoryGetter. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewSegmentHistoryGetter(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *SegmentHistoryGetter {
+	mock := &SegmentHistoryGetter{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
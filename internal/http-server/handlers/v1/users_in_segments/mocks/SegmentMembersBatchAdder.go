@@ -0,0 +1,103 @@
+// Code generated by mockery v2.33.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	models "github.com/AlexZahvatkin/segments-users-service/internal/models"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// SegmentMembersBatchAdder is an autogenerated mock type for the SegmentMembersBatchAdder type
+type SegmentMembersBatchAdder struct {
+	mock.Mock
+}
+
+// AddUsersIntoSegmentBatch provides a mock function with given fields: ctx, arg
+func (_m *SegmentMembersBatchAdder) AddUsersIntoSegmentBatch(ctx context.Context, arg models.AddUsersIntoSegmentBatchParams) ([]models.AddUsersIntoSegmentBatchRow, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 []models.AddUsersIntoSegmentBatchRow
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.AddUsersIntoSegmentBatchParams) ([]models.AddUsersIntoSegmentBatchRow, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.AddUsersIntoSegmentBatchParams) []models.AddUsersIntoSegmentBatchRow); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.AddUsersIntoSegmentBatchRow)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.AddUsersIntoSegmentBatchParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateJob provides a mock function with given fields: ctx, arg
+func (_m *SegmentMembersBatchAdder) CreateJob(ctx context.Context, arg models.CreateJobParams) (models.Job, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 models.Job
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.CreateJobParams) (models.Job, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.CreateJobParams) models.Job); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(models.Job)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.CreateJobParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSegmentByName provides a mock function with given fields: ctx, name
+func (_m *SegmentMembersBatchAdder) GetSegmentByName(ctx context.Context, name string) (models.Segment, error) {
+	ret := _m.Called(ctx, name)
+
+	var r0 models.Segment
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (models.Segment, error)); ok {
+		return rf(ctx, name)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) models.Segment); ok {
+		r0 = rf(ctx, name)
+	} else {
+		r0 = ret.Get(0).(models.Segment)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewSegmentMembersBatchAdder creates a new instance of SegmentMembersBatchAdder. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewSegmentMembersBatchAdder(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *SegmentMembersBatchAdder {
+	mock := &SegmentMembersBatchAdder{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,79 @@
+// Code generated by mockery v2.33.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	models "github.com/AlexZahvatkin/segments-users-service/internal/models"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// SegmentMembersLister is an autogenerated mock type for the SegmentMembersLister type
+type SegmentMembersLister struct {
+	mock.Mock
+}
+
+// GetSegmentByName provides a mock function with given fields: ctx, name
+func (_m *SegmentMembersLister) GetSegmentByName(ctx context.Context, name string) (models.Segment, error) {
+	ret := _m.Called(ctx, name)
+
+	var r0 models.Segment
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (models.Segment, error)); ok {
+		return rf(ctx, name)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) models.Segment); ok {
+		r0 = rf(ctx, name)
+	} else {
+		r0 = ret.Get(0).(models.Segment)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListUsersInSegment provides a mock function with given fields: ctx, arg
+func (_m *SegmentMembersLister) ListUsersInSegment(ctx context.Context, arg models.ListUsersInSegmentParams) ([]models.UsersInSegment, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 []models.UsersInSegment
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.ListUsersInSegmentParams) ([]models.UsersInSegment, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.ListUsersInSegmentParams) []models.UsersInSegment); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.UsersInSegment)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.ListUsersInSegmentParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewSegmentMembersLister creates a new instance of SegmentMembersLister. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewSegmentMembersLister(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *SegmentMembersLister {
+	mock := &SegmentMembersLister{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
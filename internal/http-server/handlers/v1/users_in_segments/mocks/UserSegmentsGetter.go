@@ -0,0 +1,154 @@
+// Code generated by mockery v2.33.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+	sql "database/sql"
+
+	models "github.com/AlexZahvatkin/segments-users-service/internal/models"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// UserSegmentsGetter is an autogenerated mock type for the UserSegmentsGetter type
+type UserSegmentsGetter struct {
+	mock.Mock
+}
+
+// GetHistoryArchivedBefore provides a mock function with given fields: ctx
+func (_m *UserSegmentsGetter) GetHistoryArchivedBefore(ctx context.Context) (sql.NullTime, error) {
+	ret := _m.Called(ctx)
+
+	var r0 sql.NullTime
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) (sql.NullTime, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) sql.NullTime); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(sql.NullTime)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetLastSegmentsActionsByUserId provides a mock function with given fields: ctx, arg
+func (_m *UserSegmentsGetter) GetLastSegmentsActionsByUserId(ctx context.Context, arg models.GetLastSegmentsActionsByUserIdParams) ([]models.UsersInSegmentsHistory, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 []models.UsersInSegmentsHistory
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.GetLastSegmentsActionsByUserIdParams) ([]models.UsersInSegmentsHistory, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.GetLastSegmentsActionsByUserIdParams) []models.UsersInSegmentsHistory); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.UsersInSegmentsHistory)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.GetLastSegmentsActionsByUserIdParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSegmentsByUserId provides a mock function with given fields: ctx, userID
+func (_m *UserSegmentsGetter) GetSegmentsByUserId(ctx context.Context, userID int64) ([]string, error) {
+	ret := _m.Called(ctx, userID)
+
+	var r0 []string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) ([]string, error)); ok {
+		return rf(ctx, userID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) []string); ok {
+		r0 = rf(ctx, userID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserByExternalId provides a mock function with given fields: ctx, externalID
+func (_m *UserSegmentsGetter) GetUserByExternalId(ctx context.Context, externalID string) (models.User, error) {
+	ret := _m.Called(ctx, externalID)
+
+	var r0 models.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (models.User, error)); ok {
+		return rf(ctx, externalID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) models.User); ok {
+		r0 = rf(ctx, externalID)
+	} else {
+		r0 = ret.Get(0).(models.User)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, externalID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserById provides a mock function with given fields: _a0, _a1
+func (_m *UserSegmentsGetter) GetUserById(_a0 context.Context, _a1 int64) (models.User, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 models.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) (models.User, error)); ok {
+		return rf(_a0, _a1)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) models.User); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		r0 = ret.Get(0).(models.User)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewUserSegmentsGetter creates a new instance of UserSegmentsGetter. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewUserSegmentsGetter(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *UserSegmentsGetter {
+	mock := &UserSegmentsGetter{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -3,25 +3,60 @@ package users_in_segments
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	httpserver "github.com/AlexZahvatkin/segments-users-service/internal/http-server"
 	"github.com/AlexZahvatkin/segments-users-service/internal/http-server/handlers"
+	"github.com/AlexZahvatkin/segments-users-service/internal/lib/logger"
 	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+	usecases_segments "github.com/AlexZahvatkin/segments-users-service/internal/use-cases/segments"
+	"github.com/AlexZahvatkin/segments-users-service/internal/use-cases/user_segments"
+	"github.com/AlexZahvatkin/segments-users-service/internal/use-cases/users"
+	"github.com/go-chi/chi"
 	"github.com/go-playground/validator/v10"
 )
 
 const (
 	timeFormat = "2006-01-02T15:04:05Z07:00" //RFC3339
+
+	defaultMembersPageSize = 1000
+	maxMembersPageSize     = 10000
+	membersStreamBatchSize = 5000
+
+	defaultHistoryPageSize = 1000
+	maxHistoryPageSize     = 10000
+	historyStreamBatchSize = 5000
 )
 
+// historyActions are the action types recorded in the segments history.
+var historyActions = []string{
+	models.ActionInserted,
+	models.ActionDeleted,
+	models.ActionExpired,
+	models.ActionAutoAssigned,
+	models.ActionScheduled,
+	models.ActionStarted,
+	models.ActionUpdated,
+	models.ActionTTLChanged,
+	models.ActionSegmentDeleted,
+	models.ActionSegmentRestored,
+	models.ActionUserDeleted,
+	models.ActionUserRestored,
+	models.ActionSnapshot,
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=SegmentsAssigner
 type SegmentsAssigner interface {
-	AddUserIntoSegment(context.Context, models.AddUserIntoSegmentParams) (models.UsersInSegment, error)
-	RemoveUserFromSegment(ctx context.Context, arg models.RemoveUserFromSegmentParams) error
+	storage.Transactor
 	SegmentGetter
 	UserGetter
 }
@@ -31,19 +66,35 @@ type SegmentsForUserGetter interface {
 	UserGetter
 }
 
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=UserSegmentsGetter
+type UserSegmentsGetter interface {
+	GetSegmentsByUserId(ctx context.Context, userID int64) ([]string, error)
+	GetLastSegmentsActionsByUserId(ctx context.Context, arg models.GetLastSegmentsActionsByUserIdParams) ([]models.UsersInSegmentsHistory, error)
+	GetHistoryArchivedBefore(ctx context.Context) (sql.NullTime, error)
+	UserGetter
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=SegmentHistoryGetter
 type SegmentHistoryGetter interface {
 	GetSegmentsHistoryByUserId(ctx context.Context, arg models.GetSegmentsHistoryByUserIdParams) ([]models.UsersInSegmentsHistory, error)
 	UserGetter
 }
 
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=SegmentsAssignerWithTTL
 type SegmentsAssignerWithTTL interface {
-	AddUserIntoSegmentWithTTLInHours(context.Context, models.AddUserIntoSegmentWithTTLInHoursParams) (models.UsersInSegment, error)
-	GetSegmentByName(ctx context.Context, name string) (models.Segment, error)
+	storage.Transactor
+	SegmentGetter
 	UserGetter
 }
 
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=SegmentMembersLister
+type SegmentMembersLister interface {
+	ListUsersInSegment(ctx context.Context, arg models.ListUsersInSegmentParams) ([]models.UsersInSegment, error)
+	SegmentGetter
+}
+
 type UserGetter interface {
-	GetUserById(context.Context, int64) (models.User, error)
+	handlers.UserResolver
 }
 
 type SegmentGetter interface {
@@ -51,36 +102,85 @@ type SegmentGetter interface {
 }
 
 type UsersInSegmentsResponse struct {
-	UserId      int64     `json:"user_id"`
-	SegmentName string    `json:"segment_name"`
-	Created_At  time.Time `json:"created_at"`
-	Updated_At  time.Time `json:"updated_at"`
-	Expire_at   time.Time `json:"expire_at,omitempty"`
+	UserId      int64      `json:"user_id"`
+	SegmentName string     `json:"segment_name"`
+	Created_At  time.Time  `json:"created_at"`
+	Updated_At  time.Time  `json:"updated_at"`
+	Expire_at   time.Time  `json:"expire_at,omitempty"`
+	Starts_at   *time.Time `json:"starts_at,omitempty"`
+}
+
+type UserSegmentsResponse struct {
+	UserId   int64     `json:"user_id"`
+	At       time.Time `json:"at"`
+	Segments []string  `json:"segments"`
 }
 
 type UsersInSegmentsHistoryResponse struct {
-	UserId      int64     `json:"user_id"`
-	SegmentName string    `json:"segment_name"`
-	ActionType  string    `json:"action_type"`
-	ActionDate  time.Time `json:"action_date"`
+	UserId      int64      `json:"user_id"`
+	SegmentName string     `json:"segment_name"`
+	ActionType  string     `json:"action_type"`
+	ActionDate  time.Time  `json:"action_date"`
+	ExpireAt    *time.Time `json:"expire_at,omitempty"`
+	OldExpireAt *time.Time `json:"old_expire_at,omitempty"`
+	Actor       string     `json:"actor,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+}
+
+type SegmentMemberResponse struct {
+	UserId     int64      `json:"user_id"`
+	Created_At *time.Time `json:"created_at,omitempty"`
+	Expire_at  *time.Time `json:"expire_at,omitempty"`
+	Starts_at  *time.Time `json:"starts_at,omitempty"`
+}
+
+type UsersInSegmentsHistoryPageResponse struct {
+	History    []UsersInSegmentsHistoryResponse `json:"history"`
+	NextCursor int64                            `json:"next_cursor,omitempty"`
+}
+
+type SegmentMembersPageResponse struct {
+	Users      []SegmentMemberResponse `json:"users"`
+	NextCursor int64                   `json:"next_cursor,omitempty"`
+}
+
+// segmentMembersQuery holds the parsed query parameters of GetUsersInSegmentHandler.
+type segmentMembersQuery struct {
+	segmentName    string
+	includeExpired bool
+	includePending bool
+	withCreatedAt  bool
+	withExpireAt   bool
+	withStartsAt   bool
+	afterUserId    int64
 }
 
 // @Summary Assigns segments to a user.
 // @Description Adds and deletes segments provided by a request for user with provied id.
+// @Description All changes are applied in a single transaction: if any of them fails, none are applied.
+// @Description With create_user=true (or USERS_CREATE_ON_ASSIGN) a user referenced by an unknown ext:<external id>
+// @Description is created in the same transaction, named user_name or, by default, by the external id.
+// @Description If the external id is shorter than 4 characters, user_name is required.
+// @Description An RFC3339 starts_at in the future schedules the added segments, as in /v1/segments/ttl/{userId}.
 // @Tags Useres in segments
 // @Accept  json
 // @Produce  json
 // @ID segments-assign
-// @Param userId path int true "User id"
+// @Param userId path string true "User id or ext:<external id>"
+// @Param create_user query bool false "Create the user if ext:<external id> is unknown"
 // @Param segments body models.SegmentAssignRequest true "Segments to delete and add for user"
 // @Success 200 {object} UsersInSegmentsResponse
 // @Failure 400 {object} error
+// @Failure 404 {object} error
+// @Failure 409 {object} error
 // @Failure 500 {object} error
 // @Router /v1/segments/assign/{userId} [post]
-func SegmentsAssignHandler(log *slog.Logger, assigner SegmentsAssigner) http.HandlerFunc {
+func SegmentsAssignHandler(log *slog.Logger, assigner SegmentsAssigner, createUsers bool) http.HandlerFunc {
 	type request struct {
-		SegmentsToDeleteNames []string `json:"to_delete"`
-		SegmentsToAddNames    []string `json:"to_add"`
+		SegmentsToDeleteNames []string   `json:"to_delete"`
+		SegmentsToAddNames    []string   `json:"to_add"`
+		StartsAt              *time.Time `json:"starts_at"`
+		UserName              string     `json:"user_name" validate:"omitempty,min=4,max=255"`
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -100,50 +200,95 @@ func SegmentsAssignHandler(log *slog.Logger, assigner SegmentsAssigner) http.Han
 			return
 		}
 
-		userId, err := httpserver.GetUserIdFromParams(w, r, log)
+		window, err := usecases_user_segments.Schedule{StartsAt: req.StartsAt}.Resolve(time.Now())
 		if err != nil {
+			httpserver.RespondWithError(w, http.StatusBadRequest, err.Error(), log)
 			return
 		}
 
-		if !checkIfUserExists(assigner, log, userId, w, r) {
+		ref, err := httpserver.GetUserRefFromParams(w, r, log)
+		if err != nil {
 			return
 		}
 
-		for _, segmentName := range req.SegmentsToAddNames {
-			if !checkIfSegmentExists(assigner, log, segmentName, w, r) {
+		createUser := shouldCreateUser(r, ref, createUsers)
+
+		var user models.User
+		if createUser {
+			if req.UserName, err = newUserName(ref, req.UserName); err != nil {
+				httpserver.RespondWithError(w, http.StatusBadRequest, err.Error(), log)
+				return
+			}
+		} else {
+			var ok bool
+			user, ok = handlers.LoadUser(w, r, log, assigner, ref)
+			if !ok {
 				return
 			}
 		}
 
-		for _, segmentName := range req.SegmentsToDeleteNames {
+		for _, segmentName := range req.SegmentsToAddNames {
 			if !checkIfSegmentExists(assigner, log, segmentName, w, r) {
 				return
 			}
 		}
 
 		for _, segmentName := range req.SegmentsToDeleteNames {
-			if err := assigner.RemoveUserFromSegment(r.Context(),
-				models.RemoveUserFromSegmentParams{UserID: userId, SegmentName: segmentName}); err != nil {
-				log.Error(err.Error())
-
-				httpserver.RespondWithError(w, http.StatusInternalServerError,
-					fmt.Sprintf("Failed to delete segment %s for user %d", segmentName, userId), log)
+			if !checkIfSegmentExists(assigner, log, segmentName, w, r) {
 				return
 			}
 		}
 
 		var result []models.UsersInSegment
 
-		for _, segmentName := range req.SegmentsToAddNames {
-			res, err := assigner.AddUserIntoSegment(r.Context(), models.AddUserIntoSegmentParams{UserID: userId, SegmentName: segmentName})
-			if err != nil {
-				log.Error(err.Error())
+		err = assigner.ExecTx(r.Context(), func(q storage.Querier) error {
+			if createUser {
+				var err error
+				user, err = getOrCreateUser(r.Context(), log, q, ref, req.UserName)
+				if err != nil {
+					return err
+				}
+			}
 
-				httpserver.RespondWithError(w, http.StatusInternalServerError,
-					fmt.Sprintf("Failed to add segment %s for user %d", segmentName, userId), log)
+			for _, segmentName := range req.SegmentsToDeleteNames {
+				if err := q.RemoveUserFromSegment(r.Context(),
+					models.RemoveUserFromSegmentParams{UserID: user.ID, SegmentName: segmentName}); err != nil {
+					return fmt.Errorf("failed to delete segment %s for user %d: %w", segmentName, user.ID, err)
+				}
+			}
+
+			for _, segmentName := range req.SegmentsToAddNames {
+				var (
+					res models.UsersInSegment
+					err error
+				)
+				if window.StartsAt.Valid {
+					res, err = q.AddUserIntoSegmentWithExpireDatetime(r.Context(), models.AddUserIntoSegmentWithExpireDatetimeParams{
+						UserID:      user.ID,
+						SegmentName: segmentName,
+						StartsAt:    window.StartsAt,
+					})
+				} else {
+					res, err = q.AddUserIntoSegment(r.Context(), models.AddUserIntoSegmentParams{UserID: user.ID, SegmentName: segmentName})
+				}
+				if err != nil {
+					return fmt.Errorf("failed to add segment %s for user %d: %w", segmentName, user.ID, err)
+				}
+				result = append(result, res)
+			}
+
+			return nil
+		})
+		if err != nil {
+			if errors.Is(err, usecases_users.ErrUserDeleted) {
+				respondUserDeleted(w, log, ref)
 				return
 			}
-			result = append(result, res)
+			log.Error(err.Error())
+
+			httpserver.RespondWithError(w, http.StatusInternalServerError,
+				fmt.Sprintf("Failed to assign segments for user %s, no changes were applied", ref), log)
+			return
 		}
 
 		var resp []UsersInSegmentsResponse
@@ -156,25 +301,35 @@ func SegmentsAssignHandler(log *slog.Logger, assigner SegmentsAssigner) http.Han
 }
 
 // @Summary Assigns segments to a user with ttl.
-// @Description Adds a provided segment to a provided user with TTL in hours.
+// @Description Adds a provided segment to a provided user for a given time window. At least one of ttl, expire_at
+// @Description and starts_at must be provided, ttl and expire_at can not be used together:
+// @Description ttl is a number of hours or a duration such as "90m", "3d", "2w" or "P1DT12H",
+// @Description expire_at is an RFC3339 timestamp in the future. An RFC3339 starts_at in the future schedules the membership:
+// @Description the segment is not returned for the user until starts_at and ttl is counted from it.
+// @Description If the user is already in the segment, the window is replaced.
+// @Description Unknown users are created the same way as in /v1/segments/assign/{userId}.
 // @Tags Useres in segments
 // @Accept  json
 // @Produce  json
 // @ID segments-assign-with-ttl
-// @Param userId path int true "User id"
-// @Param segments body models.SegmentAssignWithTTLRequest true "Segment to assign and TTL in hours"
+// @Param userId path string true "User id or ext:<external id>"
+// @Param create_user query bool false "Create the user if ext:<external id> is unknown"
+// @Param segments body models.SegmentAssignWithTTLRequest true "Segment to assign and its expiry"
 // @Success 200 {object} UsersInSegmentsResponse
 // @Failure 400 {object} error
+// @Failure 404 {object} error
+// @Failure 409 {object} error
 // @Failure 500 {object} error
 // @Router /v1/segments/ttl/{userId} [post]
-func SegmentsAssignWithTTLInHoursHandler(log *slog.Logger, assigner SegmentsAssignerWithTTL) http.HandlerFunc {
+func SegmentsAssignWithTTLHandler(log *slog.Logger, assigner SegmentsAssignerWithTTL, createUsers bool) http.HandlerFunc {
 	type request struct {
 		SegmentName string `json:"segment_name" validate:"required"`
-		TTL         int32  `json:"ttl" validate:"required,gt=0"`
+		usecases_user_segments.Schedule
+		UserName string `json:"user_name" validate:"omitempty,min=4,max=255"`
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		const op = "handlers.v1.SegmentsAssignHandler"
+		const op = "handlers.v1.SegmentsAssignWithTTLHandler"
 
 		handlers.SetLogger(log, r.Context(), op)
 
@@ -183,11 +338,6 @@ func SegmentsAssignWithTTLInHoursHandler(log *slog.Logger, assigner SegmentsAssi
 			return
 		}
 
-		userId, err := httpserver.GetUserIdFromParams(w, r, log)
-		if err != nil {
-			return
-		}
-
 		log.Info("request body decoded", slog.Any("request", req))
 
 		if err := validator.New().Struct(req); err != nil {
@@ -195,23 +345,69 @@ func SegmentsAssignWithTTLInHoursHandler(log *slog.Logger, assigner SegmentsAssi
 			return
 		}
 
-		if !checkIfUserExists(assigner, log, userId, w, r) {
+		window, err := req.Schedule.Resolve(time.Now())
+		if err != nil {
+			httpserver.RespondWithError(w, http.StatusBadRequest, err.Error(), log)
 			return
 		}
+		if !window.ExpireAt.Valid && !window.StartsAt.Valid {
+			httpserver.RespondWithError(w, http.StatusBadRequest, "You must provide ttl, expire_at or a future starts_at", log)
+			return
+		}
+
+		ref, err := httpserver.GetUserRefFromParams(w, r, log)
+		if err != nil {
+			return
+		}
+
+		createUser := shouldCreateUser(r, ref, createUsers)
+
+		var user models.User
+		if createUser {
+			if req.UserName, err = newUserName(ref, req.UserName); err != nil {
+				httpserver.RespondWithError(w, http.StatusBadRequest, err.Error(), log)
+				return
+			}
+		} else {
+			var ok bool
+			user, ok = handlers.LoadUser(w, r, log, assigner, ref)
+			if !ok {
+				return
+			}
+		}
 
 		if !checkIfSegmentExists(assigner, log, req.SegmentName, w, r) {
 			return
 		}
 
-		res, err := assigner.AddUserIntoSegmentWithTTLInHours(r.Context(), models.AddUserIntoSegmentWithTTLInHoursParams{
-			UserID:        userId,
-			SegmentName:   req.SegmentName,
-			NumberOfHours: req.TTL,
+		var res models.UsersInSegment
+
+		err = assigner.ExecTx(r.Context(), func(q storage.Querier) error {
+			if createUser {
+				var err error
+				user, err = getOrCreateUser(r.Context(), log, q, ref, req.UserName)
+				if err != nil {
+					return err
+				}
+			}
+
+			var err error
+			res, err = q.AddUserIntoSegmentWithExpireDatetime(r.Context(), models.AddUserIntoSegmentWithExpireDatetimeParams{
+				UserID:      user.ID,
+				SegmentName: req.SegmentName,
+				ExpireAt:    window.ExpireAt,
+				StartsAt:    window.StartsAt,
+			})
+			return err
 		})
 		if err != nil {
+			if errors.Is(err, usecases_users.ErrUserDeleted) {
+				respondUserDeleted(w, log, ref)
+				return
+			}
 			log.Error(err.Error())
 
-			httpserver.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to add segment %s for user %d", req.SegmentName, userId), log)
+			httpserver.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to add segment %s for user %s", req.SegmentName, ref), log)
 			return
 		}
 
@@ -225,10 +421,11 @@ func SegmentsAssignWithTTLInHoursHandler(log *slog.Logger, assigner SegmentsAssi
 // @Accept  json
 // @Produce  json
 // @ID get-segments-for-user
-// @Param userId path int true "User id"
+// @Param userId path string true "User id or ext:<external id>"
 // @Success 200 {object} []string
 // @Success 204
 // @Failure 400 {object} error
+// @Failure 404 {object} error
 // @Failure 500 {object} error
 // @Router /v1/segments/{userId} [get]
 func GetSegmentsForUserHandler(log *slog.Logger, getter SegmentsForUserGetter) http.HandlerFunc {
@@ -237,14 +434,11 @@ func GetSegmentsForUserHandler(log *slog.Logger, getter SegmentsForUserGetter) h
 
 		handlers.SetLogger(log, r.Context(), op)
 
-		userId, err := httpserver.GetUserIdFromParams(w, r, log)
-		if err != nil {
-			return
-		}
-
-		if !checkIfUserExists(getter, log, userId, w, r) {
+		user, ok := handlers.ResolveUser(w, r, log, getter)
+		if !ok {
 			return
 		}
+		userId := user.ID
 
 		res, err := getter.GetSegmentsByUserId(r.Context(), userId)
 		if err != nil {
@@ -267,17 +461,118 @@ func GetSegmentsForUserHandler(log *slog.Logger, getter SegmentsForUserGetter) h
 	}
 }
 
-// @Summary Segments history for user
-// @Description Returns a history of added and deleted segments for a provided user in a given period.
+// @Summary Segments of a user at a moment
+// @Description Returns segments a user is in now or, with at, was in at a past moment.
+// @Description The past set is reconstructed by replaying the segments history: re-adds, changed expire_at,
+// @Description expirations and scheduled starts are taken into account.
 // @Tags Useres in segments
 // @Accept  json
 // @Produce  json
+// @ID get-user-segments
+// @Param userId path string true "User id or ext:<external id>"
+// @Param at query string false "RFC3339 moment in the past, now by default. It can not be earlier than the archived history"
+// @Success 200 {object} UserSegmentsResponse
+// @Failure 400 {object} error
+// @Failure 404 {object} error
+// @Failure 500 {object} error
+// @Router /v1/users/{userId}/segments [get]
+func GetUserSegmentsHandler(log *slog.Logger, getter UserSegmentsGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.v1.GetUserSegmentsHandler"
+
+		handlers.SetLogger(log, r.Context(), op)
+
+		now := time.Now()
+		at := now
+		if r.URL.Query().Get("at") != "" {
+			var err error
+			at, err = httpserver.GetTimeFromParams(w, r, log, "at", timeFormat)
+			if err != nil {
+				return
+			}
+			if at.After(now) {
+				httpserver.RespondWithError(w, http.StatusBadRequest, "at must not be in the future", log)
+				return
+			}
+		}
+
+		user, ok := handlers.ResolveUser(w, r, log, getter)
+		if !ok {
+			return
+		}
+
+		resp := UserSegmentsResponse{
+			UserId: user.ID,
+			At:     at.UTC(),
+		}
+
+		if at == now {
+			res, err := getter.GetSegmentsByUserId(r.Context(), user.ID)
+			if err != nil {
+				log.Error(err.Error())
+
+				httpserver.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get segments for user %d", user.ID), log)
+				return
+			}
+			resp.Segments = res
+		} else {
+			archivedBefore, err := getter.GetHistoryArchivedBefore(r.Context())
+			if err != nil {
+				log.Error(err.Error())
+
+				httpserver.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get segments history for user %d", user.ID), log)
+				return
+			}
+			if archivedBefore.Valid && resp.At.Before(archivedBefore.Time) {
+				httpserver.RespondWithError(w, http.StatusBadRequest,
+					fmt.Sprintf("History before %s is archived, at must not be earlier", archivedBefore.Time.Format(timeFormat)), log)
+				return
+			}
+
+			res, err := getter.GetLastSegmentsActionsByUserId(r.Context(), models.GetLastSegmentsActionsByUserIdParams{
+				UserID: user.ID,
+				At:     resp.At,
+			})
+			if err != nil {
+				log.Error(err.Error())
+
+				httpserver.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get segments history for user %d", user.ID), log)
+				return
+			}
+			resp.Segments = usecases_user_segments.SegmentsAt(res, resp.At)
+		}
+		if resp.Segments == nil {
+			resp.Segments = []string{}
+		}
+
+		httpserver.RespondWithJSON(w, http.StatusOK, log, resp)
+	}
+}
+
+// @Summary Segments history for user
+// @Description Returns a history of added and deleted segments for a provided user in a given period, ordered as it was recorded.
+// @Description Re-assigning a segment is recorded as updated, changing its expiry as ttl_changed.
+// @Description Every record has the expire_at after the action and, for updates, the previous old_expire_at.
+// @Description The actor and the reason of a change are taken from the X-Actor (or X-Api-Key) and X-Reason (or X-Correlation-Id) headers
+// @Description of the request that made it, expired memberships have the system:expiry actor.
+// @Description CSV with a header row is the default. With format=json or Accept: application/json a page is returned,
+// @Description pass next_cursor from the response as cursor to get the next page.
+// @Description With format=ndjson or Accept: application/x-ndjson, as with CSV, all records after the cursor are streamed in a single response.
+// @Tags Useres in segments
+// @Accept  json
+// @Produce  text/csv,json,application/x-ndjson
 // @ID get-segments-for-user-history
-// @Param userId path int true "User id"
-// @Param from path string true "From datetime"
-// @Param to path string true "To datetime"
-// @Success 200 {object} []string
+// @Param userId path string true "User id or ext:<external id>"
+// @Param from query string true "From datetime"
+// @Param to query string true "To datetime"
+// @Param segment query string false "Only records of this segment"
+// @Param action query string false "Comma separated action types, e.g. inserted,deleted"
+// @Param cursor query int false "next_cursor of the previous page"
+// @Param limit query int false "Page size, 1000 by default, 10000 at most"
+// @Param format query string false "csv (default), json or ndjson"
+// @Success 200 {object} UsersInSegmentsHistoryPageResponse
 // @Failure 400 {object} error
+// @Failure 404 {object} error
 // @Failure 500 {object} error
 // @Router /v1/segments/history/{userId} [get]
 func GetSegmentsHistoryByUser(log *slog.Logger, getter SegmentHistoryGetter) http.HandlerFunc {
@@ -286,76 +581,380 @@ func GetSegmentsHistoryByUser(log *slog.Logger, getter SegmentHistoryGetter) htt
 
 		handlers.SetLogger(log, r.Context(), op)
 
-		userId, err := httpserver.GetUserIdFromParams(w, r, log)
+		from, err := httpserver.GetTimeFromParams(w, r, log, "from", timeFormat)
 		if err != nil {
 			return
 		}
 
-		from, err := httpserver.GetTimeFromParams(w, r, log, "from", timeFormat)
+		to, err := httpserver.GetTimeFromParams(w, r, log, "to", timeFormat)
 		if err != nil {
 			return
 		}
 
-		to, err := httpserver.GetTimeFromParams(w, r, log, "to", timeFormat)
+		params := models.GetSegmentsHistoryByUserIdParams{
+			FromDate:    from,
+			ToDate:      to,
+			SegmentName: usecases_segments.FormatSegmnetName(r.URL.Query().Get("segment")),
+		}
+
+		if actions := r.URL.Query().Get("action"); actions != "" {
+			for _, action := range strings.Split(actions, ",") {
+				if !slices.Contains(historyActions, action) {
+					httpserver.RespondWithError(w, http.StatusBadRequest,
+						fmt.Sprintf("Unknown action %s, expected one of %s", action, strings.Join(historyActions, ", ")), log)
+					return
+				}
+				params.ActionTypes = append(params.ActionTypes, action)
+			}
+		}
+
+		if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+			afterID, err := strconv.ParseInt(cursor, 10, 64)
+			if err != nil {
+				httpserver.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Cursor must be a number: %v", err), log)
+				return
+			}
+			params.AfterID = afterID
+		}
+
+		user, ok := handlers.ResolveUser(w, r, log, getter)
+		if !ok {
+			return
+		}
+		params.UserID = user.ID
+
+		format := httpserver.GetResponseFormatOr(r, httpserver.FormatCSV)
+		if format != httpserver.FormatJSON {
+			streamSegmentsHistory(log, getter, w, r, params, format)
+			return
+		}
+
+		params.PageSize, err = httpserver.GetLimitFromParams(w, r, log, defaultHistoryPageSize, maxHistoryPageSize)
 		if err != nil {
 			return
 		}
 
-		if !checkIfUserExists(getter, log, userId, w, r) {
+		res, err := getter.GetSegmentsHistoryByUserId(r.Context(), params)
+		if err != nil {
+			log.Error(err.Error())
+
+			httpserver.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get segments for user %d", user.ID), log)
 			return
 		}
 
-		res, err := getter.GetSegmentsHistoryByUserId(r.Context(), models.GetSegmentsHistoryByUserIdParams{
-			UserID:   userId,
-			FromDate: from,
-			ToDate:   to,
-		})
+		resp := UsersInSegmentsHistoryPageResponse{
+			History: make([]UsersInSegmentsHistoryResponse, 0, len(res)),
+		}
+		for _, item := range res {
+			resp.History = append(resp.History, transformToUsersInSegmentsHistoryResponse(item))
+		}
+		if len(res) == int(params.PageSize) {
+			resp.NextCursor = res[len(res)-1].ID
+		}
+
+		httpserver.RespondWithJSON(w, http.StatusOK, log, resp)
+	}
+}
+
+// streamSegmentsHistory writes all history records matching params starting after the cursor,
+// reading them from the database in batches.
+func streamSegmentsHistory(log *slog.Logger, getter SegmentHistoryGetter, w http.ResponseWriter, r *http.Request,
+	params models.GetSegmentsHistoryByUserIdParams, format string) {
+	stream := httpserver.NewStreamWriter(w, format, fmt.Sprintf("history_%d", params.UserID))
+
+	if err := stream.WriteHeader(usecases_user_segments.HistoryCSVHeader); err != nil {
+		log.Error("Failed to write response", sl.Err(err))
+		return
+	}
 
+	params.PageSize = historyStreamBatchSize
+	for {
+		res, err := getter.GetSegmentsHistoryByUserId(r.Context(), params)
 		if err != nil {
+			log.Error("Failed to get segments history, response is incomplete", sl.Err(err))
+			return
+		}
+
+		for _, item := range res {
+			if err := stream.WriteRow(usecases_user_segments.HistoryCSVRecord(item), transformToUsersInSegmentsHistoryResponse(item)); err != nil {
+				log.Error("Failed to write response", sl.Err(err))
+				return
+			}
+		}
+		if err := stream.Flush(); err != nil {
+			log.Error("Failed to write response", sl.Err(err))
+			return
+		}
+
+		if len(res) < historyStreamBatchSize {
+			return
+		}
+		params.AfterID = res[len(res)-1].ID
+	}
+}
+
+// @Summary Users in segment
+// @Description Returns users in a segment ordered by id. Pass next_cursor from the response as cursor to get the next page.
+// @Description With format=csv or format=ndjson (or the matching Accept header) all users are streamed in a single response instead.
+// @Tags Useres in segments
+// @Accept  json
+// @Produce  json,text/csv,application/x-ndjson
+// @ID get-users-in-segment
+// @Param name path string true "Segment name"
+// @Param include_expired query bool false "Include users whose TTL has expired but who are not removed yet"
+// @Param include_pending query bool false "Include users whose membership starts in the future"
+// @Param include query string false "Comma separated extra fields: created_at, expire_at, starts_at"
+// @Param cursor query int false "Id of the last user on the previous page"
+// @Param limit query int false "Page size, 1000 by default, 10000 at most"
+// @Param format query string false "json (default), csv or ndjson"
+// @Success 200 {object} SegmentMembersPageResponse
+// @Failure 400 {object} error
+// @Failure 404 {object} error
+// @Failure 500 {object} error
+// @Router /v1/segments/{name}/users [get]
+func GetUsersInSegmentHandler(log *slog.Logger, lister SegmentMembersLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.v1.GetUsersInSegmentHandler"
+
+		handlers.SetLogger(log, r.Context(), op)
+
+		query := segmentMembersQuery{
+			segmentName:    usecases_segments.FormatSegmnetName(chi.URLParam(r, "name")),
+			includeExpired: r.URL.Query().Get("include_expired") == "true",
+			includePending: r.URL.Query().Get("include_pending") == "true",
+		}
+
+		if include := r.URL.Query().Get("include"); include != "" {
+			for _, field := range strings.Split(include, ",") {
+				switch field {
+				case "created_at":
+					query.withCreatedAt = true
+				case "expire_at":
+					query.withExpireAt = true
+				case "starts_at":
+					query.withStartsAt = true
+				default:
+					httpserver.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Unknown field %s, expected created_at, expire_at or starts_at", field), log)
+					return
+				}
+			}
+		}
+
+		if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+			afterUserId, err := strconv.ParseInt(cursor, 10, 64)
+			if err != nil {
+				httpserver.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Cursor must be a number: %v", err), log)
+				return
+			}
+			query.afterUserId = afterUserId
+		}
+
+		if _, err := lister.GetSegmentByName(r.Context(), query.segmentName); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				httpserver.RespondWithError(w, http.StatusNotFound, "Segment does not exist", log)
+				return
+			}
 			log.Error(err.Error())
 
-			httpserver.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get segments for user %d", userId), log)
+			httpserver.RespondWithError(w, http.StatusInternalServerError, "Failed to get segment", log)
+			return
+		}
+
+		format := httpserver.GetResponseFormat(r)
+		if format != httpserver.FormatJSON {
+			streamUsersInSegment(log, lister, w, r, query, format)
+			return
+		}
+
+		limit, err := httpserver.GetLimitFromParams(w, r, log, defaultMembersPageSize, maxMembersPageSize)
+		if err != nil {
+			return
+		}
+
+		res, err := lister.ListUsersInSegment(r.Context(), models.ListUsersInSegmentParams{
+			SegmentName:    query.segmentName,
+			AfterUserID:    query.afterUserId,
+			IncludeExpired: query.includeExpired,
+			IncludePending: query.includePending,
+			PageSize:       limit,
+		})
+		if err != nil {
+			log.Error(err.Error())
+
+			httpserver.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get users in segment %s", query.segmentName), log)
+			return
+		}
+
+		resp := SegmentMembersPageResponse{
+			Users: make([]SegmentMemberResponse, 0, len(res)),
+		}
+		for _, item := range res {
+			resp.Users = append(resp.Users, transformToSegmentMemberResponse(item, query))
+		}
+		if len(res) == int(limit) {
+			resp.NextCursor = res[len(res)-1].UserID
+		}
+
+		httpserver.RespondWithJSON(w, http.StatusOK, log, resp)
+	}
+}
+
+// streamUsersInSegment writes all users of the segment starting after the cursor,
+// reading them from the database in batches.
+func streamUsersInSegment(log *slog.Logger, lister SegmentMembersLister, w http.ResponseWriter, r *http.Request,
+	query segmentMembersQuery, format string) {
+	stream := httpserver.NewStreamWriter(w, format, strings.ToLower(query.segmentName))
+
+	header := []string{"user_id"}
+	if query.withCreatedAt {
+		header = append(header, "created_at")
+	}
+	if query.withExpireAt {
+		header = append(header, "expire_at")
+	}
+	if query.withStartsAt {
+		header = append(header, "starts_at")
+	}
+	if err := stream.WriteHeader(header); err != nil {
+		log.Error("Failed to write response", sl.Err(err))
+		return
+	}
+
+	afterUserId := query.afterUserId
+	for {
+		res, err := lister.ListUsersInSegment(r.Context(), models.ListUsersInSegmentParams{
+			SegmentName:    query.segmentName,
+			AfterUserID:    afterUserId,
+			IncludeExpired: query.includeExpired,
+			IncludePending: query.includePending,
+			PageSize:       membersStreamBatchSize,
+		})
+		if err != nil {
+			log.Error("Failed to get users in segment, response is incomplete", sl.Err(err))
 			return
 		}
 
-		var resp [][]string
 		for _, item := range res {
-			resp = append(resp, transformUsersInSegmentsHistoryToString(item))
+			member := transformToSegmentMemberResponse(item, query)
+			if err := stream.WriteRow(transformSegmentMemberToString(member, query), member); err != nil {
+				log.Error("Failed to write response", sl.Err(err))
+				return
+			}
 		}
+		if err := stream.Flush(); err != nil {
+			log.Error("Failed to write response", sl.Err(err))
+			return
+		}
+
+		if len(res) < membersStreamBatchSize {
+			return
+		}
+		afterUserId = res[len(res)-1].UserID
+	}
+}
+
+func transformToSegmentMemberResponse(userInSegment models.UsersInSegment, query segmentMembersQuery) SegmentMemberResponse {
+	resp := SegmentMemberResponse{
+		UserId: userInSegment.UserID,
+	}
+	if query.withCreatedAt {
+		resp.Created_At = &userInSegment.CreatedAt
+	}
+	if query.withExpireAt && userInSegment.ExpireAt.Valid {
+		resp.Expire_at = &userInSegment.ExpireAt.Time
+	}
+	if query.withStartsAt && userInSegment.StartsAt.Valid {
+		resp.Starts_at = &userInSegment.StartsAt.Time
+	}
+	return resp
+}
 
-		httpserver.RespondWithCSV(w, http.StatusOK, log, resp)
+func transformSegmentMemberToString(member SegmentMemberResponse, query segmentMembersQuery) []string {
+	res := []string{strconv.FormatInt(member.UserId, 10)}
+	if query.withCreatedAt {
+		res = append(res, member.Created_At.Format(timeFormat))
 	}
+	if query.withExpireAt {
+		res = append(res, formatOptionalTime(member.Expire_at))
+	}
+	if query.withStartsAt {
+		res = append(res, formatOptionalTime(member.Starts_at))
+	}
+	return res
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(timeFormat)
 }
 
 func transformToUsersInSegmentsResponse(userInSegment models.UsersInSegment) UsersInSegmentsResponse {
-	return UsersInSegmentsResponse{
+	resp := UsersInSegmentsResponse{
 		UserId:      userInSegment.UserID,
 		SegmentName: userInSegment.SegmentName,
 		Created_At:  userInSegment.CreatedAt,
 		Updated_At:  userInSegment.UpdatedAt,
 		Expire_at:   userInSegment.ExpireAt.Time,
 	}
+	if userInSegment.StartsAt.Valid {
+		resp.Starts_at = &userInSegment.StartsAt.Time
+	}
+	return resp
 }
 
-func transformUsersInSegmentsHistoryToString(userInSegment models.UsersInSegmentsHistory) []string {
-	var res []string
-	res = append(res, strconv.FormatInt(userInSegment.UserID, 10))
-	res = append(res, userInSegment.SegmentName)
-	res = append(res, userInSegment.ActionType)
-	res = append(res, userInSegment.ActionDate.Format("2006-01-02 15:04:05"))
-	return res
+func transformToUsersInSegmentsHistoryResponse(userInSegment models.UsersInSegmentsHistory) UsersInSegmentsHistoryResponse {
+	resp := UsersInSegmentsHistoryResponse{
+		UserId:      userInSegment.UserID,
+		SegmentName: userInSegment.SegmentName,
+		ActionType:  userInSegment.ActionType,
+		ActionDate:  userInSegment.ActionDate,
+		Actor:       userInSegment.Actor.String,
+		Reason:      userInSegment.Reason.String,
+	}
+	if userInSegment.ExpireAt.Valid {
+		resp.ExpireAt = &userInSegment.ExpireAt.Time
+	}
+	if userInSegment.OldExpireAt.Valid {
+		resp.OldExpireAt = &userInSegment.OldExpireAt.Time
+	}
+	return resp
 }
 
-func checkIfUserExists(getter UserGetter, log *slog.Logger, userId int64, w http.ResponseWriter, r *http.Request) bool {
-	if _, err := getter.GetUserById(r.Context(), userId); err != nil {
-		if err == sql.ErrNoRows {
-			httpserver.RespondWithError(w, http.StatusBadRequest, "User does not exist", log)
-			return false
-		}
-		httpserver.RespondWithError(w, http.StatusInternalServerError, "Failed to get user", log)
-		return false
+// shouldCreateUser reports whether an unknown user should be created on assignment.
+// Only users referenced by an external id can be created: internal ids are minted by the service.
+func shouldCreateUser(r *http.Request, ref httpserver.UserRef, createUsers bool) bool {
+	return ref.IsExternal() && (createUsers || r.URL.Query().Get("create_user") == "true")
+}
+
+// newUserName returns the name for a user created by ref: the requested one or, by default,
+// the external id, which then has to be long enough to be a valid user name.
+func newUserName(ref httpserver.UserRef, name string) (string, error) {
+	if name != "" {
+		return name, nil
 	}
-	return true
+	if n := utf8.RuneCountInString(ref.ExternalID); n < 4 || n > 255 {
+		return "", fmt.Errorf("external id %s can not be used as a user name, provide user_name of 4 to 255 characters", ref.ExternalID)
+	}
+	return ref.ExternalID, nil
+}
+
+func respondUserDeleted(w http.ResponseWriter, log *slog.Logger, ref httpserver.UserRef) {
+	httpserver.RespondWithError(w, http.StatusConflict,
+		fmt.Sprintf("User %s was deleted, restore it or wait until it is purged", ref), log)
+}
+
+func getOrCreateUser(ctx context.Context, log *slog.Logger, q storage.Querier, ref httpserver.UserRef, name string) (models.User, error) {
+	user, created, err := usecases_users.GetOrCreateByExternalId(ctx, q, ref.ExternalID, name)
+	if err != nil {
+		return models.User{}, fmt.Errorf("failed to create user %s: %w", ref, err)
+	}
+	if created {
+		log.Info("user created on assignment", slog.Int64("user_id", user.ID), slog.String("external_id", ref.ExternalID))
+	}
+
+	return user, nil
 }
 
 func checkIfSegmentExists(getter SegmentGetter, log *slog.Logger, segment_name string, w http.ResponseWriter, r *http.Request) bool {
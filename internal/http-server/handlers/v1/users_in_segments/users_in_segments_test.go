@@ -0,0 +1,711 @@
+package users_in_segments_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/http-server/handlers/v1/users_in_segments"
+	"github.com/AlexZahvatkin/segments-users-service/internal/http-server/handlers/v1/users_in_segments/mocks"
+	"github.com/AlexZahvatkin/segments-users-service/internal/jobs"
+	slogdiscard "github.com/AlexZahvatkin/segments-users-service/internal/lib/logger/handlers"
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+	storagemocks "github.com/AlexZahvatkin/segments-users-service/internal/storage/mocks"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSegmentsAssignHandler(t *testing.T) {
+	cases := []struct {
+		name        string
+		userId      string
+		query       string
+		body        string
+		scheduled   bool
+		createUsers bool
+		addErr      error
+		statusCode  int
+	}{
+		{
+			name:       "All changes applied",
+			userId:     "1",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Scheduled add",
+			userId:     "1",
+			body:       `{"to_add": ["TEST_ADD"], "starts_at": "2100-01-01T00:00:00Z"}`,
+			scheduled:  true,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Failed add rolls back the whole request",
+			userId:     "1",
+			addErr:     errors.New("insert failed"),
+			statusCode: http.StatusInternalServerError,
+		},
+		{
+			name:       "Unknown external user",
+			userId:     "ext:crm-42",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "Unknown external user created on request",
+			userId:     "ext:crm-42",
+			query:      "?create_user=true",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:        "Unknown external user created by config",
+			userId:      "ext:crm-42",
+			createUsers: true,
+			statusCode:  http.StatusOK,
+		},
+		{
+			name:        "Short external id can not be a user name",
+			userId:      "ext:abc",
+			createUsers: true,
+			statusCode:  http.StatusBadRequest,
+		},
+		{
+			name:        "Short external id with user name",
+			userId:      "ext:abc",
+			body:        `{"to_add": ["TEST_ADD"], "user_name": "Alexander"}`,
+			createUsers: true,
+			statusCode:  http.StatusOK,
+		},
+		{
+			name:        "External id of a deleted user",
+			userId:      "ext:deleted-user",
+			createUsers: true,
+			statusCode:  http.StatusConflict,
+		},
+		{
+			name:        "Internal ids are never created",
+			userId:      "2",
+			query:       "?create_user=true",
+			createUsers: true,
+			statusCode:  http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			querierMock := storagemocks.NewQuerier(t)
+			querierMock.On("GetUserByExternalId", mock.Anything, mock.Anything).Return(models.User{}, sql.ErrNoRows).Maybe()
+			querierMock.On("AddUserIfNotExists", mock.Anything, mock.MatchedBy(func(arg models.AddUserIfNotExistsParams) bool {
+				return *arg.ExternalID == "deleted-user"
+			})).Return(models.User{}, sql.ErrNoRows).Maybe()
+			querierMock.On("AddUserIfNotExists", mock.Anything, mock.Anything).Return(models.User{ID: 3}, nil).Maybe()
+			querierMock.On("SetHistoryAction", mock.Anything, mock.Anything).Return(nil).Maybe()
+			querierMock.On("AddUserIntoRolloutSegments", mock.Anything, int64(3)).Return([]models.UsersInSegment{}, nil).Maybe()
+			querierMock.On("RemoveUserFromSegment", mock.Anything, mock.Anything).Return(nil).Maybe()
+			querierMock.On("AddUserIntoSegment", mock.Anything, mock.Anything).Return(models.UsersInSegment{}, tc.addErr).Maybe()
+			querierMock.On("AddUserIntoSegmentWithExpireDatetime", mock.Anything, mock.MatchedBy(
+				func(arg models.AddUserIntoSegmentWithExpireDatetimeParams) bool {
+					return arg.StartsAt.Valid && arg.StartsAt.Time.Equal(time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)) && !arg.ExpireAt.Valid
+				})).Return(models.UsersInSegment{}, tc.addErr).Maybe()
+
+			assignerMock := mocks.NewSegmentsAssigner(t)
+			assignerMock.On("GetUserById", mock.Anything, int64(1)).Return(models.User{ID: 1}, nil).Maybe()
+			assignerMock.On("GetUserById", mock.Anything, int64(2)).Return(models.User{}, sql.ErrNoRows).Maybe()
+			assignerMock.On("GetUserByExternalId", mock.Anything, "crm-42").Return(models.User{}, sql.ErrNoRows).Maybe()
+			assignerMock.On("GetSegmentByName", mock.Anything, mock.Anything).Return(models.Segment{}, nil).Maybe()
+			assignerMock.On("ExecTx", mock.Anything, mock.Anything).Return(
+				func(_ context.Context, fn func(storage.Querier) error) error {
+					return fn(querierMock)
+				}).Maybe()
+
+			handler := users_in_segments.SegmentsAssignHandler(slogdiscard.NewDiscardLogger(), assignerMock, tc.createUsers)
+			body := `{"to_add": ["TEST_ADD"], "to_delete": ["TEST_DELETE"]}`
+			if tc.body != "" {
+				body = tc.body
+			}
+			req, err := http.NewRequest(http.MethodPost, "/segments/assign/"+tc.userId+tc.query, bytes.NewReader([]byte(body)))
+			require.NoError(t, err)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("userId", tc.userId)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tc.statusCode, rr.Code)
+			if tc.scheduled {
+				querierMock.AssertNotCalled(t, "AddUserIntoSegment", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestSegmentsAssignWithTTLHandler(t *testing.T) {
+	cases := []struct {
+		name       string
+		body       string
+		expireAt   time.Time
+		startsAt   time.Time
+		statusCode int
+	}{
+		{
+			name:       "TTL in hours",
+			body:       `{"segment_name": "TEST_SEGMENT", "ttl": 24}`,
+			expireAt:   time.Now().Add(24 * time.Hour),
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "TTL duration",
+			body:       `{"segment_name": "TEST_SEGMENT", "ttl": "90m"}`,
+			expireAt:   time.Now().Add(90 * time.Minute),
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Expire at",
+			body:       `{"segment_name": "TEST_SEGMENT", "expire_at": "2100-01-01T03:00:00+03:00"}`,
+			expireAt:   time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC),
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Scheduled",
+			body:       `{"segment_name": "TEST_SEGMENT", "starts_at": "2100-01-01T00:00:00Z", "ttl": "3d"}`,
+			startsAt:   time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC),
+			expireAt:   time.Date(2100, 1, 4, 0, 0, 0, 0, time.UTC),
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Scheduled without expiry",
+			body:       `{"segment_name": "TEST_SEGMENT", "starts_at": "2100-01-01T00:00:00Z"}`,
+			startsAt:   time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC),
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Expire at before starts at",
+			body:       `{"segment_name": "TEST_SEGMENT", "starts_at": "2100-01-01T00:00:00Z", "expire_at": "2099-01-01T00:00:00Z"}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Expire at in the past",
+			body:       `{"segment_name": "TEST_SEGMENT", "expire_at": "2000-01-01T00:00:00Z"}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Both ttl and expire_at",
+			body:       `{"segment_name": "TEST_SEGMENT", "ttl": 1, "expire_at": "2100-01-01T00:00:00Z"}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Neither ttl nor expire_at",
+			body:       `{"segment_name": "TEST_SEGMENT"}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Invalid duration",
+			body:       `{"segment_name": "TEST_SEGMENT", "ttl": "soon"}`,
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			querierMock := storagemocks.NewQuerier(t)
+			closeTo := func(actual sql.NullTime, expected time.Time) bool {
+				if expected.IsZero() {
+					return !actual.Valid
+				}
+				return actual.Valid && actual.Time.Location() == time.UTC && actual.Time.Sub(expected).Abs() < time.Minute
+			}
+			querierMock.On("AddUserIntoSegmentWithExpireDatetime", mock.Anything, mock.MatchedBy(
+				func(arg models.AddUserIntoSegmentWithExpireDatetimeParams) bool {
+					return arg.UserID == 1 && arg.SegmentName == "TEST_SEGMENT" &&
+						closeTo(arg.ExpireAt, tc.expireAt) && closeTo(arg.StartsAt, tc.startsAt)
+				})).Return(models.UsersInSegment{UserID: 1, SegmentName: "TEST_SEGMENT"}, nil).Maybe()
+
+			assignerMock := mocks.NewSegmentsAssignerWithTTL(t)
+			assignerMock.On("GetUserById", mock.Anything, int64(1)).Return(models.User{ID: 1}, nil).Maybe()
+			assignerMock.On("GetSegmentByName", mock.Anything, "TEST_SEGMENT").Return(models.Segment{}, nil).Maybe()
+			assignerMock.On("ExecTx", mock.Anything, mock.Anything).Return(
+				func(_ context.Context, fn func(storage.Querier) error) error {
+					return fn(querierMock)
+				}).Maybe()
+
+			handler := users_in_segments.SegmentsAssignWithTTLHandler(slogdiscard.NewDiscardLogger(), assignerMock, false)
+			req, err := http.NewRequest(http.MethodPost, "/segments/ttl/1", bytes.NewReader([]byte(tc.body)))
+			require.NoError(t, err)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("userId", "1")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tc.statusCode, rr.Code)
+		})
+	}
+}
+
+func TestGetUserSegmentsHandler(t *testing.T) {
+	at := time.Date(2023, 9, 5, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name           string
+		userId         string
+		query          string
+		archivedBefore sql.NullTime
+		statusCode     int
+		response       string
+	}{
+		{
+			name:       "Current segments",
+			userId:     "1",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Segments at a past moment",
+			userId:     "1",
+			query:      "?at=2023-09-05T15:00:00%2B03:00",
+			statusCode: http.StatusOK,
+			response:   `{"user_id":1,"at":"2023-09-05T12:00:00Z","segments":["CARRIED","READDED","STILL_ACTIVE"]}`,
+		},
+		{
+			name:           "Moment after the archived history",
+			userId:         "1",
+			query:          "?at=2023-09-05T12:00:00Z",
+			archivedBefore: sql.NullTime{Time: time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+			statusCode:     http.StatusOK,
+			response:       `{"user_id":1,"at":"2023-09-05T12:00:00Z","segments":["CARRIED","READDED","STILL_ACTIVE"]}`,
+		},
+		{
+			name:           "Moment in the archived history",
+			userId:         "1",
+			query:          "?at=2023-09-05T12:00:00Z",
+			archivedBefore: sql.NullTime{Time: time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+			statusCode:     http.StatusBadRequest,
+		},
+		{
+			name:       "Moment in the future",
+			userId:     "1",
+			query:      "?at=2100-01-01T00:00:00Z",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Wrong moment format",
+			userId:     "1",
+			query:      "?at=yesterday",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Unknown user",
+			userId:     "2",
+			query:      "?at=2023-09-05T12:00:00Z",
+			statusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			getterMock := mocks.NewUserSegmentsGetter(t)
+			getterMock.On("GetUserById", mock.Anything, int64(1)).Return(models.User{ID: 1}, nil).Maybe()
+			getterMock.On("GetUserById", mock.Anything, int64(2)).Return(models.User{}, sql.ErrNoRows).Maybe()
+			getterMock.On("GetSegmentsByUserId", mock.Anything, int64(1)).Return([]string{"CURRENT"}, nil).Maybe()
+			getterMock.On("GetLastSegmentsActionsByUserId", mock.Anything, models.GetLastSegmentsActionsByUserIdParams{
+				UserID: 1,
+				At:     at,
+			}).Return([]models.UsersInSegmentsHistory{
+				{SegmentName: "CARRIED", ActionType: models.ActionSnapshot},
+				{SegmentName: "EXPIRED", ActionType: models.ActionInserted, ExpireAt: sql.NullTime{Time: at.Add(-time.Minute), Valid: true}},
+				{SegmentName: "READDED", ActionType: models.ActionInserted},
+				{SegmentName: "REMOVED", ActionType: models.ActionDeleted},
+				{SegmentName: "STILL_ACTIVE", ActionType: models.ActionInserted, ExpireAt: sql.NullTime{Time: at.Add(time.Minute), Valid: true}},
+			}, nil).Maybe()
+			getterMock.On("GetHistoryArchivedBefore", mock.Anything).Return(tc.archivedBefore, nil).Maybe()
+
+			handler := users_in_segments.GetUserSegmentsHandler(slogdiscard.NewDiscardLogger(), getterMock)
+			req, err := http.NewRequest(http.MethodGet, "/users/"+tc.userId+"/segments"+tc.query, nil)
+			require.NoError(t, err)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("userId", tc.userId)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tc.statusCode, rr.Code)
+			if tc.response != "" {
+				require.JSONEq(t, tc.response, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetSegmentsHistoryByUser(t *testing.T) {
+	actionDate := time.Date(2023, 9, 1, 10, 0, 0, 0, time.UTC)
+	expireAt := time.Date(2023, 9, 3, 10, 0, 0, 0, time.UTC)
+	oldExpireAt := time.Date(2023, 9, 2, 10, 0, 0, 0, time.UTC)
+	from := time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2023, 9, 2, 0, 0, 0, 0, time.UTC)
+	history := []models.UsersInSegmentsHistory{
+		{
+			ID:          7,
+			UserID:      1,
+			SegmentName: "TEST_SEGMENT",
+			ActionType:  models.ActionInserted,
+			ActionDate:  actionDate,
+			Actor:       sql.NullString{String: "key:3f2a9c1b7d4e", Valid: true},
+			Reason:      sql.NullString{String: "TICKET-42", Valid: true},
+		},
+		{
+			ID:          9,
+			UserID:      1,
+			SegmentName: "TEST_SEGMENT",
+			ActionType:  models.ActionTTLChanged,
+			ActionDate:  actionDate,
+			ExpireAt:    sql.NullTime{Time: expireAt, Valid: true},
+			OldExpireAt: sql.NullTime{Time: oldExpireAt, Valid: true},
+		},
+	}
+
+	cases := []struct {
+		name       string
+		query      string
+		accept     string
+		params     models.GetSegmentsHistoryByUserIdParams
+		statusCode int
+		response   string
+	}{
+		{
+			name:       "CSV with header by default",
+			query:      "?from=2023-09-01T00:00:00Z&to=2023-09-02T00:00:00Z",
+			params:     models.GetSegmentsHistoryByUserIdParams{UserID: 1, FromDate: from, ToDate: to, PageSize: 5000},
+			statusCode: http.StatusOK,
+			response: "user_id,segment_name,action_type,action_date,expire_at,old_expire_at,actor,reason\n" +
+				"1,TEST_SEGMENT,inserted,2023-09-01 10:00:00,,,key:3f2a9c1b7d4e,TICKET-42\n" +
+				"1,TEST_SEGMENT,ttl_changed,2023-09-01 10:00:00,2023-09-03 10:00:00,2023-09-02 10:00:00,,\n",
+		},
+		{
+			name:       "JSON page by Accept",
+			query:      "?from=2023-09-01T00:00:00Z&to=2023-09-02T00:00:00Z&limit=2",
+			accept:     "application/json",
+			params:     models.GetSegmentsHistoryByUserIdParams{UserID: 1, FromDate: from, ToDate: to, PageSize: 2},
+			statusCode: http.StatusOK,
+			response: `{"history":[{"user_id":1,"segment_name":"TEST_SEGMENT","action_type":"inserted","action_date":"2023-09-01T10:00:00Z",` +
+				`"actor":"key:3f2a9c1b7d4e","reason":"TICKET-42"},` +
+				`{"user_id":1,"segment_name":"TEST_SEGMENT","action_type":"ttl_changed","action_date":"2023-09-01T10:00:00Z",` +
+				`"expire_at":"2023-09-03T10:00:00Z","old_expire_at":"2023-09-02T10:00:00Z"}],"next_cursor":9}`,
+		},
+		{
+			name:   "NDJSON with filters and cursor",
+			query:  "?from=2023-09-01T00:00:00Z&to=2023-09-02T00:00:00Z&segment=test_segment&action=inserted,ttl_changed&cursor=5",
+			accept: "application/x-ndjson",
+			params: models.GetSegmentsHistoryByUserIdParams{
+				UserID:      1,
+				FromDate:    from,
+				ToDate:      to,
+				SegmentName: "TEST_SEGMENT",
+				ActionTypes: []string{models.ActionInserted, models.ActionTTLChanged},
+				AfterID:     5,
+				PageSize:    5000,
+			},
+			statusCode: http.StatusOK,
+			response: `{"user_id":1,"segment_name":"TEST_SEGMENT","action_type":"inserted","action_date":"2023-09-01T10:00:00Z",` +
+				`"actor":"key:3f2a9c1b7d4e","reason":"TICKET-42"}` + "\n" +
+				`{"user_id":1,"segment_name":"TEST_SEGMENT","action_type":"ttl_changed","action_date":"2023-09-01T10:00:00Z",` +
+				`"expire_at":"2023-09-03T10:00:00Z","old_expire_at":"2023-09-02T10:00:00Z"}` + "\n",
+		},
+		{
+			name:       "Unknown action",
+			query:      "?from=2023-09-01T00:00:00Z&to=2023-09-02T00:00:00Z&action=renamed",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Invalid cursor",
+			query:      "?from=2023-09-01T00:00:00Z&to=2023-09-02T00:00:00Z&cursor=last",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			getterMock := mocks.NewSegmentHistoryGetter(t)
+			getterMock.On("GetUserById", mock.Anything, int64(1)).Return(models.User{ID: 1}, nil).Maybe()
+			getterMock.On("GetSegmentsHistoryByUserId", mock.Anything, tc.params).Return(history, nil).Maybe()
+
+			handler := users_in_segments.GetSegmentsHistoryByUser(slogdiscard.NewDiscardLogger(), getterMock)
+			req, err := http.NewRequest(http.MethodGet, "/segments/history/1"+tc.query, nil)
+			require.NoError(t, err)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("userId", "1")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tc.statusCode, rr.Code)
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+			if tc.accept == "application/json" {
+				require.JSONEq(t, tc.response, rr.Body.String())
+			} else {
+				require.Equal(t, tc.response, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetUsersInSegmentHandler(t *testing.T) {
+	createdAt := time.Date(2023, 8, 31, 20, 0, 0, 0, time.UTC)
+	expireAt := createdAt.Add(time.Hour)
+	members := []models.UsersInSegment{
+		{UserID: 1, SegmentName: "TEST_SEGMENT", CreatedAt: createdAt},
+		{UserID: 5, SegmentName: "TEST_SEGMENT", CreatedAt: createdAt, ExpireAt: sql.NullTime{Time: expireAt, Valid: true}},
+	}
+
+	cases := []struct {
+		name       string
+		query      string
+		accept     string
+		segmentErr error
+		params     models.ListUsersInSegmentParams
+		statusCode int
+		body       string
+	}{
+		{
+			name:       "Full page has a cursor",
+			query:      "?limit=2&cursor=0",
+			params:     models.ListUsersInSegmentParams{SegmentName: "TEST_SEGMENT", PageSize: 2},
+			statusCode: http.StatusOK,
+			body:       `{"users":[{"user_id":1},{"user_id":5}],"next_cursor":5}`,
+		},
+		{
+			name:       "Expired users and extra fields",
+			query:      "?include_expired=true&include=expire_at",
+			params:     models.ListUsersInSegmentParams{SegmentName: "TEST_SEGMENT", IncludeExpired: true, PageSize: 1000},
+			statusCode: http.StatusOK,
+			body:       `{"users":[{"user_id":1},{"user_id":5,"expire_at":"2023-08-31T21:00:00Z"}]}`,
+		},
+		{
+			name:       "CSV stream",
+			query:      "?include=created_at,expire_at",
+			accept:     "text/csv",
+			params:     models.ListUsersInSegmentParams{SegmentName: "TEST_SEGMENT", PageSize: 5000},
+			statusCode: http.StatusOK,
+			body: "user_id,created_at,expire_at\n" +
+				"1,2023-08-31T20:00:00Z,\n" +
+				"5,2023-08-31T20:00:00Z,2023-08-31T21:00:00Z\n",
+		},
+		{
+			name:       "NDJSON stream",
+			query:      "?format=ndjson",
+			params:     models.ListUsersInSegmentParams{SegmentName: "TEST_SEGMENT", PageSize: 5000},
+			statusCode: http.StatusOK,
+			body:       "{\"user_id\":1}\n{\"user_id\":5}\n",
+		},
+		{
+			name:       "Unknown field",
+			query:      "?include=name",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Segment does not exist",
+			segmentErr: sql.ErrNoRows,
+			statusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			listerMock := mocks.NewSegmentMembersLister(t)
+			listerMock.On("GetSegmentByName", mock.Anything, "TEST_SEGMENT").Return(models.Segment{}, tc.segmentErr).Maybe()
+			listerMock.On("ListUsersInSegment", mock.Anything, tc.params).Return(members, nil).Maybe()
+
+			handler := users_in_segments.GetUsersInSegmentHandler(slogdiscard.NewDiscardLogger(), listerMock)
+			req, err := http.NewRequest(http.MethodGet, "/segments/test%20segment/users"+tc.query, nil)
+			require.NoError(t, err)
+			req.Header.Set("Accept", tc.accept)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("name", "test segment")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tc.statusCode, rr.Code)
+			if tc.body != "" {
+				require.Equal(t, tc.body, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestAddSegmentMembersBatchHandler(t *testing.T) {
+	cases := []struct {
+		name        string
+		contentType string
+		query       string
+		body        string
+		segmentErr  error
+		statusCode  int
+		response    string
+	}{
+		{
+			name:       "JSON batch",
+			body:       `{"users": [{"user_id": 1}, {"user_id": 2, "ttl": "3d"}, {"user_id": 3}, {"user_id": 1}]}`,
+			statusCode: http.StatusOK,
+			response: `{"total":3,"added":1,"updated":1,"failed":1,"results":[` +
+				`{"user_id":1,"status":"added"},` +
+				`{"user_id":2,"status":"updated","expire_at":"2023-09-01T00:00:00Z"},` +
+				`{"user_id":3,"status":"failed","error":"User does not exist"}]}`,
+		},
+		{
+			name:        "CSV batch with header",
+			contentType: "text/csv",
+			body:        "user_id,ttl\n1\n2,24\n3,\n",
+			statusCode:  http.StatusOK,
+		},
+		{
+			name:        "CSV batch with expire_at",
+			contentType: "text/csv",
+			body:        "1\n2,2100-01-01T00:00:00Z\n3\n",
+			statusCode:  http.StatusOK,
+		},
+		{
+			name:        "NDJSON batch",
+			contentType: "application/x-ndjson",
+			body:        "{\"user_id\": 1}\n\n{\"user_id\": 2, \"expire_at\": \"2100-01-01T00:00:00Z\"}\n{\"user_id\": 3}\n",
+			statusCode:  http.StatusOK,
+		},
+		{
+			name:        "Invalid CSV line",
+			contentType: "text/csv",
+			body:        "1\nabc\n",
+			statusCode:  http.StatusBadRequest,
+			response:    `{"error":"Invalid batch: line 2: user_id must be a number"}`,
+		},
+		{
+			name:        "Invalid NDJSON line",
+			contentType: "application/x-ndjson",
+			body:        "{\"user_id\": 1}\n{\"user_id\": 2, \"ttl\": -1}\n",
+			statusCode:  http.StatusBadRequest,
+		},
+		{
+			name:       "Expire at in the past",
+			body:       `{"users": [{"user_id": 1, "expire_at": "2000-01-01T00:00:00Z"}]}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Both ttl and expire_at",
+			body:       `{"users": [{"user_id": 1, "ttl": "1h", "expire_at": "2100-01-01T00:00:00Z"}]}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Empty batch",
+			body:       `{"users": []}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:        "Too large batch",
+			contentType: "text/csv",
+			body:        "1\n2\n3\n4\n5\n6\n",
+			statusCode:  http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "Too large JSON batch",
+			body:       `{"users": [{"user_id": 1}, {"user_id": 2}, {"user_id": 3}, {"user_id": 4}, {"user_id": 5}, {"user_id": 6}, {"user_id": "not read"}]}`,
+			statusCode: http.StatusRequestEntityTooLarge,
+			response:   `{"error":"Batch must contain at most 5 users"}`,
+		},
+		{
+			name:       "Too large body",
+			body:       `{"comment": "` + strings.Repeat("x", 1024) + `", "users": [{"user_id": 1}]}`,
+			statusCode: http.StatusRequestEntityTooLarge,
+			response:   `{"error":"Request body must be at most 1024 bytes"}`,
+		},
+		{
+			name:       "Users is not an array",
+			body:       `{"users": {"user_id": 1}}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:        "Large batch is applied by a job",
+			contentType: "text/csv",
+			body:        "1\n2\n3\n4\n",
+			statusCode:  http.StatusAccepted,
+			response:    `{"job_id":7}`,
+		},
+		{
+			name:       "Async batch",
+			query:      "?async=true",
+			body:       `{"users": [{"user_id": 1}]}`,
+			statusCode: http.StatusAccepted,
+			response:   `{"job_id":7}`,
+		},
+		{
+			name:       "Unknown segment",
+			body:       `{"users": [{"user_id": 1}]}`,
+			segmentErr: sql.ErrNoRows,
+			statusCode: http.StatusNotFound,
+		},
+	}
+
+	expireAt := time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			adderMock := mocks.NewSegmentMembersBatchAdder(t)
+			adderMock.On("GetSegmentByName", mock.Anything, "TEST_SEGMENT").Return(models.Segment{}, tc.segmentErr).Maybe()
+			adderMock.On("AddUsersIntoSegmentBatch", mock.Anything, mock.MatchedBy(func(arg models.AddUsersIntoSegmentBatchParams) bool {
+				return arg.SegmentName == "TEST_SEGMENT" &&
+					assert.ObjectsAreEqual([]int64{1, 2, 3}, arg.UserIds) &&
+					len(arg.ExpireAt) == 3 && !arg.ExpireAt[0].Valid && arg.ExpireAt[1].Valid && !arg.ExpireAt[2].Valid
+			})).Return([]models.AddUsersIntoSegmentBatchRow{
+				{UserID: 2, UserExists: true, ExpireAt: sql.NullTime{Time: expireAt, Valid: true}},
+				{UserID: 1, UserExists: true, Inserted: true},
+				{UserID: 3},
+			}, nil).Maybe()
+			adderMock.On("CreateJob", mock.Anything, mock.MatchedBy(func(arg models.CreateJobParams) bool {
+				return arg.Kind == jobs.KindSegmentMembersBatch
+			})).Return(models.Job{ID: 7}, nil).Maybe()
+
+			handler := users_in_segments.AddSegmentMembersBatchHandler(slogdiscard.NewDiscardLogger(), adderMock, 3, 5, 1024)
+			req, err := http.NewRequest(http.MethodPost, "/segments/test_segment/members:batch"+tc.query, bytes.NewReader([]byte(tc.body)))
+			require.NoError(t, err)
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("name", "test_segment")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tc.statusCode, rr.Code)
+			if tc.response != "" {
+				require.JSONEq(t, tc.response, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package mwaudit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/lib/audit"
+)
+
+const (
+	HeaderActor         = "X-Actor"
+	HeaderAPIKey        = "X-Api-Key"
+	HeaderReason        = "X-Reason"
+	HeaderCorrelationID = "X-Correlation-Id"
+
+	maxHeaderLength = 255
+)
+
+// New attaches the actor and the reason of a request to its context.
+// The actor is the X-Actor header (a service name) or, without it, a fingerprint of X-Api-Key:
+// the key itself is never stored. The reason is the X-Reason header or the X-Correlation-Id.
+func New() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			a := audit.Audit{
+				Actor:  header(r, HeaderActor),
+				Reason: header(r, HeaderReason),
+			}
+			if a.Actor == "" {
+				if key := r.Header.Get(HeaderAPIKey); key != "" {
+					sum := sha256.Sum256([]byte(key))
+					a.Actor = "key:" + hex.EncodeToString(sum[:])[:12]
+				} else {
+					a.Actor = audit.ActorAPI
+				}
+			}
+			if a.Reason == "" {
+				a.Reason = header(r, HeaderCorrelationID)
+			}
+
+			next.ServeHTTP(w, r.WithContext(audit.WithAudit(r.Context(), a)))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+func header(r *http.Request, name string) string {
+	v := strings.TrimSpace(r.Header.Get(name))
+	if utf8.RuneCountInString(v) > maxHeaderLength {
+		v = string([]rune(v)[:maxHeaderLength])
+	}
+	return v
+}
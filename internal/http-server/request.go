@@ -6,25 +6,54 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi"
 )
 
-func GetUserIdFromParams(w http.ResponseWriter, r *http.Request, log *slog.Logger) (int64, error) {
+const externalIdPrefix = "ext:"
+
+// UserRef identifies a user in the URL either by the internal id or, with the ext: prefix, by the external id.
+type UserRef struct {
+	ID         int64
+	ExternalID string
+}
+
+func (u UserRef) IsExternal() bool {
+	return u.ExternalID != ""
+}
+
+func (u UserRef) String() string {
+	if u.IsExternal() {
+		return externalIdPrefix + u.ExternalID
+	}
+	return strconv.FormatInt(u.ID, 10)
+}
+
+func GetUserRefFromParams(w http.ResponseWriter, r *http.Request, log *slog.Logger) (UserRef, error) {
 	s := chi.URLParam(r, "userId")
 	log.Debug("Param is " + s)
 	if s == "" {
 		RespondWithError(w, http.StatusBadRequest, "You must provide userId", log)
-		return -1, errors.New("No parameter provided")
+		return UserRef{}, errors.New("No parameter provided")
+	}
+	if externalId, ok := strings.CutPrefix(s, externalIdPrefix); ok {
+		externalId, err := url.PathUnescape(externalId)
+		if err != nil || externalId == "" {
+			RespondWithError(w, http.StatusBadRequest, "Invalid external user id", log)
+			return UserRef{}, errors.New("Invalid external user id")
+		}
+		return UserRef{ExternalID: externalId}, nil
 	}
 	userId, err := strconv.ParseInt(s, 10, 64)
 	if err != nil {
-		RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("User id must be a number: %v", err), log)
-		return -1, err
+		RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("User id must be a number or ext:<external id>: %v", err), log)
+		return UserRef{}, err
 	}
-	return userId, nil
+	return UserRef{ID: userId}, nil
 }
 
 func GetTimeFromParams(w http.ResponseWriter, r *http.Request, log *slog.Logger, paramName string, timeFormat string) (time.Time, error) {
@@ -50,3 +79,30 @@ func DecodeRequsetBody[t any](w http.ResponseWriter, r *http.Request, req t, log
 	}
 	return req, nil
 }
+
+// GetRequestFormat picks the request body format from the Content-Type header. JSON is the default.
+func GetRequestFormat(r *http.Request) string {
+	contentType := r.Header.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(contentType, "text/csv"):
+		return FormatCSV
+	case strings.HasPrefix(contentType, "application/x-ndjson"):
+		return FormatNDJSON
+	}
+	return FormatJSON
+}
+
+// GetLimitFromParams reads an optional page size from the limit query parameter.
+// defaultLimit is used when the parameter is absent, values above maxLimit are rejected.
+func GetLimitFromParams(w http.ResponseWriter, r *http.Request, log *slog.Logger, defaultLimit int32, maxLimit int32) (int32, error) {
+	s := r.URL.Query().Get("limit")
+	if s == "" {
+		return defaultLimit, nil
+	}
+	limit, err := strconv.ParseInt(s, 10, 32)
+	if err != nil || limit < 1 || limit > int64(maxLimit) {
+		RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Limit must be a number from 1 to %d", maxLimit), log)
+		return 0, errors.New("Invalid limit")
+	}
+	return int32(limit), nil
+}
@@ -3,8 +3,11 @@ package httpserver
 import (
 	"encoding/csv"
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/AlexZahvatkin/segments-users-service/internal/utils/validator"
 	"github.com/go-playground/validator/v10"
@@ -12,7 +15,7 @@ import (
 
 func RespondWithError(w http.ResponseWriter, code int, msg string, log *slog.Logger) {
 	if code > 499 {
-		log.Error("Responding with 5XX error:", msg)
+		log.Error("Responding with 5XX error", slog.String("error", msg))
 	}
 
 	log.Error(msg)
@@ -29,7 +32,7 @@ func RespondWithError(w http.ResponseWriter, code int, msg string, log *slog.Log
 func RespondWithJSON(w http.ResponseWriter, code int, log *slog.Logger, payload interface{}) {
 	dat, err := json.Marshal(payload)
 	if err != nil {
-		log.Error("Failed to marshal JSON response: %v", payload)
+		log.Error("Failed to marshal JSON response", slog.Any("payload", payload))
 		w.WriteHeader(500)
 		return
 	}
@@ -38,18 +41,104 @@ func RespondWithJSON(w http.ResponseWriter, code int, log *slog.Logger, payload
 	w.Write(dat)
 }
 
-func RespondWithCSV(w http.ResponseWriter, code int, log *slog.Logger, payload [][]string) {
-	w.Header().Set("Content-Type", "text/csv")
-	w.Header().Set("Content-Disposition", "attachment;filename=report.csv")
-
-	writer := csv.NewWriter(w)
-	if err := writer.WriteAll(payload); err != nil {
-		log.Error("Failed to write CSV response: %v", payload)
-	}
-}
-
 func RespondWithValidateError(w http.ResponseWriter, log *slog.Logger, err error) {
 	validateErr := err.(validator.ValidationErrors)
 	msg := validator_utils.ValidationError(validateErr)
 	RespondWithError(w, http.StatusBadRequest, msg, log)
 }
+
+const (
+	FormatJSON   = "json"
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// GetResponseFormat picks the response format from the format query parameter
+// or, if it is absent, from the Accept header. JSON is the default.
+func GetResponseFormat(r *http.Request) string {
+	return GetResponseFormatOr(r, FormatJSON)
+}
+
+// GetResponseFormatOr is GetResponseFormat for endpoints with another default format.
+func GetResponseFormatOr(r *http.Request, defaultFormat string) string {
+	switch r.URL.Query().Get("format") {
+	case FormatCSV:
+		return FormatCSV
+	case FormatNDJSON:
+		return FormatNDJSON
+	case FormatJSON:
+		return FormatJSON
+	}
+
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "text/csv"):
+		return FormatCSV
+	case strings.Contains(accept, "application/x-ndjson"):
+		return FormatNDJSON
+	case strings.Contains(accept, "application/json"):
+		return FormatJSON
+	}
+	return defaultFormat
+}
+
+// StreamWriter writes a CSV or NDJSON response row by row, so large result sets
+// never have to be loaded into memory. Once the first row is written the status
+// is sent, so errors after that can only be logged.
+type StreamWriter struct {
+	w      http.ResponseWriter
+	rc     *http.ResponseController
+	format string
+	csv    *csv.Writer
+	json   *json.Encoder
+}
+
+// NewStreamWriter sets the response headers for the format and lifts the server write timeout,
+// which is meant for regular requests and would cut a long download.
+func NewStreamWriter(w http.ResponseWriter, format string, filename string) *StreamWriter {
+	s := &StreamWriter{
+		w:      w,
+		rc:     http.NewResponseController(w),
+		format: format,
+	}
+
+	_ = s.rc.SetWriteDeadline(time.Time{})
+
+	if format == FormatCSV {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment;filename=%s.csv", filename))
+		s.csv = csv.NewWriter(w)
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		s.json = json.NewEncoder(w)
+	}
+
+	return s
+}
+
+// WriteHeader writes the CSV header row. It does nothing for NDJSON.
+func (s *StreamWriter) WriteHeader(header []string) error {
+	if s.csv == nil {
+		return nil
+	}
+	return s.csv.Write(header)
+}
+
+// WriteRow writes record as a CSV row or object as a JSON line, depending on the format.
+func (s *StreamWriter) WriteRow(record []string, object any) error {
+	if s.csv != nil {
+		return s.csv.Write(record)
+	}
+	return s.json.Encode(object)
+}
+
+// Flush sends everything written so far to the client.
+func (s *StreamWriter) Flush() error {
+	if s.csv != nil {
+		s.csv.Flush()
+		if err := s.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return s.rc.Flush()
+}
@@ -0,0 +1,101 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+	"github.com/AlexZahvatkin/segments-users-service/internal/use-cases/user_segments"
+)
+
+const (
+	KindHistoryReport = "history_report"
+
+	// reportProgressEvery is how many history records are written between progress reports.
+	reportProgressEvery = 100000
+)
+
+type HistoryReportPayload struct {
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	SegmentName string    `json:"segment_name,omitempty"`
+	Gzip        bool      `json:"gzip"`
+}
+
+func (p HistoryReportPayload) Params() models.HistoryReportParams {
+	return models.HistoryReportParams{
+		FromDate:    p.From.UTC(),
+		ToDate:      p.To.UTC(),
+		SegmentName: p.SegmentName,
+	}
+}
+
+// NewHistoryReportHandler writes a history report into the blob store under reports/<job id>/<filename>
+// and records it in the reports table, from which it is removed after retention.
+// The report is streamed from the database cursor straight into the store. A restarted job
+// writes the report anew, replacing whatever the interrupted attempt has written.
+func NewHistoryReportHandler(store storage.Storage, blobs storage.BlobStore, retention time.Duration) Handler {
+	return func(ctx context.Context, job models.Job, report func(Progress) error) error {
+		var payload HistoryReportPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return err
+		}
+
+		params := payload.Params()
+		filename := usecases_user_segments.HistoryReportFilename(params, payload.Gzip)
+		key := fmt.Sprintf("reports/%d/%s", job.ID, filename)
+
+		progress := Progress{Total: job.Total, Affected: job.Affected}
+		if len(job.Checkpoint) > 0 {
+			progress.Checkpoint = job.Checkpoint
+		}
+		reporter := historyProgress{HistoryReporter: store, report: report, progress: progress}
+		size, records, err := usecases_user_segments.PutHistoryReport(ctx, reporter, blobs, key, params, payload.Gzip)
+		if err != nil {
+			return err
+		}
+
+		if err := report(Progress{Total: records, Processed: records, Affected: records}); err != nil {
+			return err
+		}
+
+		_, err = store.CreateReport(ctx, models.CreateReportParams{
+			JobID:       job.ID,
+			BlobKey:     key,
+			Filename:    filename,
+			ContentType: usecases_user_segments.HistoryReportContentType(payload.Gzip),
+			Size:        size,
+			Records:     records,
+			ExpireAt:    time.Now().Add(retention).UTC(),
+		})
+		return err
+	}
+}
+
+// historyProgress reports the number of records read every reportProgressEvery records,
+// so a long report shows its progress and can be cancelled. The rest of progress is kept
+// as it was last reported.
+type historyProgress struct {
+	storage.HistoryReporter
+	report   func(Progress) error
+	progress Progress
+}
+
+func (h historyProgress) ReportSegmentsHistory(ctx context.Context, arg models.HistoryReportParams,
+	fn func(models.UsersInSegmentsHistory) error) error {
+	progress := h.progress
+	progress.Processed = 0
+	return h.HistoryReporter.ReportSegmentsHistory(ctx, arg, func(item models.UsersInSegmentsHistory) error {
+		if err := fn(item); err != nil {
+			return err
+		}
+		progress.Processed++
+		if progress.Processed%reportProgressEvery == 0 {
+			return h.report(progress)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,179 @@
+package jobs_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/jobs"
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryReportHandler(t *testing.T) {
+	history := []models.UsersInSegmentsHistory{
+		{ID: 1, UserID: 1, SegmentName: "TEST_SEGMENT", ActionType: models.ActionInserted,
+			ActionDate: time.Date(2023, 9, 1, 10, 0, 0, 0, time.UTC)},
+		{ID: 2, UserID: 2, SegmentName: "TEST_SEGMENT", ActionType: models.ActionDeleted,
+			ActionDate: time.Date(2023, 9, 2, 10, 0, 0, 0, time.UTC)},
+	}
+	params := models.HistoryReportParams{
+		FromDate:    time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC),
+		ToDate:      time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC),
+		SegmentName: "TEST_SEGMENT",
+	}
+	key := "reports/7/history_TEST_SEGMENT_2023-09.csv"
+
+	cases := []struct {
+		name      string
+		reportErr error
+		putErr    error
+	}{
+		{
+			name: "Report stored",
+		},
+		{
+			name:      "Database fails",
+			reportErr: errors.New("connection reset"),
+		},
+		{
+			name:   "Blob store fails",
+			putErr: errors.New("disk full"),
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			storageMock := mocks.NewStorage(t)
+			storageMock.On("ReportSegmentsHistory", mock.Anything, params, mock.Anything).Return(
+				func(_ context.Context, _ models.HistoryReportParams, fn func(models.UsersInSegmentsHistory) error) error {
+					if tc.reportErr != nil {
+						return tc.reportErr
+					}
+					for _, h := range history {
+						if err := fn(h); err != nil {
+							return err
+						}
+					}
+					return nil
+				})
+
+			blobs := &memBlobStore{putErr: tc.putErr}
+			if tc.reportErr == nil && tc.putErr == nil {
+				storageMock.On("CreateReport", mock.Anything, mock.MatchedBy(func(arg models.CreateReportParams) bool {
+					return arg.JobID == 7 && arg.BlobKey == key && arg.Filename == "history_TEST_SEGMENT_2023-09.csv" &&
+						arg.ContentType == "text/csv" && arg.Size == int64(len(blobs.blobs[key])) && arg.Records == 2 &&
+						time.Until(arg.ExpireAt) > 23*time.Hour
+				})).Return(models.Report{}, nil).Once()
+			}
+
+			payload, err := json.Marshal(jobs.HistoryReportPayload{
+				From:        params.FromDate,
+				To:          params.ToDate,
+				SegmentName: "TEST_SEGMENT",
+			})
+			require.NoError(t, err)
+
+			var reports []jobs.Progress
+			handler := jobs.NewHistoryReportHandler(storageMock, blobs, 24*time.Hour)
+			err = handler(context.Background(), models.Job{ID: 7, Kind: jobs.KindHistoryReport, Payload: payload},
+				func(p jobs.Progress) error {
+					reports = append(reports, p)
+					return nil
+				})
+
+			switch {
+			case tc.reportErr != nil:
+				require.ErrorIs(t, err, tc.reportErr)
+			case tc.putErr != nil:
+				require.ErrorIs(t, err, tc.putErr)
+			default:
+				require.NoError(t, err)
+				require.Equal(t, "user_id,segment_name,action_type,action_date,expire_at,old_expire_at,actor,reason\n"+
+					"1,TEST_SEGMENT,inserted,2023-09-01 10:00:00,,,,\n"+
+					"2,TEST_SEGMENT,deleted,2023-09-02 10:00:00,,,,\n", blobs.blobs[key])
+				require.Equal(t, []jobs.Progress{{Total: 2, Processed: 2, Affected: 2}}, reports)
+			}
+		})
+	}
+}
+
+func TestHistoryReportHandlerKeepsProgress(t *testing.T) {
+	const records = 100000
+
+	storageMock := mocks.NewStorage(t)
+	storageMock.On("ReportSegmentsHistory", mock.Anything, mock.Anything, mock.Anything).Return(
+		func(_ context.Context, _ models.HistoryReportParams, fn func(models.UsersInSegmentsHistory) error) error {
+			for i := int64(1); i <= records; i++ {
+				if err := fn(models.UsersInSegmentsHistory{ID: i, UserID: i, SegmentName: "TEST_SEGMENT"}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	storageMock.On("CreateReport", mock.Anything, mock.Anything).Return(models.Report{}, nil).Once()
+
+	payload, err := json.Marshal(jobs.HistoryReportPayload{
+		From: time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC),
+	})
+	require.NoError(t, err)
+
+	var reports []jobs.Progress
+	handler := jobs.NewHistoryReportHandler(storageMock, &memBlobStore{}, 24*time.Hour)
+	err = handler(context.Background(), models.Job{ID: 7, Kind: jobs.KindHistoryReport, Payload: payload, Total: 5, Affected: 3},
+		func(p jobs.Progress) error {
+			reports = append(reports, p)
+			return nil
+		})
+	require.NoError(t, err)
+	require.Equal(t, []jobs.Progress{
+		{Total: 5, Processed: records, Affected: 3},
+		{Total: records, Processed: records, Affected: records},
+	}, reports)
+}
+
+// memBlobStore keeps blobs in memory. Put fails with putErr without reading anything if it is set.
+type memBlobStore struct {
+	putErr error
+	blobs  map[string]string
+}
+
+func (s *memBlobStore) Put(_ context.Context, key string, r io.Reader) (int64, error) {
+	if s.putErr != nil {
+		return 0, s.putErr
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	if s.blobs == nil {
+		s.blobs = make(map[string]string)
+	}
+	s.blobs[key] = string(data)
+	return int64(len(data)), nil
+}
+
+func (s *memBlobStore) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	data, ok := s.blobs[key]
+	if !ok {
+		return nil, storage.ErrBlobNotFound
+	}
+	return io.NopCloser(strings.NewReader(data)), nil
+}
+
+func (s *memBlobStore) Delete(_ context.Context, key string) error {
+	delete(s.blobs, key)
+	return nil
+}
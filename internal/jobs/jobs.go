@@ -0,0 +1,260 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/lib/audit"
+	"github.com/AlexZahvatkin/segments-users-service/internal/lib/logger"
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+)
+
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+var (
+	ErrCancelled = errors.New("job cancelled")
+	// ErrLost is returned from report when the job is no longer run by this attempt:
+	// it has been found stale and requeued or failed, and may already be run by another worker.
+	ErrLost = errors.New("job is no longer run by this attempt")
+)
+
+// Progress is saved after every report. Checkpoint is stored as JSON and handed back
+// to the handler in models.Job.Checkpoint when an interrupted job is resumed.
+type Progress struct {
+	Total      int64
+	Processed  int64
+	Affected   int64
+	Checkpoint any
+}
+
+// Handler executes a claimed job and reports its progress through report.
+// A handler must stop and return ctx.Err() once ctx is cancelled, and return the error
+// from report as is: it is ErrCancelled when the job has been cancelled through the API
+// and ErrLost when the job has been taken away from this run.
+type Handler func(ctx context.Context, job models.Job, report func(Progress) error) error
+
+// NewJobParams prepares a job of the given kind. The job keeps the audit of ctx,
+// so the changes it makes are recorded in the history under the actor who requested it.
+func NewJobParams(ctx context.Context, kind string, payload json.RawMessage) models.CreateJobParams {
+	a, _ := audit.FromContext(ctx)
+	return models.CreateJobParams{
+		Kind:    kind,
+		Payload: payload,
+		Actor:   a.Actor,
+		Reason:  a.Reason,
+	}
+}
+
+type Config struct {
+	Workers      int
+	PollInterval time.Duration
+	// StaleAfter is how long a running job may go without reporting progress
+	// before it is considered abandoned by a crashed instance and requeued.
+	StaleAfter  time.Duration
+	MaxAttempts int32
+}
+
+// Pool runs queued jobs from the jobs table on a fixed number of workers.
+type Pool struct {
+	log      *slog.Logger
+	storage  storage.Querier
+	handlers map[string]Handler
+	cfg      Config
+}
+
+func NewPool(log *slog.Logger, storage storage.Querier, cfg Config) *Pool {
+	return &Pool{
+		log:      log.With(slog.String("component", "jobs")),
+		storage:  storage,
+		handlers: make(map[string]Handler),
+		cfg:      cfg,
+	}
+}
+
+// Register sets the handler for jobs of the given kind. It must be called before Run.
+func (p *Pool) Register(kind string, handler Handler) {
+	p.handlers[kind] = handler
+}
+
+// Run starts the workers and blocks until ctx is cancelled and all of them have stopped.
+func (p *Pool) Run(ctx context.Context) {
+	p.log.Info("job workers started", slog.Int("workers", p.cfg.Workers))
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		p.requeueStale(ctx)
+	}()
+
+	for i := 0; i < p.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.work(ctx)
+		}()
+	}
+	wg.Wait()
+
+	p.log.Info("job workers stopped")
+}
+
+// requeueStale puts jobs abandoned by crashed instances back to the queue,
+// once on start and then every StaleAfter.
+func (p *Pool) requeueStale(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.StaleAfter)
+	defer ticker.Stop()
+
+	for {
+		n, err := p.storage.RequeueStaleJobs(ctx, models.RequeueStaleJobsParams{
+			MaxAttempts:       p.cfg.MaxAttempts,
+			StaleAfterSeconds: p.cfg.StaleAfter.Seconds(),
+		})
+		if err != nil && ctx.Err() == nil {
+			p.log.Error("failed to requeue stale jobs", sl.Err(err))
+		}
+		if n > 0 {
+			p.log.Info("stale jobs requeued", slog.Int64("count", n))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Pool) work(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain the queue before going back to sleep.
+		for ctx.Err() == nil && p.runNext(ctx) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runNext claims and runs a single job. It reports whether a job was claimed.
+func (p *Pool) runNext(ctx context.Context) bool {
+	job, err := p.storage.ClaimNextJob(ctx)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) && ctx.Err() == nil {
+			p.log.Error("failed to claim job", sl.Err(err))
+		}
+		return false
+	}
+
+	log := p.log.With(slog.Int64("job_id", job.ID), slog.String("kind", job.Kind))
+	log.Info("job started", slog.Int("attempt", int(job.Attempts)))
+
+	err = p.execute(ctx, job)
+	switch {
+	case err == nil:
+		log.Info("job succeeded")
+		p.finish(log, job, StatusSucceeded, nil)
+	case errors.Is(err, ErrCancelled):
+		log.Info("job cancelled")
+	case errors.Is(err, ErrLost):
+		log.Warn("job stopped", sl.Err(err))
+	case ctx.Err() != nil:
+		// The service is stopping: put the job back so it resumes from its checkpoint after restart.
+		log.Info("job interrupted, requeueing")
+		if err := p.storage.RequeueJob(context.Background(), job.ID); err != nil {
+			log.Error("failed to requeue job", sl.Err(err))
+		}
+	default:
+		log.Error("job failed", sl.Err(err))
+		p.finish(log, job, StatusFailed, err)
+	}
+
+	return true
+}
+
+func (p *Pool) execute(ctx context.Context, job models.Job) error {
+	handler, ok := p.handlers[job.Kind]
+	if !ok {
+		return fmt.Errorf("unknown job kind %s", job.Kind)
+	}
+
+	a := audit.Audit{Actor: job.Actor, Reason: job.Reason}
+	if a.Actor == "" {
+		a.Actor = audit.ActorJobs
+	}
+	ctx = audit.WithAudit(ctx, a)
+
+	return handler(ctx, job, func(progress Progress) error {
+		checkpoint, err := json.Marshal(progress.Checkpoint)
+		if err != nil {
+			return err
+		}
+
+		status, err := p.storage.UpdateJobProgress(ctx, models.UpdateJobProgressParams{
+			Total:      progress.Total,
+			Processed:  progress.Processed,
+			Affected:   progress.Affected,
+			Checkpoint: checkpoint,
+			ID:         job.ID,
+			Attempts:   job.Attempts,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			// The progress is saved only while this attempt runs the job, look up what happened to it.
+			current, err := p.storage.GetJobById(ctx, job.ID)
+			if err != nil {
+				return err
+			}
+			if current.Status == StatusRunning && current.Attempts != job.Attempts {
+				return fmt.Errorf("%w: it is run by attempt %d", ErrLost, current.Attempts)
+			}
+			status = current.Status
+		} else if err != nil {
+			return err
+		}
+
+		switch status {
+		case StatusRunning:
+			return nil
+		case StatusCancelled:
+			return ErrCancelled
+		default:
+			return fmt.Errorf("%w: it is %s", ErrLost, status)
+		}
+	})
+}
+
+func (p *Pool) finish(log *slog.Logger, job models.Job, status string, jobErr error) {
+	var errMsg sql.NullString
+	if jobErr != nil {
+		errMsg = sql.NullString{String: jobErr.Error(), Valid: true}
+	}
+
+	if err := p.storage.FinishJob(context.Background(), models.FinishJobParams{
+		Status:   status,
+		Error:    errMsg,
+		ID:       job.ID,
+		Attempts: job.Attempts,
+	}); err != nil {
+		log.Error("failed to save job status", sl.Err(err))
+	}
+}
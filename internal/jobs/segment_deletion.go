@@ -0,0 +1,78 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+)
+
+const (
+	KindSegmentDeletion = "segment_deletion"
+)
+
+type SegmentDeletionPayload struct {
+	SegmentName string `json:"segment_name"`
+}
+
+// NewSegmentDeletionHandler removes all users from a segment batchSize at a time
+// and then deletes the segment itself, so no single statement has to delete millions of rows.
+// The removals are recorded in the history as segment_deleted, the same way as a synchronous deletion,
+// so restoring the segment brings its users back.
+func NewSegmentDeletionHandler(store storage.Storage, batchSize int32) Handler {
+	return func(ctx context.Context, job models.Job, report func(Progress) error) error {
+		var payload SegmentDeletionPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return err
+		}
+
+		remaining, err := store.CountUsersInSegment(ctx, payload.SegmentName)
+		if err != nil {
+			return err
+		}
+
+		progress := Progress{
+			Total:     job.Processed + remaining,
+			Processed: job.Processed,
+			Affected:  job.Affected,
+		}
+		if err := report(progress); err != nil {
+			return err
+		}
+
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			var deleted int64
+			err := store.ExecTx(ctx, func(q storage.Querier) error {
+				if err := q.SetHistoryAction(ctx, models.ActionSegmentDeleted); err != nil {
+					return err
+				}
+
+				var err error
+				deleted, err = q.RemoveUsersBatchFromSegment(ctx, models.RemoveUsersBatchFromSegmentParams{
+					SegmentName: payload.SegmentName,
+					BatchSize:   batchSize,
+				})
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			if deleted == 0 {
+				break
+			}
+
+			progress.Processed += deleted
+			progress.Affected += deleted
+			if err := report(progress); err != nil {
+				return err
+			}
+		}
+
+		return store.DeleteSegment(ctx, payload.SegmentName)
+	}
+}
@@ -0,0 +1,49 @@
+package jobs_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/jobs"
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSegmentDeletionHandler(t *testing.T) {
+	params := models.RemoveUsersBatchFromSegmentParams{SegmentName: "TEST_SEGMENT", BatchSize: 2}
+
+	querierMock := mocks.NewQuerier(t)
+	querierMock.On("SetHistoryAction", mock.Anything, models.ActionSegmentDeleted).Return(nil)
+	querierMock.On("RemoveUsersBatchFromSegment", mock.Anything, params).Return(int64(2), nil).Once()
+	querierMock.On("RemoveUsersBatchFromSegment", mock.Anything, params).Return(int64(1), nil).Once()
+	querierMock.On("RemoveUsersBatchFromSegment", mock.Anything, params).Return(int64(0), nil).Once()
+
+	storageMock := mocks.NewStorage(t)
+	storageMock.On("CountUsersInSegment", mock.Anything, "TEST_SEGMENT").Return(int64(3), nil)
+	storageMock.On("ExecTx", mock.Anything, mock.Anything).Return(
+		func(_ context.Context, fn func(storage.Querier) error) error {
+			return fn(querierMock)
+		})
+	storageMock.On("DeleteSegment", mock.Anything, "TEST_SEGMENT").Return(nil).Once()
+
+	payload, err := json.Marshal(jobs.SegmentDeletionPayload{SegmentName: "TEST_SEGMENT"})
+	require.NoError(t, err)
+
+	var reports []jobs.Progress
+	handler := jobs.NewSegmentDeletionHandler(storageMock, 2)
+	err = handler(context.Background(), models.Job{ID: 1, Kind: jobs.KindSegmentDeletion, Payload: payload},
+		func(p jobs.Progress) error {
+			reports = append(reports, p)
+			return nil
+		})
+	require.NoError(t, err)
+	require.Equal(t, []jobs.Progress{
+		{Total: 3},
+		{Total: 3, Processed: 2, Affected: 2},
+		{Total: 3, Processed: 3, Affected: 3},
+	}, reports)
+}
@@ -0,0 +1,79 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+	"github.com/AlexZahvatkin/segments-users-service/internal/use-cases/user_segments"
+)
+
+const (
+	KindSegmentMembersBatch = "segment_members_batch"
+)
+
+type SegmentMembersBatchPayload struct {
+	SegmentName string                               `json:"segment_name"`
+	Users       []usecases_user_segments.BatchMember `json:"users"`
+}
+
+type segmentMembersBatchCheckpoint struct {
+	Offset int `json:"offset"`
+}
+
+// NewSegmentMembersBatchHandler adds the users of a batch request into a segment batchSize at a time,
+// every chunk is a single set-based upsert. Users that do not exist are skipped: they are counted
+// as processed but not as affected. An interrupted job continues after the last applied chunk.
+func NewSegmentMembersBatchHandler(store storage.Storage, batchSize int32) Handler {
+	return func(ctx context.Context, job models.Job, report func(Progress) error) error {
+		var payload SegmentMembersBatchPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return err
+		}
+
+		var checkpoint segmentMembersBatchCheckpoint
+		if len(job.Checkpoint) > 0 {
+			if err := json.Unmarshal(job.Checkpoint, &checkpoint); err != nil {
+				return err
+			}
+		}
+
+		progress := Progress{
+			Total:      int64(len(payload.Users)),
+			Processed:  job.Processed,
+			Affected:   job.Affected,
+			Checkpoint: checkpoint,
+		}
+		if err := report(progress); err != nil {
+			return err
+		}
+
+		for checkpoint.Offset < len(payload.Users) {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			end := min(checkpoint.Offset+int(batchSize), len(payload.Users))
+			res, err := store.AddUsersIntoSegmentBatch(ctx,
+				usecases_user_segments.BatchParams(payload.SegmentName, payload.Users[checkpoint.Offset:end]))
+			if err != nil {
+				return err
+			}
+
+			for _, row := range res {
+				if row.UserExists {
+					progress.Affected++
+				}
+			}
+			progress.Processed += int64(end - checkpoint.Offset)
+			checkpoint.Offset = end
+			progress.Checkpoint = checkpoint
+			if err := report(progress); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,66 @@
+package jobs_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/jobs"
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage/mocks"
+	usecases_user_segments "github.com/AlexZahvatkin/segments-users-service/internal/use-cases/user_segments"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSegmentMembersBatchHandler(t *testing.T) {
+	expireAt := time.Date(2023, 9, 1, 20, 0, 0, 0, time.UTC)
+	startsAt := time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	storageMock := mocks.NewStorage(t)
+	storageMock.On("AddUsersIntoSegmentBatch", mock.Anything, models.AddUsersIntoSegmentBatchParams{
+		UserIds:     []int64{2, 3},
+		ExpireAt:    []sql.NullTime{{}, {}},
+		StartsAt:    []sql.NullTime{{}, {}},
+		SegmentName: "TEST_SEGMENT",
+	}).Return([]models.AddUsersIntoSegmentBatchRow{
+		{UserID: 2, UserExists: true, Inserted: true},
+		{UserID: 3},
+	}, nil).Once()
+	storageMock.On("AddUsersIntoSegmentBatch", mock.Anything, models.AddUsersIntoSegmentBatchParams{
+		UserIds:     []int64{4},
+		ExpireAt:    []sql.NullTime{{Time: expireAt, Valid: true}},
+		StartsAt:    []sql.NullTime{{Time: startsAt, Valid: true}},
+		SegmentName: "TEST_SEGMENT",
+	}).Return([]models.AddUsersIntoSegmentBatchRow{
+		{UserID: 4, UserExists: true},
+	}, nil).Once()
+
+	payload, err := json.Marshal(jobs.SegmentMembersBatchPayload{
+		SegmentName: "TEST_SEGMENT",
+		Users: []usecases_user_segments.BatchMember{
+			{UserID: 1}, {UserID: 2}, {UserID: 3}, {UserID: 4, ExpireAt: &expireAt, StartsAt: &startsAt},
+		},
+	})
+	require.NoError(t, err)
+
+	// The first user has been applied before the job was interrupted.
+	var reports []report
+	handler := jobs.NewSegmentMembersBatchHandler(storageMock, 2)
+	err = handler(context.Background(), models.Job{
+		ID:         1,
+		Kind:       jobs.KindSegmentMembersBatch,
+		Payload:    payload,
+		Processed:  1,
+		Affected:   1,
+		Checkpoint: []byte(`{"offset":1}`),
+	}, recordProgress(t, &reports))
+	require.NoError(t, err)
+	require.Equal(t, []report{
+		{Total: 4, Processed: 1, Affected: 1, Checkpoint: `{"offset":1}`},
+		{Total: 4, Processed: 3, Affected: 2, Checkpoint: `{"offset":3}`},
+		{Total: 4, Processed: 4, Affected: 3, Checkpoint: `{"offset":4}`},
+	}, reports)
+}
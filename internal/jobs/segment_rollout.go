@@ -0,0 +1,89 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+)
+
+const (
+	KindSegmentRollout = "segment_rollout"
+)
+
+type SegmentRolloutPayload struct {
+	SegmentName string `json:"segment_name"`
+}
+
+type segmentRolloutCheckpoint struct {
+	AfterID int64 `json:"after_id"`
+}
+
+// NewSegmentRolloutHandler enrolls existing users into a percentage segment.
+// Users are scanned in id order, batchSize at a time, and every batch is a single set-based insert.
+// An interrupted job continues after the last processed user id.
+func NewSegmentRolloutHandler(store storage.Storage, batchSize int32) Handler {
+	return func(ctx context.Context, job models.Job, report func(Progress) error) error {
+		var payload SegmentRolloutPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return err
+		}
+
+		var checkpoint segmentRolloutCheckpoint
+		if len(job.Checkpoint) > 0 {
+			if err := json.Unmarshal(job.Checkpoint, &checkpoint); err != nil {
+				return err
+			}
+		}
+
+		total, err := store.CountUsers(ctx)
+		if err != nil {
+			return err
+		}
+
+		progress := Progress{
+			Total:      total,
+			Processed:  job.Processed,
+			Affected:   job.Affected,
+			Checkpoint: checkpoint,
+		}
+		if err := report(progress); err != nil {
+			return err
+		}
+
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			var res models.AddUsersBatchIntoRolloutSegmentRow
+			err := store.ExecTx(ctx, func(q storage.Querier) error {
+				if err := q.SetHistoryAction(ctx, models.ActionAutoAssigned); err != nil {
+					return err
+				}
+				var err error
+				res, err = q.AddUsersBatchIntoRolloutSegment(ctx, models.AddUsersBatchIntoRolloutSegmentParams{
+					AfterID:     checkpoint.AfterID,
+					BatchSize:   batchSize,
+					SegmentName: payload.SegmentName,
+				})
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			if res.Processed == 0 {
+				return nil
+			}
+
+			checkpoint.AfterID = res.LastUserID
+			progress.Processed += res.Processed
+			progress.Affected += res.Enrolled
+			progress.Checkpoint = checkpoint
+			if err := report(progress); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package jobs_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/jobs"
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSegmentRolloutHandler(t *testing.T) {
+	querierMock := mocks.NewQuerier(t)
+	querierMock.On("SetHistoryAction", mock.Anything, models.ActionAutoAssigned).Return(nil)
+	querierMock.On("AddUsersBatchIntoRolloutSegment", mock.Anything, models.AddUsersBatchIntoRolloutSegmentParams{
+		AfterID: 0, BatchSize: 2, SegmentName: "TEST_SEGMENT",
+	}).Return(models.AddUsersBatchIntoRolloutSegmentRow{LastUserID: 2, Processed: 2, Enrolled: 1}, nil).Once()
+	querierMock.On("AddUsersBatchIntoRolloutSegment", mock.Anything, models.AddUsersBatchIntoRolloutSegmentParams{
+		AfterID: 2, BatchSize: 2, SegmentName: "TEST_SEGMENT",
+	}).Return(models.AddUsersBatchIntoRolloutSegmentRow{LastUserID: 5, Processed: 1, Enrolled: 1}, nil).Once()
+	querierMock.On("AddUsersBatchIntoRolloutSegment", mock.Anything, models.AddUsersBatchIntoRolloutSegmentParams{
+		AfterID: 5, BatchSize: 2, SegmentName: "TEST_SEGMENT",
+	}).Return(models.AddUsersBatchIntoRolloutSegmentRow{}, nil).Once()
+
+	storageMock := mocks.NewStorage(t)
+	storageMock.On("CountUsers", mock.Anything).Return(int64(3), nil)
+	storageMock.On("ExecTx", mock.Anything, mock.Anything).Return(
+		func(_ context.Context, fn func(storage.Querier) error) error {
+			return fn(querierMock)
+		})
+
+	payload, err := json.Marshal(jobs.SegmentRolloutPayload{SegmentName: "TEST_SEGMENT"})
+	require.NoError(t, err)
+
+	var reports []report
+	handler := jobs.NewSegmentRolloutHandler(storageMock, 2)
+	err = handler(context.Background(), models.Job{ID: 1, Kind: jobs.KindSegmentRollout, Payload: payload},
+		recordProgress(t, &reports))
+	require.NoError(t, err)
+	require.Equal(t, []report{
+		{Total: 3, Checkpoint: `{"after_id":0}`},
+		{Total: 3, Processed: 2, Affected: 1, Checkpoint: `{"after_id":2}`},
+		{Total: 3, Processed: 3, Affected: 2, Checkpoint: `{"after_id":5}`},
+	}, reports)
+}
+
+func TestSegmentRolloutHandlerResume(t *testing.T) {
+	querierMock := mocks.NewQuerier(t)
+	querierMock.On("SetHistoryAction", mock.Anything, models.ActionAutoAssigned).Return(nil)
+	querierMock.On("AddUsersBatchIntoRolloutSegment", mock.Anything, models.AddUsersBatchIntoRolloutSegmentParams{
+		AfterID: 2, BatchSize: 2, SegmentName: "TEST_SEGMENT",
+	}).Return(models.AddUsersBatchIntoRolloutSegmentRow{LastUserID: 5, Processed: 1, Enrolled: 1}, nil).Once()
+	querierMock.On("AddUsersBatchIntoRolloutSegment", mock.Anything, models.AddUsersBatchIntoRolloutSegmentParams{
+		AfterID: 5, BatchSize: 2, SegmentName: "TEST_SEGMENT",
+	}).Return(models.AddUsersBatchIntoRolloutSegmentRow{}, nil).Once()
+
+	storageMock := mocks.NewStorage(t)
+	storageMock.On("CountUsers", mock.Anything).Return(int64(3), nil)
+	storageMock.On("ExecTx", mock.Anything, mock.Anything).Return(
+		func(_ context.Context, fn func(storage.Querier) error) error {
+			return fn(querierMock)
+		})
+
+	payload, err := json.Marshal(jobs.SegmentRolloutPayload{SegmentName: "TEST_SEGMENT"})
+	require.NoError(t, err)
+
+	var reports []report
+	handler := jobs.NewSegmentRolloutHandler(storageMock, 2)
+	err = handler(context.Background(), models.Job{
+		ID:         1,
+		Kind:       jobs.KindSegmentRollout,
+		Payload:    payload,
+		Processed:  2,
+		Affected:   1,
+		Checkpoint: []byte(`{"after_id":2}`),
+	}, recordProgress(t, &reports))
+	require.NoError(t, err)
+	require.Equal(t, []report{
+		{Total: 3, Processed: 2, Affected: 1, Checkpoint: `{"after_id":2}`},
+		{Total: 3, Processed: 3, Affected: 2, Checkpoint: `{"after_id":5}`},
+	}, reports)
+}
+
+func TestSegmentRolloutHandlerCancelled(t *testing.T) {
+	storageMock := mocks.NewStorage(t)
+	storageMock.On("CountUsers", mock.Anything).Return(int64(3), nil)
+
+	payload, err := json.Marshal(jobs.SegmentRolloutPayload{SegmentName: "TEST_SEGMENT"})
+	require.NoError(t, err)
+
+	handler := jobs.NewSegmentRolloutHandler(storageMock, 2)
+	err = handler(context.Background(), models.Job{ID: 1, Kind: jobs.KindSegmentRollout, Payload: payload},
+		func(jobs.Progress) error {
+			return jobs.ErrCancelled
+		})
+	require.ErrorIs(t, err, jobs.ErrCancelled)
+}
+
+// report is a jobs.Progress with the checkpoint marshalled the way the pool saves it.
+type report struct {
+	Total      int64
+	Processed  int64
+	Affected   int64
+	Checkpoint string
+}
+
+func recordProgress(t *testing.T, reports *[]report) func(jobs.Progress) error {
+	return func(p jobs.Progress) error {
+		checkpoint, err := json.Marshal(p.Checkpoint)
+		require.NoError(t, err)
+		*reports = append(*reports, report{
+			Total:      p.Total,
+			Processed:  p.Processed,
+			Affected:   p.Affected,
+			Checkpoint: string(checkpoint),
+		})
+		return nil
+	}
+}
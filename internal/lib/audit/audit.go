@@ -0,0 +1,31 @@
+package audit
+
+import "context"
+
+const (
+	// ActorAPI is recorded for API requests that do not name their actor.
+	ActorAPI = "api"
+	// ActorExpiry is recorded for memberships removed by the expiry sweeper.
+	ActorExpiry = "system:expiry"
+	// ActorJobs is recorded for changes made by jobs created before actors were recorded.
+	ActorJobs = "system:jobs"
+)
+
+// Audit says who made a change and why. It travels in the context down to the database,
+// where it is recorded in the segments history together with every membership change.
+type Audit struct {
+	Actor  string
+	Reason string
+}
+
+type ctxKey struct{}
+
+func WithAudit(ctx context.Context, a Audit) context.Context {
+	return context.WithValue(ctx, ctxKey{}, a)
+}
+
+// FromContext returns the audit attached to ctx. ok is false if there is none.
+func FromContext(ctx context.Context) (a Audit, ok bool) {
+	a, ok = ctx.Value(ctxKey{}).(Audit)
+	return a, ok
+}
@@ -0,0 +1,38 @@
+package urlsign_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/lib/urlsign"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigner(t *testing.T) {
+	signer := urlsign.New([]byte("secret"))
+	now := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	link := signer.Sign("/v1/reports/1/download", now.Add(time.Hour))
+
+	parse := func(link string) (string, url.Values) {
+		u, err := url.Parse(link)
+		require.NoError(t, err)
+		return u.Path, u.Query()
+	}
+
+	path, query := parse(link)
+	require.Equal(t, "/v1/reports/1/download", path)
+	require.NoError(t, signer.Verify(path, query, now))
+	require.ErrorIs(t, signer.Verify(path, query, now.Add(time.Hour)), urlsign.ErrExpired)
+
+	require.ErrorIs(t, signer.Verify("/v1/reports/2/download", query, now), urlsign.ErrInvalidSignature)
+	require.ErrorIs(t, urlsign.New([]byte("other")).Verify(path, query, now), urlsign.ErrInvalidSignature)
+
+	extended := url.Values{"expires": {"9999999999"}, "signature": query["signature"]}
+	require.ErrorIs(t, signer.Verify(path, extended, now), urlsign.ErrInvalidSignature)
+
+	_, query = parse(strings.Replace(link, "signature=", "signature=zz", 1))
+	require.ErrorIs(t, signer.Verify(path, query, now), urlsign.ErrInvalidSignature)
+	require.ErrorIs(t, signer.Verify(path, url.Values{}, now), urlsign.ErrInvalidSignature)
+}
@@ -0,0 +1,30 @@
+package models
+
+// MaxImportErrors is how many row errors an import reports before it stops looking for more.
+const MaxImportErrors = 100
+
+// ImportUser is a valid row of a user import file.
+type ImportUser struct {
+	Line       int
+	Name       string
+	ExternalID *string
+	Segments   []ImportUserSegment
+}
+
+// ImportUserSegment is an initial segment of an imported user. TTL is in hours, zero means no TTL.
+type ImportUserSegment struct {
+	Name string `json:"name"`
+	TTL  int32  `json:"ttl,omitempty"`
+}
+
+type ImportError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+type ImportUsersResult struct {
+	Users    int64         `json:"users"`
+	Segments int64         `json:"segments"`
+	DryRun   bool          `json:"dry_run"`
+	Errors   []ImportError `json:"errors,omitempty"`
+}
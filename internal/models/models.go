@@ -2,21 +2,45 @@ package models
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 )
 
+const (
+	ActionInserted     = "inserted"
+	ActionDeleted      = "deleted"
+	ActionExpired      = "expired"
+	ActionAutoAssigned = "auto_assigned"
+	ActionScheduled    = "scheduled"
+	ActionStarted      = "started"
+	ActionUpdated      = "updated"
+	ActionTTLChanged   = "ttl_changed"
+	// Memberships removed and brought back together with their segment or user.
+	ActionSegmentDeleted  = "segment_deleted"
+	ActionSegmentRestored = "segment_restored"
+	ActionUserDeleted     = "user_deleted"
+	ActionUserRestored    = "user_restored"
+	// Snapshot carries a membership into the next month when the history of a month is archived.
+	ActionSnapshot = "snapshot"
+)
+
 type Segment struct {
-	Name        string
-	Description sql.NullString
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	Name           string
+	Description    sql.NullString
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	RolloutSalt    string
+	RolloutPercent sql.NullFloat64
+	DeletedAt      sql.NullTime
 }
 
 type User struct {
-	ID        int64     `json:"id"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID         int64        `json:"id"`
+	Name       string       `json:"name"`
+	ExternalID *string      `json:"external_id,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+	DeletedAt  sql.NullTime `json:"-"`
 }
 
 type UsersInSegment struct {
@@ -25,6 +49,9 @@ type UsersInSegment struct {
 	ExpireAt    sql.NullTime
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
+	StartsAt    sql.NullTime
+	// Started is false for a scheduled membership until the sweeper records its start.
+	Started bool
 }
 
 type UsersInSegmentsHistory struct {
@@ -33,6 +60,12 @@ type UsersInSegmentsHistory struct {
 	ExpireAt    sql.NullTime
 	ActionType  string
 	ActionDate  time.Time
+	StartsAt    sql.NullTime
+	ID          int64
+	OldExpireAt sql.NullTime
+	Actor       sql.NullString
+	Reason      sql.NullString
+	TxID        int64
 }
 
 type AddUserIntoSegmentWithTTLInHoursParams struct {
@@ -40,3 +73,113 @@ type AddUserIntoSegmentWithTTLInHoursParams struct {
 	SegmentName   string
 	NumberOfHours int32
 }
+
+type Job struct {
+	ID         int64
+	Kind       string
+	Status     string
+	Payload    json.RawMessage
+	Total      int64
+	Processed  int64
+	Affected   int64
+	Error      sql.NullString
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	StartedAt  sql.NullTime
+	FinishedAt sql.NullTime
+	Checkpoint json.RawMessage
+	Attempts   int32
+	Actor      string
+	Reason     string
+}
+
+type Report struct {
+	JobID       int64
+	BlobKey     string
+	Filename    string
+	ContentType string
+	Size        int64
+	Records     int64
+	CreatedAt   time.Time
+	ExpireAt    time.Time
+}
+
+type HistoryArchive struct {
+	Month     time.Time
+	BlobKey   string
+	Size      int64
+	Records   int64
+	CreatedAt time.Time
+}
+
+type SegmentDailyStat struct {
+	SegmentName string
+	Day         time.Time
+	Added       int64
+	Removed     int64
+	Expired     int64
+}
+
+type SegmentStatsState struct {
+	ID        bool
+	LastTxID  int64
+	UpdatedAt time.Time
+}
+
+type AddUsersBatchIntoRolloutSegmentRow struct {
+	LastUserID int64
+	Processed  int64
+	Enrolled   int64
+}
+
+type AddUsersIntoSegmentBatchRow struct {
+	UserID     int64
+	UserExists bool
+	Inserted   bool
+	ExpireAt   sql.NullTime
+	StartsAt   sql.NullTime
+}
+
+type GetSegmentWithMembersCountRow struct {
+	Name           string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Description    sql.NullString
+	RolloutSalt    string
+	RolloutPercent sql.NullFloat64
+	MembersCount   int64
+	PendingCount   int64
+}
+
+type ListSegmentsRow struct {
+	Name           string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Description    sql.NullString
+	RolloutSalt    string
+	RolloutPercent sql.NullFloat64
+	MembersCount   int64
+	PendingCount   int64
+}
+
+type GetSegmentDailyStatsRow struct {
+	Day     time.Time
+	Added   int64
+	Removed int64
+	Expired int64
+}
+
+type GetSegmentMembershipCountsRow struct {
+	ActiveCount   int64
+	ExpiringCount int64
+}
+
+type RollupSegmentStatsRow struct {
+	LastTxID  int64
+	Processed int64
+}
+
+type ListHistoryPartitionsRow struct {
+	Name  string
+	Month time.Time
+}
@@ -5,9 +5,35 @@ package models
 type SegmentAssignRequest struct {
 	SegmentsToDeleteNames []string `json:"to_delete"`
 	SegmentsToAddNames    []string `json:"to_add"`
+	StartsAt              string   `json:"starts_at" example:"2023-09-01T00:00:00Z"`
+	UserName              string   `json:"user_name"`
 }
 
 type SegmentAssignWithTTLRequest struct {
 	SegmentName string `json:"segment_name" validate:"required"`
-	TTL         int32  `json:"ttl" validate:"required,gt=0"`
+	// A number of hours or a duration: "90m", "3d", "2w", "P1DT12H"
+	TTL      string `json:"ttl" example:"3d"`
+	ExpireAt string `json:"expire_at" example:"2023-09-01T20:00:00Z"`
+	StartsAt string `json:"starts_at" example:"2023-09-01T00:00:00Z"`
+	UserName string `json:"user_name"`
+}
+
+type SegmentMembersBatchRequest struct {
+	Users []SegmentMembersBatchItem `json:"users"`
+}
+
+type SegmentMembersBatchItem struct {
+	UserID   int64  `json:"user_id"`
+	TTL      string `json:"ttl" example:"3d"`
+	ExpireAt string `json:"expire_at" example:"2023-09-01T20:00:00Z"`
+	StartsAt string `json:"starts_at" example:"2023-09-01T00:00:00Z"`
+}
+
+type HistoryReportRequest struct {
+	// Year and month, instead of from and to
+	Month   string `json:"month" example:"2023-09"`
+	From    string `json:"from" example:"2023-09-01T00:00:00Z"`
+	To      string `json:"to" example:"2023-09-15T00:00:00Z"`
+	Segment string `json:"segment"`
+	Gzip    bool   `json:"gzip"`
 }
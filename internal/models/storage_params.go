@@ -2,13 +2,36 @@ package models
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 )
 
+type GetLastSegmentsActionsByUserIdParams struct {
+	UserID int64
+	At     time.Time
+}
+
+type SetHistoryAuditParams struct {
+	Actor  string
+	Reason string
+}
+
 type GetSegmentsHistoryByUserIdParams struct {
-	UserID   int64
-	FromDate time.Time
-	ToDate   time.Time
+	UserID      int64
+	FromDate    time.Time
+	ToDate      time.Time
+	SegmentName string
+	ActionTypes []string
+	AfterID     int64
+	// PageSize of 0 returns all records.
+	PageSize int32
+}
+
+// HistoryReportParams selects the history of all users recorded from FromDate inclusive to ToDate exclusive.
+type HistoryReportParams struct {
+	FromDate    time.Time
+	ToDate      time.Time
+	SegmentName string
 }
 
 type RemoveUserFromSegmentParams struct {
@@ -24,12 +47,160 @@ type AddUserIntoSegmentParams struct {
 type AddUserIntoSegmentWithExpireDatetimeParams struct {
 	UserID      int64
 	SegmentName string
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
 	ExpireAt    sql.NullTime
+	StartsAt    sql.NullTime
+}
+
+type StartScheduledUsersInSegmentsParams struct {
+	Now       time.Time
+	BatchSize int32
 }
 
 type AddSegmentParams struct {
-	Name        string
-	Description sql.NullString
+	Name           string
+	Description    sql.NullString
+	RolloutSalt    string
+	RolloutPercent sql.NullFloat64
+}
+
+type AddUsersBatchIntoRolloutSegmentParams struct {
+	AfterID     int64
+	BatchSize   int32
+	SegmentName string
+}
+
+type AddUsersIntoSegmentBatchParams struct {
+	UserIds     []int64
+	ExpireAt    []sql.NullTime
+	StartsAt    []sql.NullTime
+	SegmentName string
+}
+
+type CreateJobParams struct {
+	Kind    string
+	Payload json.RawMessage
+	Actor   string
+	Reason  string
+}
+
+type UpdateJobProgressParams struct {
+	Total      int64
+	Processed  int64
+	Affected   int64
+	Checkpoint json.RawMessage
+	ID         int64
+	Attempts   int32
+}
+
+type FinishJobParams struct {
+	Status   string
+	Error    sql.NullString
+	ID       int64
+	Attempts int32
+}
+
+type RequeueStaleJobsParams struct {
+	MaxAttempts       int32
+	StaleAfterSeconds float64
+}
+
+type CreateReportParams struct {
+	JobID       int64
+	BlobKey     string
+	Filename    string
+	ContentType string
+	Size        int64
+	Records     int64
+	ExpireAt    time.Time
+}
+
+type ListExpiredReportsParams struct {
+	ExpiredBefore time.Time
+	BatchSize     int32
+}
+
+type CreateHistoryPartitionsParams struct {
+	FromMonth time.Time
+	ToMonth   time.Time
+}
+
+type CreateHistoryArchiveParams struct {
+	Month   time.Time
+	BlobKey string
+	Size    int64
+	Records int64
+}
+
+type RollupSegmentStatsParams struct {
+	AfterTxID int64
+	BatchSize int32
+}
+
+type GetSegmentDailyStatsParams struct {
+	SegmentName string
+	FromDay     time.Time
+	ToDay       time.Time
+}
+
+type GetSegmentMembershipCountsParams struct {
+	ExpiringBefore time.Time
+	SegmentName    string
+}
+
+type RemoveUsersBatchFromSegmentParams struct {
+	SegmentName string
+	BatchSize   int32
+}
+
+type ListSegmentsParams struct {
+	NamePrefix string
+	AfterName  string
+	PageSize   int32
+}
+
+type RestoreSegmentParams struct {
+	Name         string
+	DeletedAfter time.Time
+}
+
+type UpdateSegmentParams struct {
+	Description    sql.NullString
+	RolloutPercent sql.NullFloat64
+	Name           string
+}
+
+type ListUsersInSegmentParams struct {
+	SegmentName    string
+	AfterUserID    int64
+	IncludeExpired bool
+	IncludePending bool
+	PageSize       int32
+}
+
+type ListUsersParams struct {
+	AfterID   int64
+	NameQuery string
+	PageSize  int32
+}
+
+type AddUserParams struct {
+	Name       string
+	ExternalID *string
+}
+
+type AddUserIfNotExistsParams struct {
+	Name       string
+	ExternalID *string
+}
+
+type RestoreUserParams struct {
+	ID           int64
+	ExternalID   *string
+	DeletedAfter time.Time
+}
+
+type UpdateUserParams struct {
+	Name       *string
+	ExternalID *string
+	ID         int64
 }
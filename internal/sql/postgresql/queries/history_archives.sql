@@ -0,0 +1,25 @@
+-- name: CreateHistoryPartitions :one
+SELECT create_history_partitions(@from_month::timestamp, @to_month::timestamp)::integer AS created;
+-- name: ListHistoryPartitions :many
+SELECT c.relname::text AS name,
+	to_date(right(c.relname, 6), 'YYYYMM')::timestamp AS month
+FROM pg_inherits i
+	JOIN pg_class c ON c.oid = i.inhrelid
+WHERE i.inhparent = 'users_in_segments_history'::regclass
+	AND c.relname ~ '^users_in_segments_history_p[0-9]{6}$'
+	AND to_date(right(c.relname, 6), 'YYYYMM') < @before::timestamp
+ORDER BY month;
+-- name: DropHistoryPartition :one
+SELECT drop_history_partition(@month::timestamp) AS dropped;
+-- name: GetHistoryArchivedBefore :one
+SELECT (max(month) + interval '1 month')::timestamp AS archived_before
+FROM history_archives;
+-- name: CreateHistoryArchive :one
+INSERT INTO history_archives (month, blob_key, size, records, created_at)
+VALUES ($1, $2, $3, $4, now()) ON CONFLICT (month) DO
+UPDATE
+SET blob_key = EXCLUDED.blob_key,
+	size = EXCLUDED.size,
+	records = EXCLUDED.records,
+	created_at = EXCLUDED.created_at
+RETURNING *;
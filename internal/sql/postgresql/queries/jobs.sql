@@ -0,0 +1,81 @@
+-- name: CreateJob :one
+INSERT INTO jobs (
+		kind,
+		status,
+		payload,
+		created_at,
+		updated_at,
+		actor,
+		reason
+	)
+VALUES ($1, 'queued', $2, now(), now(), $3, $4)
+RETURNING *;
+-- name: GetJobById :one
+SELECT *
+FROM jobs
+WHERE id = $1;
+-- name: ClaimNextJob :one
+UPDATE jobs
+SET status = 'running',
+	attempts = attempts + 1,
+	started_at = now(),
+	updated_at = now()
+WHERE id = (
+		SELECT id
+		FROM jobs
+		WHERE status = 'queued'
+		ORDER BY id
+		LIMIT 1 FOR UPDATE SKIP LOCKED
+	)
+RETURNING *;
+-- name: UpdateJobProgress :one
+UPDATE jobs
+SET total = @total,
+	processed = @processed,
+	affected = @affected,
+	checkpoint = @checkpoint,
+	updated_at = now()
+WHERE id = @id
+	AND status = 'running'
+	AND attempts = @attempts
+RETURNING status;
+-- name: FinishJob :exec
+UPDATE jobs
+SET status = @status,
+	error = @error,
+	finished_at = now(),
+	updated_at = now()
+WHERE id = @id
+	AND status = 'running'
+	AND attempts = @attempts;
+-- name: RequeueJob :exec
+UPDATE jobs
+SET status = 'queued',
+	updated_at = now()
+WHERE id = $1
+	AND status = 'running';
+-- name: CancelJob :one
+UPDATE jobs
+SET status = 'cancelled',
+	finished_at = now(),
+	updated_at = now()
+WHERE id = $1
+	AND status IN ('queued', 'running')
+RETURNING *;
+-- name: RequeueStaleJobs :execrows
+UPDATE jobs
+SET status = CASE
+		WHEN attempts >= @max_attempts::integer THEN 'failed'
+		ELSE 'queued'
+	END,
+	error = CASE
+		WHEN attempts >= @max_attempts::integer THEN 'job was interrupted too many times'
+		ELSE error
+	END,
+	finished_at = CASE
+		WHEN attempts >= @max_attempts::integer THEN now()
+		ELSE finished_at
+	END,
+	updated_at = now()
+WHERE status = 'running'
+	AND updated_at < now() - make_interval(secs => @stale_after_seconds::float8);
\ No newline at end of file
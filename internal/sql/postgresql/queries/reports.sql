@@ -0,0 +1,34 @@
+-- name: CreateReport :one
+INSERT INTO reports (
+		job_id,
+		blob_key,
+		filename,
+		content_type,
+		size,
+		records,
+		created_at,
+		expire_at
+	)
+VALUES ($1, $2, $3, $4, $5, $6, now(), $7) ON CONFLICT (job_id) DO
+UPDATE
+SET blob_key = EXCLUDED.blob_key,
+	filename = EXCLUDED.filename,
+	content_type = EXCLUDED.content_type,
+	size = EXCLUDED.size,
+	records = EXCLUDED.records,
+	created_at = EXCLUDED.created_at,
+	expire_at = EXCLUDED.expire_at
+RETURNING *;
+-- name: GetReportByJobId :one
+SELECT *
+FROM reports
+WHERE job_id = $1;
+-- name: ListExpiredReports :many
+SELECT *
+FROM reports
+WHERE expire_at < @expired_before
+ORDER BY expire_at
+LIMIT @batch_size;
+-- name: DeleteReport :exec
+DELETE FROM reports
+WHERE job_id = $1;
@@ -0,0 +1,117 @@
+-- name: GetSegmentStatsState :one
+SELECT last_tx_id::text::bigint AS last_tx_id
+FROM segment_stats_state
+WHERE id
+FOR UPDATE;
+-- name: SetSegmentStatsState :exec
+UPDATE segment_stats_state
+SET last_tx_id = @last_tx_id::xid8,
+	updated_at = now()
+WHERE id;
+-- name: RollupSegmentStats :one
+WITH bound AS (
+	SELECT max(tx_id) AS tx_id
+	FROM (
+			SELECT tx_id
+			FROM users_in_segments_history
+			WHERE tx_id > @after_tx_id::xid8
+				AND tx_id < pg_snapshot_xmin(pg_current_snapshot())
+			ORDER BY tx_id
+			LIMIT @batch_size
+		) pending
+),
+batch AS (
+	SELECT h.segment_name,
+		h.action_date::date AS day,
+		segment_stats_kind(h.action_type) AS kind
+	FROM users_in_segments_history h,
+		bound
+	WHERE h.tx_id > @after_tx_id::xid8
+		AND h.tx_id <= bound.tx_id
+), rolled AS (
+	INSERT INTO segment_daily_stats(segment_name, day, added, removed, expired)
+	SELECT segment_name,
+		day,
+		count(*) FILTER (
+			WHERE kind = 'added'
+		),
+		count(*) FILTER (
+			WHERE kind = 'removed'
+		),
+		count(*) FILTER (
+			WHERE kind = 'expired'
+		)
+	FROM batch
+	WHERE kind IS NOT NULL
+	GROUP BY segment_name,
+		day ON CONFLICT (segment_name, day) DO
+	UPDATE
+	SET added = segment_daily_stats.added + EXCLUDED.added,
+		removed = segment_daily_stats.removed + EXCLUDED.removed,
+		expired = segment_daily_stats.expired + EXCLUDED.expired
+)
+SELECT COALESCE(bound.tx_id, @after_tx_id::xid8)::text::bigint AS last_tx_id,
+	(
+		SELECT count(*)
+		FROM batch
+	) AS processed
+FROM bound;
+-- name: GetSegmentDailyStats :many
+SELECT day,
+	sum(added)::bigint AS added,
+	sum(removed)::bigint AS removed,
+	sum(expired)::bigint AS expired
+FROM (
+		SELECT day,
+			added,
+			removed,
+			expired
+		FROM segment_daily_stats
+		WHERE segment_name = @segment_name
+			AND day >= @from_day::date
+			AND day < @to_day::date
+		UNION ALL
+		SELECT action_date::date,
+			count(*) FILTER (
+				WHERE segment_stats_kind(action_type) = 'added'
+			),
+			count(*) FILTER (
+				WHERE segment_stats_kind(action_type) = 'removed'
+			),
+			count(*) FILTER (
+				WHERE segment_stats_kind(action_type) = 'expired'
+			)
+		FROM users_in_segments_history
+		WHERE tx_id > (
+				SELECT last_tx_id
+				FROM segment_stats_state
+				WHERE segment_stats_state.id
+			)
+			AND segment_name = @segment_name
+			AND action_date >= @from_day::date
+			AND action_date < @to_day::date
+		GROUP BY action_date::date
+	) stats
+GROUP BY day
+ORDER BY day;
+-- name: GetSegmentMembershipCounts :one
+SELECT count(uis.user_id) FILTER (
+		WHERE uis.starts_at IS NULL
+			OR uis.starts_at <= now()
+	) AS active_count,
+	count(uis.user_id) FILTER (
+		WHERE (
+				uis.starts_at IS NULL
+				OR uis.starts_at <= now()
+			)
+			AND uis.expire_at <= @expiring_before::timestamp
+	) AS expiring_count
+FROM segments s
+	LEFT JOIN users_in_segments uis ON uis.segment_name = s.name
+	AND (
+		uis.expire_at IS NULL
+		OR uis.expire_at > now()
+	)
+WHERE s.name = @segment_name
+	AND s.deleted_at IS NULL
+GROUP BY s.name;
@@ -1,11 +1,100 @@
 -- name: AddSegment :one
-INSERT INTO segments (name, created_at, updated_at, description)
-VALUES ($1, now(), now(), $2)
+INSERT INTO segments (
+		name,
+		created_at,
+		updated_at,
+		description,
+		rollout_salt,
+		rollout_percent
+	)
+VALUES ($1, now(), now(), $2, $3, $4)
 RETURNING *;
 -- name: DeleteSegment :exec
+UPDATE segments
+SET deleted_at = now(),
+	updated_at = now()
+WHERE name = $1
+	AND deleted_at IS NULL;
+-- name: RestoreSegment :one
+UPDATE segments
+SET deleted_at = null,
+	updated_at = now()
+WHERE name = @name
+	AND deleted_at > @deleted_after
+RETURNING *;
+-- name: PurgeDeletedSegments :execrows
 DELETE FROM segments
-WHERE name = $1;
+WHERE deleted_at <= @deleted_before;
 -- name: GetSegmentByName :one
 SELECT *
 FROM segments
-WHERE name = $1;
\ No newline at end of file
+WHERE name = $1
+	AND deleted_at IS NULL;
+-- name: GetSegmentWithMembersCount :one
+SELECT s.name,
+	s.created_at,
+	s.updated_at,
+	s.description,
+	s.rollout_salt,
+	s.rollout_percent,
+	counts.members_count,
+	counts.pending_count
+FROM segments s
+	CROSS JOIN LATERAL (
+		SELECT count(*) FILTER (
+				WHERE uis.starts_at IS NULL
+					OR uis.starts_at <= now()
+			) AS members_count,
+			count(*) FILTER (
+				WHERE uis.starts_at > now()
+			) AS pending_count
+		FROM users_in_segments uis
+		WHERE uis.segment_name = s.name
+			AND (
+				uis.expire_at IS NULL
+				OR uis.expire_at > now()
+			)
+	) counts
+WHERE s.name = $1
+	AND s.deleted_at IS NULL;
+-- name: ListSegments :many
+SELECT s.name,
+	s.created_at,
+	s.updated_at,
+	s.description,
+	s.rollout_salt,
+	s.rollout_percent,
+	counts.members_count,
+	counts.pending_count
+FROM segments s
+	CROSS JOIN LATERAL (
+		SELECT count(*) FILTER (
+				WHERE uis.starts_at IS NULL
+					OR uis.starts_at <= now()
+			) AS members_count,
+			count(*) FILTER (
+				WHERE uis.starts_at > now()
+			) AS pending_count
+		FROM users_in_segments uis
+		WHERE uis.segment_name = s.name
+			AND (
+				uis.expire_at IS NULL
+				OR uis.expire_at > now()
+			)
+	) counts
+WHERE s.deleted_at IS NULL
+	AND starts_with(s.name, @name_prefix::text)
+	AND s.name > @after_name::text
+ORDER BY s.name
+LIMIT @page_size::integer;
+-- name: UpdateSegment :one
+UPDATE segments
+SET description = COALESCE(sqlc.narg(description), description),
+	rollout_percent = COALESCE(sqlc.narg(rollout_percent), rollout_percent)
+WHERE name = @name
+	AND deleted_at IS NULL
+	AND (
+		sqlc.narg(rollout_percent)::double precision IS NULL
+		OR COALESCE(rollout_percent, 0) <= sqlc.narg(rollout_percent)::double precision
+	)
+RETURNING *;
@@ -3,4 +3,28 @@ SELECT *
 FROM users_in_segments_history
 WHERE user_id = $1
     AND action_date > @from_date
-    AND action_date < @to_date;
\ No newline at end of file
+    AND action_date < @to_date
+    AND (
+        @segment_name::text = ''
+        OR segment_name = @segment_name::text
+    )
+    AND (
+        COALESCE(cardinality(@action_types::text []), 0) = 0
+        OR action_type = ANY(@action_types::text [])
+    )
+    AND id > @after_id
+ORDER BY id
+LIMIT NULLIF(@page_size::integer, 0);
+-- name: GetLastSegmentsActionsByUserId :many
+SELECT DISTINCT ON (segment_name) *
+FROM users_in_segments_history
+WHERE user_id = @user_id
+    AND action_date <= @at
+ORDER BY segment_name,
+    action_date DESC,
+    id DESC;
+-- name: SetHistoryAudit :exec
+SELECT set_config('segments.actor', @actor::text, true),
+    set_config('segments.reason', @reason::text, true);
+-- name: SetHistoryAction :exec
+SELECT set_config('segments.action_type', @action_type::text, true);
\ No newline at end of file
@@ -5,7 +5,11 @@ WHERE user_id = @user_id
 	AND CASE
 		WHEN expire_at IS NOT NULL THEN expire_at > now()
 		ELSE TRUE
-	END;
+	END
+	AND (
+		starts_at IS NULL
+		OR starts_at <= now()
+	);
 -- name: AddUserIntoSegment :one
 INSERT INTO users_in_segments (
 		user_id,
@@ -17,7 +21,8 @@ INSERT INTO users_in_segments (
 VALUES (@user_id, @segment_name, now(), now(), null) ON CONFLICT (user_id, segment_name) DO
 UPDATE
 SET updated_at = now(),
-	expire_at = null
+	expire_at = null,
+	starts_at = null
 RETURNING *;
 -- name: AddUserIntoSegmentWithTTLInHours :one
 INSERT INTO users_in_segments (
@@ -36,19 +41,174 @@ VALUES (
 	) ON CONFLICT (user_id, segment_name) DO
 UPDATE
 SET updated_at = now(),
-	expire_at = now() + make_interval(hours => @number_of_hours)
+	expire_at = now() + make_interval(hours => @number_of_hours),
+	starts_at = null
 RETURNING *;
 -- name: RemoveUserFromSegment :exec 
 DELETE FROM users_in_segments
 WHERE user_id = @user_id
 	AND segment_name = @segment_name;
--- name: AddUserIntoSegmentWithExpireDatetime :one 
+-- name: AddUserIntoSegmentWithExpireDatetime :one
 INSERT INTO users_in_segments(
+		user_id,
+		segment_name,
+		created_at,
+		updated_at,
+		expire_at,
+		starts_at
+	)
+VALUES (
+		@user_id,
+		@segment_name,
+		now(),
+		now(),
+		@expire_at,
+		@starts_at
+	) ON CONFLICT (user_id, segment_name) DO
+UPDATE
+SET updated_at = now(),
+	expire_at = EXCLUDED.expire_at,
+	starts_at = EXCLUDED.starts_at
+RETURNING *;
+-- name: DeleteExpiredUsersFromSegments :execrows
+DELETE FROM users_in_segments
+WHERE (user_id, segment_name) IN (
+		SELECT user_id,
+			segment_name
+		FROM users_in_segments
+		WHERE expire_at <= now()
+		LIMIT @batch_size FOR UPDATE SKIP LOCKED
+	);
+-- name: StartScheduledUsersInSegments :execrows
+UPDATE users_in_segments
+SET started = TRUE
+WHERE (user_id, segment_name) IN (
+		SELECT user_id,
+			segment_name
+		FROM users_in_segments
+		WHERE NOT started
+			AND starts_at <= @now
+		LIMIT @batch_size FOR UPDATE SKIP LOCKED
+	);
+-- name: AddUserIntoRolloutSegments :many
+INSERT INTO users_in_segments (
 		user_id,
 		segment_name,
 		created_at,
 		updated_at,
 		expire_at
 	)
-VALUES ($1, $2, $3, $4, $5)
-RETURNING *;
\ No newline at end of file
+SELECT @user_id::bigint,
+	name,
+	now(),
+	now(),
+	null
+FROM segments
+WHERE deleted_at IS NULL
+	AND rollout_percent IS NOT NULL
+	AND rollout_bucket(rollout_salt, @user_id::bigint) < rollout_percent * 100 ON CONFLICT (user_id, segment_name) DO NOTHING
+RETURNING *;
+-- name: AddUsersBatchIntoRolloutSegment :one
+WITH batch AS (
+	SELECT id
+	FROM users
+	WHERE id > @after_id
+		AND deleted_at IS NULL
+	ORDER BY id
+	LIMIT @batch_size
+), inserted AS (
+	INSERT INTO users_in_segments (
+			user_id,
+			segment_name,
+			created_at,
+			updated_at,
+			expire_at
+		)
+	SELECT batch.id,
+		segments.name,
+		now(),
+		now(),
+		null
+	FROM batch
+		JOIN segments ON segments.name = @segment_name
+	WHERE segments.deleted_at IS NULL
+		AND segments.rollout_percent IS NOT NULL
+		AND rollout_bucket(segments.rollout_salt, batch.id) < segments.rollout_percent * 100 ON CONFLICT (user_id, segment_name) DO NOTHING
+	RETURNING user_id
+)
+SELECT COALESCE((SELECT max(id) FROM batch), 0)::bigint AS last_user_id,
+	(SELECT count(*) FROM batch) AS processed,
+	(SELECT count(*) FROM inserted) AS enrolled;
+-- name: CountUsersInSegment :one
+SELECT count(*)
+FROM users_in_segments
+WHERE segment_name = $1;
+-- name: RemoveUsersBatchFromSegment :execrows
+DELETE FROM users_in_segments
+WHERE (user_id, segment_name) IN (
+		SELECT user_id,
+			segment_name
+		FROM users_in_segments
+		WHERE segment_name = @segment_name
+		LIMIT @batch_size FOR UPDATE SKIP LOCKED
+	);
+-- name: ListUsersInSegment :many
+SELECT *
+FROM users_in_segments
+WHERE segment_name = @segment_name
+	AND user_id > @after_user_id
+	AND (
+		@include_expired::boolean
+		OR expire_at IS NULL
+		OR expire_at > now()
+	)
+	AND (
+		@include_pending::boolean
+		OR starts_at IS NULL
+		OR starts_at <= now()
+	)
+ORDER BY user_id
+LIMIT @page_size::integer;
+-- name: AddUsersIntoSegmentBatch :many
+WITH input AS (
+	SELECT *
+	FROM unnest(
+			@user_ids::bigint [],
+			@expire_at::timestamp [],
+			@starts_at::timestamp []
+		) AS input(user_id, expire_at, starts_at)
+),
+upserted AS (
+	INSERT INTO users_in_segments (
+			user_id,
+			segment_name,
+			created_at,
+			updated_at,
+			expire_at,
+			starts_at
+		)
+	SELECT input.user_id,
+		@segment_name::text,
+		now(),
+		now(),
+		input.expire_at,
+		input.starts_at
+	FROM input
+		JOIN users ON users.id = input.user_id
+		AND users.deleted_at IS NULL ON CONFLICT (user_id, segment_name) DO
+	UPDATE
+	SET updated_at = now(),
+		expire_at = EXCLUDED.expire_at,
+		starts_at = EXCLUDED.starts_at
+	RETURNING user_id,
+		expire_at,
+		starts_at,
+		xmax = 0 AS inserted
+)
+SELECT input.user_id,
+	upserted.user_id IS NOT NULL AS user_exists,
+	COALESCE(upserted.inserted, false)::boolean AS inserted,
+	upserted.expire_at,
+	upserted.starts_at
+FROM input
+	LEFT JOIN upserted ON upserted.user_id = input.user_id;
@@ -1,14 +1,66 @@
 -- name: AddUser :one
-INSERT INTO users(name, created_at, updated_at)
-VALUES ($1, now(), now())
+INSERT INTO users(name, external_id, created_at, updated_at)
+VALUES ($1, $2, now(), now())
+RETURNING *;
+-- name: AddUserIfNotExists :one
+INSERT INTO users(name, external_id, created_at, updated_at)
+VALUES ($1, $2, now(), now()) ON CONFLICT (external_id) DO NOTHING
 RETURNING *;
 -- name: DeleteUser :exec 
+UPDATE users
+SET deleted_at = now(),
+	updated_at = now()
+WHERE id = $1
+	AND deleted_at IS NULL;
+-- name: RestoreUser :one
+UPDATE users
+SET deleted_at = null,
+	updated_at = now()
+WHERE (
+		id = @id
+		OR external_id = sqlc.narg(external_id)
+	)
+	AND deleted_at > @deleted_after
+RETURNING *;
+-- name: PurgeDeletedUsers :execrows
 DELETE FROM users
-WHERE id = $1;
+WHERE deleted_at <= @deleted_before;
 -- name: GetAllUsersId :many
 SELECT id
-FROM users;
+FROM users
+WHERE deleted_at IS NULL;
 -- name: GetUserById :one 
 SELECT *
 FROM users
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1
+	AND deleted_at IS NULL;
+-- name: GetUserByExternalId :one
+SELECT *
+FROM users
+WHERE external_id = $1
+	AND deleted_at IS NULL;
+-- name: CountUsers :one
+SELECT count(*)
+FROM users
+WHERE deleted_at IS NULL;
+-- name: ListUsers :many
+SELECT *
+FROM users
+WHERE deleted_at IS NULL
+	AND id > @after_id
+	AND (
+		@name_query::text = ''
+		OR strpos(lower(name), lower(@name_query::text)) > 0
+	)
+ORDER BY id
+LIMIT @page_size::integer;
+-- name: UpdateUser :one
+UPDATE users
+SET name = COALESCE(sqlc.narg(name), name),
+	external_id = CASE
+		WHEN sqlc.narg(external_id)::varchar IS NULL THEN external_id
+		ELSE NULLIF(sqlc.narg(external_id)::varchar, '')
+	END
+WHERE id = @id
+	AND deleted_at IS NULL
+RETURNING *;
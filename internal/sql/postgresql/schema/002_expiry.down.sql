@@ -0,0 +1,19 @@
+CREATE OR REPLACE FUNCTION users_in_segments_delete() RETURNS TRIGGER AS $$ BEGIN
+INSERT INTO users_in_segments_history(
+		user_id,
+		segment_name,
+		expire_at,
+		action_type,
+		action_date
+	)
+VALUES (
+		OLD.user_id,
+		OLD.segment_name,
+		OLD.expire_at,
+		'deleted',
+		now()
+	);
+RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+DROP INDEX IF EXISTS users_in_segments_expire_at_idx;
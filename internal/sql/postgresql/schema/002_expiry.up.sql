@@ -0,0 +1,23 @@
+CREATE INDEX IF NOT EXISTS users_in_segments_expire_at_idx ON users_in_segments(expire_at)
+WHERE expire_at IS NOT NULL;
+CREATE OR REPLACE FUNCTION users_in_segments_delete() RETURNS TRIGGER AS $$ BEGIN
+INSERT INTO users_in_segments_history(
+		user_id,
+		segment_name,
+		expire_at,
+		action_type,
+		action_date
+	)
+VALUES (
+		OLD.user_id,
+		OLD.segment_name,
+		OLD.expire_at,
+		COALESCE(
+			NULLIF(current_setting('segments.action_type', true), ''),
+			'deleted'
+		),
+		now()
+	);
+RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,8 @@
+ALTER TABLE segments
+ADD COLUMN IF NOT EXISTS rollout_salt TEXT;
+UPDATE segments
+SET rollout_salt = name
+WHERE rollout_salt IS NULL;
+ALTER TABLE segments
+ALTER COLUMN rollout_salt
+SET NOT NULL;
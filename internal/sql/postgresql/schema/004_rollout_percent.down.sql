@@ -0,0 +1,20 @@
+CREATE OR REPLACE FUNCTION users_in_segments_insert() RETURNS TRIGGER AS $$ BEGIN
+INSERT INTO users_in_segments_history(
+		user_id,
+		segment_name,
+		expire_at,
+		action_type,
+		action_date
+	)
+VALUES (
+		NEW.user_id,
+		NEW.segment_name,
+		NEW.expire_at,
+		'inserted',
+		now()
+	);
+RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+DROP FUNCTION IF EXISTS rollout_bucket(TEXT, BIGINT);
+ALTER TABLE segments DROP COLUMN IF EXISTS rollout_percent;
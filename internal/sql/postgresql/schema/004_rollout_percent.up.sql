@@ -0,0 +1,31 @@
+ALTER TABLE segments
+ADD COLUMN IF NOT EXISTS rollout_percent DOUBLE PRECISION;
+-- Must stay in sync with usecases_user_segments.Bucket.
+CREATE OR REPLACE FUNCTION rollout_bucket(salt TEXT, user_id BIGINT) RETURNS INTEGER AS $$
+SELECT (
+		(
+			'x' || substr(md5(salt || ':' || user_id::text), 1, 8)
+		)::bit(32)::bigint % 10000
+	)::integer;
+$$ LANGUAGE SQL IMMUTABLE;
+CREATE OR REPLACE FUNCTION users_in_segments_insert() RETURNS TRIGGER AS $$ BEGIN
+INSERT INTO users_in_segments_history(
+		user_id,
+		segment_name,
+		expire_at,
+		action_type,
+		action_date
+	)
+VALUES (
+		NEW.user_id,
+		NEW.segment_name,
+		NEW.expire_at,
+		COALESCE(
+			NULLIF(current_setting('segments.action_type', true), ''),
+			'inserted'
+		),
+		now()
+	);
+RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
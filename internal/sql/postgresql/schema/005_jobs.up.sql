@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS jobs(
+	id BIGSERIAL PRIMARY KEY,
+	kind TEXT NOT NULL,
+	status TEXT NOT NULL,
+	payload JSONB NOT NULL,
+	total BIGINT NOT NULL DEFAULT 0,
+	processed BIGINT NOT NULL DEFAULT 0,
+	affected BIGINT NOT NULL DEFAULT 0,
+	error TEXT,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	started_at TIMESTAMP,
+	finished_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS jobs_queued_idx ON jobs(id)
+WHERE status = 'queued';
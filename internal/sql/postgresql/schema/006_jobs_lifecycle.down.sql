@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS jobs_running_idx;
+ALTER TABLE jobs DROP COLUMN IF EXISTS checkpoint,
+	DROP COLUMN IF EXISTS attempts;
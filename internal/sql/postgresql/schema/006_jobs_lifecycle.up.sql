@@ -0,0 +1,5 @@
+ALTER TABLE jobs
+ADD COLUMN IF NOT EXISTS checkpoint JSONB NOT NULL DEFAULT '{}',
+	ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS jobs_running_idx ON jobs(updated_at)
+WHERE status = 'running';
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS users_in_segments_before_update ON users_in_segments;
+DROP TRIGGER IF EXISTS segments_before_update ON segments;
+DROP TRIGGER IF EXISTS users_before_update ON users;
+DROP FUNCTION IF EXISTS set_updated_at();
@@ -0,0 +1,10 @@
+CREATE OR REPLACE FUNCTION set_updated_at() RETURNS TRIGGER AS $$ BEGIN NEW.updated_at = now();
+RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+CREATE OR REPLACE TRIGGER users_before_update BEFORE
+UPDATE ON users FOR EACH ROW EXECUTE PROCEDURE set_updated_at();
+CREATE OR REPLACE TRIGGER segments_before_update BEFORE
+UPDATE ON segments FOR EACH ROW EXECUTE PROCEDURE set_updated_at();
+CREATE OR REPLACE TRIGGER users_in_segments_before_update BEFORE
+UPDATE ON users_in_segments FOR EACH ROW EXECUTE PROCEDURE set_updated_at();
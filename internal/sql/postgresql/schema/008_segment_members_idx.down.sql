@@ -0,0 +1 @@
+DROP INDEX IF EXISTS users_in_segments_segment_name_idx;
\ No newline at end of file
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS users_in_segments_segment_name_idx ON users_in_segments(segment_name, user_id);
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS external_id TEXT UNIQUE;
\ No newline at end of file
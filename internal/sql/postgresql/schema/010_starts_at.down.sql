@@ -0,0 +1,51 @@
+DROP TRIGGER IF EXISTS users_in_segments_after_start ON users_in_segments;
+DROP FUNCTION IF EXISTS users_in_segments_start();
+DROP TRIGGER IF EXISTS users_in_segments_before_update_starts_at ON users_in_segments;
+DROP TRIGGER IF EXISTS users_in_segments_before_insert ON users_in_segments;
+DROP FUNCTION IF EXISTS users_in_segments_set_started();
+DROP INDEX IF EXISTS users_in_segments_not_started_idx;
+CREATE OR REPLACE FUNCTION users_in_segments_insert() RETURNS TRIGGER AS $$ BEGIN
+INSERT INTO users_in_segments_history(
+		user_id,
+		segment_name,
+		expire_at,
+		action_type,
+		action_date
+	)
+VALUES (
+		NEW.user_id,
+		NEW.segment_name,
+		NEW.expire_at,
+		COALESCE(
+			NULLIF(current_setting('segments.action_type', true), ''),
+			'inserted'
+		),
+		now()
+	);
+RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+CREATE OR REPLACE FUNCTION users_in_segments_delete() RETURNS TRIGGER AS $$ BEGIN
+INSERT INTO users_in_segments_history(
+		user_id,
+		segment_name,
+		expire_at,
+		action_type,
+		action_date
+	)
+VALUES (
+		OLD.user_id,
+		OLD.segment_name,
+		OLD.expire_at,
+		COALESCE(
+			NULLIF(current_setting('segments.action_type', true), ''),
+			'deleted'
+		),
+		now()
+	);
+RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+ALTER TABLE users_in_segments_history DROP COLUMN IF EXISTS starts_at;
+ALTER TABLE users_in_segments DROP COLUMN IF EXISTS started,
+	DROP COLUMN IF EXISTS starts_at;
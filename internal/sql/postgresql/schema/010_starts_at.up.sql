@@ -0,0 +1,92 @@
+ALTER TABLE users_in_segments
+ADD COLUMN IF NOT EXISTS starts_at TIMESTAMP,
+	ADD COLUMN IF NOT EXISTS started BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE users_in_segments_history
+ADD COLUMN IF NOT EXISTS starts_at TIMESTAMP;
+CREATE OR REPLACE FUNCTION users_in_segments_insert() RETURNS TRIGGER AS $$ BEGIN
+INSERT INTO users_in_segments_history(
+		user_id,
+		segment_name,
+		expire_at,
+		action_type,
+		action_date,
+		starts_at
+	)
+VALUES (
+		NEW.user_id,
+		NEW.segment_name,
+		NEW.expire_at,
+		COALESCE(
+			NULLIF(current_setting('segments.action_type', true), ''),
+			CASE
+				WHEN NEW.starts_at > now() THEN 'scheduled'
+				ELSE 'inserted'
+			END
+		),
+		now(),
+		NEW.starts_at
+	);
+RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+CREATE OR REPLACE FUNCTION users_in_segments_delete() RETURNS TRIGGER AS $$ BEGIN
+INSERT INTO users_in_segments_history(
+		user_id,
+		segment_name,
+		expire_at,
+		action_type,
+		action_date,
+		starts_at
+	)
+VALUES (
+		OLD.user_id,
+		OLD.segment_name,
+		OLD.expire_at,
+		COALESCE(
+			NULLIF(current_setting('segments.action_type', true), ''),
+			'deleted'
+		),
+		now(),
+		OLD.starts_at
+	);
+RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+CREATE INDEX IF NOT EXISTS users_in_segments_not_started_idx ON users_in_segments(starts_at)
+WHERE NOT started;
+CREATE OR REPLACE FUNCTION users_in_segments_set_started() RETURNS TRIGGER AS $$ BEGIN NEW.started := NEW.starts_at IS NULL
+	OR NEW.starts_at <= now();
+RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+CREATE OR REPLACE TRIGGER users_in_segments_before_insert BEFORE
+INSERT ON users_in_segments FOR EACH ROW EXECUTE PROCEDURE users_in_segments_set_started();
+CREATE OR REPLACE TRIGGER users_in_segments_before_update_starts_at BEFORE
+UPDATE OF starts_at ON users_in_segments FOR EACH ROW EXECUTE PROCEDURE users_in_segments_set_started();
+CREATE OR REPLACE FUNCTION users_in_segments_start() RETURNS TRIGGER AS $$ BEGIN
+INSERT INTO users_in_segments_history(
+		user_id,
+		segment_name,
+		expire_at,
+		action_type,
+		action_date,
+		starts_at
+	)
+VALUES (
+		NEW.user_id,
+		NEW.segment_name,
+		NEW.expire_at,
+		'started',
+		now(),
+		NEW.starts_at
+	);
+RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+CREATE OR REPLACE TRIGGER users_in_segments_after_start
+AFTER
+UPDATE OF started ON users_in_segments FOR EACH ROW
+	WHEN (
+		NOT OLD.started
+		AND NEW.started
+	) EXECUTE PROCEDURE users_in_segments_start();
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS users_in_segments_history_user_id_idx;
+ALTER TABLE users_in_segments_history DROP COLUMN IF EXISTS id;
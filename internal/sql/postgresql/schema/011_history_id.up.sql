@@ -0,0 +1,3 @@
+ALTER TABLE users_in_segments_history
+ADD COLUMN IF NOT EXISTS id BIGSERIAL;
+CREATE INDEX IF NOT EXISTS users_in_segments_history_user_id_idx ON users_in_segments_history(user_id, action_date);
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS users_in_segments_after_update ON users_in_segments;
+DROP FUNCTION IF EXISTS users_in_segments_update();
+ALTER TABLE users_in_segments_history DROP COLUMN IF EXISTS old_expire_at;
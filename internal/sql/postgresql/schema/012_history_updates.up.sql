@@ -0,0 +1,38 @@
+ALTER TABLE users_in_segments_history
+ADD COLUMN IF NOT EXISTS old_expire_at TIMESTAMP;
+CREATE OR REPLACE FUNCTION users_in_segments_update() RETURNS TRIGGER AS $$ BEGIN
+INSERT INTO users_in_segments_history(
+		user_id,
+		segment_name,
+		expire_at,
+		action_type,
+		action_date,
+		starts_at,
+		old_expire_at
+	)
+VALUES (
+		NEW.user_id,
+		NEW.segment_name,
+		NEW.expire_at,
+		COALESCE(
+			NULLIF(current_setting('segments.action_type', true), ''),
+			CASE
+				WHEN OLD.expire_at IS DISTINCT FROM NEW.expire_at THEN 'ttl_changed'
+				ELSE 'updated'
+			END
+		),
+		now(),
+		NEW.starts_at,
+		OLD.expire_at
+	);
+RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+CREATE OR REPLACE TRIGGER users_in_segments_after_update
+AFTER
+UPDATE OF expire_at,
+	starts_at ON users_in_segments FOR EACH ROW
+	WHEN (
+		OLD.expire_at IS DISTINCT FROM NEW.expire_at
+		OR OLD.starts_at IS DISTINCT FROM NEW.starts_at
+	) EXECUTE PROCEDURE users_in_segments_update();
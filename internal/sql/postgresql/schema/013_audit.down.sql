@@ -0,0 +1,78 @@
+CREATE OR REPLACE FUNCTION users_in_segments_insert() RETURNS TRIGGER AS $$ BEGIN
+INSERT INTO users_in_segments_history(
+		user_id,
+		segment_name,
+		expire_at,
+		action_type,
+		action_date,
+		starts_at
+	)
+VALUES (
+		NEW.user_id,
+		NEW.segment_name,
+		NEW.expire_at,
+		COALESCE(
+			NULLIF(current_setting('segments.action_type', true), ''),
+			CASE
+				WHEN NEW.starts_at > now() THEN 'scheduled'
+				ELSE 'inserted'
+			END
+		),
+		now(),
+		NEW.starts_at
+	);
+RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+CREATE OR REPLACE FUNCTION users_in_segments_delete() RETURNS TRIGGER AS $$ BEGIN
+INSERT INTO users_in_segments_history(
+		user_id,
+		segment_name,
+		expire_at,
+		action_type,
+		action_date,
+		starts_at
+	)
+VALUES (
+		OLD.user_id,
+		OLD.segment_name,
+		OLD.expire_at,
+		COALESCE(
+			NULLIF(current_setting('segments.action_type', true), ''),
+			'deleted'
+		),
+		now(),
+		OLD.starts_at
+	);
+RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+CREATE OR REPLACE FUNCTION users_in_segments_update() RETURNS TRIGGER AS $$ BEGIN
+INSERT INTO users_in_segments_history(
+		user_id,
+		segment_name,
+		expire_at,
+		action_type,
+		action_date,
+		starts_at,
+		old_expire_at
+	)
+VALUES (
+		NEW.user_id,
+		NEW.segment_name,
+		NEW.expire_at,
+		CASE
+			WHEN OLD.expire_at IS DISTINCT FROM NEW.expire_at THEN 'ttl_changed'
+			ELSE 'updated'
+		END,
+		now(),
+		NEW.starts_at,
+		OLD.expire_at
+	);
+RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+ALTER TABLE jobs DROP COLUMN IF EXISTS reason,
+	DROP COLUMN IF EXISTS actor;
+ALTER TABLE users_in_segments_history DROP COLUMN IF EXISTS reason,
+	DROP COLUMN IF EXISTS actor;
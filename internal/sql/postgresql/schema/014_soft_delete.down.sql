@@ -0,0 +1,15 @@
+DROP TRIGGER IF EXISTS users_after_restore ON users;
+DROP TRIGGER IF EXISTS users_after_soft_delete ON users;
+DROP TRIGGER IF EXISTS segments_after_restore ON segments;
+DROP TRIGGER IF EXISTS segments_after_soft_delete ON segments;
+DROP FUNCTION IF EXISTS users_restore();
+DROP FUNCTION IF EXISTS users_soft_delete();
+DROP FUNCTION IF EXISTS segments_restore();
+DROP FUNCTION IF EXISTS segments_soft_delete();
+DROP INDEX IF EXISTS users_in_segments_history_segment_name_idx;
+DELETE FROM users
+WHERE deleted_at IS NOT NULL;
+DELETE FROM segments
+WHERE deleted_at IS NOT NULL;
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE segments DROP COLUMN IF EXISTS deleted_at;
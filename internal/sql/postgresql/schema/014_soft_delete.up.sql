@@ -0,0 +1,127 @@
+ALTER TABLE segments
+ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS segments_deleted_at_idx ON segments(deleted_at)
+WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS users_deleted_at_idx ON users(deleted_at)
+WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS users_in_segments_history_segment_name_idx ON users_in_segments_history(segment_name, user_id);
+CREATE OR REPLACE FUNCTION segments_soft_delete() RETURNS TRIGGER AS $$
+DECLARE action_type TEXT := COALESCE(current_setting('segments.action_type', true), '');
+BEGIN PERFORM set_config('segments.action_type', 'segment_deleted', true);
+DELETE FROM users_in_segments
+WHERE segment_name = NEW.name;
+PERFORM set_config('segments.action_type', action_type, true);
+RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+CREATE OR REPLACE TRIGGER segments_after_soft_delete
+AFTER
+UPDATE OF deleted_at ON segments FOR EACH ROW
+	WHEN (
+		OLD.deleted_at IS NULL
+		AND NEW.deleted_at IS NOT NULL
+	) EXECUTE PROCEDURE segments_soft_delete();
+CREATE OR REPLACE FUNCTION segments_restore() RETURNS TRIGGER AS $$
+DECLARE action_type TEXT := COALESCE(current_setting('segments.action_type', true), '');
+BEGIN PERFORM set_config('segments.action_type', 'segment_restored', true);
+INSERT INTO users_in_segments (
+		user_id,
+		segment_name,
+		created_at,
+		updated_at,
+		expire_at,
+		starts_at
+	)
+SELECT last_actions.user_id,
+	last_actions.segment_name,
+	now(),
+	now(),
+	last_actions.expire_at,
+	last_actions.starts_at
+FROM (
+		SELECT DISTINCT ON (user_id) *
+		FROM users_in_segments_history
+		WHERE segment_name = NEW.name
+		ORDER BY user_id,
+			action_date DESC,
+			id DESC
+	) last_actions
+	JOIN users ON users.id = last_actions.user_id
+	AND users.deleted_at IS NULL
+WHERE last_actions.action_type = 'segment_deleted'
+	AND (
+		last_actions.expire_at IS NULL
+		OR last_actions.expire_at > now()
+	) ON CONFLICT (user_id, segment_name) DO NOTHING;
+PERFORM set_config('segments.action_type', action_type, true);
+RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+CREATE OR REPLACE TRIGGER segments_after_restore
+AFTER
+UPDATE OF deleted_at ON segments FOR EACH ROW
+	WHEN (
+		OLD.deleted_at IS NOT NULL
+		AND NEW.deleted_at IS NULL
+	) EXECUTE PROCEDURE segments_restore();
+CREATE OR REPLACE FUNCTION users_soft_delete() RETURNS TRIGGER AS $$
+DECLARE action_type TEXT := COALESCE(current_setting('segments.action_type', true), '');
+BEGIN PERFORM set_config('segments.action_type', 'user_deleted', true);
+DELETE FROM users_in_segments
+WHERE user_id = NEW.id;
+PERFORM set_config('segments.action_type', action_type, true);
+RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+CREATE OR REPLACE TRIGGER users_after_soft_delete
+AFTER
+UPDATE OF deleted_at ON users FOR EACH ROW
+	WHEN (
+		OLD.deleted_at IS NULL
+		AND NEW.deleted_at IS NOT NULL
+	) EXECUTE PROCEDURE users_soft_delete();
+CREATE OR REPLACE FUNCTION users_restore() RETURNS TRIGGER AS $$
+DECLARE action_type TEXT := COALESCE(current_setting('segments.action_type', true), '');
+BEGIN PERFORM set_config('segments.action_type', 'user_restored', true);
+INSERT INTO users_in_segments (
+		user_id,
+		segment_name,
+		created_at,
+		updated_at,
+		expire_at,
+		starts_at
+	)
+SELECT last_actions.user_id,
+	last_actions.segment_name,
+	now(),
+	now(),
+	last_actions.expire_at,
+	last_actions.starts_at
+FROM (
+		SELECT DISTINCT ON (segment_name) *
+		FROM users_in_segments_history
+		WHERE user_id = NEW.id
+		ORDER BY segment_name,
+			action_date DESC,
+			id DESC
+	) last_actions
+	JOIN segments ON segments.name = last_actions.segment_name
+	AND segments.deleted_at IS NULL
+WHERE last_actions.action_type = 'user_deleted'
+	AND (
+		last_actions.expire_at IS NULL
+		OR last_actions.expire_at > now()
+	) ON CONFLICT (user_id, segment_name) DO NOTHING;
+PERFORM set_config('segments.action_type', action_type, true);
+RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+CREATE OR REPLACE TRIGGER users_after_restore
+AFTER
+UPDATE OF deleted_at ON users FOR EACH ROW
+	WHEN (
+		OLD.deleted_at IS NOT NULL
+		AND NEW.deleted_at IS NULL
+	) EXECUTE PROCEDURE users_restore();
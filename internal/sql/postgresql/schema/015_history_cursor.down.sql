@@ -0,0 +1 @@
+DROP INDEX IF EXISTS users_in_segments_history_user_id_id_idx;
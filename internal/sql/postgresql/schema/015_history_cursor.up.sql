@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS users_in_segments_history_user_id_id_idx ON users_in_segments_history(user_id, id);
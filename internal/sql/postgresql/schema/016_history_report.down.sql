@@ -0,0 +1 @@
+DROP INDEX IF EXISTS users_in_segments_history_action_date_id_idx;
\ No newline at end of file
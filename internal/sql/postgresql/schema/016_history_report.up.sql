@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS users_in_segments_history_action_date_id_idx ON users_in_segments_history(action_date, id);
\ No newline at end of file
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS reports(
+	job_id BIGINT PRIMARY KEY REFERENCES jobs(id) ON DELETE CASCADE,
+	blob_key TEXT NOT NULL,
+	filename TEXT NOT NULL,
+	content_type TEXT NOT NULL,
+	size BIGINT NOT NULL,
+	records BIGINT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	expire_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS reports_expire_at_idx ON reports(expire_at);
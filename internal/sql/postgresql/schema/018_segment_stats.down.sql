@@ -0,0 +1,4 @@
+DROP FUNCTION IF EXISTS segment_stats_kind(TEXT);
+DROP INDEX IF EXISTS users_in_segments_history_id_idx;
+DROP TABLE IF EXISTS segment_stats_state;
+DROP TABLE IF EXISTS segment_daily_stats;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS segment_daily_stats(
+	segment_name TEXT NOT NULL,
+	day DATE NOT NULL,
+	added BIGINT NOT NULL DEFAULT 0,
+	removed BIGINT NOT NULL DEFAULT 0,
+	expired BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (segment_name, day)
+);
+CREATE TABLE IF NOT EXISTS segment_stats_state(
+	id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+	last_history_id BIGINT NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+INSERT INTO segment_stats_state(id, last_history_id, updated_at)
+VALUES (TRUE, 0, now()) ON CONFLICT (id) DO NOTHING;
+CREATE INDEX IF NOT EXISTS users_in_segments_history_id_idx ON users_in_segments_history(id);
+CREATE OR REPLACE FUNCTION segment_stats_kind(action_type TEXT) RETURNS TEXT AS $$
+SELECT CASE
+		WHEN action_type IN (
+			'inserted',
+			'scheduled',
+			'auto_assigned',
+			'segment_restored',
+			'user_restored'
+		) THEN 'added'
+		WHEN action_type IN ('deleted', 'segment_deleted', 'user_deleted') THEN 'removed'
+		WHEN action_type = 'expired' THEN 'expired'
+	END;
+$$ LANGUAGE sql IMMUTABLE;
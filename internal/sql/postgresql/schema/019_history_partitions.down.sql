@@ -0,0 +1,19 @@
+DROP TABLE IF EXISTS history_archives;
+CREATE TABLE users_in_segments_history_flat (
+	LIKE users_in_segments_history INCLUDING DEFAULTS
+);
+INSERT INTO users_in_segments_history_flat
+SELECT *
+FROM users_in_segments_history;
+ALTER SEQUENCE users_in_segments_history_user_id_seq OWNED BY users_in_segments_history_flat.user_id;
+ALTER SEQUENCE users_in_segments_history_id_seq OWNED BY users_in_segments_history_flat.id;
+DROP TABLE users_in_segments_history;
+ALTER TABLE users_in_segments_history_flat
+	RENAME TO users_in_segments_history;
+CREATE INDEX IF NOT EXISTS users_in_segments_history_user_id_idx ON users_in_segments_history(user_id, action_date);
+CREATE INDEX IF NOT EXISTS users_in_segments_history_user_id_id_idx ON users_in_segments_history(user_id, id);
+CREATE INDEX IF NOT EXISTS users_in_segments_history_action_date_id_idx ON users_in_segments_history(action_date, id);
+CREATE INDEX IF NOT EXISTS users_in_segments_history_segment_name_idx ON users_in_segments_history(segment_name, user_id);
+CREATE INDEX IF NOT EXISTS users_in_segments_history_id_idx ON users_in_segments_history(id);
+DROP FUNCTION IF EXISTS drop_history_partition(TIMESTAMP);
+DROP FUNCTION IF EXISTS create_history_partitions(TIMESTAMP, TIMESTAMP);
@@ -0,0 +1,125 @@
+ALTER TABLE users_in_segments_history
+	RENAME TO users_in_segments_history_old;
+CREATE TABLE users_in_segments_history (
+	LIKE users_in_segments_history_old INCLUDING DEFAULTS
+) PARTITION BY RANGE (action_date);
+ALTER SEQUENCE users_in_segments_history_user_id_seq OWNED BY users_in_segments_history.user_id;
+ALTER SEQUENCE users_in_segments_history_id_seq OWNED BY users_in_segments_history.id;
+CREATE TABLE IF NOT EXISTS users_in_segments_history_default PARTITION OF users_in_segments_history DEFAULT;
+CREATE OR REPLACE FUNCTION create_history_partitions(from_month TIMESTAMP, to_month TIMESTAMP) RETURNS INTEGER AS $$
+DECLARE partition_month TIMESTAMP := date_trunc('month', from_month);
+partition_name TEXT;
+created INTEGER := 0;
+BEGIN WHILE partition_month <= to_month LOOP partition_name := 'users_in_segments_history_p' || to_char(partition_month, 'YYYYMM');
+IF to_regclass(partition_name) IS NULL THEN EXECUTE format(
+	'CREATE TABLE %I (LIKE users_in_segments_history INCLUDING DEFAULTS)',
+	partition_name
+);
+EXECUTE format(
+	'WITH moved AS (DELETE FROM users_in_segments_history_default WHERE action_date >= $1 AND action_date < $2 RETURNING *) INSERT INTO %I SELECT * FROM moved',
+	partition_name
+) USING partition_month,
+partition_month + interval '1 month';
+EXECUTE format(
+	'ALTER TABLE users_in_segments_history ATTACH PARTITION %I FOR VALUES FROM (%L) TO (%L)',
+	partition_name,
+	partition_month,
+	partition_month + interval '1 month'
+);
+created := created + 1;
+END IF;
+partition_month := partition_month + interval '1 month';
+END LOOP;
+RETURN created;
+END;
+$$ LANGUAGE plpgsql;
+CREATE OR REPLACE FUNCTION drop_history_partition(archived_month TIMESTAMP) RETURNS BOOLEAN AS $$
+DECLARE partition_name TEXT := 'users_in_segments_history_p' || to_char(archived_month, 'YYYYMM');
+next_month TIMESTAMP := date_trunc('month', archived_month) + interval '1 month';
+not_aggregated BOOLEAN;
+restorable BOOLEAN;
+BEGIN IF to_regclass(partition_name) IS NULL THEN RETURN FALSE;
+END IF;
+EXECUTE format(
+	'SELECT EXISTS (SELECT 1 FROM %I WHERE id > (SELECT last_history_id FROM segment_stats_state WHERE segment_stats_state.id))',
+	partition_name
+) INTO not_aggregated;
+IF not_aggregated THEN RAISE EXCEPTION 'partition % has history not aggregated into segment stats yet',
+partition_name;
+END IF;
+EXECUTE format(
+	'SELECT EXISTS (SELECT 1 FROM %I h WHERE (h.action_type = ''segment_deleted'' AND EXISTS (SELECT 1 FROM segments s WHERE s.name = h.segment_name AND s.deleted_at IS NOT NULL)) OR (h.action_type = ''user_deleted'' AND EXISTS (SELECT 1 FROM users u WHERE u.id = h.user_id AND u.deleted_at IS NOT NULL)))',
+	partition_name
+) INTO restorable;
+IF restorable THEN RAISE EXCEPTION 'partition % has history of deleted segments or users that can still be restored',
+partition_name;
+END IF;
+-- Memberships that outlive the month are carried into the next one,
+-- so the segments of a user at a moment after it can still be told without the dropped history.
+INSERT INTO users_in_segments_history (
+		user_id,
+		segment_name,
+		expire_at,
+		action_type,
+		action_date,
+		starts_at
+	)
+SELECT last_actions.user_id,
+	last_actions.segment_name,
+	last_actions.expire_at,
+	'snapshot',
+	next_month,
+	last_actions.starts_at
+FROM (
+		SELECT DISTINCT ON (user_id, segment_name) user_id,
+			segment_name,
+			expire_at,
+			action_type,
+			starts_at
+		FROM users_in_segments_history
+		WHERE action_date < next_month
+		ORDER BY user_id,
+			segment_name,
+			action_date DESC,
+			id DESC
+	) last_actions
+WHERE last_actions.action_type NOT IN (
+		'deleted',
+		'expired',
+		'segment_deleted',
+		'user_deleted'
+	)
+	AND (
+		last_actions.expire_at IS NULL
+		OR last_actions.expire_at > next_month
+	);
+EXECUTE format('DROP TABLE %I', partition_name);
+RETURN TRUE;
+END;
+$$ LANGUAGE plpgsql;
+SELECT create_history_partitions(
+		COALESCE(
+			(
+				SELECT min(action_date)
+				FROM users_in_segments_history_old
+			),
+			now()
+		)::timestamp,
+		(now() + interval '3 months')::timestamp
+	);
+INSERT INTO users_in_segments_history
+SELECT *
+FROM users_in_segments_history_old;
+DROP TABLE users_in_segments_history_old;
+CREATE INDEX IF NOT EXISTS users_in_segments_history_user_id_idx ON users_in_segments_history(user_id, action_date);
+CREATE INDEX IF NOT EXISTS users_in_segments_history_user_id_id_idx ON users_in_segments_history(user_id, id);
+CREATE INDEX IF NOT EXISTS users_in_segments_history_action_date_id_idx ON users_in_segments_history(action_date, id);
+CREATE INDEX IF NOT EXISTS users_in_segments_history_segment_name_idx ON users_in_segments_history(segment_name, user_id);
+CREATE INDEX IF NOT EXISTS users_in_segments_history_id_idx ON users_in_segments_history(id);
+CREATE TABLE IF NOT EXISTS history_archives(
+	month DATE PRIMARY KEY,
+	blob_key TEXT NOT NULL,
+	size BIGINT NOT NULL,
+	records BIGINT NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
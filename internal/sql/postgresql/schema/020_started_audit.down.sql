@@ -0,0 +1,33 @@
+CREATE OR REPLACE FUNCTION users_in_segments_start() RETURNS TRIGGER AS $$ BEGIN
+INSERT INTO users_in_segments_history(
+		user_id,
+		segment_name,
+		expire_at,
+		action_type,
+		action_date,
+		starts_at
+	)
+VALUES (
+		NEW.user_id,
+		NEW.segment_name,
+		NEW.expire_at,
+		'started',
+		now(),
+		NEW.starts_at
+	);
+RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+CREATE OR REPLACE FUNCTION segment_stats_kind(action_type TEXT) RETURNS TEXT AS $$
+SELECT CASE
+		WHEN action_type IN (
+			'inserted',
+			'scheduled',
+			'auto_assigned',
+			'segment_restored',
+			'user_restored'
+		) THEN 'added'
+		WHEN action_type IN ('deleted', 'segment_deleted', 'user_deleted') THEN 'removed'
+		WHEN action_type = 'expired' THEN 'expired'
+	END;
+$$ LANGUAGE sql IMMUTABLE;
@@ -0,0 +1,37 @@
+CREATE OR REPLACE FUNCTION users_in_segments_start() RETURNS TRIGGER AS $$ BEGIN
+INSERT INTO users_in_segments_history(
+		user_id,
+		segment_name,
+		expire_at,
+		action_type,
+		action_date,
+		starts_at,
+		actor,
+		reason
+	)
+VALUES (
+		NEW.user_id,
+		NEW.segment_name,
+		NEW.expire_at,
+		'started',
+		now(),
+		NEW.starts_at,
+		NULLIF(current_setting('segments.actor', true), ''),
+		NULLIF(current_setting('segments.reason', true), '')
+	);
+RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+CREATE OR REPLACE FUNCTION segment_stats_kind(action_type TEXT) RETURNS TEXT AS $$
+SELECT CASE
+		WHEN action_type IN (
+			'inserted',
+			'started',
+			'auto_assigned',
+			'segment_restored',
+			'user_restored'
+		) THEN 'added'
+		WHEN action_type IN ('deleted', 'segment_deleted', 'user_deleted') THEN 'removed'
+		WHEN action_type = 'expired' THEN 'expired'
+	END;
+$$ LANGUAGE sql IMMUTABLE;
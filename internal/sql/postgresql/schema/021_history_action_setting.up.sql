@@ -0,0 +1,32 @@
+CREATE OR REPLACE FUNCTION users_in_segments_update() RETURNS TRIGGER AS $$ BEGIN
+INSERT INTO users_in_segments_history(
+		user_id,
+		segment_name,
+		expire_at,
+		action_type,
+		action_date,
+		starts_at,
+		old_expire_at,
+		actor,
+		reason
+	)
+VALUES (
+		NEW.user_id,
+		NEW.segment_name,
+		NEW.expire_at,
+		COALESCE(
+			NULLIF(current_setting('segments.action_type', true), ''),
+			CASE
+				WHEN OLD.expire_at IS DISTINCT FROM NEW.expire_at THEN 'ttl_changed'
+				ELSE 'updated'
+			END
+		),
+		now(),
+		NEW.starts_at,
+		OLD.expire_at,
+		NULLIF(current_setting('segments.actor', true), ''),
+		NULLIF(current_setting('segments.reason', true), '')
+	);
+RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
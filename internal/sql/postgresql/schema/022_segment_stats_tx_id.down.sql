@@ -0,0 +1,80 @@
+CREATE OR REPLACE FUNCTION drop_history_partition(archived_month TIMESTAMP) RETURNS BOOLEAN AS $$
+DECLARE partition_name TEXT := 'users_in_segments_history_p' || to_char(archived_month, 'YYYYMM');
+next_month TIMESTAMP := date_trunc('month', archived_month) + interval '1 month';
+not_aggregated BOOLEAN;
+restorable BOOLEAN;
+BEGIN IF to_regclass(partition_name) IS NULL THEN RETURN FALSE;
+END IF;
+EXECUTE format(
+	'SELECT EXISTS (SELECT 1 FROM %I WHERE id > (SELECT last_history_id FROM segment_stats_state WHERE segment_stats_state.id))',
+	partition_name
+) INTO not_aggregated;
+IF not_aggregated THEN RAISE EXCEPTION 'partition % has history not aggregated into segment stats yet',
+partition_name;
+END IF;
+EXECUTE format(
+	'SELECT EXISTS (SELECT 1 FROM %I h WHERE (h.action_type = ''segment_deleted'' AND EXISTS (SELECT 1 FROM segments s WHERE s.name = h.segment_name AND s.deleted_at IS NOT NULL)) OR (h.action_type = ''user_deleted'' AND EXISTS (SELECT 1 FROM users u WHERE u.id = h.user_id AND u.deleted_at IS NOT NULL)))',
+	partition_name
+) INTO restorable;
+IF restorable THEN RAISE EXCEPTION 'partition % has history of deleted segments or users that can still be restored',
+partition_name;
+END IF;
+-- Memberships that outlive the month are carried into the next one,
+-- so the segments of a user at a moment after it can still be told without the dropped history.
+INSERT INTO users_in_segments_history (
+		user_id,
+		segment_name,
+		expire_at,
+		action_type,
+		action_date,
+		starts_at
+	)
+SELECT last_actions.user_id,
+	last_actions.segment_name,
+	last_actions.expire_at,
+	'snapshot',
+	next_month,
+	last_actions.starts_at
+FROM (
+		SELECT DISTINCT ON (user_id, segment_name) user_id,
+			segment_name,
+			expire_at,
+			action_type,
+			starts_at
+		FROM users_in_segments_history
+		WHERE action_date < next_month
+		ORDER BY user_id,
+			segment_name,
+			action_date DESC,
+			id DESC
+	) last_actions
+WHERE last_actions.action_type NOT IN (
+		'deleted',
+		'expired',
+		'segment_deleted',
+		'user_deleted'
+	)
+	AND (
+		last_actions.expire_at IS NULL
+		OR last_actions.expire_at > next_month
+	);
+EXECUTE format('DROP TABLE %I', partition_name);
+RETURN TRUE;
+END;
+$$ LANGUAGE plpgsql;
+DROP INDEX IF EXISTS users_in_segments_history_tx_id_idx;
+CREATE INDEX IF NOT EXISTS users_in_segments_history_id_idx ON users_in_segments_history(id);
+ALTER TABLE segment_stats_state
+ADD COLUMN IF NOT EXISTS last_history_id BIGINT NOT NULL DEFAULT 0;
+UPDATE segment_stats_state
+SET last_history_id = COALESCE(
+		(
+			SELECT max(id)
+			FROM users_in_segments_history
+			WHERE tx_id <= segment_stats_state.last_tx_id
+		),
+		0
+	);
+ALTER TABLE segment_stats_state ALTER COLUMN last_history_id DROP DEFAULT;
+ALTER TABLE segment_stats_state DROP COLUMN IF EXISTS last_tx_id;
+ALTER TABLE users_in_segments_history DROP COLUMN IF EXISTS tx_id;
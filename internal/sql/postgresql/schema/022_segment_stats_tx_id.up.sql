@@ -0,0 +1,80 @@
+ALTER TABLE users_in_segments_history
+ADD COLUMN IF NOT EXISTS tx_id xid8 NOT NULL DEFAULT pg_current_xact_id();
+-- History already folded into the stats is moved behind the new position, the rest is folded by the next rollup.
+UPDATE users_in_segments_history
+SET tx_id = '0'
+WHERE id <= (
+		SELECT last_history_id
+		FROM segment_stats_state
+		WHERE segment_stats_state.id
+	);
+ALTER TABLE segment_stats_state
+ADD COLUMN IF NOT EXISTS last_tx_id xid8 NOT NULL DEFAULT '0';
+ALTER TABLE segment_stats_state ALTER COLUMN last_tx_id DROP DEFAULT;
+ALTER TABLE segment_stats_state DROP COLUMN IF EXISTS last_history_id;
+DROP INDEX IF EXISTS users_in_segments_history_id_idx;
+CREATE INDEX IF NOT EXISTS users_in_segments_history_tx_id_idx ON users_in_segments_history(tx_id);
+CREATE OR REPLACE FUNCTION drop_history_partition(archived_month TIMESTAMP) RETURNS BOOLEAN AS $$
+DECLARE partition_name TEXT := 'users_in_segments_history_p' || to_char(archived_month, 'YYYYMM');
+next_month TIMESTAMP := date_trunc('month', archived_month) + interval '1 month';
+not_aggregated BOOLEAN;
+restorable BOOLEAN;
+BEGIN IF to_regclass(partition_name) IS NULL THEN RETURN FALSE;
+END IF;
+EXECUTE format(
+	'SELECT EXISTS (SELECT 1 FROM %I WHERE tx_id > (SELECT last_tx_id FROM segment_stats_state WHERE segment_stats_state.id))',
+	partition_name
+) INTO not_aggregated;
+IF not_aggregated THEN RAISE EXCEPTION 'partition % has history not aggregated into segment stats yet',
+partition_name;
+END IF;
+EXECUTE format(
+	'SELECT EXISTS (SELECT 1 FROM %I h WHERE (h.action_type = ''segment_deleted'' AND EXISTS (SELECT 1 FROM segments s WHERE s.name = h.segment_name AND s.deleted_at IS NOT NULL)) OR (h.action_type = ''user_deleted'' AND EXISTS (SELECT 1 FROM users u WHERE u.id = h.user_id AND u.deleted_at IS NOT NULL)))',
+	partition_name
+) INTO restorable;
+IF restorable THEN RAISE EXCEPTION 'partition % has history of deleted segments or users that can still be restored',
+partition_name;
+END IF;
+-- Memberships that outlive the month are carried into the next one,
+-- so the segments of a user at a moment after it can still be told without the dropped history.
+INSERT INTO users_in_segments_history (
+		user_id,
+		segment_name,
+		expire_at,
+		action_type,
+		action_date,
+		starts_at
+	)
+SELECT last_actions.user_id,
+	last_actions.segment_name,
+	last_actions.expire_at,
+	'snapshot',
+	next_month,
+	last_actions.starts_at
+FROM (
+		SELECT DISTINCT ON (user_id, segment_name) user_id,
+			segment_name,
+			expire_at,
+			action_type,
+			starts_at
+		FROM users_in_segments_history
+		WHERE action_date < next_month
+		ORDER BY user_id,
+			segment_name,
+			action_date DESC,
+			id DESC
+	) last_actions
+WHERE last_actions.action_type NOT IN (
+		'deleted',
+		'expired',
+		'segment_deleted',
+		'user_deleted'
+	)
+	AND (
+		last_actions.expire_at IS NULL
+		OR last_actions.expire_at > next_month
+	);
+EXECUTE format('DROP TABLE %I', partition_name);
+RETURN TRUE;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,69 @@
+package blob_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage/blob"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFS(t *testing.T) {
+	root := t.TempDir()
+	store, err := blob.NewFS(filepath.Join(root, "blobs"))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	n, err := store.Put(ctx, "reports/1/history.csv", strings.NewReader("user_id\n1\n"))
+	require.NoError(t, err)
+	require.Equal(t, int64(10), n)
+
+	_, err = store.Put(ctx, "reports/1/history.csv", strings.NewReader("user_id\n2\n"))
+	require.NoError(t, err)
+
+	r, err := store.Get(ctx, "reports/1/history.csv")
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, "user_id\n2\n", string(data))
+
+	require.NoError(t, store.Delete(ctx, "reports/1/history.csv"))
+	require.NoError(t, store.Delete(ctx, "reports/1/history.csv"))
+	_, err = store.Get(ctx, "reports/1/history.csv")
+	require.ErrorIs(t, err, storage.ErrBlobNotFound)
+
+	for _, key := range []string{"../outside", "/etc/passwd", ""} {
+		_, err = store.Put(ctx, key, strings.NewReader("x"))
+		require.Error(t, err, key)
+	}
+}
+
+func TestFSPutFailureLeavesNothing(t *testing.T) {
+	root := t.TempDir()
+	store, err := blob.NewFS(root)
+	require.NoError(t, err)
+
+	readErr := errors.New("report failed")
+	_, err = store.Put(context.Background(), "reports/2/history.csv",
+		io.MultiReader(strings.NewReader("user_id\n"), &failingReader{err: readErr}))
+	require.ErrorIs(t, err, readErr)
+
+	entries, err := os.ReadDir(filepath.Join(root, "reports", "2"))
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+type failingReader struct {
+	err error
+}
+
+func (r *failingReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
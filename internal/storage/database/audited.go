@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+)
+
+// The history triggers read the audit from settings local to a transaction, so membership changes
+// that callers run outside of ExecTx are wrapped into one here.
+
+func (s *Store) DeleteUser(ctx context.Context, id int64) error {
+	return s.ExecTx(ctx, func(q storage.Querier) error {
+		return q.DeleteUser(ctx, id)
+	})
+}
+
+func (s *Store) DeleteSegment(ctx context.Context, name string) error {
+	return s.ExecTx(ctx, func(q storage.Querier) error {
+		return q.DeleteSegment(ctx, name)
+	})
+}
+
+func (s *Store) RestoreUser(ctx context.Context, arg models.RestoreUserParams) (models.User, error) {
+	var user models.User
+	err := s.ExecTx(ctx, func(q storage.Querier) error {
+		var err error
+		user, err = q.RestoreUser(ctx, arg)
+		return err
+	})
+	return user, err
+}
+
+func (s *Store) RestoreSegment(ctx context.Context, arg models.RestoreSegmentParams) (models.Segment, error) {
+	var segment models.Segment
+	err := s.ExecTx(ctx, func(q storage.Querier) error {
+		var err error
+		segment, err = q.RestoreSegment(ctx, arg)
+		return err
+	})
+	return segment, err
+}
+
+func (s *Store) AddUsersIntoSegmentBatch(ctx context.Context, arg models.AddUsersIntoSegmentBatchParams) ([]models.AddUsersIntoSegmentBatchRow, error) {
+	var rows []models.AddUsersIntoSegmentBatchRow
+	err := s.ExecTx(ctx, func(q storage.Querier) error {
+		var err error
+		rows, err = q.AddUsersIntoSegmentBatch(ctx, arg)
+		return err
+	})
+	return rows, err
+}
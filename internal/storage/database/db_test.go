@@ -3,13 +3,18 @@ package database_test
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/AlexZahvatkin/segments-users-service/internal/lib/audit"
 	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
 	"github.com/AlexZahvatkin/segments-users-service/internal/storage/database"
+	usecases_user_segments "github.com/AlexZahvatkin/segments-users-service/internal/use-cases/user_segments"
 	"github.com/AlexZahvatkin/segments-users-service/internal/utils/testutils"
 	"github.com/stretchr/testify/assert"
 )
@@ -35,7 +40,7 @@ func TestMain(m *testing.M) {
 func TestAddUser(t *testing.T) {
 	query := database.TestDB(t, databaseURL)
 	user := models.NewTestUser()
-	res, err := query.AddUser(context.Background(), user.Name)
+	res, err := query.AddUser(context.Background(), models.AddUserParams{Name: user.Name})
 	assert.NoError(t, err)
 	assert.NotNil(t, res)
 	assert.Equal(t, user.Name, res.Name)
@@ -44,8 +49,8 @@ func TestAddUser(t *testing.T) {
 func TestGetAllUsers(t *testing.T) {
 	query := database.TestDB(t, databaseURL)
 	user := models.NewTestUser()
-	query.AddUser(context.Background(), user.Name)
-	query.AddUser(context.Background(), user.Name+"2")
+	query.AddUser(context.Background(), models.AddUserParams{Name: user.Name})
+	query.AddUser(context.Background(), models.AddUserParams{Name: user.Name + "2"})
 	res, err := query.GetAllUsersId(context.Background())
 	assert.NoError(t, err)
 	assert.NotNil(t, res)
@@ -55,7 +60,7 @@ func TestGetAllUsers(t *testing.T) {
 func TestDeleteUser(t *testing.T) {
 	query := database.TestDB(t, databaseURL)
 	user := models.NewTestUser()
-	addedUser, err := query.AddUser(context.Background(), user.Name)
+	addedUser, err := query.AddUser(context.Background(), models.AddUserParams{Name: user.Name})
 	assert.NotNil(t, addedUser)
 	assert.NoError(t, err)
 	ids, err := query.GetAllUsersId(context.Background())
@@ -101,7 +106,7 @@ func TestAddUserIntoSegment(t *testing.T) {
 		Name: segment.Name,
 	})
 	assert.NoError(t, err)
-	addedUser, err := query.AddUser(context.Background(), user.Name)
+	addedUser, err := query.AddUser(context.Background(), models.AddUserParams{Name: user.Name})
 	assert.NoError(t, err)
 	res, err := query.AddUserIntoSegment(context.Background(), models.AddUserIntoSegmentParams{
 		UserID:      addedUser.ID,
@@ -120,7 +125,7 @@ func TestAddUserIntoSegmentWithTTLInHours(t *testing.T) {
 		Name: segment.Name,
 	})
 	assert.NoError(t, err)
-	addedUser, err := query.AddUser(context.Background(), user.Name)
+	addedUser, err := query.AddUser(context.Background(), models.AddUserParams{Name: user.Name})
 	assert.NoError(t, err)
 	timeAfterHour := time.Now().Add(time.Hour)
 	res, err := query.AddUserIntoSegmentWithTTLInHours(context.Background(), models.AddUserIntoSegmentWithTTLInHoursParams{
@@ -153,7 +158,7 @@ func TestGetSegmentsByUserId(t *testing.T) {
 		Name: segment2.Name,
 	})
 	assert.NoError(t, err)
-	addedUser, err := query.AddUser(context.Background(), user.Name)
+	addedUser, err := query.AddUser(context.Background(), models.AddUserParams{Name: user.Name})
 	assert.NoError(t, err)
 	segmentForUser1, err := query.AddUserIntoSegmentWithTTLInHours(context.Background(), models.AddUserIntoSegmentWithTTLInHoursParams{
 		UserID:        addedUser.ID,
@@ -183,7 +188,7 @@ func TestRemoveUserFromSegment(t *testing.T) {
 		Name: segment.Name,
 	})
 	assert.NoError(t, err)
-	addedUser, err := query.AddUser(context.Background(), user.Name)
+	addedUser, err := query.AddUser(context.Background(), models.AddUserParams{Name: user.Name})
 	assert.NoError(t, err)
 	addRec, err := query.AddUserIntoSegment(context.Background(), models.AddUserIntoSegmentParams{
 		UserID:      addedUser.ID,
@@ -209,7 +214,7 @@ func TestGetSegmentsHistoryByUserId(t *testing.T) {
 		Name: segment.Name,
 	})
 	assert.NoError(t, err)
-	addedUser, err := query.AddUser(context.Background(), user.Name)
+	addedUser, err := query.AddUser(context.Background(), models.AddUserParams{Name: user.Name})
 	assert.NoError(t, err)
 	addRec, err := query.AddUserIntoSegment(context.Background(), models.AddUserIntoSegmentParams{
 		UserID:      addedUser.ID,
@@ -237,3 +242,1373 @@ func TestGetSegmentsHistoryByUserId(t *testing.T) {
 	assert.Equal(t, "inserted", res[0].ActionType)
 	assert.Equal(t, "deleted", res[1].ActionType)
 }
+
+func TestExecTxRollback(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	segment := models.NewTestSegment()
+	user := models.NewTestUser()
+	_, err := store.AddSegment(context.Background(), models.AddSegmentParams{
+		Name: segment.Name,
+	})
+	assert.NoError(t, err)
+	addedUser, err := store.AddUser(context.Background(), models.AddUserParams{Name: user.Name})
+	assert.NoError(t, err)
+	err = store.ExecTx(context.Background(), func(q storage.Querier) error {
+		if _, err := q.AddUserIntoSegment(context.Background(), models.AddUserIntoSegmentParams{
+			UserID:      addedUser.ID,
+			SegmentName: segment.Name,
+		}); err != nil {
+			return err
+		}
+		_, err := q.AddUserIntoSegment(context.Background(), models.AddUserIntoSegmentParams{
+			UserID:      addedUser.ID,
+			SegmentName: "NotExistingSegment",
+		})
+		return err
+	})
+	assert.Error(t, err)
+	res, err := store.GetSegmentsByUserId(context.Background(), addedUser.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(res))
+}
+
+func TestDeleteExpiredUsersFromSegments(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	segment := models.NewTestSegment()
+	user := models.NewTestUser()
+	_, err := store.AddSegment(context.Background(), models.AddSegmentParams{
+		Name: segment.Name,
+	})
+	assert.NoError(t, err)
+	addedUser, err := store.AddUser(context.Background(), models.AddUserParams{Name: user.Name})
+	assert.NoError(t, err)
+	_, err = store.AddUserIntoSegmentWithExpireDatetime(context.Background(), models.AddUserIntoSegmentWithExpireDatetimeParams{
+		UserID:      addedUser.ID,
+		SegmentName: segment.Name,
+		ExpireAt:    sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true},
+	})
+	assert.NoError(t, err)
+	var deleted int64
+	err = store.ExecTx(context.Background(), func(q storage.Querier) error {
+		if err := q.SetHistoryAction(context.Background(), "expired"); err != nil {
+			return err
+		}
+		deleted, err = q.DeleteExpiredUsersFromSegments(context.Background(), 10)
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	res, err := store.GetSegmentsHistoryByUserId(context.Background(), models.GetSegmentsHistoryByUserIdParams{
+		UserID:   addedUser.ID,
+		FromDate: time.Now().Add(-time.Hour),
+		ToDate:   time.Now().Add(time.Hour),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(res))
+	assert.Equal(t, "inserted", res[0].ActionType)
+	assert.Equal(t, "expired", res[1].ActionType)
+}
+
+func TestAddUserIntoRolloutSegments(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	segment := models.NewTestSegment()
+	_, err := store.AddSegment(context.Background(), models.AddSegmentParams{
+		Name:           segment.Name,
+		RolloutSalt:    segment.Name,
+		RolloutPercent: sql.NullFloat64{Float64: 50, Valid: true},
+	})
+	assert.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		addedUser, err := store.AddUser(context.Background(), models.AddUserParams{Name: fmt.Sprintf("user%d", i)})
+		assert.NoError(t, err)
+		res, err := store.AddUserIntoRolloutSegments(context.Background(), addedUser.ID)
+		assert.NoError(t, err)
+		if usecases_user_segments.InRollout(segment.Name, addedUser.ID, 50) {
+			assert.Equal(t, 1, len(res))
+		} else {
+			assert.Equal(t, 0, len(res))
+		}
+	}
+}
+
+func TestAddUsersBatchIntoRolloutSegment(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	segment := models.NewTestSegment()
+	_, err := store.AddSegment(context.Background(), models.AddSegmentParams{
+		Name:           segment.Name,
+		RolloutSalt:    segment.Name,
+		RolloutPercent: sql.NullFloat64{Float64: 50, Valid: true},
+	})
+	assert.NoError(t, err)
+	var expected int64
+	for i := 0; i < 5; i++ {
+		addedUser, err := store.AddUser(context.Background(), models.AddUserParams{Name: fmt.Sprintf("user%d", i)})
+		assert.NoError(t, err)
+		if usecases_user_segments.InRollout(segment.Name, addedUser.ID, 50) {
+			expected++
+		}
+	}
+	first, err := store.AddUsersBatchIntoRolloutSegment(context.Background(), models.AddUsersBatchIntoRolloutSegmentParams{
+		AfterID:     0,
+		BatchSize:   3,
+		SegmentName: segment.Name,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), first.Processed)
+	second, err := store.AddUsersBatchIntoRolloutSegment(context.Background(), models.AddUsersBatchIntoRolloutSegmentParams{
+		AfterID:     first.LastUserID,
+		BatchSize:   3,
+		SegmentName: segment.Name,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), second.Processed)
+	assert.Equal(t, expected, first.Enrolled+second.Enrolled)
+}
+
+func TestRaiseRolloutPercent(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	segment := models.NewTestSegment()
+	_, err := store.AddSegment(context.Background(), models.AddSegmentParams{
+		Name:           segment.Name,
+		RolloutSalt:    segment.Name,
+		RolloutPercent: sql.NullFloat64{Float64: 10, Valid: true},
+	})
+	assert.NoError(t, err)
+	var ids []int64
+	for i := 0; i < 200; i++ {
+		addedUser, err := store.AddUser(context.Background(), models.AddUserParams{Name: fmt.Sprintf("user%d", i)})
+		assert.NoError(t, err)
+		ids = append(ids, addedUser.ID)
+	}
+	rollout := func() []int64 {
+		_, err := store.AddUsersBatchIntoRolloutSegment(context.Background(), models.AddUsersBatchIntoRolloutSegmentParams{
+			BatchSize:   1000,
+			SegmentName: segment.Name,
+		})
+		assert.NoError(t, err)
+		var members []int64
+		for _, id := range ids {
+			segments, err := store.GetSegmentsByUserId(context.Background(), id)
+			assert.NoError(t, err)
+			if len(segments) > 0 {
+				members = append(members, id)
+			}
+		}
+		return members
+	}
+
+	ten := rollout()
+	_, err = store.UpdateSegment(context.Background(), models.UpdateSegmentParams{
+		RolloutPercent: sql.NullFloat64{Float64: 20, Valid: true},
+		Name:           segment.Name,
+	})
+	assert.NoError(t, err)
+	_, err = store.UpdateSegment(context.Background(), models.UpdateSegmentParams{
+		RolloutPercent: sql.NullFloat64{Float64: 15, Valid: true},
+		Name:           segment.Name,
+	})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	twenty := rollout()
+
+	// Raising the percent keeps everyone from the smaller rollout and only adds users.
+	assert.Subset(t, twenty, ten)
+	assert.Greater(t, len(twenty), len(ten))
+	for _, id := range twenty {
+		assert.True(t, usecases_user_segments.InRollout(segment.Name, id, 20))
+	}
+}
+
+func TestJobLifecycle(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	job, err := store.CreateJob(context.Background(), models.CreateJobParams{
+		Kind:    "test",
+		Payload: []byte(`{}`),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "queued", job.Status)
+	claimed, err := store.ClaimNextJob(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, job.ID, claimed.ID)
+	assert.Equal(t, "running", claimed.Status)
+	_, err = store.ClaimNextJob(context.Background())
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	status, err := store.UpdateJobProgress(context.Background(), models.UpdateJobProgressParams{
+		Total:      10,
+		Processed:  5,
+		Affected:   1,
+		Checkpoint: []byte(`{"after_id": 5}`),
+		ID:         job.ID,
+		Attempts:   claimed.Attempts,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "running", status)
+	err = store.FinishJob(context.Background(), models.FinishJobParams{
+		Status:   "succeeded",
+		ID:       job.ID,
+		Attempts: claimed.Attempts,
+	})
+	assert.NoError(t, err)
+	res, err := store.GetJobById(context.Background(), job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "succeeded", res.Status)
+	assert.Equal(t, int64(5), res.Processed)
+	assert.JSONEq(t, `{"after_id": 5}`, string(res.Checkpoint))
+	assert.True(t, res.FinishedAt.Valid)
+	_, err = store.CancelJob(context.Background(), job.ID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestCancelJob(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	job, err := store.CreateJob(context.Background(), models.CreateJobParams{
+		Kind:    "test",
+		Payload: []byte(`{}`),
+	})
+	assert.NoError(t, err)
+	claimed, err := store.ClaimNextJob(context.Background())
+	assert.NoError(t, err)
+	cancelled, err := store.CancelJob(context.Background(), job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "cancelled", cancelled.Status)
+	_, err = store.UpdateJobProgress(context.Background(), models.UpdateJobProgressParams{
+		Processed:  5,
+		Checkpoint: []byte(`{}`),
+		ID:         job.ID,
+		Attempts:   claimed.Attempts,
+	})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	err = store.FinishJob(context.Background(), models.FinishJobParams{
+		Status:   "succeeded",
+		ID:       job.ID,
+		Attempts: claimed.Attempts,
+	})
+	assert.NoError(t, err)
+	res, err := store.GetJobById(context.Background(), job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "cancelled", res.Status)
+	assert.Equal(t, int64(0), res.Processed)
+}
+
+func TestRequeueStaleJobs(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	job, err := store.CreateJob(context.Background(), models.CreateJobParams{
+		Kind:    "test",
+		Payload: []byte(`{}`),
+	})
+	assert.NoError(t, err)
+	first, err := store.ClaimNextJob(context.Background())
+	assert.NoError(t, err)
+	n, err := store.RequeueStaleJobs(context.Background(), models.RequeueStaleJobsParams{
+		MaxAttempts:       2,
+		StaleAfterSeconds: 3600,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = store.RequeueStaleJobs(context.Background(), models.RequeueStaleJobsParams{
+		MaxAttempts:       2,
+		StaleAfterSeconds: 0,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	claimed, err := store.ClaimNextJob(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, job.ID, claimed.ID)
+	assert.Equal(t, int32(2), claimed.Attempts)
+	// The first attempt is still alive: it can neither save its progress nor finish the job run by the second one.
+	_, err = store.UpdateJobProgress(context.Background(), models.UpdateJobProgressParams{
+		Processed:  7,
+		Checkpoint: []byte(`{"after_id": 7}`),
+		ID:         job.ID,
+		Attempts:   first.Attempts,
+	})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	err = store.FinishJob(context.Background(), models.FinishJobParams{
+		Status:   "succeeded",
+		ID:       job.ID,
+		Attempts: first.Attempts,
+	})
+	assert.NoError(t, err)
+	res, err := store.GetJobById(context.Background(), job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "running", res.Status)
+	assert.Equal(t, int64(0), res.Processed)
+	n, err = store.RequeueStaleJobs(context.Background(), models.RequeueStaleJobsParams{
+		MaxAttempts:       2,
+		StaleAfterSeconds: 0,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	res, err = store.GetJobById(context.Background(), job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "failed", res.Status)
+}
+
+func TestListSegments(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	user, err := store.AddUser(context.Background(), models.AddUserParams{Name: "user"})
+	assert.NoError(t, err)
+	for _, name := range []string{"LIST_A", "LIST_B", "LIST_C", "OTHER_A"} {
+		_, err := store.AddSegment(context.Background(), models.AddSegmentParams{Name: name, RolloutSalt: name})
+		assert.NoError(t, err)
+	}
+	_, err = store.AddUserIntoSegment(context.Background(), models.AddUserIntoSegmentParams{
+		UserID:      user.ID,
+		SegmentName: "LIST_A",
+	})
+	assert.NoError(t, err)
+	first, err := store.ListSegments(context.Background(), models.ListSegmentsParams{
+		NamePrefix: "LIST_",
+		PageSize:   2,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, first, 2)
+	assert.Equal(t, "LIST_A", first[0].Name)
+	assert.Equal(t, int64(1), first[0].MembersCount)
+	assert.Equal(t, int64(0), first[1].MembersCount)
+	second, err := store.ListSegments(context.Background(), models.ListSegmentsParams{
+		NamePrefix: "LIST_",
+		AfterName:  first[1].Name,
+		PageSize:   2,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, second, 1)
+	assert.Equal(t, "LIST_C", second[0].Name)
+}
+
+func TestUpdateSegment(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	segment, err := store.AddSegment(context.Background(), models.AddSegmentParams{
+		Name:        "UPDATE_SEGMENT",
+		Description: sql.NullString{String: "old", Valid: true},
+		RolloutSalt: "UPDATE_SEGMENT",
+	})
+	assert.NoError(t, err)
+	updated, err := store.UpdateSegment(context.Background(), models.UpdateSegmentParams{
+		Description: sql.NullString{String: "new", Valid: true},
+		Name:        segment.Name,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "new", updated.Description.String)
+	assert.True(t, updated.UpdatedAt.After(segment.UpdatedAt))
+	_, err = store.UpdateSegment(context.Background(), models.UpdateSegmentParams{
+		Description: sql.NullString{String: "new", Valid: true},
+		Name:        "MISSING_SEGMENT",
+	})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestListUsersInSegment(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	segment, err := store.AddSegment(context.Background(), models.AddSegmentParams{
+		Name:        "MEMBERS_SEGMENT",
+		RolloutSalt: "MEMBERS_SEGMENT",
+	})
+	assert.NoError(t, err)
+	var ids []int64
+	for i := 0; i < 3; i++ {
+		user, err := store.AddUser(context.Background(), models.AddUserParams{Name: fmt.Sprintf("user%d", i)})
+		assert.NoError(t, err)
+		ids = append(ids, user.ID)
+	}
+	for _, id := range ids[:2] {
+		_, err := store.AddUserIntoSegment(context.Background(), models.AddUserIntoSegmentParams{
+			UserID:      id,
+			SegmentName: segment.Name,
+		})
+		assert.NoError(t, err)
+	}
+	_, err = store.AddUserIntoSegmentWithExpireDatetime(context.Background(), models.AddUserIntoSegmentWithExpireDatetimeParams{
+		UserID:      ids[2],
+		SegmentName: segment.Name,
+		ExpireAt:    sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true},
+	})
+	assert.NoError(t, err)
+	first, err := store.ListUsersInSegment(context.Background(), models.ListUsersInSegmentParams{
+		SegmentName: segment.Name,
+		PageSize:    1,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, first, 1)
+	assert.Equal(t, ids[0], first[0].UserID)
+	rest, err := store.ListUsersInSegment(context.Background(), models.ListUsersInSegmentParams{
+		SegmentName: segment.Name,
+		AfterUserID: first[0].UserID,
+		PageSize:    10,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, rest, 1)
+	withExpired, err := store.ListUsersInSegment(context.Background(), models.ListUsersInSegmentParams{
+		SegmentName:    segment.Name,
+		IncludeExpired: true,
+		PageSize:       10,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, withExpired, 3)
+}
+
+func TestListUsers(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	for _, name := range []string{"John Smith", "Jane Doe", "johnny"} {
+		_, err := store.AddUser(context.Background(), models.AddUserParams{Name: name})
+		assert.NoError(t, err)
+	}
+	first, err := store.ListUsers(context.Background(), models.ListUsersParams{
+		NameQuery: "JOHN",
+		PageSize:  1,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, first, 1)
+	assert.Equal(t, "John Smith", first[0].Name)
+	rest, err := store.ListUsers(context.Background(), models.ListUsersParams{
+		AfterID:   first[0].ID,
+		NameQuery: "JOHN",
+		PageSize:  10,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, rest, 1)
+	assert.Equal(t, "johnny", rest[0].Name)
+}
+
+func TestUpdateUser(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	user, err := store.AddUser(context.Background(), models.AddUserParams{Name: "old name"})
+	assert.NoError(t, err)
+	name := "new name"
+	updated, err := store.UpdateUser(context.Background(), models.UpdateUserParams{
+		Name: &name,
+		ID:   user.ID,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "new name", updated.Name)
+	assert.True(t, updated.UpdatedAt.After(user.UpdatedAt))
+	_, err = store.UpdateUser(context.Background(), models.UpdateUserParams{
+		Name: &name,
+		ID:   user.ID + 1,
+	})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestUserExternalId(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	externalID := "3f1c8a52-0d7e-4a5e-9d51-5b1f0c7d2e11"
+	user, err := store.AddUser(context.Background(), models.AddUserParams{
+		Name:       "external user",
+		ExternalID: &externalID,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, externalID, *user.ExternalID)
+	res, err := store.GetUserByExternalId(context.Background(), externalID)
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, res.ID)
+	_, err = store.AddUser(context.Background(), models.AddUserParams{
+		Name:       "duplicate",
+		ExternalID: &externalID,
+	})
+	assert.True(t, storage.IsUniqueViolation(err))
+	_, err = store.GetUserByExternalId(context.Background(), "missing")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	empty := ""
+	cleared, err := store.UpdateUser(context.Background(), models.UpdateUserParams{
+		ExternalID: &empty,
+		ID:         user.ID,
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, cleared.ExternalID)
+	assert.Equal(t, "external user", cleared.Name)
+}
+
+func TestAddUserIfNotExists(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	externalID := "crm-if-not-exists"
+	user, err := store.AddUserIfNotExists(context.Background(), models.AddUserIfNotExistsParams{
+		Name:       "test",
+		ExternalID: &externalID,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, externalID, *user.ExternalID)
+	_, err = store.AddUserIfNotExists(context.Background(), models.AddUserIfNotExistsParams{
+		Name:       "duplicate",
+		ExternalID: &externalID,
+	})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestAddUsersIntoSegmentBatch(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	segment, err := store.AddSegment(context.Background(), models.AddSegmentParams{
+		Name:        "BATCH_SEGMENT",
+		RolloutSalt: "BATCH_SEGMENT",
+	})
+	assert.NoError(t, err)
+	first, err := store.AddUser(context.Background(), models.AddUserParams{Name: "first"})
+	assert.NoError(t, err)
+	second, err := store.AddUser(context.Background(), models.AddUserParams{Name: "second"})
+	assert.NoError(t, err)
+	_, err = store.AddUserIntoSegment(context.Background(), models.AddUserIntoSegmentParams{
+		UserID:      second.ID,
+		SegmentName: segment.Name,
+	})
+	assert.NoError(t, err)
+	res, err := store.AddUsersIntoSegmentBatch(context.Background(), models.AddUsersIntoSegmentBatchParams{
+		UserIds:     []int64{first.ID, second.ID, second.ID + 1000},
+		ExpireAt:    []sql.NullTime{{}, {Time: time.Now().Add(24 * time.Hour).UTC(), Valid: true}, {}},
+		StartsAt:    []sql.NullTime{{}, {}, {}},
+		SegmentName: segment.Name,
+	})
+	assert.NoError(t, err)
+	byUser := make(map[int64]models.AddUsersIntoSegmentBatchRow)
+	for _, row := range res {
+		byUser[row.UserID] = row
+	}
+	assert.Len(t, byUser, 3)
+	assert.True(t, byUser[first.ID].Inserted)
+	assert.False(t, byUser[first.ID].ExpireAt.Valid)
+	assert.True(t, byUser[second.ID].UserExists)
+	assert.False(t, byUser[second.ID].Inserted)
+	assert.True(t, byUser[second.ID].ExpireAt.Valid)
+	assert.False(t, byUser[second.ID+1000].UserExists)
+}
+
+type importRows struct {
+	users []models.ImportUser
+}
+
+func (s *importRows) Next() (models.ImportUser, error) {
+	if len(s.users) == 0 {
+		return models.ImportUser{}, io.EOF
+	}
+	user := s.users[0]
+	s.users = s.users[1:]
+	return user, nil
+}
+
+func (s *importRows) Errors() []models.ImportError {
+	return nil
+}
+
+func TestImportUsers(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	segment, err := store.AddSegment(context.Background(), models.AddSegmentParams{
+		Name:        "IMPORT_SEGMENT",
+		RolloutSalt: "IMPORT_SEGMENT",
+	})
+	assert.NoError(t, err)
+	externalID := "crm-import"
+	users := []models.ImportUser{
+		{Line: 1, Name: "first", ExternalID: &externalID, Segments: []models.ImportUserSegment{{Name: segment.Name, TTL: 24}}},
+		{Line: 2, Name: "second"},
+	}
+
+	res, err := store.ImportUsers(context.Background(), &importRows{users: users}, true)
+	assert.NoError(t, err)
+	assert.Empty(t, res.Errors)
+	assert.Equal(t, int64(2), res.Users)
+	assert.Equal(t, int64(1), res.Segments)
+	_, err = store.GetUserByExternalId(context.Background(), externalID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	res, err = store.ImportUsers(context.Background(), &importRows{users: users}, false)
+	assert.NoError(t, err)
+	assert.Empty(t, res.Errors)
+	user, err := store.GetUserByExternalId(context.Background(), externalID)
+	assert.NoError(t, err)
+	segments, err := store.GetSegmentsByUserId(context.Background(), user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{segment.Name}, segments)
+
+	res, err = store.ImportUsers(context.Background(), &importRows{users: []models.ImportUser{
+		{Line: 1, Name: "third", ExternalID: &externalID},
+		{Line: 2, Name: "fourth", Segments: []models.ImportUserSegment{{Name: "MISSING"}}},
+	}}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ImportError{
+		{Line: 1, Error: "user with external id crm-import already exists"},
+		{Line: 2, Error: "segment MISSING does not exist"},
+	}, res.Errors)
+	count, err := store.CountUsers(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestAddUserIntoSegmentWithExpireDatetimeUpsert(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	segment := models.NewTestSegment()
+	_, err := store.AddSegment(context.Background(), models.AddSegmentParams{Name: segment.Name})
+	assert.NoError(t, err)
+	user, err := store.AddUser(context.Background(), models.AddUserParams{Name: models.NewTestUser().Name})
+	assert.NoError(t, err)
+
+	first, err := store.AddUserIntoSegmentWithExpireDatetime(context.Background(), models.AddUserIntoSegmentWithExpireDatetimeParams{
+		UserID:      user.ID,
+		SegmentName: segment.Name,
+		ExpireAt:    sql.NullTime{Time: time.Now().Add(time.Hour).UTC(), Valid: true},
+	})
+	assert.NoError(t, err)
+	expireAt := time.Now().Add(72 * time.Hour).UTC().Truncate(time.Microsecond)
+	second, err := store.AddUserIntoSegmentWithExpireDatetime(context.Background(), models.AddUserIntoSegmentWithExpireDatetimeParams{
+		UserID:      user.ID,
+		SegmentName: segment.Name,
+		ExpireAt:    sql.NullTime{Time: expireAt, Valid: true},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, first.CreatedAt, second.CreatedAt)
+	assert.True(t, expireAt.Equal(second.ExpireAt.Time))
+}
+
+func TestScheduledMembership(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	segment, err := store.AddSegment(context.Background(), models.AddSegmentParams{
+		Name:        "SCHEDULED_SEGMENT",
+		RolloutSalt: "SCHEDULED_SEGMENT",
+	})
+	assert.NoError(t, err)
+	active, err := store.AddUser(context.Background(), models.AddUserParams{Name: "active"})
+	assert.NoError(t, err)
+	pending, err := store.AddUser(context.Background(), models.AddUserParams{Name: "pending"})
+	assert.NoError(t, err)
+	_, err = store.AddUserIntoSegment(context.Background(), models.AddUserIntoSegmentParams{
+		UserID:      active.ID,
+		SegmentName: segment.Name,
+	})
+	assert.NoError(t, err)
+	startsAt := time.Now().Add(24 * time.Hour).UTC()
+	added, err := store.AddUserIntoSegmentWithExpireDatetime(context.Background(), models.AddUserIntoSegmentWithExpireDatetimeParams{
+		UserID:      pending.ID,
+		SegmentName: segment.Name,
+		ExpireAt:    sql.NullTime{Time: startsAt.Add(72 * time.Hour), Valid: true},
+		StartsAt:    sql.NullTime{Time: startsAt, Valid: true},
+	})
+	assert.NoError(t, err)
+	assert.True(t, added.StartsAt.Valid)
+
+	segments, err := store.GetSegmentsByUserId(context.Background(), pending.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, segments)
+
+	counts, err := store.GetSegmentWithMembersCount(context.Background(), segment.Name)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), counts.MembersCount)
+	assert.Equal(t, int64(1), counts.PendingCount)
+
+	members, err := store.ListUsersInSegment(context.Background(), models.ListUsersInSegmentParams{
+		SegmentName: segment.Name,
+		PageSize:    10,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, members, 1)
+	members, err = store.ListUsersInSegment(context.Background(), models.ListUsersInSegmentParams{
+		SegmentName:    segment.Name,
+		IncludePending: true,
+		PageSize:       10,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, members, 2)
+
+	history, err := store.GetSegmentsHistoryByUserId(context.Background(), models.GetSegmentsHistoryByUserIdParams{
+		UserID:   pending.ID,
+		FromDate: time.Now().Add(-time.Hour),
+		ToDate:   time.Now().Add(time.Hour),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, history, 1)
+	assert.Equal(t, models.ActionScheduled, history[0].ActionType)
+	assert.True(t, history[0].StartsAt.Valid)
+	assert.False(t, added.Started)
+
+	soon, err := store.AddUser(context.Background(), models.AddUserParams{Name: "soon"})
+	assert.NoError(t, err)
+	_, err = store.AddUserIntoSegmentWithExpireDatetime(context.Background(), models.AddUserIntoSegmentWithExpireDatetimeParams{
+		UserID:      soon.ID,
+		SegmentName: segment.Name,
+		StartsAt:    sql.NullTime{Time: time.Now().Add(time.Hour).UTC(), Valid: true},
+	})
+	assert.NoError(t, err)
+	started, err := store.StartScheduledUsersInSegments(context.Background(), models.StartScheduledUsersInSegmentsParams{
+		Now:       time.Now().UTC(),
+		BatchSize: 10,
+	})
+	assert.NoError(t, err)
+	assert.Zero(t, started)
+	params := models.StartScheduledUsersInSegmentsParams{
+		Now:       time.Now().Add(2 * time.Hour).UTC(),
+		BatchSize: 10,
+	}
+	started, err = store.StartScheduledUsersInSegments(context.Background(), params)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), started)
+	started, err = store.StartScheduledUsersInSegments(context.Background(), params)
+	assert.NoError(t, err)
+	assert.Zero(t, started)
+	history, err = store.GetSegmentsHistoryByUserId(context.Background(), models.GetSegmentsHistoryByUserIdParams{
+		UserID:   soon.ID,
+		FromDate: time.Now().Add(-time.Hour),
+		ToDate:   time.Now().Add(time.Hour),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, models.ActionScheduled, history[0].ActionType)
+	assert.Equal(t, models.ActionStarted, history[1].ActionType)
+}
+
+func TestGetLastSegmentsActionsByUserId(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	segment, err := store.AddSegment(context.Background(), models.AddSegmentParams{
+		Name:        "REPLAY_SEGMENT",
+		RolloutSalt: "REPLAY_SEGMENT",
+	})
+	assert.NoError(t, err)
+	user, err := store.AddUser(context.Background(), models.AddUserParams{Name: "replay"})
+	assert.NoError(t, err)
+	params := models.AddUserIntoSegmentParams{UserID: user.ID, SegmentName: segment.Name}
+	_, err = store.AddUserIntoSegment(context.Background(), params)
+	assert.NoError(t, err)
+	err = store.RemoveUserFromSegment(context.Background(), models.RemoveUserFromSegmentParams(params))
+	assert.NoError(t, err)
+	history, err := store.GetSegmentsHistoryByUserId(context.Background(), models.GetSegmentsHistoryByUserIdParams{
+		UserID:   user.ID,
+		FromDate: time.Now().Add(-time.Hour),
+		ToDate:   time.Now().Add(time.Hour),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, models.ActionDeleted, history[1].ActionType)
+	removedAt := history[1].ActionDate
+	_, err = store.AddUserIntoSegment(context.Background(), params)
+	assert.NoError(t, err)
+
+	res, err := store.GetLastSegmentsActionsByUserId(context.Background(), models.GetLastSegmentsActionsByUserIdParams{
+		UserID: user.ID,
+		At:     removedAt,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, res, 1)
+	assert.Equal(t, models.ActionDeleted, res[0].ActionType)
+
+	res, err = store.GetLastSegmentsActionsByUserId(context.Background(), models.GetLastSegmentsActionsByUserIdParams{
+		UserID: user.ID,
+		At:     time.Now().UTC(),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, res, 1)
+	assert.Equal(t, models.ActionInserted, res[0].ActionType)
+
+	_, err = store.AddUserIntoSegmentWithTTLInHours(context.Background(), models.AddUserIntoSegmentWithTTLInHoursParams{
+		UserID:        user.ID,
+		SegmentName:   segment.Name,
+		NumberOfHours: 48,
+	})
+	assert.NoError(t, err)
+	res, err = store.GetLastSegmentsActionsByUserId(context.Background(), models.GetLastSegmentsActionsByUserIdParams{
+		UserID: user.ID,
+		At:     time.Now().UTC(),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, res, 1)
+	assert.True(t, res[0].ExpireAt.Valid)
+	assert.True(t, res[0].ExpireAt.Time.After(time.Now().Add(47*time.Hour)))
+}
+
+func TestHistoryRecordsUpdates(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	segment, err := store.AddSegment(context.Background(), models.AddSegmentParams{
+		Name:        "UPDATED_SEGMENT",
+		RolloutSalt: "UPDATED_SEGMENT",
+	})
+	assert.NoError(t, err)
+	user, err := store.AddUser(context.Background(), models.AddUserParams{Name: "updated"})
+	assert.NoError(t, err)
+	_, err = store.AddUserIntoSegmentWithTTLInHours(context.Background(), models.AddUserIntoSegmentWithTTLInHoursParams{
+		UserID:        user.ID,
+		SegmentName:   segment.Name,
+		NumberOfHours: 1,
+	})
+	assert.NoError(t, err)
+	_, err = store.AddUserIntoSegmentWithTTLInHours(context.Background(), models.AddUserIntoSegmentWithTTLInHoursParams{
+		UserID:        user.ID,
+		SegmentName:   segment.Name,
+		NumberOfHours: 24,
+	})
+	assert.NoError(t, err)
+	_, err = store.AddUserIntoSegment(context.Background(), models.AddUserIntoSegmentParams{
+		UserID:      user.ID,
+		SegmentName: segment.Name,
+	})
+	assert.NoError(t, err)
+	_, err = store.AddUserIntoSegment(context.Background(), models.AddUserIntoSegmentParams{
+		UserID:      user.ID,
+		SegmentName: segment.Name,
+	})
+	assert.NoError(t, err)
+	_, err = store.AddUserIntoSegmentWithExpireDatetime(context.Background(), models.AddUserIntoSegmentWithExpireDatetimeParams{
+		UserID:      user.ID,
+		SegmentName: segment.Name,
+		StartsAt:    sql.NullTime{Time: time.Now().Add(time.Hour).UTC(), Valid: true},
+	})
+	assert.NoError(t, err)
+
+	history, err := store.GetSegmentsHistoryByUserId(context.Background(), models.GetSegmentsHistoryByUserIdParams{
+		UserID:   user.ID,
+		FromDate: time.Now().Add(-time.Hour),
+		ToDate:   time.Now().Add(time.Hour),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, history, 4)
+	assert.Equal(t, models.ActionInserted, history[0].ActionType)
+	assert.Equal(t, models.ActionTTLChanged, history[1].ActionType)
+	assert.True(t, history[1].OldExpireAt.Time.Before(history[1].ExpireAt.Time))
+	assert.Equal(t, models.ActionTTLChanged, history[2].ActionType)
+	assert.False(t, history[2].ExpireAt.Valid)
+	assert.True(t, history[2].OldExpireAt.Valid)
+	assert.Equal(t, models.ActionUpdated, history[3].ActionType)
+	assert.True(t, history[3].StartsAt.Valid)
+}
+
+func TestHistoryRecordsAudit(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	segment, err := store.AddSegment(context.Background(), models.AddSegmentParams{
+		Name:        "AUDITED_SEGMENT",
+		RolloutSalt: "AUDITED_SEGMENT",
+	})
+	assert.NoError(t, err)
+	user, err := store.AddUser(context.Background(), models.AddUserParams{Name: "audited"})
+	assert.NoError(t, err)
+
+	ctx := audit.WithAudit(context.Background(), audit.Audit{Actor: "checkout-service", Reason: "TICKET-42"})
+	err = store.ExecTx(ctx, func(q storage.Querier) error {
+		_, err := q.AddUserIntoSegment(ctx, models.AddUserIntoSegmentParams{
+			UserID:      user.ID,
+			SegmentName: segment.Name,
+		})
+		return err
+	})
+	assert.NoError(t, err)
+	err = store.DeleteSegment(audit.WithAudit(context.Background(), audit.Audit{Actor: "admin"}), segment.Name)
+	assert.NoError(t, err)
+
+	history, err := store.GetSegmentsHistoryByUserId(context.Background(), models.GetSegmentsHistoryByUserIdParams{
+		UserID:   user.ID,
+		FromDate: time.Now().Add(-time.Hour),
+		ToDate:   time.Now().Add(time.Hour),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, "checkout-service", history[0].Actor.String)
+	assert.Equal(t, "TICKET-42", history[0].Reason.String)
+	assert.Equal(t, models.ActionSegmentDeleted, history[1].ActionType)
+	assert.Equal(t, "admin", history[1].Actor.String)
+	assert.False(t, history[1].Reason.Valid)
+}
+
+func TestSoftDeleteAndRestore(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	segment, err := store.AddSegment(context.Background(), models.AddSegmentParams{
+		Name:        "SOFT_DELETED_SEGMENT",
+		Description: sql.NullString{String: "kept after deletion", Valid: true},
+		RolloutSalt: "SOFT_DELETED_SEGMENT",
+	})
+	assert.NoError(t, err)
+	user, err := store.AddUser(context.Background(), models.AddUserParams{Name: "soft deleted"})
+	assert.NoError(t, err)
+	_, err = store.AddUserIntoSegmentWithTTLInHours(context.Background(), models.AddUserIntoSegmentWithTTLInHoursParams{
+		UserID:        user.ID,
+		SegmentName:   segment.Name,
+		NumberOfHours: 24,
+	})
+	assert.NoError(t, err)
+
+	err = store.DeleteSegment(context.Background(), segment.Name)
+	assert.NoError(t, err)
+	_, err = store.GetSegmentByName(context.Background(), segment.Name)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	segments, err := store.GetSegmentsByUserId(context.Background(), user.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, segments)
+
+	_, err = store.RestoreSegment(context.Background(), models.RestoreSegmentParams{
+		Name:         segment.Name,
+		DeletedAfter: time.Now().UTC().Add(time.Hour),
+	})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	restored, err := store.RestoreSegment(context.Background(), models.RestoreSegmentParams{
+		Name:         segment.Name,
+		DeletedAfter: time.Now().UTC().Add(-time.Hour),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "kept after deletion", restored.Description.String)
+	assert.False(t, restored.DeletedAt.Valid)
+	segments, err = store.GetSegmentsByUserId(context.Background(), user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{segment.Name}, segments)
+
+	err = store.DeleteUser(context.Background(), user.ID)
+	assert.NoError(t, err)
+	_, err = store.GetUserById(context.Background(), user.ID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = store.RestoreUser(context.Background(), models.RestoreUserParams{
+		ID:           user.ID,
+		DeletedAfter: time.Now().UTC().Add(-time.Hour),
+	})
+	assert.NoError(t, err)
+	segments, err = store.GetSegmentsByUserId(context.Background(), user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{segment.Name}, segments)
+
+	history, err := store.GetSegmentsHistoryByUserId(context.Background(), models.GetSegmentsHistoryByUserIdParams{
+		UserID:   user.ID,
+		FromDate: time.Now().Add(-time.Hour),
+		ToDate:   time.Now().Add(time.Hour),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, history, 5)
+	assert.Equal(t, models.ActionSegmentDeleted, history[1].ActionType)
+	assert.Equal(t, models.ActionSegmentRestored, history[2].ActionType)
+	assert.True(t, history[2].ExpireAt.Valid)
+	assert.Equal(t, models.ActionUserDeleted, history[3].ActionType)
+	assert.Equal(t, models.ActionUserRestored, history[4].ActionType)
+
+	err = store.DeleteSegment(context.Background(), segment.Name)
+	assert.NoError(t, err)
+	purged, err := store.PurgeDeletedSegments(context.Background(), time.Now().UTC().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	_, err = store.RestoreSegment(context.Background(), models.RestoreSegmentParams{
+		Name:         segment.Name,
+		DeletedAfter: time.Now().UTC().Add(-time.Hour),
+	})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestRestoreRecordsAudit(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	segment, err := store.AddSegment(context.Background(), models.AddSegmentParams{
+		Name:        "AUDITED_RESTORE_SEGMENT",
+		RolloutSalt: "AUDITED_RESTORE_SEGMENT",
+	})
+	assert.NoError(t, err)
+	user, err := store.AddUser(context.Background(), models.AddUserParams{Name: "audited restore"})
+	assert.NoError(t, err)
+	_, err = store.AddUserIntoSegment(context.Background(), models.AddUserIntoSegmentParams{
+		UserID:      user.ID,
+		SegmentName: segment.Name,
+	})
+	assert.NoError(t, err)
+
+	err = store.DeleteSegment(context.Background(), segment.Name)
+	assert.NoError(t, err)
+	ctx := audit.WithAudit(context.Background(), audit.Audit{Actor: "admin", Reason: "TICKET-7"})
+	_, err = store.RestoreSegment(ctx, models.RestoreSegmentParams{
+		Name:         segment.Name,
+		DeletedAfter: time.Now().UTC().Add(-time.Hour),
+	})
+	assert.NoError(t, err)
+	err = store.DeleteUser(context.Background(), user.ID)
+	assert.NoError(t, err)
+	_, err = store.RestoreUser(audit.WithAudit(context.Background(), audit.Audit{Actor: "support"}), models.RestoreUserParams{
+		ID:           user.ID,
+		DeletedAfter: time.Now().UTC().Add(-time.Hour),
+	})
+	assert.NoError(t, err)
+
+	history, err := store.GetSegmentsHistoryByUserId(context.Background(), models.GetSegmentsHistoryByUserIdParams{
+		UserID:   user.ID,
+		FromDate: time.Now().Add(-time.Hour),
+		ToDate:   time.Now().Add(time.Hour),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, history, 5)
+	assert.Equal(t, models.ActionSegmentRestored, history[2].ActionType)
+	assert.Equal(t, "admin", history[2].Actor.String)
+	assert.Equal(t, "TICKET-7", history[2].Reason.String)
+	assert.Equal(t, models.ActionUserRestored, history[4].ActionType)
+	assert.Equal(t, "support", history[4].Actor.String)
+	assert.False(t, history[4].Reason.Valid)
+}
+
+func TestGetSegmentsHistoryByUserIdFiltersAndPages(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	user, err := store.AddUser(context.Background(), models.AddUserParams{Name: "history pages"})
+	assert.NoError(t, err)
+	for _, name := range []string{"FIRST_SEGMENT", "SECOND_SEGMENT"} {
+		_, err := store.AddSegment(context.Background(), models.AddSegmentParams{Name: name, RolloutSalt: name})
+		assert.NoError(t, err)
+		_, err = store.AddUserIntoSegment(context.Background(), models.AddUserIntoSegmentParams{UserID: user.ID, SegmentName: name})
+		assert.NoError(t, err)
+		err = store.RemoveUserFromSegment(context.Background(), models.RemoveUserFromSegmentParams{UserID: user.ID, SegmentName: name})
+		assert.NoError(t, err)
+	}
+
+	params := models.GetSegmentsHistoryByUserIdParams{
+		UserID:   user.ID,
+		FromDate: time.Now().Add(-time.Hour),
+		ToDate:   time.Now().Add(time.Hour),
+		PageSize: 3,
+	}
+	page, err := store.GetSegmentsHistoryByUserId(context.Background(), params)
+	assert.NoError(t, err)
+	assert.Len(t, page, 3)
+	params.AfterID = page[2].ID
+	page, err = store.GetSegmentsHistoryByUserId(context.Background(), params)
+	assert.NoError(t, err)
+	assert.Len(t, page, 1)
+	assert.Equal(t, "SECOND_SEGMENT", page[0].SegmentName)
+	assert.Equal(t, models.ActionDeleted, page[0].ActionType)
+
+	for _, actions := range [][]string{nil, {}} {
+		all, err := store.GetSegmentsHistoryByUserId(context.Background(), models.GetSegmentsHistoryByUserIdParams{
+			UserID:      user.ID,
+			FromDate:    time.Now().Add(-time.Hour),
+			ToDate:      time.Now().Add(time.Hour),
+			ActionTypes: actions,
+		})
+		assert.NoError(t, err)
+		assert.Len(t, all, 4)
+	}
+
+	res, err := store.GetSegmentsHistoryByUserId(context.Background(), models.GetSegmentsHistoryByUserIdParams{
+		UserID:      user.ID,
+		FromDate:    time.Now().Add(-time.Hour),
+		ToDate:      time.Now().Add(time.Hour),
+		SegmentName: "FIRST_SEGMENT",
+		ActionTypes: []string{models.ActionDeleted},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, res, 1)
+	assert.Equal(t, "FIRST_SEGMENT", res[0].SegmentName)
+	assert.Equal(t, models.ActionDeleted, res[0].ActionType)
+}
+
+func TestReportSegmentsHistory(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	_, err := store.AddSegment(context.Background(), models.AddSegmentParams{Name: "REPORT_SEGMENT", RolloutSalt: "REPORT_SEGMENT"})
+	assert.NoError(t, err)
+	var ids []int64
+	for i := 0; i < 3; i++ {
+		user, err := store.AddUser(context.Background(), models.AddUserParams{Name: "report user"})
+		assert.NoError(t, err)
+		_, err = store.AddUserIntoSegment(context.Background(), models.AddUserIntoSegmentParams{UserID: user.ID, SegmentName: "REPORT_SEGMENT"})
+		assert.NoError(t, err)
+		ids = append(ids, user.ID)
+	}
+	err = store.RemoveUserFromSegment(context.Background(), models.RemoveUserFromSegmentParams{UserID: ids[0], SegmentName: "REPORT_SEGMENT"})
+	assert.NoError(t, err)
+
+	params := models.HistoryReportParams{
+		FromDate:    time.Now().Add(-24 * time.Hour).UTC(),
+		ToDate:      time.Now().Add(24 * time.Hour).UTC(),
+		SegmentName: "REPORT_SEGMENT",
+	}
+	var res []models.UsersInSegmentsHistory
+	err = store.ReportSegmentsHistory(context.Background(), params, func(h models.UsersInSegmentsHistory) error {
+		res = append(res, h)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, res, 4)
+	assert.Equal(t, ids[0], res[3].UserID)
+	assert.Equal(t, models.ActionDeleted, res[3].ActionType)
+	assert.NotZero(t, res[3].TxID)
+
+	stop := errors.New("stop")
+	n := 0
+	err = store.ReportSegmentsHistory(context.Background(), params, func(h models.UsersInSegmentsHistory) error {
+		n++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, n)
+
+	params.ToDate = params.FromDate.Add(time.Hour)
+	res = nil
+	err = store.ReportSegmentsHistory(context.Background(), params, func(h models.UsersInSegmentsHistory) error {
+		res = append(res, h)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, res)
+}
+
+func TestReports(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	job, err := store.CreateJob(context.Background(), models.CreateJobParams{Kind: "history_report", Payload: []byte(`{}`)})
+	assert.NoError(t, err)
+
+	params := models.CreateReportParams{
+		JobID:       job.ID,
+		BlobKey:     fmt.Sprintf("reports/%d/history_2023-09.csv", job.ID),
+		Filename:    "history_2023-09.csv",
+		ContentType: "text/csv",
+		Size:        100,
+		Records:     2,
+		ExpireAt:    time.Now().Add(-time.Minute).UTC(),
+	}
+	_, err = store.CreateReport(context.Background(), params)
+	assert.NoError(t, err)
+	// A restarted job replaces the report of the interrupted attempt.
+	params.Size = 120
+	report, err := store.CreateReport(context.Background(), params)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(120), report.Size)
+
+	report, err = store.GetReportByJobId(context.Background(), job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, params.BlobKey, report.BlobKey)
+
+	expired, err := store.ListExpiredReports(context.Background(), models.ListExpiredReportsParams{
+		ExpiredBefore: time.Now().UTC(),
+		BatchSize:     100,
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, expired, report)
+
+	assert.NoError(t, store.DeleteReport(context.Background(), job.ID))
+	_, err = store.GetReportByJobId(context.Background(), job.ID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestSegmentStats(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	segment := models.NewTestSegment()
+	_, err := store.AddSegment(context.Background(), models.AddSegmentParams{Name: segment.Name})
+	assert.NoError(t, err)
+	var users []models.User
+	for i := 0; i < 3; i++ {
+		user, err := store.AddUser(context.Background(), models.AddUserParams{Name: models.NewTestUser().Name})
+		assert.NoError(t, err)
+		users = append(users, user)
+	}
+	for _, user := range users[:2] {
+		_, err = store.AddUserIntoSegment(context.Background(), models.AddUserIntoSegmentParams{
+			UserID:      user.ID,
+			SegmentName: segment.Name,
+		})
+		assert.NoError(t, err)
+	}
+	_, err = store.AddUserIntoSegmentWithExpireDatetime(context.Background(), models.AddUserIntoSegmentWithExpireDatetimeParams{
+		UserID:      users[2].ID,
+		SegmentName: segment.Name,
+		ExpireAt:    sql.NullTime{Time: time.Now().Add(time.Hour).UTC(), Valid: true},
+	})
+	assert.NoError(t, err)
+	err = store.RemoveUserFromSegment(context.Background(), models.RemoveUserFromSegmentParams{
+		UserID:      users[0].ID,
+		SegmentName: segment.Name,
+	})
+	assert.NoError(t, err)
+
+	counts, err := store.GetSegmentMembershipCounts(context.Background(), models.GetSegmentMembershipCountsParams{
+		ExpiringBefore: time.Now().Add(2 * time.Hour).UTC(),
+		SegmentName:    segment.Name,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), counts.ActiveCount)
+	assert.Equal(t, int64(1), counts.ExpiringCount)
+
+	_, err = store.GetSegmentMembershipCounts(context.Background(), models.GetSegmentMembershipCountsParams{
+		ExpiringBefore: time.Now().UTC(),
+		SegmentName:    "NOT_EXISTING_SEGMENT",
+	})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	statsParams := models.GetSegmentDailyStatsParams{
+		SegmentName: segment.Name,
+		FromDay:     today.AddDate(0, 0, -1),
+		ToDay:       today.AddDate(0, 0, 1),
+	}
+	assertStats := func(added, removed int64) {
+		stats, err := store.GetSegmentDailyStats(context.Background(), statsParams)
+		assert.NoError(t, err)
+		if assert.Len(t, stats, 1) {
+			assert.Equal(t, added, stats[0].Added)
+			assert.Equal(t, removed, stats[0].Removed)
+			assert.Equal(t, int64(0), stats[0].Expired)
+		}
+	}
+
+	// Before aggregation the history is read directly, afterwards from the rollup.
+	assertStats(3, 1)
+	aggregateSegmentStats(t, store)
+	assertStats(3, 1)
+
+	// History of a transaction that is still running while the aggregation runs
+	// must not fall behind the watermark.
+	user, err := store.AddUser(context.Background(), models.AddUserParams{Name: models.NewTestUser().Name})
+	assert.NoError(t, err)
+	err = store.ExecTx(context.Background(), func(q storage.Querier) error {
+		_, err := q.AddUserIntoSegment(context.Background(), models.AddUserIntoSegmentParams{
+			UserID:      user.ID,
+			SegmentName: segment.Name,
+		})
+		if err != nil {
+			return err
+		}
+		aggregateSegmentStats(t, store)
+		return nil
+	})
+	assert.NoError(t, err)
+	assertStats(4, 1)
+	aggregateSegmentStats(t, store)
+	assertStats(4, 1)
+}
+
+func aggregateSegmentStats(t *testing.T, store *database.Store) {
+	t.Helper()
+	for {
+		var processed int64
+		err := store.ExecTx(context.Background(), func(q storage.Querier) error {
+			afterTxID, err := q.GetSegmentStatsState(context.Background())
+			if err != nil {
+				return err
+			}
+			res, err := q.RollupSegmentStats(context.Background(), models.RollupSegmentStatsParams{
+				AfterTxID: afterTxID,
+				BatchSize: 1000,
+			})
+			if err != nil {
+				return err
+			}
+			processed = res.Processed
+			if processed == 0 {
+				return nil
+			}
+			return q.SetSegmentStatsState(context.Background(), res.LastTxID)
+		})
+		assert.NoError(t, err)
+		if err != nil || processed < 1000 {
+			return
+		}
+	}
+}
+
+func TestHistoryPartitions(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	old := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	created, err := store.CreateHistoryPartitions(context.Background(), models.CreateHistoryPartitionsParams{
+		FromMonth: old,
+		ToMonth:   old.AddDate(0, 1, 0),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), created)
+	created, err = store.CreateHistoryPartitions(context.Background(), models.CreateHistoryPartitionsParams{
+		FromMonth: old,
+		ToMonth:   old.AddDate(0, 1, 0),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(0), created)
+
+	partitions, err := store.ListHistoryPartitions(context.Background(), old.AddDate(0, 1, 0))
+	assert.NoError(t, err)
+	if assert.Len(t, partitions, 1) {
+		assert.Equal(t, "users_in_segments_history_p200001", partitions[0].Name)
+		assert.True(t, partitions[0].Month.Equal(old))
+	}
+
+	_, err = store.CreateHistoryArchive(context.Background(), models.CreateHistoryArchiveParams{
+		Month:   old,
+		BlobKey: "archive/history_2000-01.csv.gz",
+		Size:    20,
+	})
+	assert.NoError(t, err)
+	dropped, err := store.DropHistoryPartition(context.Background(), old)
+	assert.NoError(t, err)
+	assert.True(t, dropped)
+	dropped, err = store.DropHistoryPartition(context.Background(), old)
+	assert.NoError(t, err)
+	assert.False(t, dropped)
+
+	// New history goes into the partition of the current month and is kept until it is aggregated.
+	segment := models.NewTestSegment()
+	_, err = store.AddSegment(context.Background(), models.AddSegmentParams{Name: segment.Name})
+	assert.NoError(t, err)
+	user, err := store.AddUser(context.Background(), models.AddUserParams{Name: models.NewTestUser().Name})
+	assert.NoError(t, err)
+	_, err = store.AddUserIntoSegment(context.Background(), models.AddUserIntoSegmentParams{
+		UserID:      user.ID,
+		SegmentName: segment.Name,
+	})
+	assert.NoError(t, err)
+	now := time.Now().UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	_, err = store.DropHistoryPartition(context.Background(), month)
+	assert.Error(t, err)
+	res, err := store.GetSegmentsHistoryByUserId(context.Background(), models.GetSegmentsHistoryByUserIdParams{
+		UserID:   user.ID,
+		FromDate: time.Now().Add(-time.Hour),
+		ToDate:   time.Now().Add(time.Hour),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, res, 1)
+}
+
+func TestArchivedHistoryAt(t *testing.T) {
+	store := database.TestDB(t, databaseURL)
+	names := []string{"ARCHIVE_KEPT", "ARCHIVE_REMOVED", "ARCHIVE_RESTORED"}
+	for _, name := range names {
+		_, err := store.AddSegment(context.Background(), models.AddSegmentParams{Name: name})
+		assert.NoError(t, err)
+	}
+	user, err := store.AddUser(context.Background(), models.AddUserParams{Name: models.NewTestUser().Name})
+	assert.NoError(t, err)
+	for _, name := range names {
+		_, err = store.AddUserIntoSegment(context.Background(), models.AddUserIntoSegmentParams{
+			UserID:      user.ID,
+			SegmentName: name,
+		})
+		assert.NoError(t, err)
+	}
+	err = store.RemoveUserFromSegment(context.Background(), models.RemoveUserFromSegmentParams{
+		UserID:      user.ID,
+		SegmentName: "ARCHIVE_REMOVED",
+	})
+	assert.NoError(t, err)
+	err = store.DeleteSegment(context.Background(), "ARCHIVE_RESTORED")
+	assert.NoError(t, err)
+	aggregateSegmentStats(t, store)
+
+	now := time.Now().UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	next := month.AddDate(0, 1, 0)
+
+	// The month holds the memberships of the deleted segment that are needed to restore it.
+	_, err = store.DropHistoryPartition(context.Background(), month)
+	assert.Error(t, err)
+	_, err = store.RestoreSegment(context.Background(), models.RestoreSegmentParams{
+		Name:         "ARCHIVE_RESTORED",
+		DeletedAfter: now.Add(-time.Hour),
+	})
+	assert.NoError(t, err)
+	aggregateSegmentStats(t, store)
+
+	err = store.ExecTx(context.Background(), func(q storage.Querier) error {
+		if _, err := q.CreateHistoryArchive(context.Background(), models.CreateHistoryArchiveParams{
+			Month:   month,
+			BlobKey: "archive/history.csv.gz",
+		}); err != nil {
+			return err
+		}
+		dropped, err := q.DropHistoryPartition(context.Background(), month)
+		assert.True(t, dropped)
+		return err
+	})
+	assert.NoError(t, err)
+
+	archivedBefore, err := store.GetHistoryArchivedBefore(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, archivedBefore.Valid)
+	assert.True(t, archivedBefore.Time.Equal(next))
+
+	// The memberships outliving the archived month are carried into the next one.
+	actions, err := store.GetLastSegmentsActionsByUserId(context.Background(), models.GetLastSegmentsActionsByUserIdParams{
+		UserID: user.ID,
+		At:     next,
+	})
+	assert.NoError(t, err)
+	var segments []string
+	for _, action := range actions {
+		assert.Equal(t, models.ActionSnapshot, action.ActionType)
+		assert.True(t, action.ActionDate.Equal(next))
+		segments = append(segments, action.SegmentName)
+	}
+	assert.ElementsMatch(t, []string{"ARCHIVE_KEPT", "ARCHIVE_RESTORED"}, segments)
+}
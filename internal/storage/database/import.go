@@ -0,0 +1,223 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+	"github.com/lib/pq"
+)
+
+const createImportTable = `
+CREATE TEMPORARY TABLE users_import (
+	line INTEGER NOT NULL,
+	user_id BIGINT,
+	name TEXT NOT NULL,
+	external_id TEXT,
+	segments JSONB NOT NULL
+) ON COMMIT DROP
+`
+
+const checkImport = `
+SELECT line,
+	error
+FROM (
+		SELECT line,
+			format(
+				'external id %s is already used on line %s',
+				external_id,
+				min(line) OVER (PARTITION BY external_id)
+			) AS error,
+			line <> min(line) OVER (PARTITION BY external_id) AS repeated
+		FROM users_import
+		WHERE external_id IS NOT NULL
+	) AS duplicates
+WHERE repeated
+UNION ALL
+SELECT users_import.line,
+	format('user with external id %s already exists', users_import.external_id)
+FROM users_import
+	JOIN users ON users.external_id = users_import.external_id
+UNION ALL
+SELECT users_import.line,
+	format('segment %s does not exist', segment.name)
+FROM users_import
+	CROSS JOIN LATERAL jsonb_to_recordset(users_import.segments) AS segment(name TEXT, ttl INTEGER)
+WHERE NOT EXISTS (
+		SELECT 1
+		FROM segments
+		WHERE segments.name = segment.name
+			AND segments.deleted_at IS NULL
+	)
+ORDER BY line
+LIMIT $1
+`
+
+const countImport = `
+SELECT count(*),
+	COALESCE(sum(jsonb_array_length(segments)), 0)::bigint
+FROM users_import
+`
+
+const insertImportedUsers = `
+UPDATE users_import
+SET user_id = nextval('users_id_seq');
+INSERT INTO users (id, created_at, updated_at, name, external_id)
+SELECT user_id,
+	now(),
+	now(),
+	name,
+	external_id
+FROM users_import
+ORDER BY line;
+INSERT INTO users_in_segments (
+		user_id,
+		segment_name,
+		created_at,
+		updated_at,
+		expire_at
+	)
+SELECT users_import.user_id,
+	segment.name,
+	now(),
+	now(),
+	CASE
+		WHEN segment.ttl > 0 THEN now() + make_interval(hours => segment.ttl)
+	END
+FROM users_import
+	CROSS JOIN LATERAL jsonb_to_recordset(users_import.segments) AS segment(name TEXT, ttl INTEGER);
+`
+
+const enrollImportedUsers = `
+INSERT INTO users_in_segments (
+		user_id,
+		segment_name,
+		created_at,
+		updated_at,
+		expire_at
+	)
+SELECT users_import.user_id,
+	segments.name,
+	now(),
+	now(),
+	null
+FROM users_import
+	JOIN segments ON segments.deleted_at IS NULL
+	AND segments.rollout_percent IS NOT NULL
+	AND rollout_bucket(segments.rollout_salt, users_import.user_id) < segments.rollout_percent * 100 ON CONFLICT (user_id, segment_name) DO NOTHING
+`
+
+// ImportUsers streams the source into a temporary table with COPY, checks it against the database
+// and then moves all rows into users and users_in_segments with a few set-based statements.
+// Imported users are enrolled into percentage segments the same way as users created one by one.
+func (s *Store) ImportUsers(ctx context.Context, src storage.ImportSource, dryRun bool) (models.ImportUsersResult, error) {
+	res := models.ImportUsersResult{DryRun: dryRun}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return res, err
+	}
+	defer tx.Rollback()
+
+	if err := setAudit(ctx, s.WithTx(tx)); err != nil {
+		return res, err
+	}
+
+	if _, err := tx.ExecContext(ctx, createImportTable); err != nil {
+		return res, err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("users_import", "line", "name", "external_id", "segments"))
+	if err != nil {
+		return res, err
+	}
+	for {
+		user, err := src.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			stmt.Close()
+			return res, err
+		}
+
+		segments, err := json.Marshal(user.Segments)
+		if err != nil {
+			stmt.Close()
+			return res, err
+		}
+		if user.Segments == nil {
+			segments = []byte("[]")
+		}
+
+		if _, err := stmt.ExecContext(ctx, user.Line, user.Name, user.ExternalID, string(segments)); err != nil {
+			stmt.Close()
+			return res, err
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return res, err
+	}
+	if err := stmt.Close(); err != nil {
+		return res, err
+	}
+
+	if err := tx.QueryRowContext(ctx, countImport).Scan(&res.Users, &res.Segments); err != nil {
+		return res, err
+	}
+
+	rows, err := tx.QueryContext(ctx, checkImport, models.MaxImportErrors)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+	res.Errors = src.Errors()
+	for rows.Next() {
+		var i models.ImportError
+		if err := rows.Scan(&i.Line, &i.Error); err != nil {
+			return res, err
+		}
+		res.Errors = append(res.Errors, i)
+	}
+	if err := rows.Close(); err != nil {
+		return res, err
+	}
+	if err := rows.Err(); err != nil {
+		return res, err
+	}
+
+	if len(res.Errors) > 0 {
+		sort.SliceStable(res.Errors, func(i, j int) bool {
+			return res.Errors[i].Line < res.Errors[j].Line
+		})
+		if len(res.Errors) > models.MaxImportErrors {
+			res.Errors = res.Errors[:models.MaxImportErrors]
+		}
+		return res, nil
+	}
+	if dryRun {
+		return res, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, insertImportedUsers); err != nil {
+		return res, err
+	}
+
+	q := s.WithTx(tx)
+	if err := q.SetHistoryAction(ctx, models.ActionAutoAssigned); err != nil {
+		return res, err
+	}
+	if _, err := tx.ExecContext(ctx, enrollImportedUsers); err != nil {
+		return res, err
+	}
+	if err := q.SetHistoryAction(ctx, ""); err != nil {
+		return res, err
+	}
+
+	return res, tx.Commit()
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+)
+
+const declareHistoryReport = `
+DECLARE history_report NO SCROLL CURSOR FOR
+SELECT user_id,
+	segment_name,
+	expire_at,
+	action_type,
+	action_date,
+	starts_at,
+	id,
+	old_expire_at,
+	actor,
+	reason,
+	tx_id
+FROM users_in_segments_history
+WHERE action_date >= $1
+	AND action_date < $2
+	AND (
+		$3::text = ''
+		OR segment_name = $3::text
+	)
+ORDER BY action_date,
+	id
+`
+
+// reportFetchSize is how many history records are held in memory at once while a report is read.
+const reportFetchSize = 5000
+
+var fetchHistoryReport = fmt.Sprintf("FETCH FORWARD %d FROM history_report", reportFetchSize)
+
+// ReportSegmentsHistory declares a server-side cursor in a read-only transaction and fetches
+// the history from it in batches of reportFetchSize. The cursor sees a single snapshot,
+// so records added while the report is read are not included.
+func (s *Store) ReportSegmentsHistory(ctx context.Context, arg models.HistoryReportParams, fn func(models.UsersInSegmentsHistory) error) error {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, declareHistoryReport, arg.FromDate, arg.ToDate, arg.SegmentName); err != nil {
+		return err
+	}
+
+	for {
+		n, err := fetchReportBatch(ctx, tx, fn)
+		if err != nil {
+			return err
+		}
+		if n < reportFetchSize {
+			return tx.Commit()
+		}
+	}
+}
+
+func fetchReportBatch(ctx context.Context, tx *sql.Tx, fn func(models.UsersInSegmentsHistory) error) (int, error) {
+	rows, err := tx.QueryContext(ctx, fetchHistoryReport)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		var i models.UsersInSegmentsHistory
+		if err := rows.Scan(
+			&i.UserID,
+			&i.SegmentName,
+			&i.ExpireAt,
+			&i.ActionType,
+			&i.ActionDate,
+			&i.StartsAt,
+			&i.ID,
+			&i.OldExpireAt,
+			&i.Actor,
+			&i.Reason,
+			&i.TxID,
+		); err != nil {
+			return n, err
+		}
+		n++
+		if err := fn(i); err != nil {
+			return n, err
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return n, err
+	}
+	return n, rows.Err()
+}
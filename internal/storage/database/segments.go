@@ -7,31 +7,50 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/AlexZahvatkin/segments-users-service/internal/models"
 )
 
 const addSegment = `-- name: AddSegment :one
-INSERT INTO segments (name, created_at, updated_at, description) 
-VALUES ($1, now(), now(), $2)
-RETURNING name, created_at, updated_at, description
+INSERT INTO segments (
+		name,
+		created_at,
+		updated_at,
+		description,
+		rollout_salt,
+		rollout_percent
+	)
+VALUES ($1, now(), now(), $2, $3, $4)
+RETURNING name, created_at, updated_at, description, rollout_salt, rollout_percent, deleted_at
 `
 
 func (q *Queries) AddSegment(ctx context.Context, arg models.AddSegmentParams) (models.Segment, error) {
-	row := q.db.QueryRowContext(ctx, addSegment, arg.Name, arg.Description)
+	row := q.db.QueryRowContext(ctx, addSegment,
+		arg.Name,
+		arg.Description,
+		arg.RolloutSalt,
+		arg.RolloutPercent,
+	)
 	var i models.Segment
 	err := row.Scan(
 		&i.Name,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Description,
+		&i.RolloutSalt,
+		&i.RolloutPercent,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const deleteSegment = `-- name: DeleteSegment :exec
-DELETE FROM segments 
+UPDATE segments
+SET deleted_at = now(),
+	updated_at = now()
 WHERE name = $1
+	AND deleted_at IS NULL
 `
 
 func (q *Queries) DeleteSegment(ctx context.Context, name string) error {
@@ -39,10 +58,48 @@ func (q *Queries) DeleteSegment(ctx context.Context, name string) error {
 	return err
 }
 
+const restoreSegment = `-- name: RestoreSegment :one
+UPDATE segments
+SET deleted_at = null,
+	updated_at = now()
+WHERE name = $1
+	AND deleted_at > $2
+RETURNING name, created_at, updated_at, description, rollout_salt, rollout_percent, deleted_at
+`
+
+func (q *Queries) RestoreSegment(ctx context.Context, arg models.RestoreSegmentParams) (models.Segment, error) {
+	row := q.db.QueryRowContext(ctx, restoreSegment, arg.Name, arg.DeletedAfter)
+	var i models.Segment
+	err := row.Scan(
+		&i.Name,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Description,
+		&i.RolloutSalt,
+		&i.RolloutPercent,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const purgeDeletedSegments = `-- name: PurgeDeletedSegments :execrows
+DELETE FROM segments
+WHERE deleted_at <= $1
+`
+
+func (q *Queries) PurgeDeletedSegments(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedSegments, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getSegmentByName = `-- name: GetSegmentByName :one
-SELECT name, created_at, updated_at, description
+SELECT name, created_at, updated_at, description, rollout_salt, rollout_percent, deleted_at
 FROM segments 
 WHERE name = $1
+	AND deleted_at IS NULL
 `
 
 func (q *Queries) GetSegmentByName(ctx context.Context, name string) (models.Segment, error) {
@@ -53,6 +110,146 @@ func (q *Queries) GetSegmentByName(ctx context.Context, name string) (models.Seg
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Description,
+		&i.RolloutSalt,
+		&i.RolloutPercent,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getSegmentWithMembersCount = `-- name: GetSegmentWithMembersCount :one
+SELECT s.name,
+	s.created_at,
+	s.updated_at,
+	s.description,
+	s.rollout_salt,
+	s.rollout_percent,
+	counts.members_count,
+	counts.pending_count
+FROM segments s
+	CROSS JOIN LATERAL (
+		SELECT count(*) FILTER (
+				WHERE uis.starts_at IS NULL
+					OR uis.starts_at <= now()
+			) AS members_count,
+			count(*) FILTER (
+				WHERE uis.starts_at > now()
+			) AS pending_count
+		FROM users_in_segments uis
+		WHERE uis.segment_name = s.name
+			AND (
+				uis.expire_at IS NULL
+				OR uis.expire_at > now()
+			)
+	) counts
+WHERE s.name = $1
+	AND s.deleted_at IS NULL
+`
+
+func (q *Queries) GetSegmentWithMembersCount(ctx context.Context, name string) (models.GetSegmentWithMembersCountRow, error) {
+	row := q.db.QueryRowContext(ctx, getSegmentWithMembersCount, name)
+	var i models.GetSegmentWithMembersCountRow
+	err := row.Scan(
+		&i.Name,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Description,
+		&i.RolloutSalt,
+		&i.RolloutPercent,
+		&i.MembersCount,
+		&i.PendingCount,
+	)
+	return i, err
+}
+
+const listSegments = `-- name: ListSegments :many
+SELECT s.name,
+	s.created_at,
+	s.updated_at,
+	s.description,
+	s.rollout_salt,
+	s.rollout_percent,
+	counts.members_count,
+	counts.pending_count
+FROM segments s
+	CROSS JOIN LATERAL (
+		SELECT count(*) FILTER (
+				WHERE uis.starts_at IS NULL
+					OR uis.starts_at <= now()
+			) AS members_count,
+			count(*) FILTER (
+				WHERE uis.starts_at > now()
+			) AS pending_count
+		FROM users_in_segments uis
+		WHERE uis.segment_name = s.name
+			AND (
+				uis.expire_at IS NULL
+				OR uis.expire_at > now()
+			)
+	) counts
+WHERE s.deleted_at IS NULL
+	AND starts_with(s.name, $1::text)
+	AND s.name > $2::text
+ORDER BY s.name
+LIMIT $3::integer
+`
+
+func (q *Queries) ListSegments(ctx context.Context, arg models.ListSegmentsParams) ([]models.ListSegmentsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listSegments, arg.NamePrefix, arg.AfterName, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []models.ListSegmentsRow
+	for rows.Next() {
+		var i models.ListSegmentsRow
+		if err := rows.Scan(
+			&i.Name,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Description,
+			&i.RolloutSalt,
+			&i.RolloutPercent,
+			&i.MembersCount,
+			&i.PendingCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateSegment = `-- name: UpdateSegment :one
+UPDATE segments
+SET description = COALESCE($1, description),
+	rollout_percent = COALESCE($2, rollout_percent)
+WHERE name = $3
+	AND deleted_at IS NULL
+	AND (
+		$2::double precision IS NULL
+		OR COALESCE(rollout_percent, 0) <= $2::double precision
+	)
+RETURNING name, created_at, updated_at, description, rollout_salt, rollout_percent, deleted_at
+`
+
+func (q *Queries) UpdateSegment(ctx context.Context, arg models.UpdateSegmentParams) (models.Segment, error) {
+	row := q.db.QueryRowContext(ctx, updateSegment, arg.Description, arg.RolloutPercent, arg.Name)
+	var i models.Segment
+	err := row.Scan(
+		&i.Name,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Description,
+		&i.RolloutSalt,
+		&i.RolloutPercent,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -9,16 +9,83 @@ import (
 	"context"
 
 	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/lib/pq"
 )
 
+const getLastSegmentsActionsByUserId = `-- name: GetLastSegmentsActionsByUserId :many
+SELECT DISTINCT ON (segment_name) user_id, segment_name, expire_at, action_type, action_date, starts_at, id, old_expire_at, actor, reason, tx_id
+FROM users_in_segments_history
+WHERE user_id = $1
+	AND action_date <= $2
+ORDER BY segment_name,
+	action_date DESC,
+	id DESC
+`
+
+func (q *Queries) GetLastSegmentsActionsByUserId(ctx context.Context, arg models.GetLastSegmentsActionsByUserIdParams) ([]models.UsersInSegmentsHistory, error) {
+	rows, err := q.db.QueryContext(ctx, getLastSegmentsActionsByUserId, arg.UserID, arg.At)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []models.UsersInSegmentsHistory
+	for rows.Next() {
+		var i models.UsersInSegmentsHistory
+		if err := rows.Scan(
+			&i.UserID,
+			&i.SegmentName,
+			&i.ExpireAt,
+			&i.ActionType,
+			&i.ActionDate,
+			&i.StartsAt,
+			&i.ID,
+			&i.OldExpireAt,
+			&i.Actor,
+			&i.Reason,
+			&i.TxID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getSegmentsHistoryByUserId = `-- name: GetSegmentsHistoryByUserId :many
-SELECT user_id, segment_name, expire_at, action_type, action_date 
+SELECT user_id, segment_name, expire_at, action_type, action_date, starts_at, id, old_expire_at, actor, reason, tx_id 
 FROM users_in_segments_history
-WHERE user_id = $1 AND action_date > $2 AND action_date < $3
+WHERE user_id = $1
+    AND action_date > $2
+    AND action_date < $3
+    AND (
+        $4::text = ''
+        OR segment_name = $4::text
+    )
+    AND (
+        COALESCE(cardinality($5::text []), 0) = 0
+        OR action_type = ANY($5::text [])
+    )
+    AND id > $6
+ORDER BY id
+LIMIT NULLIF($7::integer, 0)
 `
 
 func (q *Queries) GetSegmentsHistoryByUserId(ctx context.Context, arg models.GetSegmentsHistoryByUserIdParams) ([]models.UsersInSegmentsHistory, error) {
-	rows, err := q.db.QueryContext(ctx, getSegmentsHistoryByUserId, arg.UserID, arg.FromDate, arg.ToDate)
+	rows, err := q.db.QueryContext(ctx, getSegmentsHistoryByUserId,
+		arg.UserID,
+		arg.FromDate,
+		arg.ToDate,
+		arg.SegmentName,
+		pq.Array(arg.ActionTypes),
+		arg.AfterID,
+		arg.PageSize,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -32,6 +99,12 @@ func (q *Queries) GetSegmentsHistoryByUserId(ctx context.Context, arg models.Get
 			&i.ExpireAt,
 			&i.ActionType,
 			&i.ActionDate,
+			&i.StartsAt,
+			&i.ID,
+			&i.OldExpireAt,
+			&i.Actor,
+			&i.Reason,
+			&i.TxID,
 		); err != nil {
 			return nil, err
 		}
@@ -45,3 +118,22 @@ func (q *Queries) GetSegmentsHistoryByUserId(ctx context.Context, arg models.Get
 	}
 	return items, nil
 }
+
+const setHistoryAudit = `-- name: SetHistoryAudit :exec
+SELECT set_config('segments.actor', $1::text, true),
+	set_config('segments.reason', $2::text, true)
+`
+
+func (q *Queries) SetHistoryAudit(ctx context.Context, arg models.SetHistoryAuditParams) error {
+	_, err := q.db.ExecContext(ctx, setHistoryAudit, arg.Actor, arg.Reason)
+	return err
+}
+
+const setHistoryAction = `-- name: SetHistoryAction :exec
+SELECT set_config('segments.action_type', $1::text, true)
+`
+
+func (q *Queries) SetHistoryAction(ctx context.Context, actionType string) error {
+	_, err := q.db.ExecContext(ctx, setHistoryAction, actionType)
+	return err
+}
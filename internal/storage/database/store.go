@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/lib/audit"
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+)
+
+type Store struct {
+	*Queries
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		Queries: New(db),
+		db:      db,
+	}
+}
+
+func (s *Store) ExecTx(ctx context.Context, fn func(storage.Querier) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	q := s.WithTx(tx)
+	if err := setAudit(ctx, q); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := fn(q); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("tx err: %w, rollback err: %v", err, rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// setAudit passes the audit attached to ctx to the history triggers of the transaction.
+func setAudit(ctx context.Context, q *Queries) error {
+	a, ok := audit.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return q.SetHistoryAudit(ctx, models.SetHistoryAuditParams{
+		Actor:  a.Actor,
+		Reason: a.Reason,
+	})
+}
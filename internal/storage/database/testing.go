@@ -10,7 +10,7 @@ import (
 	_ "github.com/lib/pq"
 )
 
-func TestDB(t *testing.T, databaseUrl string) *Queries {
+func TestDB(t *testing.T, databaseUrl string) *Store {
 	t.Helper()
 
 	db, err := sql.Open("postgres", databaseUrl)
@@ -37,5 +37,5 @@ func TestDB(t *testing.T, databaseUrl string) *Queries {
 		t.Fatal(err)
 	}
 
-	return New(db)
+	return NewStore(db)
 }
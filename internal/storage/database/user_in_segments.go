@@ -9,14 +9,15 @@ import (
 	"context"
 
 	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/lib/pq"
 )
 
 const addUserIntoSegment = `-- name: AddUserIntoSegment :one
 INSERT INTO users_in_segments (user_id, segment_name, created_at, updated_at, expire_at) 
 VALUES ($1, $2, now(), now(), null)
 ON CONFLICT (user_id, segment_name) DO UPDATE
-	SET updated_at = now(), expire_at = null
-RETURNING user_id, segment_name, created_at, updated_at, expire_at
+	SET updated_at = now(), expire_at = null, starts_at = null
+RETURNING user_id, segment_name, created_at, updated_at, expire_at, starts_at, started
 `
 
 func (q *Queries) AddUserIntoSegment(ctx context.Context, arg models.AddUserIntoSegmentParams) (models.UsersInSegment, error) {
@@ -28,23 +29,86 @@ func (q *Queries) AddUserIntoSegment(ctx context.Context, arg models.AddUserInto
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.ExpireAt,
+		&i.StartsAt,
+		&i.Started,
 	)
 	return i, err
 }
 
+const addUserIntoRolloutSegments = `-- name: AddUserIntoRolloutSegments :many
+INSERT INTO users_in_segments (
+		user_id,
+		segment_name,
+		created_at,
+		updated_at,
+		expire_at
+	)
+SELECT $1::bigint,
+	name,
+	now(),
+	now(),
+	null
+FROM segments
+WHERE deleted_at IS NULL
+	AND rollout_percent IS NOT NULL
+	AND rollout_bucket(rollout_salt, $1::bigint) < rollout_percent * 100 ON CONFLICT (user_id, segment_name) DO NOTHING
+RETURNING user_id, segment_name, created_at, updated_at, expire_at, starts_at, started
+`
+
+func (q *Queries) AddUserIntoRolloutSegments(ctx context.Context, userID int64) ([]models.UsersInSegment, error) {
+	rows, err := q.db.QueryContext(ctx, addUserIntoRolloutSegments, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []models.UsersInSegment
+	for rows.Next() {
+		var i models.UsersInSegment
+		if err := rows.Scan(
+			&i.UserID,
+			&i.SegmentName,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.ExpireAt,
+			&i.StartsAt,
+			&i.Started,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const addUserIntoSegmentWithExpireDatetime = `-- name: AddUserIntoSegmentWithExpireDatetime :one
-INSERT INTO users_in_segments(user_id, segment_name, created_at, updated_at, expire_at)
-VALUES ($1, $2, $3, $4, $5)
-RETURNING user_id, segment_name, created_at, updated_at, expire_at
+INSERT INTO users_in_segments(
+		user_id,
+		segment_name,
+		created_at,
+		updated_at,
+		expire_at,
+		starts_at
+	)
+VALUES ($1, $2, now(), now(), $3, $4) ON CONFLICT (user_id, segment_name) DO
+UPDATE
+SET updated_at = now(),
+	expire_at = EXCLUDED.expire_at,
+	starts_at = EXCLUDED.starts_at
+RETURNING user_id, segment_name, created_at, updated_at, expire_at, starts_at, started
 `
 
 func (q *Queries) AddUserIntoSegmentWithExpireDatetime(ctx context.Context, arg models.AddUserIntoSegmentWithExpireDatetimeParams) (models.UsersInSegment, error) {
 	row := q.db.QueryRowContext(ctx, addUserIntoSegmentWithExpireDatetime,
 		arg.UserID,
 		arg.SegmentName,
-		arg.CreatedAt,
-		arg.UpdatedAt,
 		arg.ExpireAt,
+		arg.StartsAt,
 	)
 	var i models.UsersInSegment
 	err := row.Scan(
@@ -53,6 +117,8 @@ func (q *Queries) AddUserIntoSegmentWithExpireDatetime(ctx context.Context, arg
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.ExpireAt,
+		&i.StartsAt,
+		&i.Started,
 	)
 	return i, err
 }
@@ -61,8 +127,8 @@ const addUserIntoSegmentWithTTLInHours = `-- name: AddUserIntoSegmentWithTTLInHo
 INSERT INTO users_in_segments (user_id, segment_name, created_at, updated_at, expire_at) 
 VALUES ($1, $2, now(), now(), now() + make_interval(hours => $3))
 ON CONFLICT (user_id, segment_name) DO UPDATE
-	SET updated_at = now(), expire_at = now() + make_interval(hours => $3)
-RETURNING user_id, segment_name, created_at, updated_at, expire_at
+	SET updated_at = now(), expire_at = now() + make_interval(hours => $3), starts_at = null
+RETURNING user_id, segment_name, created_at, updated_at, expire_at, starts_at, started
 `
 
 func (q *Queries) AddUserIntoSegmentWithTTLInHours(ctx context.Context, arg models.AddUserIntoSegmentWithTTLInHoursParams) (models.UsersInSegment, error) {
@@ -74,10 +140,180 @@ func (q *Queries) AddUserIntoSegmentWithTTLInHours(ctx context.Context, arg mode
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.ExpireAt,
+		&i.StartsAt,
+		&i.Started,
 	)
 	return i, err
 }
 
+const addUsersBatchIntoRolloutSegment = `-- name: AddUsersBatchIntoRolloutSegment :one
+WITH batch AS (
+	SELECT id
+	FROM users
+	WHERE id > $1
+		AND deleted_at IS NULL
+	ORDER BY id
+	LIMIT $2
+), inserted AS (
+	INSERT INTO users_in_segments (
+			user_id,
+			segment_name,
+			created_at,
+			updated_at,
+			expire_at
+		)
+	SELECT batch.id,
+		segments.name,
+		now(),
+		now(),
+		null
+	FROM batch
+		JOIN segments ON segments.name = $3
+	WHERE segments.deleted_at IS NULL
+		AND segments.rollout_percent IS NOT NULL
+		AND rollout_bucket(segments.rollout_salt, batch.id) < segments.rollout_percent * 100 ON CONFLICT (user_id, segment_name) DO NOTHING
+	RETURNING user_id
+)
+SELECT COALESCE((SELECT max(id) FROM batch), 0)::bigint AS last_user_id,
+	(SELECT count(*) FROM batch) AS processed,
+	(SELECT count(*) FROM inserted) AS enrolled
+`
+
+func (q *Queries) AddUsersBatchIntoRolloutSegment(ctx context.Context, arg models.AddUsersBatchIntoRolloutSegmentParams) (models.AddUsersBatchIntoRolloutSegmentRow, error) {
+	row := q.db.QueryRowContext(ctx, addUsersBatchIntoRolloutSegment, arg.AfterID, arg.BatchSize, arg.SegmentName)
+	var i models.AddUsersBatchIntoRolloutSegmentRow
+	err := row.Scan(&i.LastUserID, &i.Processed, &i.Enrolled)
+	return i, err
+}
+
+const addUsersIntoSegmentBatch = `-- name: AddUsersIntoSegmentBatch :many
+WITH input AS (
+	SELECT user_id, expire_at, starts_at
+	FROM unnest($1::bigint [], $2::timestamp [], $3::timestamp []) AS input(user_id, expire_at, starts_at)
+),
+upserted AS (
+	INSERT INTO users_in_segments (
+			user_id,
+			segment_name,
+			created_at,
+			updated_at,
+			expire_at,
+			starts_at
+		)
+	SELECT input.user_id,
+		$4::text,
+		now(),
+		now(),
+		input.expire_at,
+		input.starts_at
+	FROM input
+		JOIN users ON users.id = input.user_id
+		AND users.deleted_at IS NULL ON CONFLICT (user_id, segment_name) DO
+	UPDATE
+	SET updated_at = now(),
+		expire_at = EXCLUDED.expire_at,
+		starts_at = EXCLUDED.starts_at
+	RETURNING user_id,
+		expire_at,
+		starts_at,
+		xmax = 0 AS inserted
+)
+SELECT input.user_id,
+	upserted.user_id IS NOT NULL AS user_exists,
+	COALESCE(upserted.inserted, false)::boolean AS inserted,
+	upserted.expire_at,
+	upserted.starts_at
+FROM input
+	LEFT JOIN upserted ON upserted.user_id = input.user_id
+`
+
+func (q *Queries) AddUsersIntoSegmentBatch(ctx context.Context, arg models.AddUsersIntoSegmentBatchParams) ([]models.AddUsersIntoSegmentBatchRow, error) {
+	rows, err := q.db.QueryContext(ctx, addUsersIntoSegmentBatch,
+		pq.Array(arg.UserIds),
+		pq.Array(arg.ExpireAt),
+		pq.Array(arg.StartsAt),
+		arg.SegmentName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []models.AddUsersIntoSegmentBatchRow
+	for rows.Next() {
+		var i models.AddUsersIntoSegmentBatchRow
+		if err := rows.Scan(
+			&i.UserID,
+			&i.UserExists,
+			&i.Inserted,
+			&i.ExpireAt,
+			&i.StartsAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countUsersInSegment = `-- name: CountUsersInSegment :one
+SELECT count(*)
+FROM users_in_segments
+WHERE segment_name = $1
+`
+
+func (q *Queries) CountUsersInSegment(ctx context.Context, segmentName string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUsersInSegment, segmentName)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const deleteExpiredUsersFromSegments = `-- name: DeleteExpiredUsersFromSegments :execrows
+DELETE FROM users_in_segments
+WHERE (user_id, segment_name) IN (
+		SELECT user_id,
+			segment_name
+		FROM users_in_segments
+		WHERE expire_at <= now()
+		LIMIT $1 FOR UPDATE SKIP LOCKED
+	)
+`
+
+func (q *Queries) DeleteExpiredUsersFromSegments(ctx context.Context, batchSize int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteExpiredUsersFromSegments, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const startScheduledUsersInSegments = `-- name: StartScheduledUsersInSegments :execrows
+UPDATE users_in_segments
+SET started = TRUE
+WHERE (user_id, segment_name) IN (
+		SELECT user_id,
+			segment_name
+		FROM users_in_segments
+		WHERE NOT started
+			AND starts_at <= $1
+		LIMIT $2 FOR UPDATE SKIP LOCKED
+	)
+`
+
+func (q *Queries) StartScheduledUsersInSegments(ctx context.Context, arg models.StartScheduledUsersInSegmentsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, startScheduledUsersInSegments, arg.Now, arg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getSegmentsByUserId = `-- name: GetSegmentsByUserId :many
 SELECT segment_name 
 FROM users_in_segments
@@ -85,7 +321,8 @@ WHERE user_id = $1 AND
 CASE WHEN expire_at IS NOT NULL
 THEN expire_at > now()
 ELSE TRUE
-END
+END AND
+(starts_at IS NULL OR starts_at <= now())
 `
 
 func (q *Queries) GetSegmentsByUserId(ctx context.Context, userID int64) ([]string, error) {
@@ -122,3 +359,78 @@ func (q *Queries) RemoveUserFromSegment(ctx context.Context, arg models.RemoveUs
 	_, err := q.db.ExecContext(ctx, removeUserFromSegment, arg.UserID, arg.SegmentName)
 	return err
 }
+
+const removeUsersBatchFromSegment = `-- name: RemoveUsersBatchFromSegment :execrows
+DELETE FROM users_in_segments
+WHERE (user_id, segment_name) IN (
+		SELECT user_id,
+			segment_name
+		FROM users_in_segments
+		WHERE segment_name = $1
+		LIMIT $2 FOR UPDATE SKIP LOCKED
+	)
+`
+
+func (q *Queries) RemoveUsersBatchFromSegment(ctx context.Context, arg models.RemoveUsersBatchFromSegmentParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, removeUsersBatchFromSegment, arg.SegmentName, arg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const listUsersInSegment = `-- name: ListUsersInSegment :many
+SELECT user_id, segment_name, created_at, updated_at, expire_at, starts_at, started
+FROM users_in_segments
+WHERE segment_name = $1
+	AND user_id > $2
+	AND (
+		$3::boolean
+		OR expire_at IS NULL
+		OR expire_at > now()
+	)
+	AND (
+		$4::boolean
+		OR starts_at IS NULL
+		OR starts_at <= now()
+	)
+ORDER BY user_id
+LIMIT $5::integer
+`
+
+func (q *Queries) ListUsersInSegment(ctx context.Context, arg models.ListUsersInSegmentParams) ([]models.UsersInSegment, error) {
+	rows, err := q.db.QueryContext(ctx, listUsersInSegment,
+		arg.SegmentName,
+		arg.AfterUserID,
+		arg.IncludeExpired,
+		arg.IncludePending,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []models.UsersInSegment
+	for rows.Next() {
+		var i models.UsersInSegment
+		if err := rows.Scan(
+			&i.UserID,
+			&i.SegmentName,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.ExpireAt,
+			&i.StartsAt,
+			&i.Started,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
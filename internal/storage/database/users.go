@@ -7,31 +7,70 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/AlexZahvatkin/segments-users-service/internal/models"
 )
 
 const addUser = `-- name: AddUser :one
-INSERT INTO users(name, created_at, updated_at) 
-VALUES ($1, now(), now())
-RETURNING id, created_at, updated_at, name
+INSERT INTO users(name, external_id, created_at, updated_at) 
+VALUES ($1, $2, now(), now())
+RETURNING id, created_at, updated_at, name, external_id, deleted_at
 `
 
-func (q *Queries) AddUser(ctx context.Context, name string) (models.User, error) {
-	row := q.db.QueryRowContext(ctx, addUser, name)
+func (q *Queries) AddUser(ctx context.Context, arg models.AddUserParams) (models.User, error) {
+	row := q.db.QueryRowContext(ctx, addUser, arg.Name, arg.ExternalID)
 	var i models.User
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Name,
+		&i.ExternalID,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
+const addUserIfNotExists = `-- name: AddUserIfNotExists :one
+INSERT INTO users(name, external_id, created_at, updated_at)
+VALUES ($1, $2, now(), now()) ON CONFLICT (external_id) DO NOTHING
+RETURNING id, created_at, updated_at, name, external_id, deleted_at
+`
+
+func (q *Queries) AddUserIfNotExists(ctx context.Context, arg models.AddUserIfNotExistsParams) (models.User, error) {
+	row := q.db.QueryRowContext(ctx, addUserIfNotExists, arg.Name, arg.ExternalID)
+	var i models.User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.ExternalID,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const countUsers = `-- name: CountUsers :one
+SELECT count(*)
+FROM users
+WHERE deleted_at IS NULL
+`
+
+func (q *Queries) CountUsers(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUsers)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const deleteUser = `-- name: DeleteUser :exec
-DELETE FROM users 
+UPDATE users
+SET deleted_at = now(),
+	updated_at = now()
 WHERE id = $1
+	AND deleted_at IS NULL
 `
 
 func (q *Queries) DeleteUser(ctx context.Context, id int64) error {
@@ -39,9 +78,49 @@ func (q *Queries) DeleteUser(ctx context.Context, id int64) error {
 	return err
 }
 
+const restoreUser = `-- name: RestoreUser :one
+UPDATE users
+SET deleted_at = null,
+	updated_at = now()
+WHERE (
+		id = $1
+		OR external_id = $2
+	)
+	AND deleted_at > $3
+RETURNING id, created_at, updated_at, name, external_id, deleted_at
+`
+
+func (q *Queries) RestoreUser(ctx context.Context, arg models.RestoreUserParams) (models.User, error) {
+	row := q.db.QueryRowContext(ctx, restoreUser, arg.ID, arg.ExternalID, arg.DeletedAfter)
+	var i models.User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.ExternalID,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const purgeDeletedUsers = `-- name: PurgeDeletedUsers :execrows
+DELETE FROM users
+WHERE deleted_at <= $1
+`
+
+func (q *Queries) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedUsers, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getAllUsersId = `-- name: GetAllUsersId :many
 SELECT id
 FROM users
+WHERE deleted_at IS NULL
 `
 
 func (q *Queries) GetAllUsersId(ctx context.Context) ([]int64, error) {
@@ -67,10 +146,32 @@ func (q *Queries) GetAllUsersId(ctx context.Context) ([]int64, error) {
 	return items, nil
 }
 
+const getUserByExternalId = `-- name: GetUserByExternalId :one
+SELECT id, created_at, updated_at, name, external_id, deleted_at
+FROM users
+WHERE external_id = $1
+	AND deleted_at IS NULL
+`
+
+func (q *Queries) GetUserByExternalId(ctx context.Context, externalID string) (models.User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByExternalId, externalID)
+	var i models.User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.ExternalID,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
 const getUserById = `-- name: GetUserById :one
-SELECT id, created_at, updated_at, name
+SELECT id, created_at, updated_at, name, external_id, deleted_at
 FROM users
 WHERE id = $1
+	AND deleted_at IS NULL
 `
 
 func (q *Queries) GetUserById(ctx context.Context, id int64) (models.User, error) {
@@ -81,6 +182,77 @@ func (q *Queries) GetUserById(ctx context.Context, id int64) (models.User, error
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Name,
+		&i.ExternalID,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const listUsers = `-- name: ListUsers :many
+SELECT id, created_at, updated_at, name, external_id, deleted_at
+FROM users
+WHERE deleted_at IS NULL
+	AND id > $1
+	AND (
+		$2::text = ''
+		OR strpos(lower(name), lower($2::text)) > 0
+	)
+ORDER BY id
+LIMIT $3::integer
+`
+
+func (q *Queries) ListUsers(ctx context.Context, arg models.ListUsersParams) ([]models.User, error) {
+	rows, err := q.db.QueryContext(ctx, listUsers, arg.AfterID, arg.NameQuery, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []models.User
+	for rows.Next() {
+		var i models.User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.ExternalID,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateUser = `-- name: UpdateUser :one
+UPDATE users
+SET name = COALESCE($1, name),
+	external_id = CASE
+		WHEN $2::varchar IS NULL THEN external_id
+		ELSE NULLIF($2::varchar, '')
+	END
+WHERE id = $3
+	AND deleted_at IS NULL
+RETURNING id, created_at, updated_at, name, external_id, deleted_at
+`
+
+func (q *Queries) UpdateUser(ctx context.Context, arg models.UpdateUserParams) (models.User, error) {
+	row := q.db.QueryRowContext(ctx, updateUser, arg.Name, arg.ExternalID, arg.ID)
+	var i models.User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.ExternalID,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -0,0 +1,16 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+const uniqueViolation = "23505"
+
+// IsUniqueViolation reports whether err was caused by a unique constraint,
+// e.g. when a user with the same external id already exists.
+func IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
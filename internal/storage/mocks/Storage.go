@@ -0,0 +1,1410 @@
+// Code generated by mockery v2.33.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+	sql "database/sql"
+	time "time"
+
+	models "github.com/AlexZahvatkin/segments-users-service/internal/models"
+	storage "github.com/AlexZahvatkin/segments-users-service/internal/storage"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// Storage is an autogenerated mock type for the Storage type
+type Storage struct {
+	mock.Mock
+}
+
+// AddSegment provides a mock function with given fields: ctx, arg
+func (_m *Storage) AddSegment(ctx context.Context, arg models.AddSegmentParams) (models.Segment, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 models.Segment
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.AddSegmentParams) (models.Segment, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.AddSegmentParams) models.Segment); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(models.Segment)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.AddSegmentParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AddUser provides a mock function with given fields: ctx, arg
+func (_m *Storage) AddUser(ctx context.Context, arg models.AddUserParams) (models.User, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 models.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.AddUserParams) (models.User, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.AddUserParams) models.User); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(models.User)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.AddUserParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AddUserIfNotExists provides a mock function with given fields: ctx, arg
+func (_m *Storage) AddUserIfNotExists(ctx context.Context, arg models.AddUserIfNotExistsParams) (models.User, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 models.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.AddUserIfNotExistsParams) (models.User, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.AddUserIfNotExistsParams) models.User); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(models.User)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.AddUserIfNotExistsParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AddUserIntoRolloutSegments provides a mock function with given fields: ctx, userID
+func (_m *Storage) AddUserIntoRolloutSegments(ctx context.Context, userID int64) ([]models.UsersInSegment, error) {
+	ret := _m.Called(ctx, userID)
+
+	var r0 []models.UsersInSegment
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) ([]models.UsersInSegment, error)); ok {
+		return rf(ctx, userID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) []models.UsersInSegment); ok {
+		r0 = rf(ctx, userID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.UsersInSegment)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AddUserIntoSegment provides a mock function with given fields: ctx, arg
+func (_m *Storage) AddUserIntoSegment(ctx context.Context, arg models.AddUserIntoSegmentParams) (models.UsersInSegment, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 models.UsersInSegment
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.AddUserIntoSegmentParams) (models.UsersInSegment, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.AddUserIntoSegmentParams) models.UsersInSegment); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(models.UsersInSegment)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.AddUserIntoSegmentParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AddUserIntoSegmentWithExpireDatetime provides a mock function with given fields: ctx, arg
+func (_m *Storage) AddUserIntoSegmentWithExpireDatetime(ctx context.Context, arg models.AddUserIntoSegmentWithExpireDatetimeParams) (models.UsersInSegment, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 models.UsersInSegment
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.AddUserIntoSegmentWithExpireDatetimeParams) (models.UsersInSegment, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.AddUserIntoSegmentWithExpireDatetimeParams) models.UsersInSegment); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(models.UsersInSegment)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.AddUserIntoSegmentWithExpireDatetimeParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AddUserIntoSegmentWithTTLInHours provides a mock function with given fields: ctx, arg
+func (_m *Storage) AddUserIntoSegmentWithTTLInHours(ctx context.Context, arg models.AddUserIntoSegmentWithTTLInHoursParams) (models.UsersInSegment, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 models.UsersInSegment
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.AddUserIntoSegmentWithTTLInHoursParams) (models.UsersInSegment, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.AddUserIntoSegmentWithTTLInHoursParams) models.UsersInSegment); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(models.UsersInSegment)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.AddUserIntoSegmentWithTTLInHoursParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AddUsersBatchIntoRolloutSegment provides a mock function with given fields: ctx, arg
+func (_m *Storage) AddUsersBatchIntoRolloutSegment(ctx context.Context, arg models.AddUsersBatchIntoRolloutSegmentParams) (models.AddUsersBatchIntoRolloutSegmentRow, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 models.AddUsersBatchIntoRolloutSegmentRow
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.AddUsersBatchIntoRolloutSegmentParams) (models.AddUsersBatchIntoRolloutSegmentRow, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.AddUsersBatchIntoRolloutSegmentParams) models.AddUsersBatchIntoRolloutSegmentRow); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(models.AddUsersBatchIntoRolloutSegmentRow)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.AddUsersBatchIntoRolloutSegmentParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AddUsersIntoSegmentBatch provides a mock function with given fields: ctx, arg
+func (_m *Storage) AddUsersIntoSegmentBatch(ctx context.Context, arg models.AddUsersIntoSegmentBatchParams) ([]models.AddUsersIntoSegmentBatchRow, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 []models.AddUsersIntoSegmentBatchRow
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.AddUsersIntoSegmentBatchParams) ([]models.AddUsersIntoSegmentBatchRow, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.AddUsersIntoSegmentBatchParams) []models.AddUsersIntoSegmentBatchRow); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.AddUsersIntoSegmentBatchRow)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.AddUsersIntoSegmentBatchParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CancelJob provides a mock function with given fields: ctx, id
+func (_m *Storage) CancelJob(ctx context.Context, id int64) (models.Job, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 models.Job
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) (models.Job, error)); ok {
+		return rf(ctx, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) models.Job); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Get(0).(models.Job)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ClaimNextJob provides a mock function with given fields: ctx
+func (_m *Storage) ClaimNextJob(ctx context.Context) (models.Job, error) {
+	ret := _m.Called(ctx)
+
+	var r0 models.Job
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) (models.Job, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) models.Job); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(models.Job)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CountUsers provides a mock function with given fields: ctx
+func (_m *Storage) CountUsers(ctx context.Context) (int64, error) {
+	ret := _m.Called(ctx)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) (int64, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) int64); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CountUsersInSegment provides a mock function with given fields: ctx, segmentName
+func (_m *Storage) CountUsersInSegment(ctx context.Context, segmentName string) (int64, error) {
+	ret := _m.Called(ctx, segmentName)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (int64, error)); ok {
+		return rf(ctx, segmentName)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) int64); ok {
+		r0 = rf(ctx, segmentName)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, segmentName)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateHistoryArchive provides a mock function with given fields: ctx, arg
+func (_m *Storage) CreateHistoryArchive(ctx context.Context, arg models.CreateHistoryArchiveParams) (models.HistoryArchive, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 models.HistoryArchive
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.CreateHistoryArchiveParams) (models.HistoryArchive, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.CreateHistoryArchiveParams) models.HistoryArchive); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(models.HistoryArchive)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.CreateHistoryArchiveParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateHistoryPartitions provides a mock function with given fields: ctx, arg
+func (_m *Storage) CreateHistoryPartitions(ctx context.Context, arg models.CreateHistoryPartitionsParams) (int32, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 int32
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.CreateHistoryPartitionsParams) (int32, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.CreateHistoryPartitionsParams) int32); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(int32)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.CreateHistoryPartitionsParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateJob provides a mock function with given fields: ctx, arg
+func (_m *Storage) CreateJob(ctx context.Context, arg models.CreateJobParams) (models.Job, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 models.Job
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.CreateJobParams) (models.Job, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.CreateJobParams) models.Job); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(models.Job)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.CreateJobParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateReport provides a mock function with given fields: ctx, arg
+func (_m *Storage) CreateReport(ctx context.Context, arg models.CreateReportParams) (models.Report, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 models.Report
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.CreateReportParams) (models.Report, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.CreateReportParams) models.Report); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(models.Report)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.CreateReportParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteExpiredUsersFromSegments provides a mock function with given fields: ctx, batchSize
+func (_m *Storage) DeleteExpiredUsersFromSegments(ctx context.Context, batchSize int32) (int64, error) {
+	ret := _m.Called(ctx, batchSize)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int32) (int64, error)); ok {
+		return rf(ctx, batchSize)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int32) int64); ok {
+		r0 = rf(ctx, batchSize)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int32) error); ok {
+		r1 = rf(ctx, batchSize)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteReport provides a mock function with given fields: ctx, jobID
+func (_m *Storage) DeleteReport(ctx context.Context, jobID int64) error {
+	ret := _m.Called(ctx, jobID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) error); ok {
+		r0 = rf(ctx, jobID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteSegment provides a mock function with given fields: ctx, name
+func (_m *Storage) DeleteSegment(ctx context.Context, name string) error {
+	ret := _m.Called(ctx, name)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, name)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteUser provides a mock function with given fields: ctx, id
+func (_m *Storage) DeleteUser(ctx context.Context, id int64) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DropHistoryPartition provides a mock function with given fields: ctx, month
+func (_m *Storage) DropHistoryPartition(ctx context.Context, month time.Time) (bool, error) {
+	ret := _m.Called(ctx, month)
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) (bool, error)); ok {
+		return rf(ctx, month)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) bool); ok {
+		r0 = rf(ctx, month)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time) error); ok {
+		r1 = rf(ctx, month)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ExecTx provides a mock function with given fields: ctx, fn
+func (_m *Storage) ExecTx(ctx context.Context, fn func(storage.Querier) error) error {
+	ret := _m.Called(ctx, fn)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, func(storage.Querier) error) error); ok {
+		r0 = rf(ctx, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// FinishJob provides a mock function with given fields: ctx, arg
+func (_m *Storage) FinishJob(ctx context.Context, arg models.FinishJobParams) error {
+	ret := _m.Called(ctx, arg)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.FinishJobParams) error); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetAllUsersId provides a mock function with given fields: ctx
+func (_m *Storage) GetAllUsersId(ctx context.Context) ([]int64, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) ([]int64, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) []int64); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]int64)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetHistoryArchivedBefore provides a mock function with given fields: ctx
+func (_m *Storage) GetHistoryArchivedBefore(ctx context.Context) (sql.NullTime, error) {
+	ret := _m.Called(ctx)
+
+	var r0 sql.NullTime
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) (sql.NullTime, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) sql.NullTime); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(sql.NullTime)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetJobById provides a mock function with given fields: ctx, id
+func (_m *Storage) GetJobById(ctx context.Context, id int64) (models.Job, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 models.Job
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) (models.Job, error)); ok {
+		return rf(ctx, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) models.Job); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Get(0).(models.Job)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetLastSegmentsActionsByUserId provides a mock function with given fields: ctx, arg
+func (_m *Storage) GetLastSegmentsActionsByUserId(ctx context.Context, arg models.GetLastSegmentsActionsByUserIdParams) ([]models.UsersInSegmentsHistory, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 []models.UsersInSegmentsHistory
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.GetLastSegmentsActionsByUserIdParams) ([]models.UsersInSegmentsHistory, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.GetLastSegmentsActionsByUserIdParams) []models.UsersInSegmentsHistory); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.UsersInSegmentsHistory)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.GetLastSegmentsActionsByUserIdParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetReportByJobId provides a mock function with given fields: ctx, jobID
+func (_m *Storage) GetReportByJobId(ctx context.Context, jobID int64) (models.Report, error) {
+	ret := _m.Called(ctx, jobID)
+
+	var r0 models.Report
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) (models.Report, error)); ok {
+		return rf(ctx, jobID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) models.Report); ok {
+		r0 = rf(ctx, jobID)
+	} else {
+		r0 = ret.Get(0).(models.Report)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, jobID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSegmentByName provides a mock function with given fields: ctx, name
+func (_m *Storage) GetSegmentByName(ctx context.Context, name string) (models.Segment, error) {
+	ret := _m.Called(ctx, name)
+
+	var r0 models.Segment
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (models.Segment, error)); ok {
+		return rf(ctx, name)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) models.Segment); ok {
+		r0 = rf(ctx, name)
+	} else {
+		r0 = ret.Get(0).(models.Segment)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSegmentDailyStats provides a mock function with given fields: ctx, arg
+func (_m *Storage) GetSegmentDailyStats(ctx context.Context, arg models.GetSegmentDailyStatsParams) ([]models.GetSegmentDailyStatsRow, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 []models.GetSegmentDailyStatsRow
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.GetSegmentDailyStatsParams) ([]models.GetSegmentDailyStatsRow, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.GetSegmentDailyStatsParams) []models.GetSegmentDailyStatsRow); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.GetSegmentDailyStatsRow)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.GetSegmentDailyStatsParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSegmentMembershipCounts provides a mock function with given fields: ctx, arg
+func (_m *Storage) GetSegmentMembershipCounts(ctx context.Context, arg models.GetSegmentMembershipCountsParams) (models.GetSegmentMembershipCountsRow, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 models.GetSegmentMembershipCountsRow
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.GetSegmentMembershipCountsParams) (models.GetSegmentMembershipCountsRow, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.GetSegmentMembershipCountsParams) models.GetSegmentMembershipCountsRow); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(models.GetSegmentMembershipCountsRow)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.GetSegmentMembershipCountsParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSegmentStatsState provides a mock function with given fields: ctx
+func (_m *Storage) GetSegmentStatsState(ctx context.Context) (int64, error) {
+	ret := _m.Called(ctx)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) (int64, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) int64); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSegmentWithMembersCount provides a mock function with given fields: ctx, name
+func (_m *Storage) GetSegmentWithMembersCount(ctx context.Context, name string) (models.GetSegmentWithMembersCountRow, error) {
+	ret := _m.Called(ctx, name)
+
+	var r0 models.GetSegmentWithMembersCountRow
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (models.GetSegmentWithMembersCountRow, error)); ok {
+		return rf(ctx, name)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) models.GetSegmentWithMembersCountRow); ok {
+		r0 = rf(ctx, name)
+	} else {
+		r0 = ret.Get(0).(models.GetSegmentWithMembersCountRow)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSegmentsByUserId provides a mock function with given fields: ctx, userID
+func (_m *Storage) GetSegmentsByUserId(ctx context.Context, userID int64) ([]string, error) {
+	ret := _m.Called(ctx, userID)
+
+	var r0 []string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) ([]string, error)); ok {
+		return rf(ctx, userID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) []string); ok {
+		r0 = rf(ctx, userID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSegmentsHistoryByUserId provides a mock function with given fields: ctx, arg
+func (_m *Storage) GetSegmentsHistoryByUserId(ctx context.Context, arg models.GetSegmentsHistoryByUserIdParams) ([]models.UsersInSegmentsHistory, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 []models.UsersInSegmentsHistory
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.GetSegmentsHistoryByUserIdParams) ([]models.UsersInSegmentsHistory, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.GetSegmentsHistoryByUserIdParams) []models.UsersInSegmentsHistory); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.UsersInSegmentsHistory)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.GetSegmentsHistoryByUserIdParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserByExternalId provides a mock function with given fields: ctx, externalID
+func (_m *Storage) GetUserByExternalId(ctx context.Context, externalID string) (models.User, error) {
+	ret := _m.Called(ctx, externalID)
+
+	var r0 models.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (models.User, error)); ok {
+		return rf(ctx, externalID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) models.User); ok {
+		r0 = rf(ctx, externalID)
+	} else {
+		r0 = ret.Get(0).(models.User)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, externalID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserById provides a mock function with given fields: ctx, id
+func (_m *Storage) GetUserById(ctx context.Context, id int64) (models.User, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 models.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) (models.User, error)); ok {
+		return rf(ctx, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) models.User); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Get(0).(models.User)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ImportUsers provides a mock function with given fields: ctx, src, dryRun
+func (_m *Storage) ImportUsers(ctx context.Context, src storage.ImportSource, dryRun bool) (models.ImportUsersResult, error) {
+	ret := _m.Called(ctx, src, dryRun)
+
+	var r0 models.ImportUsersResult
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, storage.ImportSource, bool) (models.ImportUsersResult, error)); ok {
+		return rf(ctx, src, dryRun)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, storage.ImportSource, bool) models.ImportUsersResult); ok {
+		r0 = rf(ctx, src, dryRun)
+	} else {
+		r0 = ret.Get(0).(models.ImportUsersResult)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, storage.ImportSource, bool) error); ok {
+		r1 = rf(ctx, src, dryRun)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListExpiredReports provides a mock function with given fields: ctx, arg
+func (_m *Storage) ListExpiredReports(ctx context.Context, arg models.ListExpiredReportsParams) ([]models.Report, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 []models.Report
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.ListExpiredReportsParams) ([]models.Report, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.ListExpiredReportsParams) []models.Report); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Report)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.ListExpiredReportsParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListHistoryPartitions provides a mock function with given fields: ctx, before
+func (_m *Storage) ListHistoryPartitions(ctx context.Context, before time.Time) ([]models.ListHistoryPartitionsRow, error) {
+	ret := _m.Called(ctx, before)
+
+	var r0 []models.ListHistoryPartitionsRow
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) ([]models.ListHistoryPartitionsRow, error)); ok {
+		return rf(ctx, before)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) []models.ListHistoryPartitionsRow); ok {
+		r0 = rf(ctx, before)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.ListHistoryPartitionsRow)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time) error); ok {
+		r1 = rf(ctx, before)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListSegments provides a mock function with given fields: ctx, arg
+func (_m *Storage) ListSegments(ctx context.Context, arg models.ListSegmentsParams) ([]models.ListSegmentsRow, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 []models.ListSegmentsRow
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.ListSegmentsParams) ([]models.ListSegmentsRow, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.ListSegmentsParams) []models.ListSegmentsRow); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.ListSegmentsRow)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.ListSegmentsParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListUsers provides a mock function with given fields: ctx, arg
+func (_m *Storage) ListUsers(ctx context.Context, arg models.ListUsersParams) ([]models.User, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 []models.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.ListUsersParams) ([]models.User, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.ListUsersParams) []models.User); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.User)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.ListUsersParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListUsersInSegment provides a mock function with given fields: ctx, arg
+func (_m *Storage) ListUsersInSegment(ctx context.Context, arg models.ListUsersInSegmentParams) ([]models.UsersInSegment, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 []models.UsersInSegment
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.ListUsersInSegmentParams) ([]models.UsersInSegment, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.ListUsersInSegmentParams) []models.UsersInSegment); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.UsersInSegment)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.ListUsersInSegmentParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PurgeDeletedSegments provides a mock function with given fields: ctx, deletedBefore
+func (_m *Storage) PurgeDeletedSegments(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	ret := _m.Called(ctx, deletedBefore)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) (int64, error)); ok {
+		return rf(ctx, deletedBefore)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) int64); ok {
+		r0 = rf(ctx, deletedBefore)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time) error); ok {
+		r1 = rf(ctx, deletedBefore)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PurgeDeletedUsers provides a mock function with given fields: ctx, deletedBefore
+func (_m *Storage) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	ret := _m.Called(ctx, deletedBefore)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) (int64, error)); ok {
+		return rf(ctx, deletedBefore)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) int64); ok {
+		r0 = rf(ctx, deletedBefore)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time) error); ok {
+		r1 = rf(ctx, deletedBefore)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RemoveUserFromSegment provides a mock function with given fields: ctx, arg
+func (_m *Storage) RemoveUserFromSegment(ctx context.Context, arg models.RemoveUserFromSegmentParams) error {
+	ret := _m.Called(ctx, arg)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.RemoveUserFromSegmentParams) error); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RemoveUsersBatchFromSegment provides a mock function with given fields: ctx, arg
+func (_m *Storage) RemoveUsersBatchFromSegment(ctx context.Context, arg models.RemoveUsersBatchFromSegmentParams) (int64, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.RemoveUsersBatchFromSegmentParams) (int64, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.RemoveUsersBatchFromSegmentParams) int64); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.RemoveUsersBatchFromSegmentParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ReportSegmentsHistory provides a mock function with given fields: ctx, arg, fn
+func (_m *Storage) ReportSegmentsHistory(ctx context.Context, arg models.HistoryReportParams, fn func(models.UsersInSegmentsHistory) error) error {
+	ret := _m.Called(ctx, arg, fn)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.HistoryReportParams, func(models.UsersInSegmentsHistory) error) error); ok {
+		r0 = rf(ctx, arg, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RequeueJob provides a mock function with given fields: ctx, id
+func (_m *Storage) RequeueJob(ctx context.Context, id int64) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RequeueStaleJobs provides a mock function with given fields: ctx, arg
+func (_m *Storage) RequeueStaleJobs(ctx context.Context, arg models.RequeueStaleJobsParams) (int64, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.RequeueStaleJobsParams) (int64, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.RequeueStaleJobsParams) int64); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.RequeueStaleJobsParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RestoreSegment provides a mock function with given fields: ctx, arg
+func (_m *Storage) RestoreSegment(ctx context.Context, arg models.RestoreSegmentParams) (models.Segment, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 models.Segment
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.RestoreSegmentParams) (models.Segment, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.RestoreSegmentParams) models.Segment); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(models.Segment)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.RestoreSegmentParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RestoreUser provides a mock function with given fields: ctx, arg
+func (_m *Storage) RestoreUser(ctx context.Context, arg models.RestoreUserParams) (models.User, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 models.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.RestoreUserParams) (models.User, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.RestoreUserParams) models.User); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(models.User)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.RestoreUserParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RollupSegmentStats provides a mock function with given fields: ctx, arg
+func (_m *Storage) RollupSegmentStats(ctx context.Context, arg models.RollupSegmentStatsParams) (models.RollupSegmentStatsRow, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 models.RollupSegmentStatsRow
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.RollupSegmentStatsParams) (models.RollupSegmentStatsRow, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.RollupSegmentStatsParams) models.RollupSegmentStatsRow); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(models.RollupSegmentStatsRow)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.RollupSegmentStatsParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetHistoryAction provides a mock function with given fields: ctx, actionType
+func (_m *Storage) SetHistoryAction(ctx context.Context, actionType string) error {
+	ret := _m.Called(ctx, actionType)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, actionType)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetHistoryAudit provides a mock function with given fields: ctx, arg
+func (_m *Storage) SetHistoryAudit(ctx context.Context, arg models.SetHistoryAuditParams) error {
+	ret := _m.Called(ctx, arg)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.SetHistoryAuditParams) error); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetSegmentStatsState provides a mock function with given fields: ctx, lastHistoryID
+func (_m *Storage) SetSegmentStatsState(ctx context.Context, lastHistoryID int64) error {
+	ret := _m.Called(ctx, lastHistoryID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) error); ok {
+		r0 = rf(ctx, lastHistoryID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// StartScheduledUsersInSegments provides a mock function with given fields: ctx, arg
+func (_m *Storage) StartScheduledUsersInSegments(ctx context.Context, arg models.StartScheduledUsersInSegmentsParams) (int64, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.StartScheduledUsersInSegmentsParams) (int64, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.StartScheduledUsersInSegmentsParams) int64); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.StartScheduledUsersInSegmentsParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateJobProgress provides a mock function with given fields: ctx, arg
+func (_m *Storage) UpdateJobProgress(ctx context.Context, arg models.UpdateJobProgressParams) (string, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.UpdateJobProgressParams) (string, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.UpdateJobProgressParams) string); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.UpdateJobProgressParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateSegment provides a mock function with given fields: ctx, arg
+func (_m *Storage) UpdateSegment(ctx context.Context, arg models.UpdateSegmentParams) (models.Segment, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 models.Segment
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.UpdateSegmentParams) (models.Segment, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.UpdateSegmentParams) models.Segment); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(models.Segment)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.UpdateSegmentParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateUser provides a mock function with given fields: ctx, arg
+func (_m *Storage) UpdateUser(ctx context.Context, arg models.UpdateUserParams) (models.User, error) {
+	ret := _m.Called(ctx, arg)
+
+	var r0 models.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.UpdateUserParams) (models.User, error)); ok {
+		return rf(ctx, arg)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.UpdateUserParams) models.User); ok {
+		r0 = rf(ctx, arg)
+	} else {
+		r0 = ret.Get(0).(models.User)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.UpdateUserParams) error); ok {
+		r1 = rf(ctx, arg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewStorage creates a new instance of Storage. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewStorage(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *Storage {
+	mock := &Storage{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,54 @@
+// Code generated by mockery v2.33.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	models "github.com/AlexZahvatkin/segments-users-service/internal/models"
+	storage "github.com/AlexZahvatkin/segments-users-service/internal/storage"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// UserImporter is an autogenerated mock type for the UserImporter type
+type UserImporter struct {
+	mock.Mock
+}
+
+// ImportUsers provides a mock function with given fields: ctx, src, dryRun
+func (_m *UserImporter) ImportUsers(ctx context.Context, src storage.ImportSource, dryRun bool) (models.ImportUsersResult, error) {
+	ret := _m.Called(ctx, src, dryRun)
+
+	var r0 models.ImportUsersResult
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, storage.ImportSource, bool) (models.ImportUsersResult, error)); ok {
+		return rf(ctx, src, dryRun)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, storage.ImportSource, bool) models.ImportUsersResult); ok {
+		r0 = rf(ctx, src, dryRun)
+	} else {
+		r0 = ret.Get(0).(models.ImportUsersResult)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, storage.ImportSource, bool) error); ok {
+		r1 = rf(ctx, src, dryRun)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewUserImporter creates a new instance of UserImporter. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewUserImporter(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *UserImporter {
+	mock := &UserImporter{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
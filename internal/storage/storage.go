@@ -2,22 +2,129 @@ package storage
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"time"
 
 	"github.com/AlexZahvatkin/segments-users-service/internal/models"
 )
 
-type Storage interface {
-	AddUser(ctx context.Context, name string) (models.User, error)
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=Querier
+type Querier interface {
+	AddUser(ctx context.Context, arg models.AddUserParams) (models.User, error)
+	AddUserIfNotExists(ctx context.Context, arg models.AddUserIfNotExistsParams) (models.User, error)
 	DeleteUser(ctx context.Context, id int64) error
+	RestoreUser(ctx context.Context, arg models.RestoreUserParams) (models.User, error)
+	PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error)
 	GetAllUsersId(ctx context.Context) ([]int64, error)
 	GetUserById(ctx context.Context, id int64) (models.User, error)
+	GetUserByExternalId(ctx context.Context, externalID string) (models.User, error)
+	ListUsers(ctx context.Context, arg models.ListUsersParams) ([]models.User, error)
+	UpdateUser(ctx context.Context, arg models.UpdateUserParams) (models.User, error)
 	AddSegment(ctx context.Context, arg models.AddSegmentParams) (models.Segment, error)
 	DeleteSegment(ctx context.Context, name string) error
+	RestoreSegment(ctx context.Context, arg models.RestoreSegmentParams) (models.Segment, error)
+	PurgeDeletedSegments(ctx context.Context, deletedBefore time.Time) (int64, error)
 	GetSegmentByName(ctx context.Context, name string) (models.Segment, error)
+	GetSegmentWithMembersCount(ctx context.Context, name string) (models.GetSegmentWithMembersCountRow, error)
+	ListSegments(ctx context.Context, arg models.ListSegmentsParams) ([]models.ListSegmentsRow, error)
+	UpdateSegment(ctx context.Context, arg models.UpdateSegmentParams) (models.Segment, error)
 	AddUserIntoSegment(ctx context.Context, arg models.AddUserIntoSegmentParams) (models.UsersInSegment, error)
 	AddUserIntoSegmentWithExpireDatetime(ctx context.Context, arg models.AddUserIntoSegmentWithExpireDatetimeParams) (models.UsersInSegment, error)
 	AddUserIntoSegmentWithTTLInHours(ctx context.Context, arg models.AddUserIntoSegmentWithTTLInHoursParams) (models.UsersInSegment, error)
+	AddUserIntoRolloutSegments(ctx context.Context, userID int64) ([]models.UsersInSegment, error)
 	GetSegmentsByUserId(ctx context.Context, userID int64) ([]string, error)
+	ListUsersInSegment(ctx context.Context, arg models.ListUsersInSegmentParams) ([]models.UsersInSegment, error)
 	RemoveUserFromSegment(ctx context.Context, arg models.RemoveUserFromSegmentParams) error
 	GetSegmentsHistoryByUserId(ctx context.Context, arg models.GetSegmentsHistoryByUserIdParams) ([]models.UsersInSegmentsHistory, error)
+	GetLastSegmentsActionsByUserId(ctx context.Context, arg models.GetLastSegmentsActionsByUserIdParams) ([]models.UsersInSegmentsHistory, error)
+	SetHistoryAction(ctx context.Context, actionType string) error
+	SetHistoryAudit(ctx context.Context, arg models.SetHistoryAuditParams) error
+	DeleteExpiredUsersFromSegments(ctx context.Context, batchSize int32) (int64, error)
+	StartScheduledUsersInSegments(ctx context.Context, arg models.StartScheduledUsersInSegmentsParams) (int64, error)
+	CountUsers(ctx context.Context) (int64, error)
+	AddUsersBatchIntoRolloutSegment(ctx context.Context, arg models.AddUsersBatchIntoRolloutSegmentParams) (models.AddUsersBatchIntoRolloutSegmentRow, error)
+	CreateJob(ctx context.Context, arg models.CreateJobParams) (models.Job, error)
+	GetJobById(ctx context.Context, id int64) (models.Job, error)
+	ClaimNextJob(ctx context.Context) (models.Job, error)
+	UpdateJobProgress(ctx context.Context, arg models.UpdateJobProgressParams) (string, error)
+	FinishJob(ctx context.Context, arg models.FinishJobParams) error
+	RequeueJob(ctx context.Context, id int64) error
+	CancelJob(ctx context.Context, id int64) (models.Job, error)
+	RequeueStaleJobs(ctx context.Context, arg models.RequeueStaleJobsParams) (int64, error)
+	CreateReport(ctx context.Context, arg models.CreateReportParams) (models.Report, error)
+	GetReportByJobId(ctx context.Context, jobID int64) (models.Report, error)
+	ListExpiredReports(ctx context.Context, arg models.ListExpiredReportsParams) ([]models.Report, error)
+	DeleteReport(ctx context.Context, jobID int64) error
+	CreateHistoryPartitions(ctx context.Context, arg models.CreateHistoryPartitionsParams) (int32, error)
+	ListHistoryPartitions(ctx context.Context, before time.Time) ([]models.ListHistoryPartitionsRow, error)
+	DropHistoryPartition(ctx context.Context, month time.Time) (bool, error)
+	CreateHistoryArchive(ctx context.Context, arg models.CreateHistoryArchiveParams) (models.HistoryArchive, error)
+	GetHistoryArchivedBefore(ctx context.Context) (sql.NullTime, error)
+	GetSegmentStatsState(ctx context.Context) (int64, error)
+	SetSegmentStatsState(ctx context.Context, lastHistoryID int64) error
+	RollupSegmentStats(ctx context.Context, arg models.RollupSegmentStatsParams) (models.RollupSegmentStatsRow, error)
+	GetSegmentDailyStats(ctx context.Context, arg models.GetSegmentDailyStatsParams) ([]models.GetSegmentDailyStatsRow, error)
+	GetSegmentMembershipCounts(ctx context.Context, arg models.GetSegmentMembershipCountsParams) (models.GetSegmentMembershipCountsRow, error)
+	CountUsersInSegment(ctx context.Context, segmentName string) (int64, error)
+	RemoveUsersBatchFromSegment(ctx context.Context, arg models.RemoveUsersBatchFromSegmentParams) (int64, error)
+	AddUsersIntoSegmentBatch(ctx context.Context, arg models.AddUsersIntoSegmentBatchParams) ([]models.AddUsersIntoSegmentBatchRow, error)
+}
+
+// Transactor runs a unit of work in a single database transaction.
+// If fn returns an error, every change made through the provided Querier is rolled back.
+// The audit attached to ctx, if any, is recorded in the history of every membership change of the transaction.
+//
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=Transactor
+type Transactor interface {
+	ExecTx(ctx context.Context, fn func(Querier) error) error
+}
+
+// ImportSource yields the valid rows of an import file one by one and io.EOF after the last one.
+// Invalid rows are skipped and reported by Errors.
+type ImportSource interface {
+	Next() (models.ImportUser, error)
+	Errors() []models.ImportError
+}
+
+// UserImporter bulk loads users with their initial segments. The import is all or nothing:
+// if the source or the database check reports any error, nothing is written.
+//
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=UserImporter
+type UserImporter interface {
+	ImportUsers(ctx context.Context, src ImportSource, dryRun bool) (models.ImportUsersResult, error)
+}
+
+// HistoryReporter reads the history of all users through a database cursor and passes it to fn
+// record by record, ordered by action date, so a report of any size is never loaded into memory.
+// If fn returns an error, reading stops and the error is returned.
+//
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=HistoryReporter
+type HistoryReporter interface {
+	ReportSegmentsHistory(ctx context.Context, arg models.HistoryReportParams, fn func(models.UsersInSegmentsHistory) error) error
+}
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore keeps report files. Keys are slash separated relative paths such as reports/42/history_2023-09.csv.gz.
+// The local filesystem implementation is in storage/blob, an S3-compatible store fits the same interface.
+//
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=BlobStore
+type BlobStore interface {
+	// Put stores everything read from r under key, replacing the previous blob, and returns its size.
+	// A failed Put leaves no partial blob behind.
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	// Get opens the blob stored under key or returns ErrBlobNotFound.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob stored under key. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.33.0 --name=Storage
+type Storage interface {
+	Querier
+	Transactor
+	UserImporter
+	HistoryReporter
 }
@@ -2,6 +2,7 @@ package usecases_segments
 
 import (
 	"strings"
+	"unicode"
 )
 
 func FormatSegmnetName(segmentName string) string {
@@ -9,3 +10,9 @@ func FormatSegmnetName(segmentName string) string {
 	formated = strings.Replace(formated, " ", "_", -1)
 	return formated
 }
+
+// IsNumericSegmentName reports whether a segment name consists of digits only.
+// Such a segment could not be told apart from a user id in /v1/segments/{userId}.
+func IsNumericSegmentName(segmentName string) bool {
+	return segmentName != "" && strings.IndexFunc(segmentName, func(r rune) bool { return !unicode.IsDigit(r) }) == -1
+}
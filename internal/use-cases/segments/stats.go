@@ -0,0 +1,72 @@
+package usecases_segments
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+)
+
+const (
+	StatsDateFormat       = "2006-01-02"
+	DefaultStatsDays      = 30
+	MaxStatsDays          = 366
+	DefaultExpiringWithin = 24 * time.Hour
+)
+
+// DailyStats is how many memberships of a segment were added, removed and expired during a day.
+type DailyStats struct {
+	Date    string `json:"date"`
+	Added   int64  `json:"added"`
+	Removed int64  `json:"removed"`
+	Expired int64  `json:"expired"`
+}
+
+// StatsPeriod turns the inclusive range of days from-to into [fromDay, toDay) of UTC midnights.
+// Missing bounds default to the last DefaultStatsDays days up to today.
+func StatsPeriod(from, to string, now time.Time) (fromDay time.Time, toDay time.Time, err error) {
+	last := now.UTC().Truncate(24 * time.Hour)
+	if to != "" {
+		if last, err = time.Parse(StatsDateFormat, to); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("wrong date format of to: %w", err)
+		}
+	}
+
+	fromDay = last.AddDate(0, 0, -(DefaultStatsDays - 1))
+	if from != "" {
+		if fromDay, err = time.Parse(StatsDateFormat, from); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("wrong date format of from: %w", err)
+		}
+	}
+
+	toDay = last.AddDate(0, 0, 1)
+	if !fromDay.Before(toDay) {
+		return time.Time{}, time.Time{}, errors.New("from must not be after to")
+	}
+	if toDay.Sub(fromDay) > MaxStatsDays*24*time.Hour {
+		return time.Time{}, time.Time{}, fmt.Errorf("period must not be longer than %d days", MaxStatsDays)
+	}
+	return fromDay, toDay, nil
+}
+
+// FillDailyStats returns an entry for every day of [fromDay, toDay), with zeros for days without changes.
+func FillDailyStats(fromDay, toDay time.Time, rows []models.GetSegmentDailyStatsRow) []DailyStats {
+	byDay := make(map[string]models.GetSegmentDailyStatsRow, len(rows))
+	for _, row := range rows {
+		byDay[row.Day.Format(StatsDateFormat)] = row
+	}
+
+	var days []DailyStats
+	for day := fromDay; day.Before(toDay); day = day.AddDate(0, 0, 1) {
+		date := day.Format(StatsDateFormat)
+		row := byDay[date]
+		days = append(days, DailyStats{
+			Date:    date,
+			Added:   row.Added,
+			Removed: row.Removed,
+			Expired: row.Expired,
+		})
+	}
+	return days
+}
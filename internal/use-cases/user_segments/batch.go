@@ -0,0 +1,55 @@
+package usecases_user_segments
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+)
+
+// BatchMember is a user to be added into a segment by a batch request.
+// StartsAt and ExpireAt are resolved when the request is accepted, so a batch applied later
+// by a background job expires at the same time as if it was applied at once.
+type BatchMember struct {
+	UserID   int64      `json:"user_id"`
+	ExpireAt *time.Time `json:"expire_at,omitempty"`
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+}
+
+// DedupMembers keeps a single entry per user, so a batch never touches the same row twice.
+// The last entry for a user wins, but it takes the place of the first one.
+func DedupMembers(members []BatchMember) []BatchMember {
+	positions := make(map[int64]int, len(members))
+	res := make([]BatchMember, 0, len(members))
+	for _, member := range members {
+		if i, ok := positions[member.UserID]; ok {
+			res[i] = member
+			continue
+		}
+		positions[member.UserID] = len(res)
+		res = append(res, member)
+	}
+	return res
+}
+
+func BatchParams(segmentName string, members []BatchMember) models.AddUsersIntoSegmentBatchParams {
+	params := models.AddUsersIntoSegmentBatchParams{
+		UserIds:     make([]int64, 0, len(members)),
+		ExpireAt:    make([]sql.NullTime, 0, len(members)),
+		StartsAt:    make([]sql.NullTime, 0, len(members)),
+		SegmentName: segmentName,
+	}
+	for _, member := range members {
+		params.UserIds = append(params.UserIds, member.UserID)
+		params.ExpireAt = append(params.ExpireAt, nullTime(member.ExpireAt))
+		params.StartsAt = append(params.StartsAt, nullTime(member.StartsAt))
+	}
+	return params
+}
+
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
@@ -0,0 +1,122 @@
+package usecases_user_segments
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/utils/duration"
+)
+
+// TTL is how long a user stays in a segment. In JSON it is either a number of hours,
+// as the API has always accepted, or a duration string such as "90m", "3d", "2w" or "P1DT12H".
+type TTL time.Duration
+
+func (t *TTL) UnmarshalJSON(b []byte) error {
+	var hours int64
+	if err := json.Unmarshal(b, &hours); err == nil {
+		*t = TTL(time.Duration(hours) * time.Hour)
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return errors.New("ttl must be a number of hours or a duration")
+	}
+	d, err := duration_utils.Parse(s)
+	if err != nil {
+		return err
+	}
+	*t = TTL(d)
+	return nil
+}
+
+// Expiry is when a user leaves a segment: either at an absolute expire_at or after ttl from now.
+// Neither being set means the membership does not expire.
+type Expiry struct {
+	TTL      *TTL       `json:"ttl,omitempty"`
+	ExpireAt *time.Time `json:"expire_at,omitempty"`
+}
+
+// ParseExpiry parses a single text value: an RFC3339 timestamp, a number of hours or a duration.
+func ParseExpiry(s string) (Expiry, error) {
+	if s == "" {
+		return Expiry{}, nil
+	}
+	if expireAt, err := time.Parse(time.RFC3339, s); err == nil {
+		return Expiry{ExpireAt: &expireAt}, nil
+	}
+
+	var ttl TTL
+	if hours, err := strconv.ParseInt(s, 10, 64); err == nil {
+		ttl = TTL(time.Duration(hours) * time.Hour)
+		return Expiry{TTL: &ttl}, nil
+	}
+	d, err := duration_utils.Parse(s)
+	if err != nil {
+		return Expiry{}, fmt.Errorf("%q is neither an RFC3339 timestamp nor a duration", s)
+	}
+	ttl = TTL(d)
+	return Expiry{TTL: &ttl}, nil
+}
+
+// Resolve turns the expiry into an absolute time, which must be after now.
+// A ttl is counted from now.
+// The time is in UTC, as all timestamps in the database are.
+func (e Expiry) Resolve(now time.Time) (sql.NullTime, error) {
+	var expireAt time.Time
+	switch {
+	case e.TTL != nil && e.ExpireAt != nil:
+		return sql.NullTime{}, errors.New("either ttl or expire_at can be set, not both")
+	case e.TTL != nil:
+		if *e.TTL <= 0 {
+			return sql.NullTime{}, errors.New("ttl must be positive")
+		}
+		expireAt = now.Add(time.Duration(*e.TTL))
+	case e.ExpireAt != nil:
+		if !e.ExpireAt.After(now) {
+			return sql.NullTime{}, errors.New("expire_at must be in the future")
+		}
+		expireAt = *e.ExpireAt
+	default:
+		return sql.NullTime{}, nil
+	}
+	return sql.NullTime{Time: expireAt.UTC(), Valid: true}, nil
+}
+
+// Schedule is the window in which a user is in a segment. Without starts_at the membership
+// is effective at once, otherwise it becomes active at starts_at and ttl is counted from it.
+type Schedule struct {
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+	Expiry
+}
+
+// Window is a resolved schedule as it is stored in the database.
+type Window struct {
+	StartsAt sql.NullTime
+	ExpireAt sql.NullTime
+}
+
+// Resolve turns the schedule into absolute times in UTC. A starts_at that is not in the future
+// is dropped: such a membership is simply active from now on.
+func (s Schedule) Resolve(now time.Time) (Window, error) {
+	if s.StartsAt == nil || !s.StartsAt.After(now) {
+		expireAt, err := s.Expiry.Resolve(now)
+		return Window{ExpireAt: expireAt}, err
+	}
+
+	if s.ExpireAt != nil && !s.ExpireAt.After(*s.StartsAt) {
+		return Window{}, errors.New("expire_at must be after starts_at")
+	}
+	expireAt, err := s.Expiry.Resolve(*s.StartsAt)
+	if err != nil {
+		return Window{}, err
+	}
+	return Window{
+		StartsAt: sql.NullTime{Time: s.StartsAt.UTC(), Valid: true},
+		ExpireAt: expireAt,
+	}, nil
+}
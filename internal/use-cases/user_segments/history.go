@@ -0,0 +1,40 @@
+package usecases_user_segments
+
+import (
+	"time"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+)
+
+// IsRemoval reports whether a history action takes a user out of a segment.
+// Every other action puts the user into the segment with the window recorded in it.
+func IsRemoval(action string) bool {
+	switch action {
+	case models.ActionDeleted, models.ActionExpired, models.ActionSegmentDeleted, models.ActionUserDeleted:
+		return true
+	}
+	return false
+}
+
+// SegmentsAt reconstructs the segments a user was in at the given moment.
+// lastActions must hold the last history record made up to that moment for every segment:
+// a later record always overrides an earlier one, so a re-add after a removal
+// or a changed expire_at is taken into account. The user is in a segment if the last record
+// is not a removal and its window contains the moment. Expired memberships are removed
+// by the sweeper some time after expire_at, so expire_at is checked rather than the expired record.
+func SegmentsAt(lastActions []models.UsersInSegmentsHistory, at time.Time) []string {
+	res := make([]string, 0, len(lastActions))
+	for _, action := range lastActions {
+		if IsRemoval(action.ActionType) {
+			continue
+		}
+		if action.StartsAt.Valid && action.StartsAt.Time.After(at) {
+			continue
+		}
+		if action.ExpireAt.Valid && !action.ExpireAt.Time.After(at) {
+			continue
+		}
+		res = append(res, action.SegmentName)
+	}
+	return res
+}
@@ -0,0 +1,304 @@
+package usecases_user_segments
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+)
+
+const (
+	historyTimeFormat  = "2006-01-02 15:04:05"
+	archiveTimeFormat  = "2006-01-02 15:04:05.999999"
+	reportMonthFormat  = "2006-01"
+	reportPeriodFormat = "20060102T150405"
+
+	ReportContentTypeCSV  = "text/csv"
+	ReportContentTypeGzip = "application/gzip"
+)
+
+// HistoryCSVHeader is the header row of every segments history CSV.
+var HistoryCSVHeader = []string{"user_id", "segment_name", "action_type", "action_date", "expire_at", "old_expire_at", "actor", "reason"}
+
+// HistoryCSVRecord formats a history record as a row under HistoryCSVHeader.
+func HistoryCSVRecord(h models.UsersInSegmentsHistory) []string {
+	return []string{
+		strconv.FormatInt(h.UserID, 10),
+		h.SegmentName,
+		h.ActionType,
+		h.ActionDate.Format(historyTimeFormat),
+		formatHistoryTime(h.ExpireAt),
+		formatHistoryTime(h.OldExpireAt),
+		h.Actor.String,
+		h.Reason.String,
+	}
+}
+
+func formatHistoryTime(t sql.NullTime) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.Format(historyTimeFormat)
+}
+
+// HistoryArchiveHeader is the header row of an archived month of history. Unlike a report,
+// an archive keeps every column to the microsecond, so the history can be read back from it as it was.
+var HistoryArchiveHeader = []string{"id", "user_id", "segment_name", "action_type", "action_date", "expire_at",
+	"starts_at", "old_expire_at", "actor", "reason", "tx_id"}
+
+// HistoryArchiveRecord formats a history record as a row under HistoryArchiveHeader.
+func HistoryArchiveRecord(h models.UsersInSegmentsHistory) []string {
+	return []string{
+		strconv.FormatInt(h.ID, 10),
+		strconv.FormatInt(h.UserID, 10),
+		h.SegmentName,
+		h.ActionType,
+		h.ActionDate.Format(archiveTimeFormat),
+		formatArchiveTime(h.ExpireAt),
+		formatArchiveTime(h.StartsAt),
+		formatArchiveTime(h.OldExpireAt),
+		h.Actor.String,
+		h.Reason.String,
+		strconv.FormatInt(h.TxID, 10),
+	}
+}
+
+// ParseHistoryArchiveRecord parses a row written by HistoryArchiveRecord back into a history record.
+// Empty times, actor and reason are read as NULL: the history never keeps them empty.
+func ParseHistoryArchiveRecord(record []string) (models.UsersInSegmentsHistory, error) {
+	var h models.UsersInSegmentsHistory
+	if len(record) != len(HistoryArchiveHeader) {
+		return h, fmt.Errorf("archive record has %d fields, want %d", len(record), len(HistoryArchiveHeader))
+	}
+
+	var err error
+	if h.ID, err = strconv.ParseInt(record[0], 10, 64); err != nil {
+		return h, fmt.Errorf("id: %w", err)
+	}
+	if h.UserID, err = strconv.ParseInt(record[1], 10, 64); err != nil {
+		return h, fmt.Errorf("user_id: %w", err)
+	}
+	h.SegmentName = record[2]
+	h.ActionType = record[3]
+	if h.ActionDate, err = time.Parse(archiveTimeFormat, record[4]); err != nil {
+		return h, fmt.Errorf("action_date: %w", err)
+	}
+	if h.ExpireAt, err = parseArchiveTime(record[5]); err != nil {
+		return h, fmt.Errorf("expire_at: %w", err)
+	}
+	if h.StartsAt, err = parseArchiveTime(record[6]); err != nil {
+		return h, fmt.Errorf("starts_at: %w", err)
+	}
+	if h.OldExpireAt, err = parseArchiveTime(record[7]); err != nil {
+		return h, fmt.Errorf("old_expire_at: %w", err)
+	}
+	h.Actor = sql.NullString{String: record[8], Valid: record[8] != ""}
+	h.Reason = sql.NullString{String: record[9], Valid: record[9] != ""}
+	if h.TxID, err = strconv.ParseInt(record[10], 10, 64); err != nil {
+		return h, fmt.Errorf("tx_id: %w", err)
+	}
+	return h, nil
+}
+
+func formatArchiveTime(t sql.NullTime) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.Format(archiveTimeFormat)
+}
+
+func parseArchiveTime(s string) (sql.NullTime, error) {
+	if s == "" {
+		return sql.NullTime{}, nil
+	}
+	t, err := time.Parse(archiveTimeFormat, s)
+	if err != nil {
+		return sql.NullTime{}, err
+	}
+	return sql.NullTime{Time: t, Valid: true}, nil
+}
+
+// MonthPeriod parses a year-month such as 2023-09 into the period from the first moment
+// of the month inclusive to the first moment of the next month exclusive, in UTC.
+func MonthPeriod(month string) (time.Time, time.Time, error) {
+	from, err := time.Parse(reportMonthFormat, month)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("month must be in YYYY-MM format")
+	}
+	return from, from.AddDate(0, 1, 0), nil
+}
+
+// ReportPeriod resolves the period of a history report: a month if it is given, otherwise from and to,
+// which must both be set and make a non-empty period. The result is in UTC.
+func ReportPeriod(month string, from time.Time, to time.Time) (time.Time, time.Time, error) {
+	if month != "" {
+		return MonthPeriod(month)
+	}
+	if from.IsZero() || to.IsZero() {
+		return time.Time{}, time.Time{}, errors.New("you must provide month or from and to")
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, errors.New("from must be before to")
+	}
+	return from.UTC(), to.UTC(), nil
+}
+
+// HistoryReportFilename names a report file after its period and segment, such as history_2023-09.csv
+// or history_AVITO_VOICE_MESSAGES_20230901T000000_20230915T000000.csv.gz.
+func HistoryReportFilename(arg models.HistoryReportParams, compress bool) string {
+	period := fmt.Sprintf("%s_%s", arg.FromDate.Format(reportPeriodFormat), arg.ToDate.Format(reportPeriodFormat))
+	monthStart := time.Date(arg.FromDate.Year(), arg.FromDate.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if arg.FromDate.Equal(monthStart) && arg.ToDate.Equal(monthStart.AddDate(0, 1, 0)) {
+		period = arg.FromDate.Format(reportMonthFormat)
+	}
+
+	name := "history_" + period
+	if arg.SegmentName != "" {
+		name = fmt.Sprintf("history_%s_%s", arg.SegmentName, period)
+	}
+	if compress {
+		return name + ".csv.gz"
+	}
+	return name + ".csv"
+}
+
+// HistoryReportContentType is the content type of a report file.
+func HistoryReportContentType(compress bool) string {
+	if compress {
+		return ReportContentTypeGzip
+	}
+	return ReportContentTypeCSV
+}
+
+// WriteHistoryReport writes the history selected by arg to w as CSV with a header row,
+// gzip-compressed if compress is set. Records are written as they are read from the database,
+// so the report is never held in memory. It returns the number of records written.
+func WriteHistoryReport(ctx context.Context, reporter storage.HistoryReporter, arg models.HistoryReportParams,
+	w io.Writer, compress bool) (int64, error) {
+	return writeHistory(ctx, reporter, arg, w, compress, HistoryCSVHeader, HistoryCSVRecord)
+}
+
+// WriteHistoryArchive writes the history selected by arg to w as gzip-compressed CSV
+// under HistoryArchiveHeader, the same way WriteHistoryReport does.
+func WriteHistoryArchive(ctx context.Context, reporter storage.HistoryReporter, arg models.HistoryReportParams,
+	w io.Writer) (int64, error) {
+	return writeHistory(ctx, reporter, arg, w, true, HistoryArchiveHeader, HistoryArchiveRecord)
+}
+
+// ReadHistoryArchive reads an archive written by WriteHistoryArchive from r and calls fn
+// for every record in it. It returns the number of records read.
+func ReadHistoryArchive(r io.Reader, fn func(models.UsersInSegmentsHistory) error) (int64, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer gz.Close()
+	reader := csv.NewReader(gz)
+	reader.FieldsPerRecord = len(HistoryArchiveHeader)
+
+	header, err := reader.Read()
+	if err != nil {
+		return 0, err
+	}
+	for i, column := range HistoryArchiveHeader {
+		if header[i] != column {
+			return 0, fmt.Errorf("archive column %d is %s, want %s", i+1, header[i], column)
+		}
+	}
+
+	var n int64
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		h, err := ParseHistoryArchiveRecord(record)
+		if err != nil {
+			return n, fmt.Errorf("archive record %d: %w", n+1, err)
+		}
+		if err := fn(h); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+func writeHistory(ctx context.Context, reporter storage.HistoryReporter, arg models.HistoryReportParams,
+	w io.Writer, compress bool, header []string, record func(models.UsersInSegmentsHistory) []string) (int64, error) {
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+	writer := csv.NewWriter(w)
+
+	var n int64
+	if err := writer.Write(header); err != nil {
+		return n, err
+	}
+	err := reporter.ReportSegmentsHistory(ctx, arg, func(h models.UsersInSegmentsHistory) error {
+		n++
+		return writer.Write(record(h))
+	})
+	if err != nil {
+		return n, err
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return n, err
+	}
+	if gz != nil {
+		return n, gz.Close()
+	}
+	return n, nil
+}
+
+// PutHistoryReport streams the report written by WriteHistoryReport into the blob store under key.
+// It returns the size of the stored blob and the number of records in it.
+func PutHistoryReport(ctx context.Context, reporter storage.HistoryReporter, blobs storage.BlobStore, key string,
+	arg models.HistoryReportParams, compress bool) (size int64, records int64, err error) {
+	return putHistory(ctx, blobs, key, func(w io.Writer) (int64, error) {
+		return WriteHistoryReport(ctx, reporter, arg, w, compress)
+	})
+}
+
+// PutHistoryArchive streams the archive written by WriteHistoryArchive into the blob store under key.
+// It returns the size of the stored blob and the number of records in it.
+func PutHistoryArchive(ctx context.Context, reporter storage.HistoryReporter, blobs storage.BlobStore, key string,
+	arg models.HistoryReportParams) (size int64, records int64, err error) {
+	return putHistory(ctx, blobs, key, func(w io.Writer) (int64, error) {
+		return WriteHistoryArchive(ctx, reporter, arg, w)
+	})
+}
+
+func putHistory(ctx context.Context, blobs storage.BlobStore, key string,
+	write func(io.Writer) (int64, error)) (size int64, records int64, err error) {
+	pr, pw := io.Pipe()
+	written := make(chan int64, 1)
+	go func() {
+		n, err := write(pw)
+		pw.CloseWithError(err)
+		written <- n
+	}()
+
+	size, err = blobs.Put(ctx, key, pr)
+	// Unblocks the writer if the store gave up before reading everything.
+	pr.CloseWithError(err)
+	records = <-written
+	if err != nil {
+		return 0, 0, err
+	}
+	return size, records, nil
+}
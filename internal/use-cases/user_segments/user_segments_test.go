@@ -0,0 +1,249 @@
+package usecases_user_segments_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	usecases_user_segments "github.com/AlexZahvatkin/segments-users-service/internal/use-cases/user_segments"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBucketIsStable(t *testing.T) {
+	for id := int64(1); id <= 1000; id++ {
+		bucket := usecases_user_segments.Bucket("TEST_SEGMENT", id)
+		require.GreaterOrEqual(t, bucket, 0)
+		require.Less(t, bucket, usecases_user_segments.BucketsCount)
+		require.Equal(t, bucket, usecases_user_segments.Bucket("TEST_SEGMENT", id))
+	}
+}
+
+func TestPickIdsForRollout(t *testing.T) {
+	var ids []int64
+	for id := int64(1); id <= 10000; id++ {
+		ids = append(ids, id)
+	}
+
+	ten, err := usecases_user_segments.PickIdsForRollout("TEST_SEGMENT", 10, ids)
+	require.NoError(t, err)
+	twenty, err := usecases_user_segments.PickIdsForRollout("TEST_SEGMENT", 20, ids)
+	require.NoError(t, err)
+
+	require.InDelta(t, 1000, len(ten), 150)
+	require.InDelta(t, 2000, len(twenty), 200)
+	require.Subset(t, twenty, ten)
+
+	other, err := usecases_user_segments.PickIdsForRollout("OTHER_SEGMENT", 10, ids)
+	require.NoError(t, err)
+	require.NotEqual(t, ten, other)
+
+	_, err = usecases_user_segments.PickIdsForRollout("TEST_SEGMENT", 101, ids)
+	require.Error(t, err)
+}
+
+func TestDedupMembers(t *testing.T) {
+	expireAt := time.Date(2023, 9, 1, 20, 0, 0, 0, time.UTC)
+	members := usecases_user_segments.DedupMembers([]usecases_user_segments.BatchMember{
+		{UserID: 3},
+		{UserID: 1, ExpireAt: &expireAt},
+		{UserID: 3, ExpireAt: &expireAt},
+		{UserID: 2},
+		{UserID: 1},
+	})
+
+	require.Equal(t, []usecases_user_segments.BatchMember{
+		{UserID: 3, ExpireAt: &expireAt},
+		{UserID: 1},
+		{UserID: 2},
+	}, members)
+}
+
+func TestExpiry(t *testing.T) {
+	now := time.Date(2023, 9, 1, 20, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		json     string
+		expected sql.NullTime
+		err      bool
+	}{
+		{name: "No expiry", json: `{}`},
+		{name: "TTL in hours", json: `{"ttl": 24}`, expected: sql.NullTime{Time: now.Add(24 * time.Hour), Valid: true}},
+		{name: "TTL duration", json: `{"ttl": "90m"}`, expected: sql.NullTime{Time: now.Add(90 * time.Minute), Valid: true}},
+		{name: "TTL in days", json: `{"ttl": "3d"}`, expected: sql.NullTime{Time: now.Add(72 * time.Hour), Valid: true}},
+		{name: "ISO-8601 TTL", json: `{"ttl": "P1W"}`, expected: sql.NullTime{Time: now.Add(7 * 24 * time.Hour), Valid: true}},
+		{
+			name:     "Expire at",
+			json:     `{"expire_at": "2023-09-02T01:00:00+03:00"}`,
+			expected: sql.NullTime{Time: time.Date(2023, 9, 1, 22, 0, 0, 0, time.UTC), Valid: true},
+		},
+		{name: "Expire at in the past", json: `{"expire_at": "2023-09-01T19:00:00Z"}`, err: true},
+		{name: "Zero TTL", json: `{"ttl": 0}`, err: true},
+		{name: "Both", json: `{"ttl": 1, "expire_at": "2023-09-02T20:00:00Z"}`, err: true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var expiry usecases_user_segments.Expiry
+			require.NoError(t, json.Unmarshal([]byte(tc.json), &expiry))
+			expireAt, err := expiry.Resolve(now)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, expireAt)
+		})
+	}
+
+	var expiry usecases_user_segments.Expiry
+	require.Error(t, json.Unmarshal([]byte(`{"ttl": "soon"}`), &expiry))
+}
+
+func TestParseExpiry(t *testing.T) {
+	expiry, err := usecases_user_segments.ParseExpiry("2023-09-02T20:00:00Z")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2023, 9, 2, 20, 0, 0, 0, time.UTC), *expiry.ExpireAt)
+
+	expiry, err = usecases_user_segments.ParseExpiry("24")
+	require.NoError(t, err)
+	require.Equal(t, usecases_user_segments.TTL(24*time.Hour), *expiry.TTL)
+
+	expiry, err = usecases_user_segments.ParseExpiry("2w")
+	require.NoError(t, err)
+	require.Equal(t, usecases_user_segments.TTL(14*24*time.Hour), *expiry.TTL)
+
+	_, err = usecases_user_segments.ParseExpiry("tomorrow")
+	require.Error(t, err)
+}
+
+func TestSchedule(t *testing.T) {
+	now := time.Date(2023, 9, 1, 20, 0, 0, 0, time.UTC)
+	friday := time.Date(2023, 9, 8, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		json     string
+		expected usecases_user_segments.Window
+		err      bool
+	}{
+		{name: "Immediate", json: `{"ttl": 24}`, expected: usecases_user_segments.Window{
+			ExpireAt: sql.NullTime{Time: now.Add(24 * time.Hour), Valid: true},
+		}},
+		{name: "TTL is counted from starts_at", json: `{"starts_at": "2023-09-08T03:00:00+03:00", "ttl": "3d"}`, expected: usecases_user_segments.Window{
+			StartsAt: sql.NullTime{Time: friday, Valid: true},
+			ExpireAt: sql.NullTime{Time: friday.Add(72 * time.Hour), Valid: true},
+		}},
+		{name: "Starts at without expiry", json: `{"starts_at": "2023-09-08T00:00:00Z"}`, expected: usecases_user_segments.Window{
+			StartsAt: sql.NullTime{Time: friday, Valid: true},
+		}},
+		{name: "Past starts_at is dropped", json: `{"starts_at": "2023-09-01T00:00:00Z", "ttl": 1}`, expected: usecases_user_segments.Window{
+			ExpireAt: sql.NullTime{Time: now.Add(time.Hour), Valid: true},
+		}},
+		{name: "Expire at before starts_at", json: `{"starts_at": "2023-09-08T00:00:00Z", "expire_at": "2023-09-07T00:00:00Z"}`, err: true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var schedule usecases_user_segments.Schedule
+			require.NoError(t, json.Unmarshal([]byte(tc.json), &schedule))
+			window, err := schedule.Resolve(now)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, window)
+		})
+	}
+}
+
+func TestSegmentsAt(t *testing.T) {
+	at := time.Date(2023, 9, 5, 12, 0, 0, 0, time.UTC)
+	before := at.Add(-time.Hour)
+	after := at.Add(time.Hour)
+
+	actions := []models.UsersInSegmentsHistory{
+		{SegmentName: "ACTIVE", ActionType: models.ActionInserted},
+		{SegmentName: "AUTO_ASSIGNED", ActionType: models.ActionAutoAssigned},
+		{SegmentName: "DELETED", ActionType: models.ActionDeleted},
+		{SegmentName: "EXPIRED", ActionType: models.ActionExpired},
+		{SegmentName: "EXPIRED_NOT_SWEPT", ActionType: models.ActionInserted, ExpireAt: sql.NullTime{Time: before, Valid: true}},
+		{SegmentName: "EXPIRES_LATER", ActionType: models.ActionInserted, ExpireAt: sql.NullTime{Time: after, Valid: true}},
+		{SegmentName: "EXPIRES_AT_THE_MOMENT", ActionType: models.ActionInserted, ExpireAt: sql.NullTime{Time: at, Valid: true}},
+		{SegmentName: "PENDING", ActionType: models.ActionScheduled, StartsAt: sql.NullTime{Time: after, Valid: true}},
+		{SegmentName: "STARTED", ActionType: models.ActionScheduled, StartsAt: sql.NullTime{Time: before, Valid: true}},
+		{SegmentName: "SEGMENT_DELETED", ActionType: models.ActionSegmentDeleted},
+		{SegmentName: "SEGMENT_RESTORED", ActionType: models.ActionSegmentRestored},
+		{SegmentName: "USER_DELETED", ActionType: models.ActionUserDeleted},
+	}
+
+	require.Equal(t, []string{"ACTIVE", "AUTO_ASSIGNED", "EXPIRES_LATER", "STARTED", "SEGMENT_RESTORED"},
+		usecases_user_segments.SegmentsAt(actions, at))
+	require.Empty(t, usecases_user_segments.SegmentsAt(nil, at))
+}
+
+func TestHistoryArchiveRoundTrip(t *testing.T) {
+	history := historyRecords{
+		{
+			ID:          1,
+			UserID:      10,
+			SegmentName: "TEST_SEGMENT",
+			ActionType:  models.ActionScheduled,
+			ActionDate:  time.Date(2023, 1, 10, 10, 0, 0, 123456000, time.UTC),
+			ExpireAt:    sql.NullTime{Time: time.Date(2023, 2, 10, 10, 0, 0, 0, time.UTC), Valid: true},
+			StartsAt:    sql.NullTime{Time: time.Date(2023, 1, 11, 0, 0, 0, 500000000, time.UTC), Valid: true},
+			OldExpireAt: sql.NullTime{Time: time.Date(2023, 1, 31, 0, 0, 0, 0, time.UTC), Valid: true},
+			Actor:       sql.NullString{String: "checkout-service", Valid: true},
+			Reason:      sql.NullString{String: "TICKET-42, \"urgent\"", Valid: true},
+			TxID:        1234,
+		},
+		{
+			ID:          2,
+			UserID:      10,
+			SegmentName: "TEST_SEGMENT",
+			ActionType:  models.ActionDeleted,
+			ActionDate:  time.Date(2023, 1, 20, 10, 0, 0, 1000, time.UTC),
+			TxID:        1240,
+		},
+	}
+
+	var archive bytes.Buffer
+	written, err := usecases_user_segments.WriteHistoryArchive(context.Background(), history, models.HistoryReportParams{}, &archive)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), written)
+
+	var restored historyRecords
+	read, err := usecases_user_segments.ReadHistoryArchive(&archive, func(h models.UsersInSegmentsHistory) error {
+		restored = append(restored, h)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), read)
+	require.Equal(t, history, restored)
+}
+
+// historyRecords reports the history it holds regardless of the report params.
+type historyRecords []models.UsersInSegmentsHistory
+
+func (h historyRecords) ReportSegmentsHistory(_ context.Context, _ models.HistoryReportParams,
+	fn func(models.UsersInSegmentsHistory) error) error {
+	for _, item := range h {
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,17 +1,36 @@
 package usecases_user_segments
 
 import (
+	"crypto/md5"
+	"encoding/binary"
 	"errors"
-	"math/rand"
+	"strconv"
 )
 
-func PickRandomIds(percent float64, ids []int64) ([]int64, error) {
-	if percent > 100 {
+const (
+	BucketsCount = 10000
+)
+
+// Bucket deterministically maps a user to one of BucketsCount buckets.
+// The same salt and user id always give the same bucket.
+func Bucket(salt string, userId int64) int {
+	sum := md5.Sum([]byte(salt + ":" + strconv.FormatInt(userId, 10)))
+	return int(binary.BigEndian.Uint32(sum[:4]) % BucketsCount)
+}
+
+// InRollout reports whether a user falls into the given percent of buckets.
+// Raising the percent only adds users: everyone who was in a smaller rollout stays in it.
+func InRollout(salt string, userId int64, percent float64) bool {
+	return float64(Bucket(salt, userId)) < percent*BucketsCount/100
+}
+
+func PickIdsForRollout(salt string, percent float64, ids []int64) ([]int64, error) {
+	if percent < 0 || percent > 100 {
 		return nil, errors.New("Wrong percent value")
 	}
 	var res []int64
 	for _, item := range ids {
-		if rand.Float64()*100 < percent {
+		if InRollout(salt, item, percent) {
 			res = append(res, item)
 		}
 	}
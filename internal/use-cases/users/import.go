@@ -0,0 +1,235 @@
+package usecases_users
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+	usecases_segments "github.com/AlexZahvatkin/segments-users-service/internal/use-cases/segments"
+)
+
+const (
+	ImportFormatCSV    = "csv"
+	ImportFormatNDJSON = "ndjson"
+
+	maxImportLineSize = 1024 * 1024
+)
+
+// ImportUsers loads users from a CSV or NDJSON stream. The stream is read once, row by row,
+// so files of any size can be imported. With dryRun the file is only validated.
+//
+// A CSV file has the columns name, external_id and segments, the header row is optional.
+// Segments are separated by semicolons, each one may have a TTL in hours after a colon:
+// "AVITO_VOICE_MESSAGES;AVITO_DISCOUNT_30:24". An NDJSON line is an object
+// {"name": "...", "external_id": "...", "segments": [{"name": "...", "ttl": 24}]}.
+func ImportUsers(ctx context.Context, importer storage.UserImporter, r io.Reader, format string, dryRun bool) (models.ImportUsersResult, error) {
+	var src storage.ImportSource
+	switch format {
+	case ImportFormatCSV:
+		src = newCSVImportSource(r)
+	case ImportFormatNDJSON:
+		src = newNDJSONImportSource(r)
+	default:
+		return models.ImportUsersResult{}, fmt.Errorf("unsupported import format %s", format)
+	}
+
+	return importer.ImportUsers(ctx, src, dryRun)
+}
+
+// importErrors collects row errors. Once MaxImportErrors are collected the source stops reading:
+// the import will be rejected anyway.
+type importErrors struct {
+	errors []models.ImportError
+}
+
+func (e *importErrors) add(line int, err error) {
+	e.errors = append(e.errors, models.ImportError{Line: line, Error: err.Error()})
+}
+
+func (e *importErrors) full() bool {
+	return len(e.errors) >= models.MaxImportErrors
+}
+
+func (e *importErrors) Errors() []models.ImportError {
+	return e.errors
+}
+
+type csvImportSource struct {
+	importErrors
+	reader *csv.Reader
+	header bool
+}
+
+func newCSVImportSource(r io.Reader) *csvImportSource {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	return &csvImportSource{
+		reader: reader,
+		header: true,
+	}
+}
+
+func (s *csvImportSource) Next() (models.ImportUser, error) {
+	for !s.full() {
+		record, err := s.reader.Read()
+		if errors.Is(err, io.EOF) {
+			return models.ImportUser{}, io.EOF
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			// The reader can not tell where the broken record ends, so there is no point going on.
+			s.add(parseErr.StartLine, parseErr.Err)
+			return models.ImportUser{}, io.EOF
+		}
+		if err != nil {
+			return models.ImportUser{}, err
+		}
+		line, _ := s.reader.FieldPos(0)
+
+		header := s.header && record[0] == "name"
+		s.header = false
+		if header {
+			continue
+		}
+
+		user, err := parseCSVImportRecord(record)
+		if err != nil {
+			s.add(line, err)
+			continue
+		}
+		user.Line = line
+		return user, nil
+	}
+	return models.ImportUser{}, io.EOF
+}
+
+func parseCSVImportRecord(record []string) (models.ImportUser, error) {
+	if len(record) > 3 {
+		return models.ImportUser{}, fmt.Errorf("expected name, external_id and segments, got %d fields", len(record))
+	}
+	for len(record) < 3 {
+		record = append(record, "")
+	}
+
+	user := models.ImportUser{Name: record[0]}
+	if record[1] != "" {
+		externalID := record[1]
+		user.ExternalID = &externalID
+	}
+	if record[2] != "" {
+		for _, item := range strings.Split(record[2], ";") {
+			name, ttl, hasTTL := strings.Cut(strings.TrimSpace(item), ":")
+			segment := models.ImportUserSegment{Name: name}
+			if hasTTL {
+				hours, err := strconv.ParseInt(ttl, 10, 32)
+				if err != nil {
+					return models.ImportUser{}, fmt.Errorf("ttl of segment %s must be a number of hours", name)
+				}
+				segment.TTL = int32(hours)
+			}
+			user.Segments = append(user.Segments, segment)
+		}
+	}
+
+	return user, validateImportUser(&user)
+}
+
+type ndjsonImportSource struct {
+	importErrors
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONImportSource(r io.Reader) *ndjsonImportSource {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxImportLineSize)
+
+	return &ndjsonImportSource{
+		scanner: scanner,
+	}
+}
+
+func (s *ndjsonImportSource) Next() (models.ImportUser, error) {
+	type record struct {
+		Name       string                     `json:"name"`
+		ExternalID *string                    `json:"external_id"`
+		Segments   []models.ImportUserSegment `json:"segments"`
+	}
+
+	for !s.full() && s.scanner.Scan() {
+		s.line++
+		text := strings.TrimSpace(s.scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var rec record
+		if err := json.Unmarshal([]byte(text), &rec); err != nil {
+			s.add(s.line, err)
+			continue
+		}
+
+		user := models.ImportUser{
+			Line:       s.line,
+			Name:       rec.Name,
+			ExternalID: rec.ExternalID,
+			Segments:   rec.Segments,
+		}
+		if err := validateImportUser(&user); err != nil {
+			s.add(s.line, err)
+			continue
+		}
+		return user, nil
+	}
+	if errors.Is(s.scanner.Err(), bufio.ErrTooLong) {
+		s.add(s.line+1, fmt.Errorf("line is longer than %d bytes", maxImportLineSize))
+		return models.ImportUser{}, io.EOF
+	}
+	if err := s.scanner.Err(); err != nil {
+		return models.ImportUser{}, err
+	}
+	return models.ImportUser{}, io.EOF
+}
+
+// validateImportUser applies the same rules as user creation through the API,
+// normalizes segment names the way the API does and drops repeated segments, keeping the last TTL.
+func validateImportUser(user *models.ImportUser) error {
+	if n := utf8.RuneCountInString(user.Name); n < 4 || n > 255 {
+		return errors.New("name must be from 4 to 255 characters long")
+	}
+	if user.ExternalID != nil && (*user.ExternalID == "" || utf8.RuneCountInString(*user.ExternalID) > 255) {
+		return errors.New("external_id must be from 1 to 255 characters long")
+	}
+
+	positions := make(map[string]int, len(user.Segments))
+	segments := make([]models.ImportUserSegment, 0, len(user.Segments))
+	for _, segment := range user.Segments {
+		segment.Name = usecases_segments.FormatSegmnetName(segment.Name)
+		if segment.Name == "" {
+			return errors.New("segment name must not be empty")
+		}
+		if segment.TTL < 0 {
+			return fmt.Errorf("ttl of segment %s must not be negative", segment.Name)
+		}
+		if i, ok := positions[segment.Name]; ok {
+			segments[i] = segment
+			continue
+		}
+		positions[segment.Name] = len(segments)
+		segments = append(segments, segment)
+	}
+	user.Segments = segments
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package usecases_users_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+	usecases_users "github.com/AlexZahvatkin/segments-users-service/internal/use-cases/users"
+	"github.com/stretchr/testify/require"
+)
+
+// drainImporter reads the whole source the way the database importer does.
+type drainImporter struct {
+	users []models.ImportUser
+}
+
+func (d *drainImporter) ImportUsers(_ context.Context, src storage.ImportSource, dryRun bool) (models.ImportUsersResult, error) {
+	for {
+		user, err := src.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return models.ImportUsersResult{}, err
+		}
+		d.users = append(d.users, user)
+	}
+	return models.ImportUsersResult{Users: int64(len(d.users)), DryRun: dryRun, Errors: src.Errors()}, nil
+}
+
+func TestImportUsers(t *testing.T) {
+	externalID := "crm-1"
+
+	cases := []struct {
+		name   string
+		format string
+		body   string
+		users  []models.ImportUser
+		errors []models.ImportError
+	}{
+		{
+			name:   "CSV",
+			format: usecases_users.ImportFormatCSV,
+			body: "name,external_id,segments\n" +
+				"Alexander,crm-1,AVITO_VOICE_MESSAGES;AVITO_DISCOUNT_30:24\n" +
+				"\n" +
+				"Maria\n" +
+				"Bob,,\n" +
+				"Nikolay,,AVITO_DISCOUNT_30:soon\n" +
+				"Ivan,,avito discount 30:24;AVITO_DISCOUNT_30\n",
+			users: []models.ImportUser{
+				{Line: 2, Name: "Alexander", ExternalID: &externalID, Segments: []models.ImportUserSegment{
+					{Name: "AVITO_VOICE_MESSAGES"}, {Name: "AVITO_DISCOUNT_30", TTL: 24},
+				}},
+				{Line: 4, Name: "Maria", Segments: []models.ImportUserSegment{}},
+				{Line: 7, Name: "Ivan", Segments: []models.ImportUserSegment{{Name: "AVITO_DISCOUNT_30"}}},
+			},
+			errors: []models.ImportError{
+				{Line: 5, Error: "name must be from 4 to 255 characters long"},
+				{Line: 6, Error: "ttl of segment AVITO_DISCOUNT_30 must be a number of hours"},
+			},
+		},
+		{
+			name:   "Broken CSV stops the import",
+			format: usecases_users.ImportFormatCSV,
+			body:   "Alexander\n\"Maria\n",
+			users:  []models.ImportUser{{Line: 1, Name: "Alexander", Segments: []models.ImportUserSegment{}}},
+			errors: []models.ImportError{{Line: 2, Error: "extraneous or missing \" in quoted-field"}},
+		},
+		{
+			name:   "NDJSON",
+			format: usecases_users.ImportFormatNDJSON,
+			body: `{"name": "Alexander", "external_id": "crm-1", "segments": [{"name": "AVITO_DISCOUNT_30", "ttl": 24}]}` + "\n" +
+				`{"name": "Maria"` + "\n" +
+				"\n" +
+				`{"name": "Ivan", "segments": [{"name": "AVITO_DISCOUNT_30", "ttl": -1}]}` + "\n" +
+				`{"name": "Maria"}`,
+			users: []models.ImportUser{
+				{Line: 1, Name: "Alexander", ExternalID: &externalID, Segments: []models.ImportUserSegment{
+					{Name: "AVITO_DISCOUNT_30", TTL: 24},
+				}},
+				{Line: 5, Name: "Maria", Segments: []models.ImportUserSegment{}},
+			},
+			errors: []models.ImportError{
+				{Line: 2, Error: "unexpected end of JSON input"},
+				{Line: 4, Error: "ttl of segment AVITO_DISCOUNT_30 must not be negative"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			importer := &drainImporter{}
+			res, err := usecases_users.ImportUsers(context.Background(), importer, strings.NewReader(tc.body), tc.format, true)
+			require.NoError(t, err)
+			require.True(t, res.DryRun)
+			require.Equal(t, tc.users, importer.users)
+			require.Equal(t, tc.errors, res.Errors)
+		})
+	}
+}
+
+func TestImportUsersStopsAfterMaxErrors(t *testing.T) {
+	body := strings.Repeat("Bob\n", models.MaxImportErrors+10) + "Alexander\n"
+
+	importer := &drainImporter{}
+	res, err := usecases_users.ImportUsers(context.Background(), importer, strings.NewReader(body), usecases_users.ImportFormatCSV, false)
+	require.NoError(t, err)
+	require.Len(t, res.Errors, models.MaxImportErrors)
+	require.Empty(t, importer.users)
+}
@@ -0,0 +1,65 @@
+package usecases_users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+)
+
+// ErrUserDeleted is returned when the external id belongs to a soft-deleted user:
+// it can not be reused until the user is restored or purged.
+var ErrUserDeleted = errors.New("user with such external id was deleted")
+
+// EnrollIntoRolloutSegments adds a just created user into every percentage segment whose rollout covers them.
+// The insertions are recorded in history as auto_assigned; the history action is reset afterwards,
+// so the rest of the transaction is recorded as usual.
+func EnrollIntoRolloutSegments(ctx context.Context, q storage.Querier, userID int64) ([]models.UsersInSegment, error) {
+	if err := q.SetHistoryAction(ctx, models.ActionAutoAssigned); err != nil {
+		return nil, err
+	}
+
+	added, err := q.AddUserIntoRolloutSegments(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := q.SetHistoryAction(ctx, ""); err != nil {
+		return nil, err
+	}
+
+	return added, nil
+}
+
+// GetOrCreateByExternalId returns the user with the given external id, creating them if there is none.
+// It must run inside a transaction. It reports whether the user was created.
+func GetOrCreateByExternalId(ctx context.Context, q storage.Querier, externalID string, name string) (models.User, bool, error) {
+	user, err := q.GetUserByExternalId(ctx, externalID)
+	if err == nil || !errors.Is(err, sql.ErrNoRows) {
+		return user, false, err
+	}
+
+	user, err = q.AddUserIfNotExists(ctx, models.AddUserIfNotExistsParams{
+		Name:       name,
+		ExternalID: &externalID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// Created by a concurrent request after our lookup, or taken by a deleted user.
+		user, err = q.GetUserByExternalId(ctx, externalID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, false, ErrUserDeleted
+		}
+		return user, false, err
+	}
+	if err != nil {
+		return models.User{}, false, err
+	}
+
+	if _, err := EnrollIntoRolloutSegments(ctx, q, user.ID); err != nil {
+		return models.User{}, false, err
+	}
+
+	return user, true, nil
+}
@@ -0,0 +1,66 @@
+package duration_utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	day  = 24 * time.Hour
+	week = 7 * day
+)
+
+var (
+	// Go durations extended with days and weeks: 2w, 3d12h, 90m.
+	extendedPattern = regexp.MustCompile(`^(?:(\d+)w)?(?:(\d+)d)?(.*)$`)
+	// ISO-8601 durations without years and months, which have no fixed length: P2W, P1DT12H, PT30M.
+	isoPattern = regexp.MustCompile(`^P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+)
+
+// Parse parses a duration given either in Go format extended with d (days) and w (weeks) units,
+// or in ISO-8601 format.
+func Parse(s string) (time.Duration, error) {
+	if len(s) > 0 && s[0] == 'P' {
+		return parseISO(s)
+	}
+
+	m := extendedPattern.FindStringSubmatch(s)
+	if m == nil || s == "" {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	d := time.Duration(atoi(m[1]))*week + time.Duration(atoi(m[2]))*day
+	if m[3] != "" {
+		rest, err := time.ParseDuration(m[3])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		d += rest
+	}
+	return d, nil
+}
+
+func parseISO(s string) (time.Duration, error) {
+	m := isoPattern.FindStringSubmatch(s)
+	if m == nil || s == "P" || s[len(s)-1] == 'T' {
+		return 0, fmt.Errorf("invalid ISO-8601 duration %q, only weeks, days, hours, minutes and seconds are supported", s)
+	}
+
+	d := time.Duration(atoi(m[1]))*week +
+		time.Duration(atoi(m[2]))*day +
+		time.Duration(atoi(m[3]))*time.Hour +
+		time.Duration(atoi(m[4]))*time.Minute
+	if m[5] != "" {
+		seconds, _ := strconv.ParseFloat(m[5], 64)
+		d += time.Duration(seconds * float64(time.Second))
+	}
+	return d, nil
+}
+
+// atoi converts a string matched by \d+ and returns 0 for an empty one.
+func atoi(s string) int64 {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
@@ -0,0 +1,51 @@
+package duration_utils_test
+
+import (
+	"testing"
+	"time"
+
+	duration_utils "github.com/AlexZahvatkin/segments-users-service/internal/utils/duration"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected time.Duration
+		err      bool
+	}{
+		{input: "90m", expected: 90 * time.Minute},
+		{input: "36h", expected: 36 * time.Hour},
+		{input: "1h30m", expected: 90 * time.Minute},
+		{input: "3d", expected: 72 * time.Hour},
+		{input: "2w", expected: 14 * 24 * time.Hour},
+		{input: "1w2d12h", expected: 9*24*time.Hour + 12*time.Hour},
+		{input: "PT30M", expected: 30 * time.Minute},
+		{input: "P1DT12H", expected: 36 * time.Hour},
+		{input: "P2W", expected: 14 * 24 * time.Hour},
+		{input: "PT1.5S", expected: 1500 * time.Millisecond},
+		{input: "", err: true},
+		{input: "10", err: true},
+		{input: "3days", err: true},
+		{input: "P", err: true},
+		{input: "P1DT", err: true},
+		{input: "P1M", err: true},
+		{input: "P1Y", err: true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.input, func(t *testing.T) {
+			t.Parallel()
+
+			d, err := duration_utils.Parse(tc.input)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, d)
+		})
+	}
+}
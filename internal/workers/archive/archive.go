@@ -0,0 +1,123 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/lib/logger"
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+	"github.com/AlexZahvatkin/segments-users-service/internal/use-cases/user_segments"
+)
+
+// Archiver maintains the monthly partitions of users_in_segments_history.
+// It creates partitions ahead of time and moves months older than the retention into gzip-compressed
+// CSV files with every history column in the blob store, dropping their partitions afterwards.
+type Archiver struct {
+	log             *slog.Logger
+	storage         storage.Storage
+	blobs           storage.BlobStore
+	interval        time.Duration
+	retentionMonths int
+	partitionsAhead int
+}
+
+func New(log *slog.Logger, storage storage.Storage, blobs storage.BlobStore, interval time.Duration,
+	retentionMonths int, partitionsAhead int) *Archiver {
+	return &Archiver{
+		log:             log.With(slog.String("component", "workers/archive")),
+		storage:         storage,
+		blobs:           blobs,
+		interval:        interval,
+		retentionMonths: retentionMonths,
+		partitionsAhead: partitionsAhead,
+	}
+}
+
+// Run archives the history every interval until ctx is cancelled.
+func (a *Archiver) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	a.log.Info("history archiver started",
+		slog.String("interval", a.interval.String()),
+		slog.Int("retention_months", a.retentionMonths),
+		slog.Int("partitions_ahead", a.partitionsAhead),
+	)
+
+	for {
+		select {
+		case <-ctx.Done():
+			a.log.Info("history archiver stopped")
+			return
+		case <-ticker.C:
+		}
+
+		archived, err := a.Archive(ctx)
+		if err != nil {
+			a.log.Error("failed to archive history", sl.Err(err))
+		}
+		if archived > 0 {
+			a.log.Info("history archived", slog.Int("months", archived))
+		}
+	}
+}
+
+// Archive creates the partitions for the current and the next partitionsAhead months,
+// then archives and drops the partitions of the months before the retention.
+// It returns the number of archived months.
+func (a *Archiver) Archive(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	if _, err := a.storage.CreateHistoryPartitions(ctx, models.CreateHistoryPartitionsParams{
+		FromMonth: month,
+		ToMonth:   month.AddDate(0, a.partitionsAhead, 0),
+	}); err != nil {
+		return 0, fmt.Errorf("create history partitions: %w", err)
+	}
+
+	partitions, err := a.storage.ListHistoryPartitions(ctx, month.AddDate(0, -a.retentionMonths, 0))
+	if err != nil {
+		return 0, err
+	}
+
+	var archived int
+	for _, partition := range partitions {
+		if err := a.archiveMonth(ctx, partition.Month); err != nil {
+			return archived, fmt.Errorf("archive %s: %w", partition.Name, err)
+		}
+		archived++
+	}
+	return archived, nil
+}
+
+// archiveMonth writes the history of the month to archive/history_<month>.csv.gz and drops its partition.
+// If the partition can not be dropped, the month is archived again on the next run, replacing the file.
+func (a *Archiver) archiveMonth(ctx context.Context, month time.Time) error {
+	params := models.HistoryReportParams{
+		FromDate: month,
+		ToDate:   month.AddDate(0, 1, 0),
+	}
+	key := "archive/" + usecases_user_segments.HistoryReportFilename(params, true)
+
+	size, records, err := usecases_user_segments.PutHistoryArchive(ctx, a.storage, a.blobs, key, params)
+	if err != nil {
+		return err
+	}
+
+	return a.storage.ExecTx(ctx, func(q storage.Querier) error {
+		if _, err := q.CreateHistoryArchive(ctx, models.CreateHistoryArchiveParams{
+			Month:   month,
+			BlobKey: key,
+			Size:    size,
+			Records: records,
+		}); err != nil {
+			return err
+		}
+		_, err := q.DropHistoryPartition(ctx, month)
+		return err
+	})
+}
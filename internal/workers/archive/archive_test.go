@@ -0,0 +1,165 @@
+package archive_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	slogdiscard "github.com/AlexZahvatkin/segments-users-service/internal/lib/logger/handlers"
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage/mocks"
+	usecases_user_segments "github.com/AlexZahvatkin/segments-users-service/internal/use-cases/user_segments"
+	"github.com/AlexZahvatkin/segments-users-service/internal/workers/archive"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchive(t *testing.T) {
+	now := time.Now().UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	archivedMonth := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	history := []models.UsersInSegmentsHistory{
+		{ID: 1, UserID: 1, SegmentName: "TEST_SEGMENT", ActionType: models.ActionInserted,
+			ActionDate: time.Date(2023, 1, 10, 10, 0, 0, 0, time.UTC)},
+		{ID: 2, UserID: 1, SegmentName: "TEST_SEGMENT", ActionType: models.ActionExpired,
+			ActionDate: time.Date(2023, 1, 20, 10, 0, 0, 0, time.UTC)},
+	}
+	key := "archive/history_2023-01.csv.gz"
+
+	cases := []struct {
+		name          string
+		partitions    []models.ListHistoryPartitionsRow
+		partitionsErr error
+		putErr        error
+		dropErr       error
+		archived      int
+	}{
+		{
+			name:     "Nothing to archive",
+			archived: 0,
+		},
+		{
+			name:       "Old month archived",
+			partitions: []models.ListHistoryPartitionsRow{{Name: "users_in_segments_history_p202301", Month: archivedMonth}},
+			archived:   1,
+		},
+		{
+			name:          "Partitions can not be created",
+			partitionsErr: errors.New("permission denied"),
+			archived:      0,
+		},
+		{
+			name:       "Blob store fails",
+			partitions: []models.ListHistoryPartitionsRow{{Name: "users_in_segments_history_p202301", Month: archivedMonth}},
+			putErr:     errors.New("disk full"),
+			archived:   0,
+		},
+		{
+			name:       "Partition is not aggregated yet",
+			partitions: []models.ListHistoryPartitionsRow{{Name: "users_in_segments_history_p202301", Month: archivedMonth}},
+			dropErr:    errors.New("partition has history not aggregated into segment stats yet"),
+			archived:   0,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			storageMock := mocks.NewStorage(t)
+			storageMock.On("CreateHistoryPartitions", mock.Anything, models.CreateHistoryPartitionsParams{
+				FromMonth: month,
+				ToMonth:   month.AddDate(0, 3, 0),
+			}).Return(int32(0), tc.partitionsErr)
+			storageMock.On("ListHistoryPartitions", mock.Anything, month.AddDate(0, -13, 0)).
+				Return(tc.partitions, nil).Maybe()
+			storageMock.On("ReportSegmentsHistory", mock.Anything, models.HistoryReportParams{
+				FromDate: archivedMonth,
+				ToDate:   archivedMonth.AddDate(0, 1, 0),
+			}, mock.Anything).Return(
+				func(_ context.Context, _ models.HistoryReportParams, fn func(models.UsersInSegmentsHistory) error) error {
+					for _, h := range history {
+						if err := fn(h); err != nil {
+							return err
+						}
+					}
+					return nil
+				}).Maybe()
+
+			blobs := &memBlobStore{putErr: tc.putErr}
+			storageMock.On("ExecTx", mock.Anything, mock.Anything).Return(
+				func(_ context.Context, fn func(storage.Querier) error) error {
+					return fn(storageMock)
+				}).Maybe()
+			storageMock.On("CreateHistoryArchive", mock.Anything, mock.MatchedBy(func(arg models.CreateHistoryArchiveParams) bool {
+				return arg.Month.Equal(archivedMonth) && arg.BlobKey == key &&
+					arg.Size == int64(len(blobs.blobs[key])) && arg.Records == 2
+			})).Return(models.HistoryArchive{}, nil).Maybe()
+			storageMock.On("DropHistoryPartition", mock.Anything, archivedMonth).Return(tc.dropErr == nil, tc.dropErr).Maybe()
+
+			archiver := archive.New(slogdiscard.NewDiscardLogger(), storageMock, blobs, time.Hour, 13, 3)
+			archived, err := archiver.Archive(context.Background())
+			if tc.partitionsErr != nil || tc.putErr != nil || tc.dropErr != nil {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tc.archived, archived)
+
+			if tc.archived == 0 {
+				if tc.putErr != nil {
+					storageMock.AssertNotCalled(t, "DropHistoryPartition", mock.Anything, mock.Anything)
+				}
+				return
+			}
+			var records []models.UsersInSegmentsHistory
+			_, err = usecases_user_segments.ReadHistoryArchive(strings.NewReader(blobs.blobs[key]),
+				func(h models.UsersInSegmentsHistory) error {
+					records = append(records, h)
+					return nil
+				})
+			require.NoError(t, err)
+			require.Equal(t, history, records)
+		})
+	}
+}
+
+// memBlobStore keeps blobs in memory. Put fails with putErr without reading anything if it is set.
+type memBlobStore struct {
+	putErr error
+	blobs  map[string]string
+}
+
+func (s *memBlobStore) Put(_ context.Context, key string, r io.Reader) (int64, error) {
+	if s.putErr != nil {
+		return 0, s.putErr
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	if s.blobs == nil {
+		s.blobs = make(map[string]string)
+	}
+	s.blobs[key] = string(data)
+	return int64(len(data)), nil
+}
+
+func (s *memBlobStore) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	data, ok := s.blobs[key]
+	if !ok {
+		return nil, storage.ErrBlobNotFound
+	}
+	return io.NopCloser(strings.NewReader(data)), nil
+}
+
+func (s *memBlobStore) Delete(_ context.Context, key string) error {
+	delete(s.blobs, key)
+	return nil
+}
@@ -0,0 +1,87 @@
+package cleanup
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/lib/logger"
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+)
+
+// batchSize is how many expired reports are removed per query.
+const batchSize = 100
+
+// Cleaner periodically removes expired reports: first the file from the blob store, then the record,
+// so a failure in between leaves the record to be retried rather than a file nobody knows about.
+type Cleaner struct {
+	log      *slog.Logger
+	storage  storage.Querier
+	blobs    storage.BlobStore
+	interval time.Duration
+}
+
+func New(log *slog.Logger, storage storage.Querier, blobs storage.BlobStore, interval time.Duration) *Cleaner {
+	return &Cleaner{
+		log:      log.With(slog.String("component", "workers/cleanup")),
+		storage:  storage,
+		blobs:    blobs,
+		interval: interval,
+	}
+}
+
+// Run removes expired reports every interval until ctx is cancelled.
+func (c *Cleaner) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	c.log.Info("report cleaner started", slog.String("interval", c.interval.String()))
+
+	for {
+		select {
+		case <-ctx.Done():
+			c.log.Info("report cleaner stopped")
+			return
+		case <-ticker.C:
+		}
+
+		n, err := c.Cleanup(ctx)
+		if err != nil {
+			c.log.Error("failed to remove expired reports", sl.Err(err))
+		}
+		if n > 0 {
+			c.log.Info("expired reports removed", slog.Int("count", n))
+		}
+	}
+}
+
+// Cleanup removes all reports expired by now and returns how many of them were removed.
+func (c *Cleaner) Cleanup(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+
+	removed := 0
+	for {
+		reports, err := c.storage.ListExpiredReports(ctx, models.ListExpiredReportsParams{
+			ExpiredBefore: now,
+			BatchSize:     batchSize,
+		})
+		if err != nil {
+			return removed, err
+		}
+
+		for _, report := range reports {
+			if err := c.blobs.Delete(ctx, report.BlobKey); err != nil {
+				return removed, err
+			}
+			if err := c.storage.DeleteReport(ctx, report.JobID); err != nil {
+				return removed, err
+			}
+			removed++
+		}
+
+		if len(reports) < batchSize {
+			return removed, nil
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package cleanup_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	slogdiscard "github.com/AlexZahvatkin/segments-users-service/internal/lib/logger/handlers"
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage/mocks"
+	"github.com/AlexZahvatkin/segments-users-service/internal/workers/cleanup"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleanup(t *testing.T) {
+	reports := []models.Report{
+		{JobID: 1, BlobKey: "reports/1/history_2023-08.csv"},
+		{JobID: 2, BlobKey: "reports/2/history_2023-09.csv.gz"},
+	}
+
+	cases := []struct {
+		name      string
+		reports   []models.Report
+		deleteErr error
+		removed   int
+	}{
+		{
+			name: "Nothing expired",
+		},
+		{
+			name:    "Expired reports removed",
+			reports: reports,
+			removed: 2,
+		},
+		{
+			name:      "Blob store fails",
+			reports:   reports,
+			deleteErr: errors.New("permission denied"),
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			expiredBefore := mock.MatchedBy(func(arg models.ListExpiredReportsParams) bool {
+				return time.Since(arg.ExpiredBefore) < time.Minute && arg.BatchSize > 0
+			})
+
+			querierMock := mocks.NewQuerier(t)
+			querierMock.On("ListExpiredReports", mock.Anything, expiredBefore).Return(tc.reports, nil).Once()
+			blobsMock := mocks.NewBlobStore(t)
+			for _, report := range tc.reports {
+				blobsMock.On("Delete", mock.Anything, report.BlobKey).Return(tc.deleteErr).Maybe()
+				if tc.deleteErr == nil {
+					querierMock.On("DeleteReport", mock.Anything, report.JobID).Return(nil).Once()
+				}
+			}
+
+			cleaner := cleanup.New(slogdiscard.NewDiscardLogger(), querierMock, blobsMock, time.Hour)
+			removed, err := cleaner.Cleanup(context.Background())
+			if tc.deleteErr != nil {
+				require.ErrorIs(t, err, tc.deleteErr)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tc.removed, removed)
+		})
+	}
+}
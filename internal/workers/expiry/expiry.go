@@ -0,0 +1,123 @@
+package expiry
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/lib/audit"
+	"github.com/AlexZahvatkin/segments-users-service/internal/lib/logger"
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+)
+
+// Sweeper periodically removes expired memberships from users_in_segments and marks
+// scheduled ones whose starts_at has passed as started.
+// Removed rows are recorded in the history with the 'expired' action, started ones with the 'started' action,
+// both with the system:expiry actor.
+type Sweeper struct {
+	log       *slog.Logger
+	storage   storage.Transactor
+	interval  time.Duration
+	batchSize int32
+}
+
+func New(log *slog.Logger, storage storage.Transactor, interval time.Duration, batchSize int32) *Sweeper {
+	return &Sweeper{
+		log:       log.With(slog.String("component", "workers/expiry")),
+		storage:   storage,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+// Run starts due memberships and sweeps expired ones every interval until ctx is cancelled.
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	s.log.Info("expiry sweeper started",
+		slog.String("interval", s.interval.String()),
+		slog.Int("batch_size", int(s.batchSize)),
+	)
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.log.Info("expiry sweeper stopped")
+			return
+		case <-ticker.C:
+		}
+
+		started, err := s.Start(ctx)
+		if err != nil {
+			s.log.Error("failed to start scheduled segments", sl.Err(err))
+		} else if started > 0 {
+			s.log.Info("scheduled segments started", slog.Int64("count", started))
+		}
+
+		deleted, err := s.Sweep(ctx)
+		if err != nil {
+			s.log.Error("failed to sweep expired segments", sl.Err(err))
+			continue
+		}
+		if deleted > 0 {
+			s.log.Info("expired segments removed", slog.Int64("count", deleted))
+		}
+	}
+}
+
+// Sweep removes expired memberships batch by batch until none are left
+// and returns the number of removed rows. Each batch is a separate transaction.
+func (s *Sweeper) Sweep(ctx context.Context) (int64, error) {
+	ctx = audit.WithAudit(ctx, audit.Audit{Actor: audit.ActorExpiry})
+
+	var total int64
+	for {
+		var deleted int64
+		err := s.storage.ExecTx(ctx, func(q storage.Querier) error {
+			if err := q.SetHistoryAction(ctx, models.ActionExpired); err != nil {
+				return err
+			}
+			n, err := q.DeleteExpiredUsersFromSegments(ctx, s.batchSize)
+			deleted = n
+			return err
+		})
+		if err != nil {
+			return total, err
+		}
+
+		total += deleted
+		if deleted < int64(s.batchSize) {
+			return total, nil
+		}
+	}
+}
+
+// Start marks scheduled memberships whose starts_at has passed as started batch by batch
+// and returns the number of started rows. Each batch is a separate transaction.
+func (s *Sweeper) Start(ctx context.Context) (int64, error) {
+	ctx = audit.WithAudit(ctx, audit.Audit{Actor: audit.ActorExpiry})
+	now := time.Now().UTC()
+
+	var total int64
+	for {
+		var started int64
+		err := s.storage.ExecTx(ctx, func(q storage.Querier) error {
+			n, err := q.StartScheduledUsersInSegments(ctx, models.StartScheduledUsersInSegmentsParams{
+				Now:       now,
+				BatchSize: s.batchSize,
+			})
+			started = n
+			return err
+		})
+		if err != nil {
+			return total, err
+		}
+
+		total += started
+		if started < int64(s.batchSize) {
+			return total, nil
+		}
+	}
+}
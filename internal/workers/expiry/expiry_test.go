@@ -0,0 +1,128 @@
+package expiry_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	slogdiscard "github.com/AlexZahvatkin/segments-users-service/internal/lib/logger/handlers"
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage/mocks"
+	"github.com/AlexZahvatkin/segments-users-service/internal/workers/expiry"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSweep(t *testing.T) {
+	cases := []struct {
+		name      string
+		batches   []int64
+		deleteErr error
+		deleted   int64
+	}{
+		{
+			name:    "Nothing expired",
+			batches: []int64{0},
+			deleted: 0,
+		},
+		{
+			name:    "Several batches",
+			batches: []int64{2, 2, 1},
+			deleted: 5,
+		},
+		{
+			name:      "Delete fails",
+			batches:   []int64{0},
+			deleteErr: errors.New("delete failed"),
+			deleted:   0,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			querierMock := mocks.NewQuerier(t)
+			querierMock.On("SetHistoryAction", mock.Anything, "expired").Return(nil)
+			for _, n := range tc.batches {
+				querierMock.On("DeleteExpiredUsersFromSegments", mock.Anything, int32(2)).Return(n, tc.deleteErr).Once()
+			}
+
+			transactorMock := mocks.NewTransactor(t)
+			transactorMock.On("ExecTx", mock.Anything, mock.Anything).Return(
+				func(_ context.Context, fn func(storage.Querier) error) error {
+					return fn(querierMock)
+				})
+
+			sweeper := expiry.New(slogdiscard.NewDiscardLogger(), transactorMock, time.Hour, 2)
+			deleted, err := sweeper.Sweep(context.Background())
+			if tc.deleteErr != nil {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tc.deleted, deleted)
+		})
+	}
+}
+
+func TestStart(t *testing.T) {
+	cases := []struct {
+		name     string
+		batches  []int64
+		startErr error
+		started  int64
+	}{
+		{
+			name:    "Nothing to start",
+			batches: []int64{0},
+			started: 0,
+		},
+		{
+			name:    "Several batches",
+			batches: []int64{2, 1},
+			started: 3,
+		},
+		{
+			name:     "Start fails",
+			batches:  []int64{0},
+			startErr: errors.New("update failed"),
+			started:  0,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			querierMock := mocks.NewQuerier(t)
+			for _, n := range tc.batches {
+				params := mock.MatchedBy(func(arg models.StartScheduledUsersInSegmentsParams) bool {
+					return arg.BatchSize == 2 && time.Since(arg.Now) < time.Minute
+				})
+				querierMock.On("StartScheduledUsersInSegments", mock.Anything, params).Return(n, tc.startErr).Once()
+			}
+
+			transactorMock := mocks.NewTransactor(t)
+			transactorMock.On("ExecTx", mock.Anything, mock.Anything).Return(
+				func(_ context.Context, fn func(storage.Querier) error) error {
+					return fn(querierMock)
+				})
+
+			sweeper := expiry.New(slogdiscard.NewDiscardLogger(), transactorMock, time.Hour, 2)
+			started, err := sweeper.Start(context.Background())
+			if tc.startErr != nil {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tc.started, started)
+		})
+	}
+}
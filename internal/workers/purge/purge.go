@@ -0,0 +1,78 @@
+package purge
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/lib/logger"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+)
+
+// Purger periodically removes segments and users that were deleted longer than the retention period ago.
+// Until then they can be restored, afterwards only their history is left.
+type Purger struct {
+	log       *slog.Logger
+	storage   storage.Querier
+	interval  time.Duration
+	retention time.Duration
+}
+
+func New(log *slog.Logger, storage storage.Querier, interval time.Duration, retention time.Duration) *Purger {
+	return &Purger{
+		log:       log.With(slog.String("component", "workers/purge")),
+		storage:   storage,
+		interval:  interval,
+		retention: retention,
+	}
+}
+
+// Run purges deleted segments and users every interval until ctx is cancelled.
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	p.log.Info("purger started",
+		slog.String("interval", p.interval.String()),
+		slog.String("retention", p.retention.String()),
+	)
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.log.Info("purger stopped")
+			return
+		case <-ticker.C:
+		}
+
+		segments, users, err := p.Purge(ctx)
+		if err != nil {
+			p.log.Error("failed to purge deleted segments and users", sl.Err(err))
+			continue
+		}
+		if segments > 0 || users > 0 {
+			p.log.Info("deleted segments and users purged",
+				slog.Int64("segments", segments),
+				slog.Int64("users", users),
+			)
+		}
+	}
+}
+
+// Purge removes the segments and users deleted before the retention period
+// and returns how many of them were removed.
+func (p *Purger) Purge(ctx context.Context) (segments int64, users int64, err error) {
+	deletedBefore := time.Now().Add(-p.retention).UTC()
+
+	segments, err = p.storage.PurgeDeletedSegments(ctx, deletedBefore)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	users, err = p.storage.PurgeDeletedUsers(ctx, deletedBefore)
+	if err != nil {
+		return segments, 0, err
+	}
+
+	return segments, users, nil
+}
@@ -0,0 +1,71 @@
+package purge_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	slogdiscard "github.com/AlexZahvatkin/segments-users-service/internal/lib/logger/handlers"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage/mocks"
+	"github.com/AlexZahvatkin/segments-users-service/internal/workers/purge"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurge(t *testing.T) {
+	cases := []struct {
+		name        string
+		segments    int64
+		segmentsErr error
+		users       int64
+		usersErr    error
+	}{
+		{
+			name: "Nothing to purge",
+		},
+		{
+			name:     "Segments and users purged",
+			segments: 2,
+			users:    3,
+		},
+		{
+			name:        "Segments purge fails",
+			segmentsErr: errors.New("purge failed"),
+		},
+		{
+			name:     "Users purge fails",
+			segments: 2,
+			usersErr: errors.New("purge failed"),
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			// Everything deleted more than a day ago is purged.
+			deletedBefore := mock.MatchedBy(func(at time.Time) bool {
+				return time.Since(at) >= 24*time.Hour && time.Since(at) < 25*time.Hour
+			})
+
+			querierMock := mocks.NewQuerier(t)
+			querierMock.On("PurgeDeletedSegments", mock.Anything, deletedBefore).Return(tc.segments, tc.segmentsErr)
+			if tc.segmentsErr == nil {
+				querierMock.On("PurgeDeletedUsers", mock.Anything, deletedBefore).Return(tc.users, tc.usersErr)
+			}
+
+			purger := purge.New(slogdiscard.NewDiscardLogger(), querierMock, time.Hour, 24*time.Hour)
+			segments, users, err := purger.Purge(context.Background())
+			if tc.segmentsErr != nil || tc.usersErr != nil {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tc.segments, segments)
+			require.Equal(t, tc.users, users)
+		})
+	}
+}
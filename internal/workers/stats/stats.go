@@ -0,0 +1,100 @@
+package stats
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/AlexZahvatkin/segments-users-service/internal/lib/logger"
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+)
+
+// Aggregator periodically folds users_in_segments_history into daily per segment counts of
+// added, removed and expired memberships. It remembers the id of the last folded transaction,
+// so every run reads only the history written since the previous one.
+//
+// Only transactions below the xmin of the current snapshot are folded: all of them have finished,
+// so a transaction that is still writing history can never end up behind the watermark.
+type Aggregator struct {
+	log       *slog.Logger
+	storage   storage.Transactor
+	interval  time.Duration
+	batchSize int32
+}
+
+func New(log *slog.Logger, storage storage.Transactor, interval time.Duration, batchSize int32) *Aggregator {
+	return &Aggregator{
+		log:       log.With(slog.String("component", "workers/stats")),
+		storage:   storage,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+// Run aggregates the new history every interval until ctx is cancelled.
+func (a *Aggregator) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	a.log.Info("stats aggregator started",
+		slog.String("interval", a.interval.String()),
+		slog.Int("batch_size", int(a.batchSize)),
+	)
+
+	for {
+		select {
+		case <-ctx.Done():
+			a.log.Info("stats aggregator stopped")
+			return
+		case <-ticker.C:
+		}
+
+		processed, err := a.Aggregate(ctx)
+		if err != nil {
+			a.log.Error("failed to aggregate segment stats", sl.Err(err))
+			continue
+		}
+		if processed > 0 {
+			a.log.Debug("segment stats aggregated", slog.Int64("history_rows", processed))
+		}
+	}
+}
+
+// Aggregate folds the history of finished transactions batch by batch until none is left
+// and returns the number of folded history rows. Each batch is a separate transaction
+// holding the lock of the aggregation state, so concurrent aggregators never fold a row twice.
+func (a *Aggregator) Aggregate(ctx context.Context) (int64, error) {
+	var total int64
+	for {
+		var processed int64
+		err := a.storage.ExecTx(ctx, func(q storage.Querier) error {
+			afterTxID, err := q.GetSegmentStatsState(ctx)
+			if err != nil {
+				return err
+			}
+
+			res, err := q.RollupSegmentStats(ctx, models.RollupSegmentStatsParams{
+				AfterTxID: afterTxID,
+				BatchSize: a.batchSize,
+			})
+			if err != nil {
+				return err
+			}
+			processed = res.Processed
+			if processed == 0 {
+				return nil
+			}
+
+			return q.SetSegmentStatsState(ctx, res.LastTxID)
+		})
+		if err != nil {
+			return total, err
+		}
+
+		total += processed
+		if processed < int64(a.batchSize) {
+			return total, nil
+		}
+	}
+}
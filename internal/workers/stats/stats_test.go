@@ -0,0 +1,95 @@
+package stats_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	slogdiscard "github.com/AlexZahvatkin/segments-users-service/internal/lib/logger/handlers"
+	"github.com/AlexZahvatkin/segments-users-service/internal/models"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage"
+	"github.com/AlexZahvatkin/segments-users-service/internal/storage/mocks"
+	"github.com/AlexZahvatkin/segments-users-service/internal/workers/stats"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregate(t *testing.T) {
+	type batch struct {
+		afterTxID int64
+		lastTxID  int64
+		processed int64
+	}
+
+	cases := []struct {
+		name      string
+		batches   []batch
+		rollupErr error
+		processed int64
+	}{
+		{
+			name:      "Nothing new",
+			batches:   []batch{{afterTxID: 10, lastTxID: 10, processed: 0}},
+			processed: 0,
+		},
+		{
+			name: "Several batches",
+			batches: []batch{
+				{afterTxID: 10, lastTxID: 12, processed: 2},
+				{afterTxID: 12, lastTxID: 15, processed: 2},
+				{afterTxID: 15, lastTxID: 16, processed: 1},
+			},
+			processed: 5,
+		},
+		{
+			name: "Transaction larger than a batch",
+			batches: []batch{
+				{afterTxID: 10, lastTxID: 11, processed: 5},
+				{afterTxID: 11, lastTxID: 11, processed: 0},
+			},
+			processed: 5,
+		},
+		{
+			name:      "Rollup fails",
+			batches:   []batch{{afterTxID: 10}},
+			rollupErr: errors.New("rollup failed"),
+			processed: 0,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			querierMock := mocks.NewQuerier(t)
+			for _, b := range tc.batches {
+				b := b
+				querierMock.On("GetSegmentStatsState", mock.Anything).Return(b.afterTxID, nil).Once()
+				querierMock.On("RollupSegmentStats", mock.Anything, mock.MatchedBy(func(arg models.RollupSegmentStatsParams) bool {
+					return arg.AfterTxID == b.afterTxID && arg.BatchSize == 2
+				})).Return(models.RollupSegmentStatsRow{LastTxID: b.lastTxID, Processed: b.processed}, tc.rollupErr).Once()
+				if b.processed > 0 {
+					querierMock.On("SetSegmentStatsState", mock.Anything, b.lastTxID).Return(nil).Once()
+				}
+			}
+
+			transactorMock := mocks.NewTransactor(t)
+			transactorMock.On("ExecTx", mock.Anything, mock.Anything).Return(
+				func(_ context.Context, fn func(storage.Querier) error) error {
+					return fn(querierMock)
+				})
+
+			aggregator := stats.New(slogdiscard.NewDiscardLogger(), transactorMock, time.Hour, 2)
+			processed, err := aggregator.Aggregate(context.Background())
+			if tc.rollupErr != nil {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tc.processed, processed)
+		})
+	}
+}